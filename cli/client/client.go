@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -14,6 +16,36 @@ import (
 type Client struct {
 	BaseURL string
 	HTTP    *http.Client
+	Token   string // API token, sent as "Authorization: Bearer"
+}
+
+// LoadToken resolves the API token for the local server.
+// Priority: AI_HUB_TOKEN > AI_HUB_TOKEN_FILE > <data-dir>/auth.token
+func LoadToken() string {
+	if tok := strings.TrimSpace(os.Getenv("AI_HUB_TOKEN")); tok != "" {
+		return tok
+	}
+	path := os.Getenv("AI_HUB_TOKEN_FILE")
+	if path == "" {
+		dataDir := os.Getenv("AI_HUB_DATA_DIR")
+		if dataDir == "" {
+			home, _ := os.UserHomeDir()
+			dataDir = filepath.Join(home, ".ai-hub")
+		}
+		path = filepath.Join(dataDir, "auth.token")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Authorize adds the local API token to a raw request built outside Client.
+func Authorize(req *http.Request) {
+	if tok := LoadToken(); tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
 }
 
 // NewClient creates a new API client
@@ -23,6 +55,7 @@ func NewClient(port int) *Client {
 		HTTP: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		Token: LoadToken(),
 	}
 }
 
@@ -47,7 +80,22 @@ func NewClientWithURL(baseURL string) *Client {
 		HTTP: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		Token: remoteToken(baseURL),
+	}
+}
+
+// remoteToken picks the token for a custom base URL. Remote hosts only get
+// AI_HUB_REMOTE_TOKEN so the local admin token never leaves the machine.
+func remoteToken(baseURL string) string {
+	if isLocalURL(baseURL) {
+		return LoadToken()
 	}
+	return strings.TrimSpace(os.Getenv("AI_HUB_REMOTE_TOKEN"))
+}
+
+func isLocalURL(baseURL string) bool {
+	rest := baseURL[strings.Index(baseURL, "://")+3:]
+	return strings.HasPrefix(rest, "localhost:") || strings.HasPrefix(rest, "127.0.0.1:") || strings.HasPrefix(rest, "[::1]:")
 }
 
 // Request makes an HTTP request and returns response body
@@ -70,6 +118,9 @@ func (c *Client) Request(method, path string, body interface{}) ([]byte, error)
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
 
 	resp, err := c.HTTP.Do(req)
 	if err != nil {
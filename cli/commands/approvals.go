@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"ai-hub/cli/client"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type pendingApproval struct {
+	ID          string          `json:"id"`
+	SessionID   int64           `json:"session_id"`
+	ToolName    string          `json:"tool_name"`
+	Input       json.RawMessage `json:"input"`
+	RequestedAt time.Time       `json:"requested_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+}
+
+// RunApprovals handles the approvals command
+func RunApprovals(c *client.Client, args []string) int {
+	if len(args) == 0 {
+		return runApprovalsList(c, nil)
+	}
+
+	switch args[0] {
+	case "list":
+		return runApprovalsList(c, args[1:])
+	case "approve", "deny":
+		return runApprovalsDecide(c, args[0], args[1:])
+	case "--help", "-h":
+		printApprovalsHelp()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown approvals subcommand: %s\n", args[0])
+		printApprovalsHelp()
+		return 1
+	}
+}
+
+func runApprovalsList(c *client.Client, args []string) int {
+	path := "/approvals"
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--session" && i+1 < len(args) {
+			i++
+			path += "?session_id=" + args[i]
+		}
+	}
+	resp, err := c.GET(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var list []pendingApproval
+	if err := json.Unmarshal(resp, &list); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+	if len(list) == 0 {
+		fmt.Println("No pending approvals")
+		return 0
+	}
+	fmt.Printf("%-10s %-8s %-14s %-8s %s\n", "ID", "SESSION", "TOOL", "EXPIRES", "INPUT")
+	for _, a := range list {
+		left := time.Until(a.ExpiresAt).Round(time.Second)
+		input := strings.ReplaceAll(string(a.Input), "\n", " ")
+		if r := []rune(input); len(r) > 80 {
+			input = string(r[:80]) + "..."
+		}
+		fmt.Printf("%-10s %-8d %-14s %-8s %s\n", a.ID, a.SessionID, a.ToolName, left, input)
+	}
+	return 0
+}
+
+func runApprovalsDecide(c *client.Client, decision string, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "Usage: ai-hub approvals %s <id> [--reason <text>]\n", decision)
+		return 1
+	}
+	id := args[0]
+	var reason string
+	for i := 1; i < len(args); i++ {
+		if args[i] == "--reason" && i+1 < len(args) {
+			i++
+			reason = args[i]
+		}
+	}
+	if _, err := c.POST("/approvals/"+id, map[string]string{"decision": decision, "reason": reason}); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if decision == "approve" {
+		fmt.Printf("Approval %s: approved\n", id)
+	} else {
+		fmt.Printf("Approval %s: denied\n", id)
+	}
+	return 0
+}
+
+func printApprovalsHelp() {
+	fmt.Println(`Approvals - decide tool calls paused by a session's tool policy
+
+Usage:
+  ai-hub approvals [list] [--session <id>]         List pending approvals
+  ai-hub approvals approve <id> [--reason <text>]  Let the tool call run
+  ai-hub approvals deny <id> [--reason <text>]     Refuse the tool call
+
+Tool calls wait for a decision when the session's tool policy lists them in
+approval_tools (ai-hub sessions <id> tool-policy --approve Bash,Write).
+Undecided calls are denied automatically after the policy's timeout.
+Session tokens (the agent itself) cannot decide approvals.`)
+}
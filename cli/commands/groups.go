@@ -8,7 +8,7 @@ import (
 )
 
 // RunGroups executes the groups command
-// Usage: ai-hub groups [name] [create|delete]
+// Usage: ai-hub groups [name] [create|delete|tool-policy]
 func RunGroups(c *client.Client, args []string) int {
 	if len(args) == 0 {
 		return listGroups(c)
@@ -31,6 +31,10 @@ func RunGroups(c *client.Client, args []string) int {
 		return deleteGroup(c, args[1])
 	}
 
+	if len(args) > 1 && args[1] == "tool-policy" {
+		return groupToolPolicy(c, args[0], args[2:])
+	}
+
 	// Otherwise, treat first arg as group name for detail view
 	return groupDetail(c, args[0])
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // RunHooks executes the hooks command
@@ -26,6 +27,10 @@ func RunHooks(c *client.Client, args []string) int {
 		return hooksToggle(c, args[1:], true)
 	case "disable":
 		return hooksToggle(c, args[1:], false)
+	case "events":
+		return hooksEvents(c)
+	case "test":
+		return hooksTest(c, args[1:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown hooks subcommand: %s\n", args[0])
 		printHooksHelp()
@@ -191,6 +196,105 @@ func hooksToggle(c *client.Client, args []string, enable bool) int {
 	return 0
 }
 
+func hooksEvents(c *client.Client) int {
+	respData, err := c.GET("/hooks/events")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var events []struct {
+		Type        string   `json:"type"`
+		Description string   `json:"description"`
+		Content     string   `json:"content"`
+		Variables   []string `json:"variables"`
+	}
+	if err := json.Unmarshal(respData, &events); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+
+	fmt.Println("Every payload can use {source_session_id}, {event_type} and {content}.")
+	fmt.Println()
+	for _, e := range events {
+		fmt.Printf("%-18s %s\n", e.Type, e.Description)
+		fmt.Printf("%-18s {content} = %s\n", "", e.Content)
+		if len(e.Variables) > 0 {
+			vars := ""
+			for _, v := range e.Variables {
+				vars += " {" + v + "}"
+			}
+			fmt.Printf("%-18s variables:%s\n", "", vars)
+		}
+	}
+	return 0
+}
+
+func hooksTest(c *client.Client, args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ai-hub hooks test <id> [--event <type>] [--session <id>] [--content <text>] [--count N] [--source <src>] [--var k=v ...] [--condition <cond>]\n")
+		return 1
+	}
+	hookID := args[0]
+	body := map[string]interface{}{}
+	vars := map[string]string{}
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			break
+		}
+		switch args[i] {
+		case "--event":
+			i++
+			body["event"] = args[i]
+		case "--session":
+			i++
+			id, _ := strconv.ParseInt(args[i], 10, 64)
+			body["source_session_id"] = id
+		case "--content":
+			i++
+			body["content"] = args[i]
+		case "--count":
+			i++
+			n, _ := strconv.ParseInt(args[i], 10, 64)
+			body["message_count"] = n
+		case "--source":
+			i++
+			body["source"] = args[i]
+		case "--var":
+			i++
+			if k, v, ok := strings.Cut(args[i], "="); ok {
+				vars[k] = v
+			}
+		case "--condition":
+			i++
+			body["condition"] = args[i]
+		}
+	}
+	if len(vars) > 0 {
+		body["vars"] = vars
+	}
+
+	respData, err := c.POST(fmt.Sprintf("/hooks/%s/test", hookID), body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Matched bool   `json:"matched"`
+		Reason  string `json:"reason"`
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+	if !resp.Matched {
+		fmt.Printf("Hook #%s would not fire: %s\n", hookID, resp.Reason)
+		return 0
+	}
+	fmt.Printf("Hook #%s would fire with payload:\n%s\n", hookID, resp.Payload)
+	return 0
+}
+
 func printHooksHelp() {
 	fmt.Fprintf(os.Stderr, `Usage: ai-hub hooks <subcommand> [args]
 
@@ -202,20 +306,43 @@ Subcommands:
   delete <id>                         Delete a hook
   enable <id>                         Enable a hook
   disable <id>                        Disable a hook
+  events                              List event types and their payload variables
+  test <id> [--event <type>] [--session <id>] [--content <text>] [--count N]
+            [--source <src>] [--var k=v ...] [--condition <cond>]
+                                      Dry-run a hook against a sample event
 
 Event types:
   session.created    New session created
   message.received   Message received (can filter with condition)
   message.count      Session message count exceeds threshold
   session.error      Error recorded in session
+  stream.completed   AI turn finished ({input_tokens}, {output_tokens}, ...)
+  stream.failed      AI turn failed
+  tool.used          Tool call finished ({tool_name}, {tool_input})
+  trigger.fired      Trigger delivered its message ({trigger_id})
+  trigger.failed     Trigger run failed after retries
+  service.died       Managed service stopped ({service_name}, {log_path})
+  memory.written     Memory file changed ({scope}, {file_name}, {change_type})
+  compress.done      Session context compressed ({compress_mode})
+  channel.message    Feishu / QQ message forwarded to a session ({platform})
 
-Condition formats:
-  content_match:pattern1|pattern2     Match if content contains pattern
-  count_gt:N                          Match if message count > N
+Conditions:
+  Expressions over the event, combined with && || ! and parentheses:
+    event.session.group == "ops" && content =~ /error|panic/i && !(source == "trigger")
+  Comparisons: == != < <= > >= and =~ !~ against a /regex/ (flags i m s)
+  Fields: event (type), content, source (trigger|hook|channel|shadow, "" = user),
+    message_count, session.id, session.group, session.title, session.provider,
+    session.shadow, and event variables as vars.<name> or <name> (e.g. tool_name)
+  Legacy forms still work:
+    content_match:pattern1|pattern2   Content matches any pattern
+    count_gt:N                        Message count > N
 
 Examples:
   ai-hub hooks list
   ai-hub hooks create --event "message.received" --condition "content_match:我说过了|不是这样" --target-session 999 --payload "会话 {source_session_id} 用户纠正"
+  ai-hub hooks create --event "tool.used" --condition 'tool_name == "Bash" && content =~ /rm -rf/' --target-session 12 --payload "会话 {source_session_id} 执行了 {tool_input}"
+  ai-hub hooks test 1 --content "panic: nil map" --session 5
+  ai-hub hooks create --event "service.died" --condition "content_match:build" --target-session 12 --payload "服务 {service_name} 挂了，请查看日志 {log_path} 并排查"
   ai-hub hooks enable 1
   ai-hub hooks disable 1
   ai-hub hooks delete 1
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 )
 
 // RunNotes executes the notes command
@@ -30,6 +31,15 @@ func RunNotes(c *client.Client, args []string) int {
 	}
 }
 
+// notePath maps a note name to its path under the notes directory, where
+// notes list finds it.
+func notePath(filename string) string {
+	if strings.HasPrefix(filename, "notes/") {
+		return filename
+	}
+	return "notes/" + filename
+}
+
 func notesList(c *client.Client) int {
 	respData, err := c.GET("/files?scope=notes")
 	if err != nil {
@@ -65,7 +75,7 @@ func notesRead(c *client.Client, args []string) int {
 	}
 
 	filename := args[0]
-	respData, err := c.GET(fmt.Sprintf("/files/content?scope=notes&path=%s", filename))
+	respData, err := c.GET(fmt.Sprintf("/files/content?scope=notes&path=%s", notePath(filename)))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
@@ -113,7 +123,7 @@ func notesWrite(c *client.Client, args []string) int {
 
 	body := map[string]string{
 		"scope":   "notes",
-		"path":    filename,
+		"path":    notePath(filename),
 		"content": content,
 	}
 	_, err := c.PUT("/files/content", body)
@@ -133,7 +143,7 @@ func notesDelete(c *client.Client, args []string) int {
 	}
 
 	filename := args[0]
-	_, err := c.DELETE(fmt.Sprintf("/files?scope=notes&path=%s", filename))
+	_, err := c.DELETE(fmt.Sprintf("/files?scope=notes&path=%s", notePath(filename)))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
@@ -12,16 +12,18 @@ import (
 func RunSearch(c *client.Client, args []string) int {
 	query, flagArgs := SplitQueryAndFlags(args)
 
-	var level string
+	var level, mode, filter string
 	var top int
 	fs := flag.NewFlagSet("search", flag.ExitOnError)
 	fs.StringVar(&level, "level", "", "Level: session, team, or global (optional, searches all if omitted)")
 	fs.IntVar(&top, "top", 10, "Number of results to return")
+	fs.StringVar(&mode, "mode", "", "Ranking: hybrid (default), semantic, or keyword")
+	fs.StringVar(&filter, "filter", "", "Metadata filter (JSON), applied before ranking")
 
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stderr, `Usage: ai-hub search <query> [--level <level>] [flags]
 
-Search memory files by semantic similarity and keyword matching.
+Search memory files by semantic similarity and BM25 keyword ranking.
 When --level is omitted, searches session + team + global and merges results.
 
 Flags:
@@ -29,11 +31,16 @@ Flags:
 		fmt.Fprintf(os.Stderr, `  --level <level>     Optional. session / team / global (omit for all)
 `)
 		fmt.Fprintf(os.Stderr, `  --top <n>           Number of results (default: 10)
+  --mode <mode>       hybrid (BM25 + semantic, default) / semantic / keyword
+  --filter <json>     Metadata filter, e.g. '{"eq":{"mem_type":"procedure"}}'
+                      Operators: and, or, not, eq, ne, gt, gte, lt, lte, in, contains, exists
 
 Examples:
   ai-hub search "BUG修复"
   ai-hub search "BUG修复" --level session
   ai-hub search "部署流程" --level team --top 5
+  ai-hub search "ERR_CONN_RESET" --mode keyword
+  ai-hub search "部署" --filter '{"gt":{"updated_at":"2026-01-01"}}'
 `)
 	}
 
@@ -53,6 +60,16 @@ Examples:
 		"query": query,
 		"top_k": top,
 	}
+	if mode != "" {
+		reqBody["mode"] = mode
+	}
+	if filter != "" {
+		if !json.Valid([]byte(filter)) {
+			fmt.Fprintf(os.Stderr, "Error: --filter must be valid JSON\n")
+			return 1
+		}
+		reqBody["filter"] = json.RawMessage(filter)
+	}
 	if sessionID != "" {
 		reqBody["session_id"], _ = json.Number(sessionID).Int64()
 	}
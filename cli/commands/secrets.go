@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"ai-hub/cli/client"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RunSecrets handles the secrets command
+func RunSecrets(c *client.Client, args []string) int {
+	if len(args) == 0 {
+		printSecretsHelp()
+		return 0
+	}
+
+	switch args[0] {
+	case "rotate-master":
+		return runSecretsRotateMaster(c, args[1:])
+	case "--help", "-h":
+		printSecretsHelp()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown secrets subcommand: %s\n", args[0])
+		printSecretsHelp()
+		return 1
+	}
+}
+
+func runSecretsRotateMaster(c *client.Client, args []string) int {
+	var newKey string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--new-key":
+			if i+1 < len(args) {
+				i++
+				newKey = args[i]
+			}
+		}
+	}
+
+	resp, err := c.POST("/secrets/rotate-master", map[string]string{"new_key": newKey})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var result struct {
+		Reencrypted int    `json:"reencrypted"`
+		Hint        string `json:"hint"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Master key rotated, %d secret(s) re-encrypted\n", result.Reencrypted)
+	if result.Hint != "" {
+		fmt.Printf("Note: %s\n", result.Hint)
+	}
+	return 0
+}
+
+func printSecretsHelp() {
+	fmt.Println(`Secrets - encrypted-at-rest credentials (admin only)
+
+Provider API keys and channel secrets (app_secret, token, ...) are stored
+AES-GCM encrypted. The master key is read from AI_HUB_MASTER_KEY (base64 or
+hex, 32 bytes) or <data-dir>/master.key, generated on first start.
+
+Usage:
+  ai-hub secrets rotate-master [--new-key <key>]   Re-encrypt all secrets with a new master key
+
+When AI_HUB_MASTER_KEY is set, --new-key is required and the variable must be
+updated to the new key before the next restart.
+
+Examples:
+  ai-hub secrets rotate-master
+  ai-hub secrets rotate-master --new-key "$(openssl rand -base64 32)"`)
+}
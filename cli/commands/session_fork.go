@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"ai-hub/cli/client"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type sessionTreeNode struct {
+	ID        int64              `json:"id"`
+	Title     string             `json:"title"`
+	GroupName string             `json:"group_name"`
+	ForkPoint int64              `json:"fork_point"`
+	CreatedAt string             `json:"created_at"`
+	Children  []*sessionTreeNode `json:"children"`
+}
+
+// sessionFork handles "sessions fork <id> [--from <msg_id>] [--title <title>]"
+func sessionFork(c *client.Client, id int64, args []string) int {
+	var fromMsgID int64
+	var title string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--from":
+			if i+1 < len(args) {
+				i++
+				fromMsgID, _ = strconv.ParseInt(args[i], 10, 64)
+			}
+		case "--title":
+			if i+1 < len(args) {
+				i++
+				title = args[i]
+			}
+		}
+	}
+
+	path := fmt.Sprintf("/sessions/%d/fork", id)
+	if fromMsgID > 0 {
+		path += fmt.Sprintf("?from_msg_id=%d", fromMsgID)
+	}
+	respData, err := c.POST(path, map[string]string{"title": title})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Session struct {
+			ID        int64  `json:"id"`
+			Title     string `json:"title"`
+			ForkPoint int64  `json:"fork_point"`
+		} `json:"session"`
+		CopiedMessages int64 `json:"copied_messages"`
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Forked session #%d -> #%d %s\n", id, resp.Session.ID, resp.Session.Title)
+	fmt.Printf("  分叉点: 消息 #%d，已复制 %d 条消息\n", resp.Session.ForkPoint, resp.CopiedMessages)
+	return 0
+}
+
+// sessionTree handles "sessions tree <id>": the fork tree containing the session
+func sessionTree(c *client.Client, id int64) int {
+	respData, err := c.GET(fmt.Sprintf("/sessions/%d/tree", id))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Root *sessionTreeNode `json:"root"`
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil || resp.Root == nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+	printSessionTree(resp.Root, id, "", "")
+	return 0
+}
+
+func printSessionTree(n *sessionTreeNode, current int64, prefix, branch string) {
+	marker := ""
+	if n.ID == current {
+		marker = "  ← current"
+	}
+	fork := ""
+	if n.ForkPoint > 0 {
+		fork = fmt.Sprintf(" (from msg #%d)", n.ForkPoint)
+	}
+	fmt.Printf("%s%s#%d %s%s%s\n", prefix, branch, n.ID, n.Title, fork, marker)
+
+	childPrefix := prefix
+	switch branch {
+	case "├─ ":
+		childPrefix += "│  "
+	case "└─ ":
+		childPrefix += "   "
+	}
+	for i, child := range n.Children {
+		b := "├─ "
+		if i == len(n.Children)-1 {
+			b = "└─ "
+		}
+		printSessionTree(child, current, childPrefix, b)
+	}
+}
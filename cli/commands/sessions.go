@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // RunSessions executes the sessions command
@@ -34,6 +35,16 @@ func RunSessions(c *client.Client, args []string) int {
 		return listSessions(c, withErrors, groupName)
 	}
 
+	// "sessions search <query>" (cross-session full-text search)
+	if args[0] == "search" {
+		return sessionsSearch(c, args[1:], groupName)
+	}
+
+	// "sessions fork <id>" / "sessions tree <id>"
+	if (args[0] == "fork" || args[0] == "tree") && len(args) > 1 {
+		args[0], args[1] = args[1], args[0]
+	}
+
 	// Parse session ID
 	id, err := strconv.ParseInt(args[0], 10, 64)
 	if err != nil {
@@ -61,6 +72,24 @@ func RunSessions(c *client.Client, args []string) int {
 		return sessionReset(c, id, args[2:])
 	}
 
+	// Check for "failover" subcommand
+	if len(args) > 1 && args[1] == "failover" {
+		return sessionFailover(c, id, args[2:])
+	}
+
+	// Check for "tool-policy" subcommand
+	if len(args) > 1 && args[1] == "tool-policy" {
+		return sessionToolPolicy(c, id, args[2:])
+	}
+
+	// Check for "fork" / "tree" subcommands
+	if len(args) > 1 && args[1] == "fork" {
+		return sessionFork(c, id, args[2:])
+	}
+	if len(args) > 1 && args[1] == "tree" {
+		return sessionTree(c, id)
+	}
+
 	return sessionDetail(c, id)
 }
 
@@ -191,6 +220,9 @@ func sessionDetail(c *client.Client, id int64) int {
 		ProcessAlive bool   `json:"process_alive"`
 		ProcessState string `json:"process_state"`
 		ProcessPid   int    `json:"process_pid"`
+		IsShadow     bool   `json:"is_shadow"`
+		ParentID     int64  `json:"parent_id"`
+		ForkPoint    int64  `json:"fork_point"`
 		CreatedAt    string `json:"created_at"`
 		UpdatedAt    string `json:"updated_at"`
 	}
@@ -215,6 +247,9 @@ func sessionDetail(c *client.Client, id int64) int {
 	}
 	fmt.Printf("  团队: %s\n", s.GroupName)
 	fmt.Printf("  目录: %s\n", s.WorkDir)
+	if s.ParentID > 0 && !s.IsShadow {
+		fmt.Printf("  分叉: 来自 #%d（消息 #%d）\n", s.ParentID, s.ForkPoint)
+	}
 	fmt.Printf("  创建: %s\n", FormatTime(s.CreatedAt))
 	fmt.Printf("  更新: %s\n", FormatTime(s.UpdatedAt))
 	return 0
@@ -638,3 +673,66 @@ func sessionReset(c *client.Client, id int64, args []string) int {
 
 	return 0
 }
+
+// sessionFailover handles the "sessions <id> failover" subcommand
+// Usage:
+//
+//	ai-hub sessions <id> failover                      Show fallback provider chain
+//	ai-hub sessions <id> failover --set <id1,id2,...>  Set chain (tried in order)
+//	ai-hub sessions <id> failover --clear              Remove chain (use group chain)
+func sessionFailover(c *client.Client, id int64, args []string) int {
+	path := fmt.Sprintf("/sessions/%d/failover", id)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--set":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --set requires comma-separated provider IDs")
+				return 1
+			}
+			var ids []string
+			for _, p := range strings.Split(args[i+1], ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					ids = append(ids, p)
+				}
+			}
+			if _, err := c.PUT(path, map[string]interface{}{"provider_ids": ids}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Session #%d: failover chain set (%d providers)\n", id, len(ids))
+			return 0
+		case "--clear":
+			if _, err := c.PUT(path, map[string]interface{}{"provider_ids": []string{}}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Session #%d: failover chain cleared\n", id)
+			return 0
+		}
+	}
+
+	respData, err := c.GET(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		ProviderIDs []string `json:"provider_ids"`
+		Effective   []string `json:"effective"`
+	}
+	json.Unmarshal(respData, &resp)
+
+	if len(resp.Effective) == 0 {
+		fmt.Printf("Session #%d: no failover chain\n", id)
+		return 0
+	}
+	source := "session"
+	if len(resp.ProviderIDs) == 0 {
+		source = "group"
+	}
+	fmt.Printf("Session #%d failover chain (%s):\n", id, source)
+	for i, p := range resp.Effective {
+		fmt.Printf("  %d. %s\n", i+1, p)
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"ai-hub/cli/client"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sessionsSearch handles "sessions search <query> [--role r] [--since s] [--limit n]"
+// (--group is parsed by RunSessions).
+func sessionsSearch(c *client.Client, args []string, groupName string) int {
+	query, flagArgs := SplitQueryAndFlags(args)
+
+	var role, since string
+	var limit int
+	fs := flag.NewFlagSet("sessions search", flag.ExitOnError)
+	fs.StringVar(&role, "role", "", "user or assistant")
+	fs.StringVar(&since, "since", "", "2006-01-02, RFC3339, or relative (7d, 12h)")
+	fs.IntVar(&limit, "limit", 20, "Max results")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `Usage: ai-hub sessions search <query> [--group <name>] [--role user|assistant] [--since 30d] [--limit n]
+
+Full-text search across the chat history of all sessions, best matches first.
+Terms are ANDed; use quotes for a phrase.
+
+Examples:
+  ai-hub sessions search nginx 配置
+  ai-hub sessions search "proxy_pass" --role assistant --since 90d
+  ai-hub sessions search 部署 --group ops --limit 5
+`)
+	}
+	if err := fs.Parse(flagArgs); err != nil {
+		return 1
+	}
+	if query == "" {
+		fmt.Fprintf(os.Stderr, "Error: query is required\n\n")
+		fs.Usage()
+		return 1
+	}
+
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(limit))
+	if groupName != "" {
+		params.Set("group", groupName)
+	}
+	if role != "" {
+		params.Set("role", role)
+	}
+	if since != "" {
+		params.Set("since", since)
+	}
+	respData, err := c.GET("/search/messages?" + params.Encode())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Results []struct {
+			MessageID    int64  `json:"message_id"`
+			SessionID    int64  `json:"session_id"`
+			SessionTitle string `json:"session_title"`
+			GroupName    string `json:"group_name"`
+			Role         string `json:"role"`
+			Snippet      string `json:"snippet"`
+			CreatedAt    string `json:"created_at"`
+		} `json:"results"`
+		Mode string `json:"mode"`
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+	if len(resp.Results) == 0 {
+		fmt.Println("No matching messages.")
+		return 0
+	}
+
+	// Highlight matches in a terminal, plain brackets when piped
+	markOn, markOff := "[", "]"
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		markOn, markOff = "\033[1;33m", "\033[0m"
+	}
+	hl := strings.NewReplacer("<mark>", markOn, "</mark>", markOff, "\n", " ")
+
+	for _, r := range resp.Results {
+		group := ""
+		if r.GroupName != "" {
+			group = " [" + r.GroupName + "]"
+		}
+		date := r.CreatedAt
+		if len(date) >= 16 {
+			date = strings.Replace(date[:16], "T", " ", 1)
+		}
+		fmt.Printf("#%d %s%s  msg #%d %s %s\n", r.SessionID, r.SessionTitle, group, r.MessageID, r.Role, date)
+		fmt.Printf("    %s\n\n", hl.Replace(r.Snippet))
+	}
+	if resp.Mode == "like" {
+		fmt.Println("(FTS5 unavailable on the server: substring match, newest first)")
+	}
+	return 0
+}
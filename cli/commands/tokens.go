@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"ai-hub/cli/client"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// RunTokens handles the tokens command
+func RunTokens(c *client.Client, args []string) int {
+	if len(args) == 0 {
+		return runTokensList(c)
+	}
+
+	subCmd := args[0]
+	subArgs := args[1:]
+
+	switch subCmd {
+	case "list":
+		return runTokensList(c)
+	case "create":
+		return runTokensCreate(c, subArgs)
+	case "delete":
+		return runTokensDelete(c, subArgs)
+	case "--help", "-h":
+		printTokensHelp()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown tokens subcommand: %s\n", subCmd)
+		printTokensHelp()
+		return 1
+	}
+}
+
+type apiToken struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	Prefix     string `json:"prefix"`
+	ExpiresAt  string `json:"expires_at"`
+	LastUsedAt string `json:"last_used_at"`
+	CreatedAt  string `json:"created_at"`
+}
+
+func runTokensList(c *client.Client) int {
+	resp, err := c.GET("/tokens")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var tokens []apiToken
+	if err := json.Unmarshal(resp, &tokens); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+
+	if len(tokens) == 0 {
+		fmt.Println("No tokens")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tROLE\tPREFIX\tEXPIRES\tLAST USED")
+	for _, t := range tokens {
+		expires := t.ExpiresAt
+		if expires == "" {
+			expires = "never"
+		}
+		lastUsed := t.LastUsedAt
+		if lastUsed == "" {
+			lastUsed = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s…\t%s\t%s\n", t.ID, t.Name, t.Role, t.Prefix, expires, lastUsed)
+	}
+	w.Flush()
+	return 0
+}
+
+func runTokensCreate(c *client.Client, args []string) int {
+	var name, role, expiresIn string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--name":
+			if i+1 < len(args) {
+				i++
+				name = args[i]
+			}
+		case "--role":
+			if i+1 < len(args) {
+				i++
+				role = args[i]
+			}
+		case "--expires-in":
+			if i+1 < len(args) {
+				i++
+				expiresIn = args[i]
+			}
+		}
+	}
+
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "Error: --name is required\n")
+		printTokensHelp()
+		return 1
+	}
+
+	body := map[string]string{
+		"name":       name,
+		"role":       role,
+		"expires_in": expiresIn,
+	}
+	resp, err := c.POST("/tokens", body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var result struct {
+		Token string   `json:"token"`
+		Info  apiToken `json:"info"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Token created: #%d %s (%s)\n", result.Info.ID, result.Info.Name, result.Info.Role)
+	fmt.Printf("Token: %s\n", result.Token)
+	fmt.Println("Save it now — it will not be shown again.")
+	return 0
+}
+
+func runTokensDelete(c *client.Client, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: token id is required\n")
+		return 1
+	}
+
+	if _, err := c.DELETE("/tokens/" + args[0]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Token #%s revoked\n", args[0])
+	return 0
+}
+
+func printTokensHelp() {
+	fmt.Println(`Tokens - API token management (admin only)
+
+Usage:
+  ai-hub tokens list                                       List tokens
+  ai-hub tokens create --name <name> [--role <role>] [--expires-in <duration>]
+  ai-hub tokens delete <id>                                Revoke a token
+
+Roles:
+  admin      Full access (providers, tokens, shutdown, import/export)
+  operator   Chat, sessions, memory, triggers, hooks
+  readonly   Read-only access (GET and search endpoints)
+
+Token lookup (CLI):
+  AI_HUB_TOKEN > AI_HUB_TOKEN_FILE > <data-dir>/auth.token
+  --remote targets use AI_HUB_REMOTE_TOKEN
+
+Examples:
+  ai-hub tokens create --name dashboard --role readonly --expires-in 720h
+  ai-hub tokens delete 3`)
+}
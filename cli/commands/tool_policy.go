@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"ai-hub/cli/client"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type toolPolicy struct {
+	PermissionMode string   `json:"permission_mode"`
+	AllowedTools   []string `json:"allowed_tools"`
+	DeniedTools    []string `json:"denied_tools"`
+	BashPatterns   []string `json:"bash_patterns"`
+	WritablePaths  []string `json:"writable_paths"`
+	ApprovalTools  []string `json:"approval_tools"`
+	ApprovalSec    int      `json:"approval_timeout_sec"`
+}
+
+// sessionToolPolicy handles "sessions <id> tool-policy"
+func sessionToolPolicy(c *client.Client, id int64, args []string) int {
+	return runToolPolicy(c, fmt.Sprintf("/sessions/%d/tool-policy", id), fmt.Sprintf("Session #%d", id), args)
+}
+
+// groupToolPolicy handles "groups <name> tool-policy"
+func groupToolPolicy(c *client.Client, name string, args []string) int {
+	return runToolPolicy(c, "/groups/"+url.PathEscape(name)+"/tool-policy", "Group "+name, args)
+}
+
+// runToolPolicy shows or updates a tool permission policy.
+// Usage:
+//
+//	... tool-policy                                   Show policy and compiled CLI flags
+//	... tool-policy --preset readonly|workspace       Apply a preset
+//	... tool-policy [--mode <m>] [--allow a,b] [--deny c] [--bash "git status,npm test:*"] [--write "docs/**"]
+//	... tool-policy [...] --approve Bash,Write [--approval-timeout 120]
+//	... tool-policy --clear                           Remove the policy
+func runToolPolicy(c *client.Client, path, label string, args []string) int {
+	if len(args) == 0 {
+		return showToolPolicy(c, path, label)
+	}
+
+	body := map[string]interface{}{}
+	var policy toolPolicy
+	for i := 0; i < len(args); i++ {
+		next := func() string {
+			if i+1 < len(args) {
+				i++
+				return args[i]
+			}
+			return ""
+		}
+		switch args[i] {
+		case "--clear":
+			if _, err := c.DELETE(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			fmt.Printf("%s: tool policy cleared\n", label)
+			return 0
+		case "--preset":
+			body["preset"] = next()
+		case "--mode":
+			policy.PermissionMode = next()
+		case "--allow":
+			policy.AllowedTools = splitList(next())
+		case "--deny":
+			policy.DeniedTools = splitList(next())
+		case "--bash":
+			policy.BashPatterns = splitList(next())
+		case "--write":
+			policy.WritablePaths = splitList(next())
+		case "--approve":
+			policy.ApprovalTools = splitList(next())
+		case "--approval-timeout":
+			fmt.Sscanf(next(), "%d", &policy.ApprovalSec)
+		case "--help", "-h":
+			printToolPolicyHelp()
+			return 0
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown option: %s\n", args[i])
+			printToolPolicyHelp()
+			return 1
+		}
+	}
+	body["permission_mode"] = policy.PermissionMode
+	body["allowed_tools"] = policy.AllowedTools
+	body["denied_tools"] = policy.DeniedTools
+	body["bash_patterns"] = policy.BashPatterns
+	body["writable_paths"] = policy.WritablePaths
+	body["approval_tools"] = policy.ApprovalTools
+	body["approval_timeout_sec"] = policy.ApprovalSec
+
+	if _, err := c.PUT(path, body); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s: tool policy updated (running process restarts on next message)\n", label)
+	return showToolPolicy(c, path, label)
+}
+
+func showToolPolicy(c *client.Client, path, label string) int {
+	respData, err := c.GET(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Policy    *toolPolicy `json:"policy"`
+		Effective *toolPolicy `json:"effective"`
+		Source    string      `json:"source"`
+		CLIArgs   []string    `json:"cli_args"`
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+
+	p := resp.Effective
+	if p == nil {
+		p = resp.Policy
+	}
+	if p == nil {
+		fmt.Printf("%s: no tool policy (unrestricted)\n", label)
+	} else {
+		if resp.Source != "" {
+			fmt.Printf("%s tool policy (%s):\n", label, resp.Source)
+		} else {
+			fmt.Printf("%s tool policy:\n", label)
+		}
+		fmt.Printf("  Mode:      %s\n", p.PermissionMode)
+		fmt.Printf("  Allowed:   %s\n", joinOrDash(p.AllowedTools))
+		fmt.Printf("  Denied:    %s\n", joinOrDash(p.DeniedTools))
+		fmt.Printf("  Bash:      %s\n", joinOrDash(p.BashPatterns))
+		fmt.Printf("  Writable:  %s\n", joinOrDash(p.WritablePaths))
+		if len(p.ApprovalTools) > 0 {
+			timeout := p.ApprovalSec
+			if timeout == 0 {
+				timeout = 300
+			}
+			fmt.Printf("  Approval:  %s (timeout %ds)\n", joinOrDash(p.ApprovalTools), timeout)
+		}
+	}
+	if len(resp.CLIArgs) > 0 {
+		fmt.Printf("  CLI flags: %s\n", strings.Join(resp.CLIArgs, " "))
+	}
+	return 0
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func joinOrDash(list []string) string {
+	if len(list) == 0 {
+		return "-"
+	}
+	return strings.Join(list, ", ")
+}
+
+func printToolPolicyHelp() {
+	fmt.Println(`Tool policy - restrict which tools a session may use (admin only to change)
+
+Usage:
+  ai-hub sessions <id> tool-policy [options]
+  ai-hub groups <name> tool-policy [options]
+
+Options:
+  (none)                      Show the policy and the compiled Claude CLI flags
+  --preset <name>             readonly | workspace
+  --mode <mode>               default | acceptEdits | plan | bypassPermissions
+  --allow <a,b,...>           Allowed tools (e.g. Read,Grep,WebFetch)
+  --deny <a,b,...>            Denied tools (wins over --allow)
+  --bash <p1,p2,...>          Allowed Bash command patterns (e.g. "git status,npm test:*")
+  --write <g1,g2,...>         Writable path globs for Edit/Write (e.g. "docs/**")
+  --approve <a,b,...>         Tools that wait for a human decision instead of being
+                              refused ("*" = every tool not allowed above)
+  --approval-timeout <sec>    Auto-deny after this many seconds (default 300)
+  --clear                     Remove the policy (session falls back to its group)
+
+A session policy overrides its group's policy. Without any policy the session
+runs unrestricted (--dangerously-skip-permissions).
+
+Examples:
+  ai-hub groups qq-public tool-policy --preset readonly
+  ai-hub sessions 12 tool-policy --allow Read,Grep --bash "git log:*" --write "notes/**"
+  ai-hub sessions 12 tool-policy --allow Read,Grep --approve Bash,Write --approval-timeout 120`)
+}
@@ -78,6 +78,29 @@ func resolveBaseURL(c *client.Client, remoteURL string) string {
 	return c.BaseURL
 }
 
+// tokenTransport attaches an API token to every request.
+type tokenTransport struct {
+	token string
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.token != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// transferHTTPClient returns a raw HTTP client carrying the token for the
+// target server (local client token, or AI_HUB_REMOTE_TOKEN for --remote).
+func transferHTTPClient(c *client.Client, remoteURL string, timeout time.Duration) *http.Client {
+	token := c.Token
+	if remoteURL != "" {
+		token = client.NewClientWithURL(remoteURL).Token
+	}
+	return &http.Client{Timeout: timeout, Transport: tokenTransport{token: token}}
+}
+
 func runTransferSend(c *client.Client, args []string) int {
 	var filePath, remoteURL, savePath string
 	for i := 0; i < len(args); i++ {
@@ -115,7 +138,7 @@ func runTransferSend(c *client.Client, args []string) int {
 	fileName := filepath.Base(filePath)
 	baseURL := resolveBaseURL(c, remoteURL)
 
-	httpClient := &http.Client{Timeout: 0} // no timeout for large files
+	httpClient := transferHTTPClient(c, remoteURL, 0) // no timeout for large files
 
 	// Step 1: 初始化上传
 	initBody := map[string]interface{}{
@@ -274,7 +297,7 @@ func runTransferPull(c *client.Client, args []string) int {
 	}
 
 	baseURL := resolveBaseURL(c, remoteURL)
-	httpClient := &http.Client{Timeout: 0}
+	httpClient := transferHTTPClient(c, remoteURL, 0)
 
 	// Step 1: 获取文件信息
 	infoResp, err := httpClient.Get(baseURL + "/transfer/status/" + transferID)
@@ -399,7 +422,7 @@ func runTransferList(c *client.Client, args []string) int {
 	}
 
 	baseURL := resolveBaseURL(c, remoteURL)
-	httpClient := &http.Client{Timeout: 30 * time.Second}
+	httpClient := transferHTTPClient(c, remoteURL, 30*time.Second)
 
 	resp, err := httpClient.Get(baseURL + "/transfer/list")
 	if err != nil {
@@ -458,7 +481,7 @@ func runTransferStatus(c *client.Client, args []string) int {
 	}
 
 	baseURL := resolveBaseURL(c, remoteURL)
-	httpClient := &http.Client{Timeout: 30 * time.Second}
+	httpClient := transferHTTPClient(c, remoteURL, 30*time.Second)
 
 	resp, err := httpClient.Get(baseURL + "/transfer/status/" + transferID)
 	if err != nil {
@@ -497,7 +520,7 @@ func runTransferDelete(c *client.Client, args []string) int {
 	}
 
 	baseURL := resolveBaseURL(c, remoteURL)
-	httpClient := &http.Client{Timeout: 30 * time.Second}
+	httpClient := transferHTTPClient(c, remoteURL, 30*time.Second)
 
 	req, _ := http.NewRequest("DELETE", baseURL+"/transfer/delete/"+transferID, nil)
 	resp, err := httpClient.Do(req)
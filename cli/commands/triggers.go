@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // RunTriggers executes the triggers command
@@ -24,6 +25,10 @@ func RunTriggers(c *client.Client, args []string) int {
 		return triggersUpdate(c, args[1:])
 	case "delete":
 		return triggersDelete(c, args[1:])
+	case "preview":
+		return triggersPreview(c, args[1:])
+	case "runs":
+		return triggersRuns(c, args[1:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown triggers subcommand: %s\n", args[0])
 		printTriggersHelp()
@@ -48,15 +53,19 @@ func triggersList(c *client.Client, args []string) int {
 	}
 
 	var triggers []struct {
-		ID          int64  `json:"id"`
-		SessionID   int64  `json:"session_id"`
-		Content     string `json:"content"`
-		TriggerTime string `json:"trigger_time"`
-		MaxFires    int    `json:"max_fires"`
-		Enabled     bool   `json:"enabled"`
-		FiredCount  int    `json:"fired_count"`
-		Status      string `json:"status"`
-		NextFireAt  string `json:"next_fire_at"`
+		ID          int64    `json:"id"`
+		SessionID   int64    `json:"session_id"`
+		Content     string   `json:"content"`
+		TriggerTime string   `json:"trigger_time"`
+		Timezone    string   `json:"timezone"`
+		Exclusions  []string `json:"exclusions"`
+		MaxFires    int      `json:"max_fires"`
+		Misfire     string   `json:"misfire"`
+		RetryLimit  int      `json:"retry_limit"`
+		Enabled     bool     `json:"enabled"`
+		FiredCount  int      `json:"fired_count"`
+		Status      string   `json:"status"`
+		NextFireAt  string   `json:"next_fire_at"`
 	}
 	if err := json.Unmarshal(respData, &triggers); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
@@ -76,6 +85,15 @@ func triggersList(c *client.Client, args []string) int {
 		}
 		fmt.Printf("#%-4d [%s] session=%d  %s\n", t.ID, t.Status, t.SessionID, enabled)
 		fmt.Printf("      时间: %s  触发: %d/%d\n", t.TriggerTime, t.FiredCount, t.MaxFires)
+		if t.Timezone != "" {
+			fmt.Printf("      时区: %s\n", t.Timezone)
+		}
+		if len(t.Exclusions) > 0 {
+			fmt.Printf("      排除: %s\n", strings.Join(t.Exclusions, ", "))
+		}
+		if t.Misfire != "" || t.RetryLimit != 0 {
+			fmt.Printf("      补触发: %s  重试: %d\n", t.Misfire, t.RetryLimit)
+		}
 		fmt.Printf("      指令: %s\n", TruncatePreview(t.Content, 100))
 		if t.NextFireAt != "" {
 			fmt.Printf("      下次: %s\n", FormatTime(t.NextFireAt))
@@ -86,8 +104,10 @@ func triggersList(c *client.Client, args []string) int {
 }
 
 func triggersCreate(c *client.Client, args []string) int {
-	var sessionID, content, triggerTime string
+	var sessionID, content, triggerTime, timezone, misfire, retryDelay string
+	var exclusions []string
 	maxFires := -1
+	retryLimit := 0
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -106,11 +126,36 @@ func triggersCreate(c *client.Client, args []string) int {
 				i++
 				triggerTime = args[i]
 			}
+		case "--tz":
+			if i+1 < len(args) {
+				i++
+				timezone = args[i]
+			}
+		case "--exclude":
+			if i+1 < len(args) {
+				i++
+				exclusions = append(exclusions, splitExclusions(args[i])...)
+			}
 		case "--max-fires":
 			if i+1 < len(args) {
 				i++
 				fmt.Sscanf(args[i], "%d", &maxFires)
 			}
+		case "--misfire":
+			if i+1 < len(args) {
+				i++
+				misfire = args[i]
+			}
+		case "--retry":
+			if i+1 < len(args) {
+				i++
+				fmt.Sscanf(args[i], "%d", &retryLimit)
+			}
+		case "--retry-delay":
+			if i+1 < len(args) {
+				i++
+				retryDelay = args[i]
+			}
 		}
 	}
 
@@ -120,7 +165,7 @@ func triggersCreate(c *client.Client, args []string) int {
 	}
 
 	if sessionID == "" || content == "" || triggerTime == "" {
-		fmt.Fprintf(os.Stderr, "Usage: ai-hub triggers create --session <id> --time \"09:00:00\" --content \"指令\" [--max-fires -1]\n")
+		fmt.Fprintf(os.Stderr, "Usage: ai-hub triggers create --session <id> --time \"09:00:00\" --content \"指令\" [--tz Asia/Tokyo] [--exclude 2026-10-01..2026-10-07] [--max-fires -1] [--misfire fire_once|fire_all|skip] [--retry 10] [--retry-delay 1m]\n")
 		return 1
 	}
 
@@ -134,7 +179,12 @@ func triggersCreate(c *client.Client, args []string) int {
 		"session_id":   sid,
 		"content":      content,
 		"trigger_time": triggerTime,
+		"timezone":     timezone,
+		"exclusions":   exclusions,
 		"max_fires":    maxFires,
+		"misfire":      misfire,
+		"retry_limit":  retryLimit,
+		"retry_delay":  retryDelay,
 	}
 
 	respData, err := c.POST("/triggers", body)
@@ -144,7 +194,8 @@ func triggersCreate(c *client.Client, args []string) int {
 	}
 
 	var resp struct {
-		ID int64 `json:"id"`
+		ID         int64  `json:"id"`
+		NextFireAt string `json:"next_fire_at"`
 	}
 	if err := json.Unmarshal(respData, &resp); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
@@ -152,12 +203,15 @@ func triggersCreate(c *client.Client, args []string) int {
 	}
 
 	fmt.Printf("Trigger #%d created.\n", resp.ID)
+	if resp.NextFireAt != "" {
+		fmt.Printf("Next fire: %s\n", FormatTime(resp.NextFireAt))
+	}
 	return 0
 }
 
 func triggersUpdate(c *client.Client, args []string) int {
 	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "Usage: ai-hub triggers update <id> [--content \"新指令\"] [--time \"10:00:00\"] [--max-fires 5] [--enabled true/false]\n")
+		fmt.Fprintf(os.Stderr, "Usage: ai-hub triggers update <id> [--content \"新指令\"] [--time \"10:00:00\"] [--tz Asia/Tokyo] [--exclude \"@cn-holidays\"] [--max-fires 5] [--misfire skip] [--retry -1] [--retry-delay 5m] [--enabled true/false]\n")
 		return 1
 	}
 
@@ -176,6 +230,18 @@ func triggersUpdate(c *client.Client, args []string) int {
 				i++
 				body["trigger_time"] = args[i]
 			}
+		case "--tz":
+			if i+1 < len(args) {
+				i++
+				body["timezone"] = args[i]
+			}
+		case "--exclude":
+			// Replaces the exclusion list; --exclude "" clears it
+			if i+1 < len(args) {
+				i++
+				list, _ := body["exclusions"].([]string)
+				body["exclusions"] = append(list, splitExclusions(args[i])...)
+			}
 		case "--max-fires":
 			if i+1 < len(args) {
 				i++
@@ -183,6 +249,23 @@ func triggersUpdate(c *client.Client, args []string) int {
 				fmt.Sscanf(args[i], "%d", &v)
 				body["max_fires"] = v
 			}
+		case "--misfire":
+			if i+1 < len(args) {
+				i++
+				body["misfire"] = args[i]
+			}
+		case "--retry":
+			if i+1 < len(args) {
+				i++
+				var v int
+				fmt.Sscanf(args[i], "%d", &v)
+				body["retry_limit"] = v
+			}
+		case "--retry-delay":
+			if i+1 < len(args) {
+				i++
+				body["retry_delay"] = args[i]
+			}
 		case "--enabled":
 			if i+1 < len(args) {
 				i++
@@ -223,6 +306,133 @@ func triggersDelete(c *client.Client, args []string) int {
 	return 0
 }
 
+func triggersPreview(c *client.Client, args []string) int {
+	body := map[string]interface{}{}
+	var exclusions []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--time":
+			if i+1 < len(args) {
+				i++
+				body["trigger_time"] = args[i]
+			}
+		case "--tz":
+			if i+1 < len(args) {
+				i++
+				body["timezone"] = args[i]
+			}
+		case "--exclude":
+			if i+1 < len(args) {
+				i++
+				exclusions = append(exclusions, splitExclusions(args[i])...)
+			}
+		case "-n", "--count":
+			if i+1 < len(args) {
+				i++
+				var n int
+				fmt.Sscanf(args[i], "%d", &n)
+				body["count"] = n
+			}
+		}
+	}
+	if body["trigger_time"] == nil {
+		fmt.Fprintf(os.Stderr, "Usage: ai-hub triggers preview --time \"0 9 * * 1-5\" [--tz Asia/Tokyo] [--exclude 2026-10-01] [-n 5]\n")
+		return 1
+	}
+	body["exclusions"] = exclusions
+
+	respData, err := c.POST("/triggers/preview", body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Next []string `json:"next"`
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+	if len(resp.Next) == 0 {
+		fmt.Println("No upcoming fire times.")
+		return 0
+	}
+	fmt.Printf("Next %d fire times:\n", len(resp.Next))
+	for _, t := range resp.Next {
+		fmt.Printf("  %s\n", t)
+	}
+	return 0
+}
+
+func triggersRuns(c *client.Client, args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ai-hub triggers runs <id> [--limit 20]\n")
+		return 1
+	}
+	triggerID := args[0]
+	limit := 20
+	for i := 1; i < len(args); i++ {
+		if args[i] == "--limit" && i+1 < len(args) {
+			i++
+			fmt.Sscanf(args[i], "%d", &limit)
+		}
+	}
+
+	respData, err := c.GET(fmt.Sprintf("/triggers/%s/runs?limit=%d", triggerID, limit))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var runs []struct {
+		ID            int64  `json:"id"`
+		ScheduledAt   string `json:"scheduled_at"`
+		FiredAt       string `json:"fired_at"`
+		Status        string `json:"status"`
+		Attempts      int    `json:"attempts"`
+		Error         string `json:"error"`
+		Note          string `json:"note"`
+		MessageID     int64  `json:"message_id"`
+		NextAttemptAt string `json:"next_attempt_at"`
+	}
+	if err := json.Unmarshal(respData, &runs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs yet.")
+		return 0
+	}
+
+	fmt.Printf("%d runs of trigger #%s:\n\n", len(runs), triggerID)
+	for _, r := range runs {
+		fmt.Printf("#%-5d [%s] 计划: %s  尝试: %d\n", r.ID, r.Status, FormatTime(r.ScheduledAt), r.Attempts)
+		if r.FiredAt != "" {
+			fmt.Printf("       发送: %s  消息: #%d\n", FormatTime(r.FiredAt), r.MessageID)
+		}
+		if r.NextAttemptAt != "" {
+			fmt.Printf("       重试: %s\n", FormatTime(r.NextAttemptAt))
+		}
+		if r.Error != "" {
+			fmt.Printf("       错误: %s\n", r.Error)
+		}
+		if r.Note != "" {
+			fmt.Printf("       备注: %s\n", r.Note)
+		}
+	}
+	return 0
+}
+
+// splitExclusions splits a comma-separated --exclude value.
+func splitExclusions(s string) []string {
+	list := []string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
 func printTriggersHelp() {
 	fmt.Fprintf(os.Stderr, `Usage: ai-hub triggers <subcommand> [args]
 
@@ -230,14 +440,37 @@ Manage scheduled triggers.
 
 Subcommands:
   list [--session <id>]               List triggers
-  create --session <id> --time "09:00:00" --content "指令" [--max-fires -1]
-  update <id> [--content "新指令"] [--time "10:00:00"] [--enabled true/false]
+  create --session <id> --time "09:00:00" --content "指令" [--tz <zone>] [--exclude <dates>] [--max-fires -1]
+  update <id> [--content "新指令"] [--time "10:00:00"] [--tz <zone>] [--exclude <dates>] [--enabled true/false]
   delete <id>                         Delete a trigger
+  preview --time <spec> [--tz <zone>] [--exclude <dates>] [-n 5]
+                                      Show the next fire times without saving
+  runs <id> [--limit 20]              Show execution history (outcome, error, message)
+
+Time formats:
+  "2026-02-17 10:30:00"   once, at that time
+  "09:00:00"              every day
+  "1h30m"                 every interval
+  "0 9 * * 1-5"           cron (5 fields, or 6 with seconds): weekdays at 9:00
+  "0 9 * * MON#1"         first Monday of the month; "0 18 L * *" last day of month
+  "@daily" "@weekly" ...  cron descriptors
+
+  --tz takes an IANA zone (default Asia/Shanghai time, CST+8).
+  --exclude takes comma-separated dates: 2026-10-01, 2026-10-01..2026-10-07,
+  12-25 (every year) or @name (holiday list from settings trigger_calendars).
+
+  --misfire decides what happens to fire times missed while the server was
+  down: fire_once (default, fire once for all of them), fire_all or skip.
+  When the session is busy a run is retried --retry times (default 10, -1 =
+  keep queueing), waiting --retry-delay (default 1m) and doubling up to 1h.
 
 Examples:
   ai-hub triggers list
   ai-hub triggers list --session 25
   ai-hub triggers create --session 25 --time "09:00:00" --content "早报" --max-fires -1
+  ai-hub triggers create --session 25 --time "0 9 * * 1-5" --tz America/New_York --exclude @us-holidays --content "站会提醒"
+  ai-hub triggers preview --time "0 30 9 * * MON#1" -n 3
+  ai-hub triggers runs 1 --limit 10
   ai-hub triggers update 1 --content "新指令"
   ai-hub triggers delete 1
 `)
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"ai-hub/cli/client"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunVector handles vector engine maintenance commands
+// Usage: ai-hub vector bench [...] | import-model <tarball>
+func RunVector(c *client.Client, args []string) int {
+	if len(args) == 0 || args[0] == "--help" || args[0] == "-h" {
+		printVectorHelp()
+		return 0
+	}
+	switch args[0] {
+	case "bench":
+		return vectorBench(c, args[1:])
+	case "import-model":
+		return vectorImportModel(c, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown vector command: %s\n", args[0])
+		printVectorHelp()
+		return 1
+	}
+}
+
+func printVectorHelp() {
+	fmt.Println(`Usage:
+  ai-hub vector bench [--sizes 1000,5000,20000] [--dim 512] [--queries 200] [--top 10] [--ef 32,64,128]
+  ai-hub vector bench --scope memory
+
+Benchmark the HNSW index against brute-force search: recall@k and query
+latency for each dataset size and ef_search value. Without --scope, clustered
+synthetic vectors are generated; with --scope, the stored vectors are used.
+
+  ai-hub vector import-model <model.tar.gz>
+
+Install the embedding model from a tarball on the server machine (for hosts
+that cannot download it). The tarball holds config.json, vocab.txt and
+pytorch_model.bin (or a converted spago_model.bin). Until a model is loaded,
+memory search runs in keyword-only (degraded) mode.`)
+}
+
+func vectorImportModel(c *client.Client, args []string) int {
+	if len(args) != 1 || strings.HasPrefix(args[0], "-") {
+		printVectorHelp()
+		return 1
+	}
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Converting pytorch weights on first load takes a while
+	c.HTTP.Timeout = 10 * time.Minute
+	fmt.Println("Importing model...")
+	respData, err := c.POST("/vector/model/import", map[string]interface{}{"path": path})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Status struct {
+			Pending int `json:"pending_embeddings"`
+		} `json:"status"`
+	}
+	json.Unmarshal(respData, &resp)
+	fmt.Println("Model loaded.")
+	if resp.Status.Pending > 0 {
+		fmt.Printf("Embedding %d text-only chunks in the background.\n", resp.Status.Pending)
+	}
+	return 0
+}
+
+func vectorBench(c *client.Client, args []string) int {
+	var sizes, efs, scope string
+	var dim, queries, top int
+	fs := flag.NewFlagSet("vector bench", flag.ExitOnError)
+	fs.StringVar(&sizes, "sizes", "", "Comma-separated dataset sizes (default 1000,5000,20000)")
+	fs.IntVar(&dim, "dim", 0, "Vector dimension (default 512)")
+	fs.IntVar(&queries, "queries", 0, "Queries per dataset (default 200)")
+	fs.IntVar(&top, "top", 0, "k for recall@k (default 10)")
+	fs.StringVar(&efs, "ef", "", "Comma-separated ef_search values (default 32,64,128)")
+	fs.StringVar(&scope, "scope", "", "Benchmark a stored scope instead of synthetic data")
+	fs.Usage = printVectorHelp
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	body := map[string]interface{}{"dim": dim, "queries": queries, "top_k": top, "scope": scope}
+	var err error
+	if body["sizes"], err = parseIntList(sizes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --sizes: %v\n", err)
+		return 1
+	}
+	if body["ef_search"], err = parseIntList(efs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --ef: %v\n", err)
+		return 1
+	}
+
+	// Building large indexes takes a while
+	c.HTTP.Timeout = 15 * time.Minute
+	fmt.Println("Running benchmark (building indexes may take a minute)...")
+	respData, err := c.POST("/vector/benchmark", body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var resp struct {
+		Options struct {
+			Queries int `json:"queries"`
+			TopK    int `json:"top_k"`
+		} `json:"options"`
+		Results []struct {
+			Size       int     `json:"size"`
+			Dim        int     `json:"dim"`
+			EfSearch   int     `json:"ef_search"`
+			BuildMs    int64   `json:"build_ms"`
+			Recall     float64 `json:"recall"`
+			BruteAvgUs float64 `json:"brute_avg_us"`
+			BruteP95Us float64 `json:"brute_p95_us"`
+			ANNAvgUs   float64 `json:"ann_avg_us"`
+			ANNP95Us   float64 `json:"ann_p95_us"`
+			Speedup    float64 `json:"speedup"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("\n%d queries, recall@%d vs exact brute force (latency in ms)\n\n", resp.Options.Queries, resp.Options.TopK)
+	fmt.Printf("%8s %5s %5s %9s %8s %10s %10s %9s %9s %8s\n",
+		"SIZE", "DIM", "EF", "BUILD(s)", "RECALL", "BRUTE avg", "BRUTE p95", "ANN avg", "ANN p95", "SPEEDUP")
+	for _, r := range resp.Results {
+		fmt.Printf("%8d %5d %5d %9.1f %8.3f %10.2f %10.2f %9.2f %9.2f %7.1fx\n",
+			r.Size, r.Dim, r.EfSearch, float64(r.BuildMs)/1000, r.Recall,
+			r.BruteAvgUs/1000, r.BruteP95Us/1000, r.ANNAvgUs/1000, r.ANNP95Us/1000, r.Speedup)
+	}
+	return 0
+}
+
+func parseIntList(s string) ([]int, error) {
+	var out []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", part)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -162,12 +162,20 @@ func Run(args []string) int {
 		return commands.RunDaemon(c, commandArgs)
 	case "reload":
 		return commands.RunReload(c, commandArgs)
+	case "vector":
+		return commands.RunVector(c, commandArgs)
 	case "skills":
 		return commands.RunSkills(c, commandArgs)
 	case "schemas":
 		return commands.RunSchemas(c, commandArgs)
 	case "mount":
 		return commands.RunMount(c, commandArgs)
+	case "tokens":
+		return commands.RunTokens(c, commandArgs)
+	case "secrets":
+		return commands.RunSecrets(c, commandArgs)
+	case "approvals":
+		return commands.RunApprovals(c, commandArgs)
 	case "transfer":
 		return commands.RunTransfer(c, commandArgs)
 	case "injection-router":
@@ -223,7 +231,7 @@ Usage:
 
 Subcommands:
   add          Write a new structured memory record
-  retrieve     Search memories with semantic + statistical reranking
+  retrieve     Search memories with hybrid (BM25 + semantic) + statistical reranking
   feedback     Report success/fail for a memory record
   revise       Create a new version of an existing memory
   deprecate    Mark a memory as deprecated
@@ -232,6 +240,7 @@ Subcommands:
 Examples:
   echo '{"type":"procedure","title":"Deploy SOP",...}' | ai-hub mem add
   ai-hub mem retrieve --query "deploy" --types procedure
+  ai-hub mem retrieve --query "deploy" --filter '{"gt":{"updated_at":"2026-01-01"}}'
   ai-hub mem feedback --id mem_20260305_0001 --result success
   ai-hub mem spec add`)
 }
@@ -250,7 +259,7 @@ Global Flags:
   --version          Show version
 
 Memory:
-  search             Search memory by semantic similarity
+  search             Search memory (BM25 + semantic, --mode to pick one)
   list               List memory files
   read               Read memory file
   write              Write memory file
@@ -265,6 +274,11 @@ Sessions:
   sessions <id> move --group <name>  Move session to group
   sessions <id> reset [--keep-last N] [--yes]  Reset session context
   sessions <id> reset --auto-threshold N  Set auto-reset threshold
+  sessions <id> failover [--set <id1,id2> | --clear]  Fallback provider chain
+  sessions <id> tool-policy [--preset readonly | --allow .. --deny .. | --clear]  Tool permissions
+  sessions fork <id> [--from <msg_id>] [--title <t>]  Branch a new session from a message
+  sessions tree <id>  Show the fork tree containing the session
+  sessions search <query> [--group g] [--role r] [--since 30d]  Full-text search across all sessions
   send               Send message to a session (0=new)
 
 Groups:
@@ -272,6 +286,7 @@ Groups:
   groups <name>      Group detail
   groups create <name> [--desc <desc>]  Create group
   groups delete <name>  Delete group
+  groups <name> tool-policy [...]  Tool permissions for all sessions in the group
 
 Services:
   services           List all services
@@ -297,7 +312,7 @@ Schemas:
 System:
   rules              Manage session rules (get/set/delete)
   notes              Manage notes (list/read/write/delete)
-  triggers           Manage triggers (list/create/update/delete)
+  triggers           Manage triggers (list/create/update/delete/preview/runs)
   status             System status
   version            Show version
 
@@ -314,11 +329,28 @@ Hot Reload:
   reload config      Reload configuration
   reload skills      Reload skill definitions
 
+Vector:
+  vector bench [--sizes 1000,5000] [--scope memory]  ANN index recall / latency benchmark
+  vector import-model <model.tar.gz>                 Install the embedding model offline
+
 Static Mount:
   mount <path> --alias <name>   Mount local directory for static file serving
   mount list                    List all mounts
   mount remove <alias>          Remove a mount
 
+API Tokens:
+  tokens list                   List API tokens
+  tokens create --name <name> [--role admin|operator|readonly] [--expires-in 720h]
+  tokens delete <id>            Revoke a token
+
+Secrets:
+  secrets rotate-master [--new-key <key>]   Re-encrypt provider keys / channel secrets
+
+Tool Approvals:
+  approvals [list] [--session <id>]         Pending tool calls waiting for a decision
+  approvals approve <id> [--reason <text>]  Let the tool call run
+  approvals deny <id> [--reason <text>]     Refuse the tool call
+
 File Transfer:
   transfer send     Upload file to remote (--file <path> --remote <url>)
   transfer pull     Download file from remote (--remote <url> --id <id> --save <path>)
@@ -337,6 +369,8 @@ Hooks:
   hooks delete <id>                   Delete a hook
   hooks enable <id>                   Enable a hook
   hooks disable <id>                  Disable a hook
+  hooks events                        List event types and payload variables
+  hooks test <id> [--content <text>] [--session <id>] [--var k=v]  Dry-run a hook
 
 Changelog:
   changelog <file> [--scope <scope>] [--limit N]          View memory change history
@@ -31,6 +31,10 @@ type RetrieveArgs struct {
 	K      int      `json:"k,omitempty"`
 	Types  []string `json:"types,omitempty"`
 	Status []string `json:"status,omitempty"`
+	Mode   string   `json:"mode,omitempty"` // hybrid (default) | semantic | keyword
+	// Filter is an extra metadata filter ANDed with types/status,
+	// e.g. {"gt":{"updated_at":"2026-01-01"}}
+	Filter json.RawMessage `json:"filter,omitempty"`
 }
 
 func runRetrieveFlags(c *client.Client, group string, args []string) int {
@@ -58,6 +62,16 @@ func runRetrieveFlags(c *client.Client, group string, args []string) int {
 				i++
 				rArgs.Status = strings.Split(args[i], ",")
 			}
+		case "--mode":
+			if i+1 < len(args) {
+				i++
+				rArgs.Mode = args[i]
+			}
+		case "--filter":
+			if i+1 < len(args) {
+				i++
+				rArgs.Filter = json.RawMessage(args[i])
+			}
 		default:
 			if !strings.HasPrefix(args[i], "-") && rArgs.Query == "" {
 				rArgs.Query = args[i]
@@ -67,7 +81,7 @@ func runRetrieveFlags(c *client.Client, group string, args []string) int {
 
 	if rArgs.Query == "" {
 		fmt.Fprintf(os.Stderr, "Error: --query is required\n")
-		fmt.Fprintf(os.Stderr, "\nUsage: ai-hub mem retrieve --query <text> [--k N] [--types type1,type2] [--status active,deprecated]\n")
+		fmt.Fprintf(os.Stderr, "\nUsage: ai-hub mem retrieve --query <text> [--k N] [--types type1,type2] [--status active,deprecated] [--mode hybrid|semantic|keyword] [--filter <json>]\n")
 		return 1
 	}
 	return doRetrieve(c, group, rArgs)
@@ -81,21 +95,28 @@ func doRetrieve(c *client.Client, group string, rArgs *RetrieveArgs) int {
 		rArgs.Status = []string{"active"}
 	}
 
-	vectorScope := "memory"
+	// Team memories rank ahead of global ones; near-duplicates across the
+	// two are merged by the server
+	scopes := []map[string]interface{}{{"scope": "memory", "weight": globalScopeWeight, "origin": "global"}}
 	if group != "" {
-		vectorScope = group + "/memory"
+		scopes = append([]map[string]interface{}{{"scope": group + "/memory", "weight": teamScopeWeight, "origin": "team"}}, scopes...)
 	}
 
-	// Fetch more candidates than needed for post-filtering
+	// The server filters before ranking; the extra candidates only widen
+	// the pool for the statistical reranking below
 	fetchK := rArgs.K * 3
 	if fetchK < 20 {
 		fetchK = 20
 	}
 
 	reqBody := map[string]interface{}{
-		"scope": vectorScope,
-		"query": rArgs.Query,
-		"top_k": fetchK,
+		"scopes": scopes,
+		"query":  rArgs.Query,
+		"top_k":  fetchK,
+		"filter": retrieveFilter(rArgs),
+	}
+	if rArgs.Mode != "" {
+		reqBody["mode"] = rArgs.Mode
 	}
 
 	respData, err := c.POST("/vector/search", reqBody)
@@ -112,7 +133,7 @@ func doRetrieve(c *client.Client, group string, rArgs *RetrieveArgs) int {
 		return 1
 	}
 
-	// Filter and rerank
+	// Rerank
 	type scored struct {
 		result    map[string]interface{}
 		semantic  float64
@@ -122,8 +143,6 @@ func doRetrieve(c *client.Client, group string, rArgs *RetrieveArgs) int {
 	}
 
 	var candidates []scored
-	statusSet := toSet(rArgs.Status)
-	typeSet := toSet(rArgs.Types)
 
 	for _, r := range resp.Results {
 		meta, _ := r["metadata"].(map[string]interface{})
@@ -131,23 +150,16 @@ func doRetrieve(c *client.Client, group string, rArgs *RetrieveArgs) int {
 			continue
 		}
 
-		// Filter by status
-		memStatus, _ := meta["mem_status"].(string)
-		if memStatus == "" {
-			memStatus = "active"
-		}
-		if !statusSet[memStatus] {
-			continue
+		// Relevance: the server's fused (BM25 + semantic) score, weighted by
+		// scope, when present
+		similarity, ok := r["weighted_score"].(float64)
+		if !ok {
+			similarity, ok = r["score"].(float64)
 		}
-
-		// Filter by type
-		memType, _ := meta["mem_type"].(string)
-		if len(typeSet) > 0 && !typeSet[memType] {
-			continue
+		if !ok {
+			similarity, _ = r["similarity"].(float64)
 		}
 
-		similarity, _ := r["similarity"].(float64)
-
 		// Statistical reranking
 		uses := toFloat(meta["hit_count"])
 		successRate := 0.5 // default neutral
@@ -174,7 +186,7 @@ func doRetrieve(c *client.Client, group string, rArgs *RetrieveArgs) int {
 		}
 
 		breakdown := map[string]float64{
-			"semantic":     similarity,
+			"relevance":    similarity,
 			"scope":        scopePriority,
 			"success_rate": successRate,
 			"popularity":   popularity / 5.0, // normalize
@@ -226,6 +238,7 @@ func doRetrieve(c *client.Client, group string, rArgs *RetrieveArgs) int {
 			"title":           metaStr(meta, "mem_title"),
 			"status":          metaStr(meta, "mem_status"),
 			"version":         meta["mem_version"],
+			"origin":          c.result["origin"],
 			"snippet":         snippet,
 			"score":           round(c.final, 4),
 			"score_breakdown": c.breakdown,
@@ -242,16 +255,52 @@ func doRetrieve(c *client.Client, group string, rArgs *RetrieveArgs) int {
 	return 0
 }
 
-func toSet(items []string) map[string]bool {
-	s := make(map[string]bool, len(items))
+// retrieveFilter builds the server-side metadata filter for a retrieve:
+// mem_status in Status (a missing status counts as active), mem_type in
+// Types, and the caller's own Filter.
+func retrieveFilter(rArgs *RetrieveArgs) map[string]interface{} {
+	statuses := nonEmpty(rArgs.Status)
+	statusFilter := map[string]interface{}{"in": map[string]interface{}{"mem_status": statuses}}
+	for _, st := range statuses {
+		if st == "active" {
+			statusFilter = map[string]interface{}{"or": []interface{}{
+				statusFilter,
+				map[string]interface{}{"not": map[string]interface{}{"exists": "mem_status"}},
+				map[string]interface{}{"eq": map[string]interface{}{"mem_status": ""}},
+			}}
+			break
+		}
+	}
+
+	and := []interface{}{statusFilter}
+	if types := nonEmpty(rArgs.Types); len(types) > 0 {
+		and = append(and, map[string]interface{}{"in": map[string]interface{}{"mem_type": types}})
+	}
+	if len(rArgs.Filter) > 0 && string(rArgs.Filter) != "null" {
+		and = append(and, rArgs.Filter)
+	}
+	if len(and) == 1 {
+		return statusFilter
+	}
+	return map[string]interface{}{"and": and}
+}
+
+func nonEmpty(items []string) []string {
+	var out []string
 	for _, item := range items {
-		if item != "" {
-			s[item] = true
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
 		}
 	}
-	return s
+	return out
 }
 
+// Scope weights for retrieve, matching the server's layer defaults
+const (
+	teamScopeWeight   = 0.9
+	globalScopeWeight = 0.8
+)
+
 func toFloat(v interface{}) float64 {
 	switch n := v.(type) {
 	case float64:
@@ -87,7 +87,7 @@ var specSchemas = map[string]interface{}{
 	},
 	"retrieve": map[string]interface{}{
 		"command":     "mem.retrieve",
-		"description": "Search memories with semantic + statistical reranking",
+		"description": "Search memories with hybrid (BM25 + semantic) + statistical reranking",
 		"args_schema": map[string]interface{}{
 			"type":                 "object",
 			"additionalProperties": false,
@@ -97,6 +97,8 @@ var specSchemas = map[string]interface{}{
 				"k":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 20, "default": 8},
 				"types":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": ValidTypes}},
 				"status": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": ValidStatuses}, "default": []string{"active"}},
+				"mode":   map[string]interface{}{"type": "string", "enum": []string{"hybrid", "semantic", "keyword"}, "default": "hybrid"},
+				"filter": map[string]interface{}{"type": "object", "description": "Metadata filter ANDed with types/status, e.g. {\"and\":[{\"eq\":{\"mem_risk\":\"low\"}},{\"gt\":{\"updated_at\":\"2026-01-01\"}}]}. Operators: and, or, not, eq, ne, gt, gte, lt, lte, in, contains, exists"},
 			},
 		},
 	},
@@ -2,6 +2,7 @@ package main
 
 import (
 	"ai-hub/cli"
+	"ai-hub/cli/client"
 	"ai-hub/server/api"
 	"ai-hub/server/core"
 	"ai-hub/server/model"
@@ -110,6 +111,16 @@ func main() {
 	}
 	defer store.Close()
 
+	// Init API auth (mints the bootstrap admin token on first start)
+	if tokenPath, err := core.InitAuth(); err != nil {
+		log.Fatalf("Failed to init auth: %v", err)
+	} else if tokenPath != "" {
+		fmt.Printf("Admin token written to %s\n", tokenPath)
+	}
+	if !core.AuthEnabled() {
+		log.Printf("[main] WARNING: API authentication disabled (AI_HUB_AUTH=off)")
+	}
+
 	// Check dependencies and auto-install claude CLI
 	core.Deps.CheckAll()
 	core.Deps.AutoInstallClaude()
@@ -128,6 +139,9 @@ func main() {
 	}
 	// Inject active-stream checker for non-time-based zombie detection.
 	core.Pool.IsStreaming = api.IsSessionStreaming
+	// Concurrency limit + queue position updates for waiting sessions
+	core.Pool.OnQueueUpdate = api.BroadcastQueueStatus
+	core.Pool.SetMaxProcesses(store.GetPoolSettings(core.DefaultMaxProcesses).MaxProcesses)
 
 	// Pass version to API layer
 	api.SetVersion(Version)
@@ -160,6 +174,8 @@ func main() {
 
 	// Init Go-native vector engine (no Python dependency)
 	core.InitVectorEngine("")
+	chunkCfg := store.GetVectorChunkSettings(core.DefaultChunkSize, core.DefaultChunkOverlap)
+	core.Vector.SetChunkOptions(chunkCfg.Size, chunkCfg.Overlap)
 	defer func() {
 		if core.Vector != nil {
 			core.Vector.Stop()
@@ -170,6 +186,8 @@ func main() {
 	vectorWatcher := core.StartVectorWatcher()
 	core.Watcher = vectorWatcher // expose globally for SyncFileToVector
 	defer vectorWatcher.Stop()
+	core.StartMemoryConsolidation()
+	core.StartMemoryPolicies()
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
@@ -177,11 +195,15 @@ func main() {
 	r.RedirectFixedPath = false
 	r.Use(gin.Recovery())
 
-	// CORS middleware
+	// CORS middleware: only same-host and AI_HUB_ALLOWED_ORIGINS are echoed back
 	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		if origin := c.GetHeader("Origin"); origin != "" && api.IsAllowedOrigin(c.Request) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Credentials", "true")
+			c.Header("Vary", "Origin")
+		}
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-AI-Hub-Token")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -190,8 +212,17 @@ func main() {
 	})
 
 	// API routes
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", api.AuthMiddleware())
 	{
+		// Auth & API tokens
+		v1.POST("/auth/login", api.Login)
+		v1.POST("/auth/logout", api.Logout)
+		v1.GET("/auth/whoami", api.WhoAmI)
+		v1.GET("/tokens", api.ListAPITokens)
+		v1.POST("/tokens", api.CreateAPIToken)
+		v1.DELETE("/tokens/:id", api.DeleteAPIToken)
+		v1.POST("/secrets/rotate-master", api.RotateMasterKey)
+
 		// Providers
 		v1.GET("/providers", api.ListProviders)
 		v1.POST("/providers", api.CreateProvider)
@@ -208,11 +239,22 @@ func main() {
 		v1.DELETE("/sessions/:id", api.DeleteSession)
 		v1.GET("/sessions/:id/messages", api.GetMessages)
 		v1.DELETE("/sessions/:id/messages", api.TruncateMessages)
+		v1.GET("/sessions/:id/messages/:msg_id/tools", api.GetMessageToolCalls)
 		v1.POST("/sessions/:id/compress", api.CompressSession)
 		v1.POST("/sessions/:id/reset", api.ResetSession)
+		v1.POST("/sessions/:id/fork", api.ForkSession)
+		v1.GET("/sessions/:id/tree", api.GetSessionTree)
 		v1.GET("/sessions/:id/last-request", api.GetLastRawRequest)
 		v1.GET("/sessions/:id/messages/:msg_id", api.GetMessageWithContext)
 		v1.PUT("/sessions/:id/provider", api.SwitchProvider)
+		v1.GET("/sessions/:id/failover", api.GetSessionFailover)
+		v1.PUT("/sessions/:id/failover", api.PutSessionFailover)
+		v1.GET("/sessions/:id/tool-policy", api.GetSessionToolPolicy)
+		v1.PUT("/sessions/:id/tool-policy", api.PutSessionToolPolicy)
+		v1.DELETE("/sessions/:id/tool-policy", api.DeleteSessionToolPolicy)
+		v1.POST("/sessions/:id/approval-mcp", api.HandleApprovalMCP)
+		v1.GET("/approvals", api.ListApprovals)
+		v1.POST("/approvals/:id", api.DecideApproval)
 		v1.PUT("/sessions/:id/attention", api.ToggleAttention)
 		v1.GET("/sessions/:id/attention-rules", api.GetAttentionRules)
 		v1.PUT("/sessions/:id/attention-rules", api.UpdateAttentionRules)
@@ -234,6 +276,11 @@ func main() {
 		v1.GET("/groups/:name", api.GetGroup)
 		v1.PUT("/groups/:name", api.UpdateGroup)
 		v1.DELETE("/groups/:name", api.DeleteGroup)
+		v1.GET("/groups/:name/failover", api.GetGroupFailover)
+		v1.PUT("/groups/:name/failover", api.PutGroupFailover)
+		v1.GET("/groups/:name/tool-policy", api.GetGroupToolPolicy)
+		v1.PUT("/groups/:name/tool-policy", api.PutGroupToolPolicy)
+		v1.DELETE("/groups/:name/tool-policy", api.DeleteGroupToolPolicy)
 
 		// Avatars
 		v1.GET("/avatars", api.ListAvatars)
@@ -287,6 +334,10 @@ func main() {
 		v1.POST("/triggers", api.CreateTrigger)
 		v1.PUT("/triggers/:id", api.UpdateTrigger)
 		v1.DELETE("/triggers/:id", api.DeleteTrigger)
+		v1.POST("/triggers/preview", api.PreviewTrigger)
+		v1.GET("/triggers/:id/runs", api.ListTriggerRuns)
+		v1.GET("/settings/trigger_calendars", api.GetTriggerCalendars)
+		v1.PUT("/settings/trigger_calendars", api.UpdateTriggerCalendars)
 
 		// Channels (IM gateway)
 		v1.GET("/channels", api.ListChannels)
@@ -309,6 +360,9 @@ func main() {
 		v1.POST("/webhook/feishu", api.HandleFeishuWebhook)
 		v1.POST("/webhook/qq", api.HandleQQWebhook)
 
+		// Global message search (FTS5)
+		v1.GET("/search/messages", api.SearchAllMessages)
+
 		// Vector engine (Skill tools)
 		v1.POST("/vector/search", api.SearchVector)
 		v1.POST("/vector/search_memory", api.SearchMemory)
@@ -321,6 +375,8 @@ func main() {
 		v1.GET("/vector/status", api.VectorStatus)
 		v1.GET("/vector/health", api.VectorHealth)
 		v1.POST("/vector/restart", api.RestartVector)
+		v1.POST("/vector/benchmark", api.BenchmarkVector)
+		v1.POST("/vector/model/import", api.ImportVectorModel)
 		v1.GET("/vector/list", api.ListVectorFiles)
 		v1.GET("/vector/list_files", api.ListVectorFilesRich) // Issue #109: rich list with preview+type+source_session_id
 		v1.GET("/vector/list_memory", api.ListMemoryFiles)
@@ -344,6 +400,14 @@ func main() {
 		// Global settings
 		v1.GET("/settings/compress", api.GetCompressSettings)
 		v1.PUT("/settings/compress", api.UpdateCompressSettings)
+		v1.GET("/settings/pool", api.GetPoolSettings)
+		v1.PUT("/settings/pool", api.UpdatePoolSettings)
+		v1.GET("/settings/vector_chunk", api.GetVectorChunkSettings)
+		v1.PUT("/settings/vector_chunk", api.UpdateVectorChunkSettings)
+		v1.GET("/settings/memory_consolidation", api.GetMemoryConsolidationSettings)
+		v1.PUT("/settings/memory_consolidation", api.UpdateMemoryConsolidationSettings)
+		v1.GET("/settings/vector_embedder", api.GetVectorEmbedderSettings)
+		v1.PUT("/settings/vector_embedder", api.UpdateVectorEmbedderSettings)
 
 		// System management (daemon, reload)
 		v1.POST("/shutdown", api.Shutdown)
@@ -385,17 +449,33 @@ func main() {
 
 		// Hooks (Issue #211: event hook system)
 		v1.GET("/hooks", api.ListHooks)
+		v1.GET("/hooks/events", api.ListHookEvents)
 		v1.GET("/hooks/:id", api.GetHook)
 		v1.POST("/hooks", api.CreateHook)
 		v1.PUT("/hooks/:id", api.UpdateHook)
 		v1.DELETE("/hooks/:id", api.DeleteHook)
 		v1.POST("/hooks/:id/enable", api.EnableHook)
 		v1.POST("/hooks/:id/disable", api.DisableHook)
+		v1.POST("/hooks/:id/test", api.TestHook)
 
 		// Changelog (Issue #212: memory change tracking)
 		v1.GET("/changelog", api.GetChangelog)
 		v1.POST("/changelog/rollback", api.RollbackChangelog)
 
+		// Memory consolidation: merge / conflict proposals awaiting review
+		v1.GET("/memory/proposals", api.ListMemoryProposals)
+		v1.GET("/memory/proposals/:id", api.GetMemoryProposal)
+		v1.POST("/memory/proposals/:id/approve", api.ApproveMemoryProposal)
+		v1.POST("/memory/proposals/:id/reject", api.RejectMemoryProposal)
+		v1.POST("/memory/consolidate", api.ConsolidateMemory)
+
+		// Memory lifecycle policies: expiry, decay, archival
+		v1.GET("/memory/policies", api.ListMemoryPolicies)
+		v1.PUT("/memory/policies", api.SaveMemoryPolicy)
+		v1.DELETE("/memory/policies/:id", api.DeleteMemoryPolicy)
+		v1.GET("/memory/policies/report", api.MemoryPolicyReport)
+		v1.POST("/memory/policies/run", api.RunMemoryPolicies)
+
 		// Shadow AI (Issue #215)
 		v1.GET("/shadow-ai/status", api.GetShadowAIStatus)
 		v1.POST("/shadow-ai/enable", api.EnableShadowAI)
@@ -414,10 +494,13 @@ func main() {
 	}
 
 	// WebSocket
-	r.GET("/ws/chat", api.HandleChat)
+	r.GET("/ws/chat", api.AuthMiddleware(), api.HandleChat)
 
 	// Static mount serving: /static/:alias/*filepath
-	r.GET("/static/:alias/*filepath", api.ServeStaticMount)
+	r.GET("/static/:alias/*filepath", api.AuthMiddleware(), api.ServeStaticMount)
+
+	// Browser login: /auth/login?token=xxx sets the auth cookie and redirects to /
+	r.GET("/auth/login", api.LoginPage)
 
 	// Serve new version (demo.html) at /new
 	r.GET("/new", func(c *gin.Context) {
@@ -492,7 +575,7 @@ func main() {
 	})
 
 	// Start trigger scheduler
-	core.StartTriggerLoop(*port)
+	core.StartTriggerLoop()
 
 	// Initialize service manager with WS callback
 	core.InitServiceManager(func(svc *model.Service) {
@@ -996,8 +1079,11 @@ func startService() {
 // stopService stops the service gracefully
 func stopService() {
 	// Try graceful shutdown via API first
-	client := &http.Client{Timeout: 2 * time.Second}
-	client.Post("http://localhost:9527/api/v1/shutdown", "application/json", nil)
+	hc := &http.Client{Timeout: 2 * time.Second}
+	if req, err := http.NewRequest("POST", "http://localhost:9527/api/v1/shutdown", nil); err == nil {
+		client.Authorize(req)
+		hc.Do(req)
+	}
 	time.Sleep(500 * time.Millisecond)
 
 	// Fallback to platform-specific stop
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/store"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ToolApprovalRecord is one human decision on a tool call (persisted in message metadata).
+type ToolApprovalRecord struct {
+	ID          string `json:"id"`
+	ToolName    string `json:"tool_name"`
+	ToolUseID   string `json:"tool_use_id,omitempty"`
+	Decision    string `json:"decision"` // "approved" | "denied" | "timeout" | "cancelled"
+	Reason      string `json:"reason,omitempty"`
+	DecidedBy   string `json:"decided_by,omitempty"`
+	RequestedAt string `json:"requested_at"`
+	DecidedAt   string `json:"decided_at"`
+}
+
+// pendingApproval is a tool call blocked in the permission prompt tool.
+type pendingApproval struct {
+	ID          string          `json:"id"`
+	SessionID   int64           `json:"session_id"`
+	ToolName    string          `json:"tool_name"`
+	ToolUseID   string          `json:"tool_use_id,omitempty"`
+	Input       json.RawMessage `json:"input"`
+	Status      string          `json:"status"` // "pending" | "approved" | "denied" | "timeout" | "cancelled"
+	Reason      string          `json:"reason,omitempty"`
+	DecidedBy   string          `json:"decided_by,omitempty"`
+	RequestedAt time.Time       `json:"requested_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+
+	decision chan approvalDecision
+}
+
+type approvalDecision struct {
+	Approve bool
+	Reason  string
+	By      string
+}
+
+var (
+	approvalsMu     sync.Mutex
+	approvals       = make(map[string]*pendingApproval)    // approval ID → pending call
+	approvalRecords = make(map[int64][]ToolApprovalRecord) // session ID → decisions of the running turn
+)
+
+// takeApprovalRecords returns and clears the decisions collected for a session.
+func takeApprovalRecords(sessionID int64) []ToolApprovalRecord {
+	approvalsMu.Lock()
+	defer approvalsMu.Unlock()
+	records := approvalRecords[sessionID]
+	delete(approvalRecords, sessionID)
+	return records
+}
+
+// withApprovalRecords merges approval decisions into the steps metadata JSON.
+func withApprovalRecords(metadataJSON string, records []ToolApprovalRecord) string {
+	if len(records) == 0 {
+		return metadataJSON
+	}
+	var meta StepsMetadata
+	if metadataJSON != "" {
+		json.Unmarshal([]byte(metadataJSON), &meta)
+	}
+	meta.Approvals = records
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return metadataJSON
+	}
+	return string(b)
+}
+
+// requestApproval publishes a pending tool call and blocks until a human
+// decides, the policy timeout expires, or the CLI hangs up (done closed).
+func requestApproval(sessionID int64, toolName, toolUseID string, input json.RawMessage, timeout time.Duration, done <-chan struct{}) approvalDecision {
+	now := time.Now()
+	p := &pendingApproval{
+		ID:          uuid.New().String()[:8],
+		SessionID:   sessionID,
+		ToolName:    toolName,
+		ToolUseID:   toolUseID,
+		Input:       input,
+		Status:      "pending",
+		RequestedAt: now,
+		ExpiresAt:   now.Add(timeout),
+		decision:    make(chan approvalDecision, 1),
+	}
+	approvalsMu.Lock()
+	approvals[p.ID] = p
+	approvalsMu.Unlock()
+
+	log.Printf("[approval] session %d: %s waiting for approval (id=%s, timeout=%s)", sessionID, toolName, p.ID, timeout)
+	broadcastApproval(p)
+	go notifyChannel(sessionID, fmt.Sprintf("【工具审批】会话 %d 请求执行 %s\n参数: %s\n审批ID: %s\n请在 AI Hub 界面处理，或执行 ai-hub approvals approve|deny %s（%d 秒后自动拒绝）",
+		sessionID, toolName, truncateRunes(string(input), 500), p.ID, p.ID, int(timeout.Seconds())))
+
+	var d approvalDecision
+	status := ""
+	select {
+	case d = <-p.decision:
+		status = "denied"
+		if d.Approve {
+			status = "approved"
+		}
+	case <-time.After(timeout):
+		status, d.Reason = "timeout", fmt.Sprintf("no decision within %s", timeout)
+	case <-done:
+		status, d.Reason = "cancelled", "turn stopped"
+	}
+
+	approvalsMu.Lock()
+	delete(approvals, p.ID)
+	p.Status, p.Reason, p.DecidedBy = status, d.Reason, d.By
+	approvalRecords[sessionID] = append(approvalRecords[sessionID], ToolApprovalRecord{
+		ID:          p.ID,
+		ToolName:    toolName,
+		ToolUseID:   toolUseID,
+		Decision:    status,
+		Reason:      d.Reason,
+		DecidedBy:   d.By,
+		RequestedAt: p.RequestedAt.Format(time.RFC3339),
+		DecidedAt:   time.Now().Format(time.RFC3339),
+	})
+	approvalsMu.Unlock()
+
+	log.Printf("[approval] session %d: %s %s (id=%s, by=%s)", sessionID, toolName, status, p.ID, d.By)
+	broadcastApproval(p)
+	return d
+}
+
+func broadcastApproval(p *pendingApproval) {
+	data, _ := json.Marshal(p)
+	broadcast(WSMessage{Type: "tool_approval", SessionID: p.SessionID, Content: string(data), ToolID: p.ToolUseID, ToolName: p.ToolName})
+}
+
+// ListApprovals handles GET /api/v1/approvals[?session_id=]
+func ListApprovals(c *gin.Context) {
+	sessionID, _ := strconv.ParseInt(c.Query("session_id"), 10, 64)
+	approvalsMu.Lock()
+	result := make([]*pendingApproval, 0, len(approvals))
+	for _, p := range approvals {
+		if sessionID == 0 || p.SessionID == sessionID {
+			result = append(result, p)
+		}
+	}
+	approvalsMu.Unlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].RequestedAt.Before(result[j].RequestedAt) })
+	c.JSON(http.StatusOK, result)
+}
+
+// DecideApproval handles POST /api/v1/approvals/:id {decision: "approve"|"deny", reason}
+func DecideApproval(c *gin.Context) {
+	by := "anonymous"
+	if info := authFrom(c); info != nil {
+		// An agent must not approve its own (or another session's) tool calls
+		if info.SessionID > 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "session tokens cannot decide approvals"})
+			return
+		}
+		by = info.Name
+	}
+	var req struct {
+		Decision string `json:"decision"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Decision != "approve" && req.Decision != "deny" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be approve or deny"})
+		return
+	}
+
+	approvalsMu.Lock()
+	p, ok := approvals[c.Param("id")]
+	if ok {
+		// Remove first so a second decision gets 404 instead of blocking
+		delete(approvals, p.ID)
+	}
+	approvalsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "approval not found or already decided"})
+		return
+	}
+	p.decision <- approvalDecision{Approve: req.Decision == "approve", Reason: strings.TrimSpace(req.Reason), By: by}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ---- Permission prompt MCP endpoint ----
+//
+// The Claude CLI is started with --permission-prompt-tool pointing at
+// approval_prompt on this endpoint (see core.approvalArgs). It is a minimal
+// streamable-HTTP MCP server: JSON-RPC over POST, plain JSON responses.
+
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+var approvalPromptToolDef = gin.H{
+	"name":        "approval_prompt",
+	"description": "Ask an AI Hub operator to approve or deny a tool call",
+	"inputSchema": gin.H{
+		"type": "object",
+		"properties": gin.H{
+			"tool_name":   gin.H{"type": "string"},
+			"input":       gin.H{"type": "object"},
+			"tool_use_id": gin.H{"type": "string"},
+		},
+		"required": []string{"tool_name", "input"},
+	},
+}
+
+// HandleApprovalMCP handles POST /api/v1/sessions/:id/approval-mcp
+func HandleApprovalMCP(c *gin.Context) {
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	var req mcpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, mcpError(nil, -32700, "parse error"))
+		return
+	}
+	// Notifications (no id) need no response
+	if len(req.ID) == 0 {
+		c.Status(http.StatusAccepted)
+		return
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.ProtocolVersion == "" {
+			params.ProtocolVersion = "2025-03-26"
+		}
+		c.JSON(http.StatusOK, mcpResult(req.ID, gin.H{
+			"protocolVersion": params.ProtocolVersion,
+			"capabilities":    gin.H{"tools": gin.H{}},
+			"serverInfo":      gin.H{"name": core.ApprovalMCPServer, "version": "1.0.0"},
+		}))
+	case "ping":
+		c.JSON(http.StatusOK, mcpResult(req.ID, gin.H{}))
+	case "tools/list":
+		c.JSON(http.StatusOK, mcpResult(req.ID, gin.H{"tools": []gin.H{approvalPromptToolDef}}))
+	case "tools/call":
+		var params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				ToolName  string          `json:"tool_name"`
+				Input     json.RawMessage `json:"input"`
+				ToolUseID string          `json:"tool_use_id"`
+			} `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Name != "approval_prompt" {
+			c.JSON(http.StatusOK, mcpError(req.ID, -32602, "unknown tool"))
+			return
+		}
+		args := params.Arguments
+		if len(args.Input) == 0 {
+			args.Input = json.RawMessage("{}")
+		}
+		c.JSON(http.StatusOK, mcpResult(req.ID, gin.H{
+			"content": []gin.H{{"type": "text", "text": approvalVerdict(c, sessionID, args.ToolName, args.ToolUseID, args.Input)}},
+		}))
+	default:
+		c.JSON(http.StatusOK, mcpError(req.ID, -32601, "method not found: "+req.Method))
+	}
+}
+
+// approvalVerdict decides a permission prompt and returns the JSON the CLI
+// expects: {"behavior":"allow","updatedInput":...} or {"behavior":"deny","message":...}.
+func approvalVerdict(c *gin.Context, sessionID int64, toolName, toolUseID string, input json.RawMessage) string {
+	deny := func(msg string) string {
+		b, _ := json.Marshal(gin.H{"behavior": "deny", "message": msg})
+		return string(b)
+	}
+	session, err := store.GetSession(sessionID)
+	if err != nil {
+		return deny("session not found")
+	}
+	policy := store.ResolveToolPolicy(sessionID, session.GroupName)
+	if !core.ApprovalRequired(policy, toolName) {
+		return deny(fmt.Sprintf("%s is not permitted by the session's tool policy", toolName))
+	}
+	d := requestApproval(sessionID, toolName, toolUseID, input, core.ApprovalTimeout(policy), c.Request.Context().Done())
+	if !d.Approve {
+		msg := "not approved"
+		if d.Reason != "" {
+			msg += ": " + d.Reason
+		}
+		return deny(msg)
+	}
+	b, _ := json.Marshal(gin.H{"behavior": "allow", "updatedInput": input})
+	return string(b)
+}
+
+func mcpResult(id json.RawMessage, result interface{}) gin.H {
+	return gin.H{"jsonrpc": "2.0", "id": id, "result": result}
+}
+
+func mcpError(id json.RawMessage, code int, msg string) gin.H {
+	return gin.H{"jsonrpc": "2.0", "id": id, "error": gin.H{"code": code, "message": msg}}
+}
@@ -0,0 +1,534 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authCookieName holds the token for browser clients (set by /auth/login),
+// so the SPA's plain fetch() calls and the WebSocket upgrade carry credentials.
+const authCookieName = "ai_hub_token"
+
+// Role levels: a route requiring level N accepts any token with level >= N.
+const (
+	levelPublic = iota
+	levelReadOnly
+	levelOperator
+	levelAdmin
+)
+
+var roleLevels = map[string]int{
+	model.RoleReadOnly: levelReadOnly,
+	model.RoleOperator: levelOperator,
+	model.RoleAdmin:    levelAdmin,
+}
+
+// publicRoutes need no token (IM platform callbacks carry their own verification).
+var publicRoutes = map[string]bool{
+	"GET /api/v1/version":         true,
+	"POST /api/v1/webhook/feishu": true,
+	"POST /api/v1/webhook/qq":     true,
+	"POST /api/v1/auth/login":     true,
+	"POST /api/v1/auth/logout":    true,
+	"GET /api/v1/auth/whoami":     true,
+}
+
+// adminRoutes expose credentials or control the whole instance.
+var adminRoutes = map[string]bool{
+	"POST /api/v1/providers":               true,
+	"PUT /api/v1/providers/:id":            true,
+	"PUT /api/v1/providers/:id/default":    true,
+	"DELETE /api/v1/providers/:id":         true,
+	"GET /api/v1/tokens":                   true,
+	"POST /api/v1/tokens":                  true,
+	"DELETE /api/v1/tokens/:id":            true,
+	"POST /api/v1/secrets/rotate-master":   true,
+	"POST /api/v1/shutdown":                true,
+	"POST /api/v1/status/retry-install":    true,
+	"POST /api/v1/system/install-dep":      true,
+	"GET /api/v1/export/session/:id":       true,
+	"GET /api/v1/export/team/:name":        true,
+	"POST /api/v1/import":                  true,
+	"PUT /api/v1/settings/compress":        true,
+	"PUT /api/v1/settings/pool":            true,
+	"PUT /api/v1/settings/vector_chunk":    true,
+	"PUT /api/v1/settings/vector_embedder": true,
+	"POST /api/v1/vector/benchmark":        true,
+	"POST /api/v1/vector/model/import":     true,
+	// Tool policies: a session token must not be able to loosen its own sandbox
+	"PUT /api/v1/sessions/:id/tool-policy":    true,
+	"DELETE /api/v1/sessions/:id/tool-policy": true,
+	"PUT /api/v1/groups/:name/tool-policy":    true,
+	"DELETE /api/v1/groups/:name/tool-policy": true,
+	// Memory consolidation and lifecycle policies rewrite, archive and delete memory files
+	"PUT /api/v1/settings/memory_consolidation": true,
+	"POST /api/v1/memory/proposals/:id/approve": true,
+	"POST /api/v1/memory/proposals/:id/reject":  true,
+	"POST /api/v1/memory/consolidate":           true,
+	"PUT /api/v1/memory/policies":               true,
+	"DELETE /api/v1/memory/policies/:id":        true,
+	"POST /api/v1/memory/policies/run":          true,
+	// Holiday lists apply to every trigger that references them
+	"PUT /api/v1/settings/trigger_calendars": true,
+}
+
+// readOnlyPosts are POST endpoints that only query data.
+var readOnlyPosts = map[string]bool{
+	"/api/v1/vector/search":        true,
+	"/api/v1/vector/search_memory": true,
+	"/api/v1/vector/read_memory":   true,
+	"/api/v1/vector/read":          true,
+	"/api/v1/vector/get_doc":       true,
+	"/api/v1/triggers/preview":     true,
+	"/api/v1/hooks/:id/test":       true,
+}
+
+// routeLevel returns the minimum role level for a matched route.
+func routeLevel(method, fullPath string) int {
+	key := method + " " + fullPath
+	switch {
+	case publicRoutes[key]:
+		return levelPublic
+	case adminRoutes[key]:
+		return levelAdmin
+	case method == http.MethodGet || method == http.MethodHead:
+		// Provider list carries API keys
+		if fullPath == "/api/v1/providers" {
+			return levelOperator
+		}
+		return levelReadOnly
+	case method == http.MethodPost && readOnlyPosts[fullPath]:
+		return levelReadOnly
+	}
+	return levelOperator
+}
+
+// AuthInfo describes the caller of the current request.
+type AuthInfo struct {
+	TokenID   int64  `json:"token_id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	SessionID int64  `json:"session_id"`         // >0 = session-scoped token
+	Internal  bool   `json:"internal,omitempty"` // in-process caller (core.InternalToken)
+}
+
+func authFrom(c *gin.Context) *AuthInfo {
+	if v, ok := c.Get("auth"); ok {
+		return v.(*AuthInfo)
+	}
+	return nil
+}
+
+// canOperate reports whether the caller may perform write actions on a
+// session (used by the WS handler, which has no per-message route).
+func canOperate(c *gin.Context, sessionID int64) bool {
+	info := authFrom(c)
+	if info == nil || roleLevels[info.Role] < levelOperator {
+		return false
+	}
+	return info.SessionID <= 0 || info.SessionID == sessionID
+}
+
+// extractToken reads the token from (in order) X-AI-Hub-Token, an
+// "Authorization: Bearer aih_..." header, the ?token= query, or the login cookie.
+// Bearer values without the aih_ prefix are ignored: on proxy routes that
+// header belongs to the upstream provider.
+func extractToken(c *gin.Context) string {
+	if tok := strings.TrimSpace(c.GetHeader(core.TokenHeader)); tok != "" {
+		return tok
+	}
+	if h := c.GetHeader("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		if tok := strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")); strings.HasPrefix(tok, core.TokenPrefix) {
+			return tok
+		}
+	}
+	if tok := c.Query("token"); tok != "" {
+		return tok
+	}
+	if tok, err := c.Cookie(authCookieName); err == nil {
+		return tok
+	}
+	return ""
+}
+
+// resolveToken maps a plaintext token to its caller identity.
+func resolveToken(tok string) *AuthInfo {
+	if tok == "" {
+		return nil
+	}
+	if core.IsInternalToken(tok) {
+		return &AuthInfo{Name: "internal", Role: model.RoleAdmin, Internal: true}
+	}
+	t, err := store.GetAPITokenByHash(core.HashToken(tok))
+	if err != nil {
+		return nil
+	}
+	if t.ExpiresAt != "" {
+		exp, err := time.ParseInLocation("2006-01-02 15:04:05", t.ExpiresAt, time.FixedZone("CST", 8*3600))
+		if err == nil && time.Now().After(exp) {
+			return nil
+		}
+	}
+	touchToken(t.ID)
+	return &AuthInfo{TokenID: t.ID, Name: t.Name, Role: t.Role, SessionID: t.SessionID}
+}
+
+var (
+	tokenTouched   = make(map[int64]time.Time)
+	tokenTouchedMu sync.Mutex
+)
+
+// touchToken updates last_used_at at most once a minute per token.
+func touchToken(id int64) {
+	tokenTouchedMu.Lock()
+	last := tokenTouched[id]
+	if time.Since(last) < time.Minute {
+		tokenTouchedMu.Unlock()
+		return
+	}
+	tokenTouched[id] = time.Now()
+	tokenTouchedMu.Unlock()
+	go store.TouchAPIToken(id)
+}
+
+// sessionTokenRoutes are the mutating routes a session-scoped token may call,
+// each with a check that the request acts on the token's own session; a nil
+// check marks a route not tied to a session (shared memory and notes the agent
+// maintains). Every other mutating route is denied.
+var sessionTokenRoutes = map[string]func(c *gin.Context, sessionID int64) bool{
+	"PUT /api/v1/sessions/:id":                 paramSession("id"),
+	"DELETE /api/v1/sessions/:id/messages":     paramSession("id"),
+	"POST /api/v1/sessions/:id/compress":       paramSession("id"),
+	"POST /api/v1/sessions/:id/reset":          paramSession("id"),
+	"POST /api/v1/sessions/:id/fork":           paramSession("id"),
+	"PUT /api/v1/sessions/:id/failover":        paramSession("id"),
+	"POST /api/v1/sessions/:id/approval-mcp":   paramSession("id"),
+	"PUT /api/v1/sessions/:id/attention":       paramSession("id"),
+	"PUT /api/v1/sessions/:id/attention-rules": paramSession("id"),
+	"PUT /api/v1/sessions/:id/health":          paramSession("id"),
+	"PUT /api/v1/session-rules/:id":            paramSession("id"),
+	"DELETE /api/v1/session-rules/:id":         paramSession("id"),
+	"POST /api/v1/chat/send":                   chatSession,
+	"POST /api/v1/triggers":                    requestSession,
+	"PUT /api/v1/triggers/:id":                 triggerSession,
+	"DELETE /api/v1/triggers/:id":              triggerSession,
+	"POST /api/v1/shadow-ai/activity":          shadowSession,
+	"POST /api/v1/vector/write_memory":         nil,
+	"POST /api/v1/vector/write":                nil,
+	"POST /api/v1/vector/delete_memory":        nil,
+	"POST /api/v1/vector/delete":               nil,
+	"POST /api/v1/vector/update_metadata":      nil,
+	"PUT /api/v1/structured-memory/:category":  nil,
+	"PUT /api/v1/files/content":                fileScope,
+	"DELETE /api/v1/files":                     fileScope,
+	"POST /api/v1/injection-router":            shadowSession,
+}
+
+func paramSession(name string) func(c *gin.Context, sessionID int64) bool {
+	return func(c *gin.Context, sessionID int64) bool {
+		return c.Param(name) == strconv.FormatInt(sessionID, 10)
+	}
+}
+
+// requestSession checks session_id in the query or the JSON body.
+func requestSession(c *gin.Context, sessionID int64) bool {
+	if sid := c.Query("session_id"); sid != "" {
+		return sid == strconv.FormatInt(sessionID, 10)
+	}
+	var req struct {
+		SessionID int64 `json:"session_id"`
+	}
+	peekJSON(c, &req)
+	return req.SessionID == sessionID
+}
+
+// chatSession checks /chat/send: the session's own, or session_id 0, which
+// creates a new session (ai-hub send 0).
+func chatSession(c *gin.Context, sessionID int64) bool {
+	var req struct {
+		SessionID int64 `json:"session_id"`
+	}
+	peekJSON(c, &req)
+	return req.SessionID == 0 || req.SessionID == sessionID
+}
+
+// triggerSession checks that the trigger in :id belongs to the session and
+// that an update does not move it to another one.
+func triggerSession(c *gin.Context, sessionID int64) bool {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	t, err := store.GetTrigger(id)
+	if err != nil || t.SessionID != sessionID {
+		return false
+	}
+	var req struct {
+		SessionID *int64 `json:"session_id"`
+	}
+	peekJSON(c, &req)
+	return req.SessionID == nil || *req.SessionID == sessionID
+}
+
+// shadowSession lets only the shadow AI session report shadow activity.
+func shadowSession(c *gin.Context, sessionID int64) bool {
+	return loadShadowStatus().SessionID == sessionID
+}
+
+// fileScope limits file writes and deletes to notes (ai-hub notes) and, for
+// the shadow AI session, its own files under memory/shadow/.
+func fileScope(c *gin.Context, sessionID int64) bool {
+	scope, p := c.Query("scope"), c.Query("path")
+	if c.Request.Method != http.MethodDelete {
+		var req FileContentRequest
+		peekJSON(c, &req)
+		scope, p = req.Scope, req.Path
+	}
+	if !validatePath(p) {
+		return false
+	}
+	p = path.Clean("/" + p)[1:]
+	switch {
+	case scope == "notes" && strings.HasPrefix(p, "notes/"):
+		return true
+	case scope != "rules" && strings.HasPrefix(p, "memory/shadow/"):
+		return shadowSession(c, sessionID)
+	}
+	return false
+}
+
+// peekJSON decodes the JSON body into v and restores it for the handler.
+func peekJSON(c *gin.Context, v interface{}) {
+	if c.Request.Body == nil {
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err == nil {
+		json.Unmarshal(body, v)
+	}
+}
+
+// sessionScopeOK restricts session-scoped tokens: they may read anything an
+// operator can and use only their own session's Anthropic proxy route;
+// mutating routes must be in sessionTokenRoutes and act on their own session.
+func sessionScopeOK(c *gin.Context, info *AuthInfo) bool {
+	if info.SessionID <= 0 {
+		return true
+	}
+	path := c.FullPath()
+	switch path {
+	case "/api/v1/proxy/s/:session_id/anthropic/*path":
+		return c.Param("session_id") == strconv.FormatInt(info.SessionID, 10)
+	case "/api/v1/proxy/anthropic/*path":
+		return c.Query("session_id") == strconv.FormatInt(info.SessionID, 10)
+	}
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead ||
+		(c.Request.Method == http.MethodPost && readOnlyPosts[path]) {
+		return true
+	}
+	check, ok := sessionTokenRoutes[c.Request.Method+" "+path]
+	if !ok {
+		return false
+	}
+	return check == nil || check(c, info.SessionID)
+}
+
+// AuthMiddleware enforces token authentication and role checks.
+// The required role is derived from the matched route (see routeLevel).
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !core.AuthEnabled() {
+			c.Set("auth", &AuthInfo{Name: "anonymous", Role: model.RoleAdmin})
+			c.Next()
+			return
+		}
+		level := routeLevel(c.Request.Method, c.FullPath())
+		info := resolveToken(extractToken(c))
+		if info != nil {
+			c.Set("auth", info)
+		}
+		if level == levelPublic {
+			c.Next()
+			return
+		}
+		if info == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized: missing or invalid token"})
+			return
+		}
+		if roleLevels[info.Role] < level {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden: role " + info.Role + " is not allowed to " + c.Request.Method + " " + c.FullPath()})
+			return
+		}
+		if !sessionScopeOK(c, info) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden: session token may only modify its own session (" + c.Request.Method + " " + c.FullPath() + ")"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// IsAllowedOrigin accepts requests without Origin (CLI, curl), same-host
+// origins, and origins listed in AI_HUB_ALLOWED_ORIGINS (comma-separated, "*" = any).
+func IsAllowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range strings.Split(os.Getenv("AI_HUB_ALLOWED_ORIGINS"), ",") {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "*" || (o != "" && strings.EqualFold(o, origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+func setAuthCookie(c *gin.Context, tok string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     authCookieName,
+		Value:    tok,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   c.Request.TLS != nil,
+	})
+}
+
+// LoginPage GET /auth/login?token=xxx — stores the token in a cookie and
+// redirects to the UI. Convenience entry for the URL printed at startup.
+func LoginPage(c *gin.Context) {
+	tok := c.Query("token")
+	if resolveToken(tok) == nil {
+		c.String(http.StatusUnauthorized, "invalid token")
+		return
+	}
+	setAuthCookie(c, tok, 30*24*3600)
+	c.Redirect(http.StatusFound, "/")
+}
+
+// Login POST /api/v1/auth/login {token}
+func Login(c *gin.Context) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	info := resolveToken(strings.TrimSpace(req.Token))
+	if info == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	setAuthCookie(c, strings.TrimSpace(req.Token), 30*24*3600)
+	c.JSON(http.StatusOK, info)
+}
+
+// Logout POST /api/v1/auth/logout
+func Logout(c *gin.Context) {
+	setAuthCookie(c, "", -1)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// WhoAmI GET /api/v1/auth/whoami
+func WhoAmI(c *gin.Context) {
+	info := authFrom(c)
+	if info == nil {
+		c.JSON(http.StatusOK, gin.H{"authenticated": false, "auth_enabled": core.AuthEnabled()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authenticated": true, "auth_enabled": core.AuthEnabled(), "identity": info})
+}
+
+// ListAPITokens GET /api/v1/tokens
+func ListAPITokens(c *gin.Context) {
+	list, err := store.ListAPITokens()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = []model.APIToken{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// CreateAPIToken POST /api/v1/tokens {name, role, expires_in}
+// The plaintext token is only returned in this response.
+func CreateAPIToken(c *gin.Context) {
+	var req struct {
+		Name      string `json:"name"`
+		Role      string `json:"role"`
+		ExpiresIn string `json:"expires_in"` // Go duration, e.g. "720h"; empty = never
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name required"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.RoleReadOnly
+	}
+	if _, ok := roleLevels[req.Role]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role. Valid: admin, operator, readonly"})
+		return
+	}
+	plain, hash := core.GenerateToken()
+	t := &model.APIToken{
+		Name:      strings.TrimSpace(req.Name),
+		Role:      req.Role,
+		Prefix:    plain[:len(core.TokenPrefix)+6],
+		TokenHash: hash,
+	}
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid expires_in duration"})
+			return
+		}
+		t.ExpiresAt = time.Now().Add(d).In(time.FixedZone("CST", 8*3600)).Format("2006-01-02 15:04:05")
+	}
+	if err := store.CreateAPIToken(t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": plain, "info": t})
+}
+
+// DeleteAPIToken DELETE /api/v1/tokens/:id
+func DeleteAPIToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if info := authFrom(c); info != nil && info.TokenID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot revoke the token used for this request"})
+		return
+	}
+	if err := store.DeleteAPIToken(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
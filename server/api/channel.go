@@ -1,6 +1,7 @@
 package api
 
 import (
+	"ai-hub/server/core"
 	"ai-hub/server/model"
 	"ai-hub/server/store"
 	"encoding/json"
@@ -24,6 +25,9 @@ func ListChannels(c *gin.Context) {
 	if list == nil {
 		list = []model.Channel{}
 	}
+	for i := range list {
+		list[i].Config = store.MaskChannelConfig(list[i].Config)
+	}
 	c.JSON(http.StatusOK, list)
 }
 
@@ -44,7 +48,9 @@ func CreateChannel(c *gin.Context) {
 		return
 	}
 	QQWSMgr.OnChannelCreated(&ch)
-	c.JSON(http.StatusOK, ch)
+	resp := ch
+	resp.Config = store.MaskChannelConfig(ch.Config)
+	c.JSON(http.StatusOK, resp)
 }
 
 // UpdateChannel PUT /api/v1/channels/:id
@@ -80,7 +86,8 @@ func UpdateChannel(c *gin.Context) {
 		existing.SessionID = *req.SessionID
 	}
 	if req.Config != nil {
-		existing.Config = *req.Config
+		// Masked secrets sent back unchanged keep their stored value
+		existing.Config = store.UnmaskChannelConfig(*req.Config, existing.Config)
 	}
 	if req.Enabled != nil {
 		existing.Enabled = *req.Enabled
@@ -90,7 +97,9 @@ func UpdateChannel(c *gin.Context) {
 		return
 	}
 	QQWSMgr.OnChannelUpdated(existing)
-	c.JSON(http.StatusOK, existing)
+	resp := *existing
+	resp.Config = store.MaskChannelConfig(existing.Config)
+	c.JSON(http.StatusOK, resp)
 }
 
 // DeleteChannel DELETE /api/v1/channels/:id
@@ -202,7 +211,8 @@ func HandleFeishuWebhook(c *gin.Context) {
 	log.Printf("[webhook/feishu] forwarding to session %d: %s", ch.SessionID, text)
 
 	// Forward to bound session via internal SendChat logic
-	forwardToSession(ch.SessionID, forwarded)
+	rememberChannelOrigin(ch.SessionID, channelOrigin{ChannelID: ch.ID, Platform: "feishu", TargetID: chatID})
+	forwardToSession(ch.SessionID, ch.ID, "feishu", text, forwarded)
 
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
@@ -231,7 +241,7 @@ func handleFeishuEventV1(c *gin.Context, raw map[string]interface{}) {
 	// Remove @bot mention prefix if present
 	text = strings.TrimSpace(text)
 	forwarded := fmt.Sprintf("【飞书消息】\n内容: %s\n---\n频道凭证（用于回复）:\n%s", text, extractChannelCredentials(ch))
-	forwardToSession(ch.SessionID, forwarded)
+	forwardToSession(ch.SessionID, ch.ID, "feishu", text, forwarded)
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
@@ -411,7 +421,8 @@ func HandleQQWebhook(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 		return
 	}
-	forwardToSession(targetSession, forwarded)
+	rememberChannelOrigin(targetSession, qqOrigin(ch.ID, msgType, groupID, userID))
+	forwardToSession(targetSession, ch.ID, "qq", message, forwarded)
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
@@ -427,24 +438,31 @@ func jsonNumber(v interface{}) string {
 	}
 }
 
-// forwardToSession sends a message to a session, triggering AI processing
-func forwardToSession(sessionID int64, content string) {
-	session, err := store.GetSession(sessionID)
+// forwardToSession sends a channel message (text wrapped as content) to a
+// session, triggering AI processing (queued if the session is busy)
+func forwardToSession(sessionID, channelID int64, platform, text, content string) {
+	result, err := core.Dispatch(core.DispatchRequest{
+		SessionID: sessionID,
+		Content:   content,
+		Source:    core.SourceChannel,
+		SourceID:  channelID,
+		Priority:  core.PriorityChannel,
+	})
 	if err != nil {
-		log.Printf("[webhook] session %d not found: %v", sessionID, err)
-		return
-	}
-	// Save user message (even if busy — queue processing will pick it up)
-	msg := &model.Message{SessionID: session.ID, Role: "user", Content: content}
-	if err := store.AddMessage(msg); err != nil {
-		log.Printf("[webhook] save message failed: %v", err)
-		return
-	}
-	if IsSessionStreaming(session.ID) {
-		log.Printf("[webhook] session %d is streaming, message queued (msg_id=%d)", sessionID, msg.ID)
-		broadcast(WSMessage{Type: "message_queued", SessionID: session.ID, Content: content})
-		return
-	}
-	// Kick off streaming
-	go runStream(session, content, false, msg.ID)
+		log.Printf("[webhook] session %d: %v", sessionID, err)
+		return
+	}
+	if result.Status == "queued" {
+		log.Printf("[webhook] session %d is streaming, message queued (msg_id=%d)", sessionID, result.MessageID)
+	}
+	go core.FireHooks(core.HookEvent{
+		Type:            "channel.message",
+		SourceSessionID: sessionID,
+		Content:         text,
+		Source:          core.SourceChannel,
+		Vars: map[string]string{
+			"channel_id": strconv.FormatInt(channelID, 10),
+			"platform":   platform,
+		},
+	})
 }
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"ai-hub/server/store"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// channelOrigin is where a session's latest channel message came from, so the
+// hub itself can push notices (e.g. approval requests) back to that chat.
+type channelOrigin struct {
+	ChannelID int64
+	Platform  string // "feishu" | "qq"
+	ChatType  string // QQ: "group" | "private"
+	TargetID  string // Feishu chat_id, QQ group_id / user_id
+}
+
+var (
+	channelOriginsMu sync.Mutex
+	channelOrigins   = make(map[int64]channelOrigin) // hub session ID → last origin
+)
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// rememberChannelOrigin records the chat a forwarded message came from.
+func rememberChannelOrigin(sessionID int64, o channelOrigin) {
+	if sessionID <= 0 || o.TargetID == "" {
+		return
+	}
+	channelOriginsMu.Lock()
+	channelOrigins[sessionID] = o
+	channelOriginsMu.Unlock()
+}
+
+// qqOrigin builds the origin for a OneBot message (group or private).
+func qqOrigin(channelID int64, msgType, groupID, userID string) channelOrigin {
+	if msgType == "group" {
+		return channelOrigin{ChannelID: channelID, Platform: "qq", ChatType: "group", TargetID: groupID}
+	}
+	return channelOrigin{ChannelID: channelID, Platform: "qq", ChatType: "private", TargetID: userID}
+}
+
+// notifyChannel sends text to the chat that last talked to the session.
+// Best-effort: sessions without a channel origin are skipped silently.
+func notifyChannel(sessionID int64, text string) {
+	channelOriginsMu.Lock()
+	o, ok := channelOrigins[sessionID]
+	channelOriginsMu.Unlock()
+	if !ok {
+		return
+	}
+	ch, err := store.GetChannel(o.ChannelID)
+	if err != nil {
+		log.Printf("[notify] session %d: channel %d not found: %v", sessionID, o.ChannelID, err)
+		return
+	}
+	var cfg map[string]interface{}
+	json.Unmarshal([]byte(ch.Config), &cfg)
+
+	switch o.Platform {
+	case "qq":
+		err = notifyQQ(cfg, o, text)
+	case "feishu":
+		err = notifyFeishu(cfg, o, text)
+	}
+	if err != nil {
+		log.Printf("[notify] session %d: %s send failed: %v", sessionID, o.Platform, err)
+	}
+}
+
+// notifyQQ sends via the NapCat (OneBot 11) HTTP API.
+func notifyQQ(cfg map[string]interface{}, o channelOrigin, text string) error {
+	base, _ := cfg["napcat_http_url"].(string)
+	if base == "" {
+		return fmt.Errorf("napcat_http_url not configured")
+	}
+	action, payload := "send_private_msg", map[string]interface{}{"user_id": o.TargetID, "message": text}
+	if o.ChatType == "group" {
+		action, payload = "send_group_msg", map[string]interface{}{"group_id": o.TargetID, "message": text}
+	}
+	headers := map[string]string{}
+	if token, _ := cfg["token"].(string); token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	_, err := postJSON(strings.TrimRight(base, "/")+"/"+action, payload, headers)
+	return err
+}
+
+// notifyFeishu sends a text message to the chat via the Open API.
+func notifyFeishu(cfg map[string]interface{}, o channelOrigin, text string) error {
+	appID, _ := cfg["app_id"].(string)
+	appSecret, _ := cfg["app_secret"].(string)
+	if appID == "" || appSecret == "" {
+		return fmt.Errorf("app_id / app_secret not configured")
+	}
+	body, err := postJSON("https://open.feishu.cn/open-apis/auth/v3/tenant_access_token/internal",
+		map[string]string{"app_id": appID, "app_secret": appSecret}, nil)
+	if err != nil {
+		return err
+	}
+	var tok struct {
+		Code              int    `json:"code"`
+		Msg               string `json:"msg"`
+		TenantAccessToken string `json:"tenant_access_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.Code != 0 {
+		return fmt.Errorf("tenant_access_token: code=%d %s", tok.Code, tok.Msg)
+	}
+	content, _ := json.Marshal(map[string]string{"text": text})
+	_, err = postJSON("https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=chat_id",
+		map[string]string{"receive_id": o.TargetID, "msg_type": "text", "content": string(content)},
+		map[string]string{"Authorization": "Bearer " + tok.TenantAccessToken})
+	return err
+}
+
+func postJSON(url string, payload interface{}, headers map[string]string) ([]byte, error) {
+	data, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode >= 300 {
+		return body, fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncateRunes(string(body), 200))
+	}
+	return body, nil
+}
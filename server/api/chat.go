@@ -6,6 +6,7 @@ import (
 	"ai-hub/server/store"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -22,7 +23,7 @@ import (
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	CheckOrigin: IsAllowedOrigin,
 }
 
 // RawRequestSnapshot holds the last raw request sent to Claude Code CLI for a session.
@@ -36,7 +37,7 @@ type RawRequestSnapshot struct {
 var lastRawRequests sync.Map
 
 type WSMessage struct {
-	Type      string `json:"type"` // "chat" | "stop" | "subscribe" | "error" | "chunk" | "thinking" | "tool_start" | "tool_input" | "tool_result" | "done" | "session_created" | "streaming_status" | "session_update"
+	Type      string `json:"type"` // "chat" | "stop" | "subscribe" | "error" | "chunk" | "thinking" | "tool_start" | "tool_input" | "tool_result" | "done" | "session_created" | "streaming_status" | "session_update" | "failover" | "queue" | "tool_approval"
 	SessionID int64  `json:"session_id"`
 	Content   string `json:"content"`
 	Detail    string `json:"detail,omitempty"` // Optional detail content for attention_status
@@ -123,6 +124,13 @@ func BroadcastProcessState(hubSessionID int64, alive bool, state string) {
 	broadcast(WSMessage{Type: "process_update", SessionID: hubSessionID, Content: content})
 }
 
+// BroadcastQueueStatus pushes a session's position in the process pool queue
+// (content: core.QueueInfo JSON; position 0 = no longer queued).
+func BroadcastQueueStatus(hubSessionID int64, info core.QueueInfo) {
+	data, _ := json.Marshal(info)
+	broadcast(WSMessage{Type: "queue", SessionID: hubSessionID, Content: string(data)})
+}
+
 // BroadcastRaw sends a raw WS message with given type and content.
 func BroadcastRaw(msgType string, content string) {
 	broadcast(WSMessage{Type: msgType, Content: content})
@@ -191,7 +199,6 @@ func (s *ActiveStream) Cancel() {
 }
 
 var (
-	claudeClient    = core.NewClaudeCodeClient()
 	activeStreams   = make(map[int64]*ActiveStream)
 	activeStreamsMu sync.RWMutex
 	forceFreshMu    sync.Mutex
@@ -268,7 +275,7 @@ func HandleChat(c *gin.Context) {
 
 		switch msg.Type {
 		case "stop":
-			if subscribedSessionID > 0 {
+			if subscribedSessionID > 0 && canOperate(c, subscribedSessionID) {
 				activeStreamsMu.RLock()
 				stream, ok := activeStreams[subscribedSessionID]
 				activeStreamsMu.RUnlock()
@@ -317,6 +324,18 @@ func SendChat(c *gin.Context) {
 	var session *model.Session
 	isNewSession := req.SessionID == 0
 
+	// A session token's new sessions inherit its group, provider, work dir and
+	// tool policy, so a restricted session cannot start an unrestricted one.
+	var parent *model.Session
+	if info := authFrom(c); info != nil && info.SessionID > 0 && isNewSession {
+		var err error
+		if parent, err = store.GetSession(info.SessionID); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "session token's session not found"})
+			return
+		}
+		req.GroupName, req.ProviderID, req.WorkDir = parent.GroupName, parent.ProviderID, parent.WorkDir
+	}
+
 	if isNewSession {
 		var providerID string
 		if req.ProviderID != "" {
@@ -342,6 +361,15 @@ func SendChat(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "create session failed: " + err.Error()})
 			return
 		}
+		if parent != nil {
+			if p := store.GetToolPolicy(store.PolicyScopeSession, strconv.FormatInt(parent.ID, 10)); p != nil {
+				if err := store.SetToolPolicy(store.PolicyScopeSession, strconv.FormatInt(session.ID, 10), p); err != nil {
+					store.DeleteSession(session.ID)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "copy tool policy failed: " + err.Error()})
+					return
+				}
+			}
+		}
 		// Broadcast new session to all connected clients
 		sessionJSON, _ := json.Marshal(session)
 		broadcast(WSMessage{Type: "session_created", SessionID: session.ID, Content: string(sessionJSON)})
@@ -360,80 +388,55 @@ func SendChat(c *gin.Context) {
 			os.WriteFile(sessionRulesPath(session.ID), []byte(req.SessionRules), 0644)
 		}
 	} else {
-		var err error
-		session, err = store.GetSession(req.SessionID)
+		session, err := store.GetSession(req.SessionID)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
 			return
 		}
-
-		// Attention system V2: use shadow session flow when enabled
-		originalContent := req.Content
-		if session.AttentionEnabled {
-			// Check if session is already streaming
-			if IsSessionStreaming(session.ID) {
-				c.JSON(http.StatusConflict, gin.H{"error": "session is busy (attention mode)"})
-				return
-			}
-			// V3: Don't save user message here, let the flow save it at the end (clean sync)
-			// Kick off attention mode v3 flow in background
-			go runAttentionV3Flow(session, originalContent)
-			c.JSON(http.StatusOK, gin.H{
-				"session_id": session.ID,
-				"status":     "started",
-				"mode":       "attention_v3",
-			})
-			return
-		}
-
-		// Check if session is already streaming — queue message instead of rejecting
-		if IsSessionStreaming(session.ID) {
-			userMsg := &model.Message{
-				SessionID: session.ID,
-				Role:      "user",
-				Content:   req.Content,
-			}
-			if err := store.AddMessage(userMsg); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "save message failed: " + err.Error()})
-				return
-			}
-			log.Printf("[chat] session %d is streaming, message queued (msg_id=%d)", session.ID, userMsg.ID)
-			// Broadcast queued message so frontend displays it
-			broadcast(WSMessage{Type: "message_queued", SessionID: session.ID, Content: originalContent})
-			c.JSON(http.StatusOK, gin.H{
-				"session_id": session.ID,
-				"status":     "queued",
-			})
+		result, err := deliverMessage(session, req.Content, "", 0, sendPriority(c))
+		if errors.Is(err, core.ErrSessionBusy) {
+			c.JSON(http.StatusConflict, gin.H{"error": "session is busy (attention mode)"})
 			return
 		}
-		userMsg := &model.Message{
-			SessionID: session.ID,
-			Role:      "user",
-			Content:   req.Content,
-		}
-		if err := store.AddMessage(userMsg); err != nil {
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "save message failed: " + err.Error()})
 			return
 		}
+		c.JSON(http.StatusOK, result)
+		return
 	}
 
-	// Fire message.received hooks (for both new and existing sessions)
-	go fireMessageReceivedHook(session.ID, req.Content)
+	// Fire message.received hooks
+	go fireMessageReceivedHook(session.ID, req.Content, "")
 
 	// Kick off streaming in background — results are pushed via WS broadcast
 	triggerMsgID := store.GetLastUserMessageID(session.ID)
-	go runStream(session, req.Content, isNewSession, triggerMsgID)
+	go runStream(session, req.Content, isNewSession, triggerMsgID, sendPriority(c))
 
 	c.JSON(http.StatusOK, gin.H{
 		"session_id": session.ID,
 		"status":     "started",
+		"message_id": triggerMsgID,
 	})
 }
 
-// runStream executes the AI streaming in background, pushing events via WS to subscribed clients
-func runStream(session *model.Session, query string, isNewSession bool, triggerMsgID int64) {
+// sendPriority maps the caller of /chat/send to a process pool priority:
+// in-process callers use the internal token, other sessions use
+// session-scoped tokens; both queue behind interactive chats.
+func sendPriority(c *gin.Context) int {
+	info := authFrom(c)
+	if info != nil && (info.Internal || info.SessionID > 0) {
+		return core.PriorityBackground
+	}
+	return core.PriorityInteractive
+}
+
+// runStream executes the AI streaming in background, pushing events via WS to subscribed clients.
+// priority orders the turn in the process pool queue when the pool is full.
+func runStream(session *model.Session, query string, isNewSession bool, triggerMsgID int64, priority int) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	ctx = core.WithPriority(ctx, priority)
 
 	// Start with a no-op send — a client will attach via "subscribe"
 	stream := &ActiveStream{sendFn: func(WSMessage) {}, cancelFn: cancel}
@@ -443,13 +446,17 @@ func runStream(session *model.Session, query string, isNewSession bool, triggerM
 	activeStreams[session.ID] = stream
 	activeStreamsMu.Unlock()
 	broadcast(WSMessage{Type: "session_update", SessionID: session.ID, Content: "streaming"})
+	// Turn events carry the source of the message that started the turn
+	turnSource := store.GetMessageSource(triggerMsgID)
+	core.SetTurnSource(session.ID, turnSource)
 	defer func() {
+		core.ClearTurnSource(session.ID)
 		activeStreamsMu.Lock()
 		delete(activeStreams, session.ID)
 		activeStreamsMu.Unlock()
 		broadcast(WSMessage{Type: "session_update", SessionID: session.ID, Content: "idle"})
 		// Process any messages that were queued while streaming
-		processQueuedMessages(session.ID, triggerMsgID)
+		processQueuedMessages(session.ID, triggerMsgID, priority)
 	}()
 
 	provider, err := store.GetProvider(session.ProviderID)
@@ -492,6 +499,12 @@ func runStream(session *model.Session, query string, isNewSession bool, triggerM
 	log.Printf("[chat] session=%d provider=%s mode=%s model=%s base_url=%s",
 		session.ID, provider.Name, provider.Mode, provider.ModelID, provider.BaseURL)
 
+	restoreBefore := triggerMsgID
+	if restoreBefore <= 0 {
+		restoreBefore = progressMsgID
+	}
+	restorePrimaryProvider(session, restoreBefore)
+
 	// One-shot recovery seed after session reset actions.
 	if seed := takePendingRecoverySeed(session.ID); strings.TrimSpace(seed) != "" {
 		query = seed + "\n\n---\n\n" + query
@@ -505,9 +518,13 @@ func runStream(session *model.Session, query string, isNewSession bool, triggerM
 	if consumeForceFreshRun(session.ID) {
 		isResume = false
 	}
-	fullResponse, metadataJSON, usageInput, usageOutput, usageCacheCreation, usageCacheRead, err = streamClaudeCode(ctx, provider, query, session.ClaudeSessionID, isResume, stream.Send, session.ID, session.WorkDir, session.GroupName, progressMsgID)
+	takeApprovalRecords(session.ID) // drop leftovers of an aborted turn
+	turn := streamWithFailover(ctx, session, provider, query, isResume, stream.Send, progressMsgID)
+	provider = turn.Provider
+	fullResponse, metadataJSON, err = turn.FullResponse, withApprovalRecords(turn.MetadataJSON, takeApprovalRecords(session.ID)), turn.Err
+	usageInput, usageOutput, usageCacheCreation, usageCacheRead = turn.UsageInput, turn.UsageOutput, turn.UsageCacheCreation, turn.UsageCacheRead
 
-	log.Printf("[chat-flow] session=%d streamClaudeCode returned: err=%v, fullResponse_len=%d, metadata_len=%d",
+	log.Printf("[chat-flow] session=%d streamWithFailover returned: err=%v, fullResponse_len=%d, metadata_len=%d",
 		session.ID, err, len(fullResponse), len(metadataJSON))
 
 	if err != nil {
@@ -541,6 +558,17 @@ func runStream(session *model.Session, query string, isNewSession bool, triggerM
 			broadcast(WSMessage{Type: "chunk", SessionID: session.ID, Content: errContent})
 		}
 		broadcast(WSMessage{Type: "error", SessionID: session.ID, Content: err.Error()})
+		go core.FireHooks(core.HookEvent{
+			Type:            "stream.failed",
+			SourceSessionID: session.ID,
+			Content:         err.Error(),
+			Source:          turnSource,
+			Vars: map[string]string{
+				"message_id":       strconv.FormatInt(progressMsgID, 10),
+				"provider":         provider.Name,
+				"partial_response": fullResponse,
+			},
+		})
 		return
 	}
 
@@ -584,14 +612,29 @@ func runStream(session *model.Session, query string, isNewSession bool, triggerM
 		store.DeleteMessage(progressMsgID)
 	}
 
+	go core.FireHooks(core.HookEvent{
+		Type:            "stream.completed",
+		SourceSessionID: session.ID,
+		Content:         fullResponse,
+		Source:          turnSource,
+		Vars: map[string]string{
+			"message_id":            strconv.FormatInt(progressMsgID, 10),
+			"provider":              provider.Name,
+			"input_tokens":          strconv.FormatInt(usageInput, 10),
+			"output_tokens":         strconv.FormatInt(usageOutput, 10),
+			"cache_read_tokens":     strconv.FormatInt(usageCacheRead, 10),
+			"cache_creation_tokens": strconv.FormatInt(usageCacheCreation, 10),
+		},
+	})
+
 	// Broadcast done so even reconnected/new WS clients receive it (stream.Send is single-client)
 	log.Printf("[chat-flow] session=%d broadcasting done event", session.ID)
 	broadcast(WSMessage{Type: "done", SessionID: session.ID, Content: metadataJSON})
 }
 
 // processQueuedMessages checks for user messages that arrived after triggerMsgID,
-// merges them, and kicks off a new runStream to process them.
-func processQueuedMessages(sessionID int64, triggerMsgID int64) {
+// merges them, and kicks off a new runStream (same priority) to process them.
+func processQueuedMessages(sessionID int64, triggerMsgID int64, priority int) {
 	pending, err := store.GetPendingUserMessages(sessionID, triggerMsgID)
 	if err != nil || len(pending) == 0 {
 		return
@@ -608,7 +651,14 @@ func processQueuedMessages(sessionID int64, triggerMsgID int64) {
 		return
 	}
 
-	// Merge all pending messages into one query
+	// Merge the pending messages that share the first one's source into one
+	// query: the turn carries a single source, which the hook loop guard
+	// relies on. Later messages stay queued for the next round.
+	n := 1
+	for n < len(pending) && pending[n].Source == pending[0].Source {
+		n++
+	}
+	pending = pending[:n]
 	var contents []string
 	for _, m := range pending {
 		contents = append(contents, m.Content)
@@ -620,21 +670,24 @@ func processQueuedMessages(sessionID int64, triggerMsgID int64) {
 	newTriggerMsgID := pending[len(pending)-1].ID
 
 	log.Printf("[queue] session %d: processing %d queued message(s), triggerMsgID %d -> %d", sessionID, len(pending), triggerMsgID, newTriggerMsgID)
-	go runStream(session, merged, false, newTriggerMsgID)
+	go runStream(session, merged, false, newTriggerMsgID, priority)
 }
 
 // StepInfo represents a single execution step for metadata persistence
 type StepInfo struct {
-	Type   string `json:"type"`             // "thinking" | "tool"
-	Name   string `json:"name,omitempty"`   // tool name
-	Input  string `json:"input,omitempty"`  // tool input summary
-	Status string `json:"status,omitempty"` // "done"
+	Type   string `json:"type"`              // "thinking" | "tool"
+	Name   string `json:"name,omitempty"`    // tool name
+	Input  string `json:"input,omitempty"`   // tool input summary
+	Status string `json:"status,omitempty"`  // "done"
+	ToolID string `json:"tool_id,omitempty"` // tool_use_id, key into tool_calls
 }
 
 // StepsMetadata is the JSON structure stored in message.metadata
 type StepsMetadata struct {
-	Steps    []StepInfo `json:"steps"`
-	Thinking string     `json:"thinking,omitempty"` // truncated thinking summary
+	Steps     []StepInfo           `json:"steps"`
+	Thinking  string               `json:"thinking,omitempty"`  // truncated thinking summary
+	Failover  []FailoverHop        `json:"failover,omitempty"`  // retry / provider failover hops
+	Approvals []ToolApprovalRecord `json:"approvals,omitempty"` // human decisions on tool calls
 }
 
 func runtimeTemplateVars(sessID int64, groupName string) map[string]string {
@@ -653,9 +706,10 @@ func runtimeTemplateVars(sessID int64, groupName string) map[string]string {
 
 // buildStructuredMemoryInjection builds the structured memory block for system prompt.
 // It loads injection routes from the database, matches the query against them,
-// and assembles the fixed + conditionally-matched memory categories.
+// and assembles the fixed + conditionally-matched memory categories, followed
+// by the memories recalled for the query from the session's memory layers.
 // Returns empty string if no structured memory content is available.
-func buildStructuredMemoryInjection(query string) string {
+func buildStructuredMemoryInjection(sessionID int64, query string) string {
 	// Load injection routes from DB
 	dbRoutes, err := store.ListInjectionRoutes()
 	if err != nil {
@@ -673,7 +727,61 @@ func buildStructuredMemoryInjection(query string) string {
 	// Match query against routes
 	matchedConditional := core.MatchInjectionRoutes(query, coreRoutes)
 	// Build the injection block
-	return core.BuildStructuredMemoryBlock(matchedConditional)
+	block := core.BuildStructuredMemoryBlock(matchedConditional)
+	if recall := buildMemoryRecall(sessionID, query); recall != "" {
+		if block != "" {
+			block += "\n\n"
+		}
+		block += recall
+	}
+	return block
+}
+
+// Memory recall for the system prompt: a few hits from a federated
+// session → team → global search. Hybrid hits need this cosine similarity
+// to count as relevant; keyword hits (degraded engine) always do.
+const (
+	memoryRecallTopK          = 3
+	memoryRecallMinSimilarity = 0.55
+	memoryRecallSnippetRunes  = 300
+)
+
+var memoryRecallFilter, _ = core.ParseFilter(json.RawMessage(`{"ne":{"mem_status":"deprecated"}}`))
+
+// buildMemoryRecall returns the memories most relevant to query as a prompt
+// block, or "" when there are none or the vector engine is not ready (it is
+// never waited for).
+func buildMemoryRecall(sessionID int64, query string) string {
+	if core.Vector == nil || !core.Vector.IsReady() || strings.TrimSpace(query) == "" {
+		return ""
+	}
+	results, err := core.Vector.FederatedSearch(core.SessionScopes(sessionID, "memory"), query, memoryRecallTopK, core.SearchHybrid, memoryRecallFilter)
+	if err != nil {
+		log.Printf("[injection] memory recall failed: %v", err)
+		return ""
+	}
+	var parts []string
+	for _, r := range results {
+		mode, _ := r["mode"].(string)
+		similarity, _ := r["similarity"].(float64)
+		if mode != core.SearchKeyword && similarity < memoryRecallMinSimilarity {
+			continue
+		}
+		id, _ := r["id"].(string)
+		origin, _ := r["origin"].(string)
+		doc, _ := r["document"].(string)
+		if runes := []rune(strings.TrimSpace(doc)); len(runes) > memoryRecallSnippetRunes {
+			doc = string(runes[:memoryRecallSnippetRunes]) + "..."
+		}
+		parts = append(parts, fmt.Sprintf("### %s (%s)\n\n%s", id, origin, strings.TrimSpace(doc)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(
+		"<!-- memory-recall:start -->\n## 相关记忆（按当前问题检索）\n\n%s\n<!-- memory-recall:end -->",
+		strings.Join(parts, "\n\n"),
+	)
 }
 
 // buildTeamMembersList generates a markdown table of team members for injection into system prompt
@@ -715,6 +823,7 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 		WorkDir:      workDir,
 		HubSessionID: sessID,
 		GroupName:    groupName,
+		ToolPolicy:   store.ResolveToolPolicy(sessID, groupName),
 	}
 	// OAuth/subscription mode uses Claude default model selection.
 	if p.AuthMode == "oauth" {
@@ -746,7 +855,7 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 		promptParts = append(promptParts, core.RenderTemplateWithVars(rules, tplVars))
 	}
 	// Structured memory injection (Issue #210): append memory block after all rules
-	if memBlock := buildStructuredMemoryInjection(query); memBlock != "" {
+	if memBlock := buildStructuredMemoryInjection(sessID, query); memBlock != "" {
 		promptParts = append(promptParts, memBlock)
 	}
 	if len(promptParts) > 0 {
@@ -754,7 +863,7 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 	}
 	// For non-Anthropic API providers, append web_search disable hint
 	// (--disallowed-tools only works for client tools, not server_tool_use like web_search)
-	if p.BaseURL != "" && !strings.Contains(p.BaseURL, "api.anthropic.com") {
+	if p.Mode == model.ModeClaudeCode && p.BaseURL != "" && !strings.Contains(p.BaseURL, "api.anthropic.com") {
 		webSearchHint := "\n\n重要：当前 API 不支持 web_search 工具，请勿使用。如需搜索信息，请使用其他方式（如 MCP 浏览器工具）。"
 		req.SystemPrompt += webSearchHint
 	}
@@ -773,6 +882,8 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 	toolIDs := make(map[int]string)
 	toolNames := make(map[int]string)
 	toolInputs := make(map[int]string)
+	// Complete tool call records (full input + result), persisted to tool_calls
+	tools := newToolCallTracker(sessID, progressMsgID, send)
 	// Full text from assistant message (preserves newlines, used as fallback)
 	var assistantFullText string
 	var usageInput, usageOutput, usageCacheCreation, usageCacheRead int64
@@ -781,7 +892,10 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 	var lastSaveTime time.Time
 	var lastSaveLen int
 
-	err := claudeClient.StreamPersistent(ctx, req, func(line string) {
+	// Dispatch on provider mode: Claude Code CLI or a native API backend,
+	// all reporting progress as stream-json lines parsed below.
+	backend := core.BackendFor(p.Mode)
+	err := backend.StreamTurn(ctx, req, func(line string) {
 		// Debug: log raw line type for troubleshooting (especially Windows)
 		if len(line) > 0 {
 			// Parse type first to decide log level
@@ -822,7 +936,7 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 		switch wrapper.Type {
 		case "error":
 			// API-level error: Error can be string or object
-			errMsg := "unknown error"
+			errMsg, errType := "unknown error", ""
 			if len(wrapper.Error) > 0 {
 				// Try string first
 				var errStr string
@@ -835,12 +949,13 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 						Type    string `json:"type"`
 					}
 					if err := json.Unmarshal(wrapper.Error, &errObj); err == nil && errObj.Message != "" {
-						errMsg = errObj.Message
+						errMsg, errType = errObj.Message, errObj.Type
 					}
 				}
 			}
 			log.Printf("[claude] API error: %s", errMsg)
-			send(WSMessage{Type: "error", SessionID: sessID, Content: errMsg})
+			// Detail carries error.type (e.g. overloaded_error) for failover classification
+			send(WSMessage{Type: "error", SessionID: sessID, Content: errMsg, Detail: errType})
 
 		case "stream_event":
 			// Real-time streaming events from --include-partial-messages
@@ -886,6 +1001,7 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 					toolIDs[inner.Index] = inner.ContentBlock.ID
 					toolNames[inner.Index] = inner.ContentBlock.Name
 					toolInputs[inner.Index] = ""
+					tools.start(inner.ContentBlock.ID)
 					send(WSMessage{
 						Type:      "tool_start",
 						SessionID: sessID,
@@ -941,8 +1057,10 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 						Name:   toolNames[inner.Index],
 						Input:  inputSummary,
 						Status: "done",
+						ToolID: toolID,
 					})
-					send(WSMessage{Type: "tool_result", SessionID: sessID, ToolID: toolID})
+					// tool_result is sent once the CLI reports the tool's output ("user" line)
+					tools.inputDone(toolID, toolNames[inner.Index], toolInputs[inner.Index])
 					delete(toolIDs, inner.Index)
 					delete(toolNames, inner.Index)
 					delete(toolInputs, inner.Index)
@@ -1065,6 +1183,10 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 				log.Printf("[claude] session %d: result usage +input=%d +output=%d +cache_create=%d +cache_read=%d (total: input=%d output=%d cache_create=%d cache_read=%d)", sessID, wrapper.Usage.InputTokens, wrapper.Usage.OutputTokens, wrapper.Usage.CacheCreationInputTokens, wrapper.Usage.CacheReadInputTokens, usageInput, usageOutput, usageCacheCreation, usageCacheRead)
 			}
 
+		case "user":
+			// Tool results fed back to the model
+			tools.handleUserLine(line)
+
 		case "assistant":
 			// Parse assistant message to capture full text with formatting (newlines preserved)
 			var aMsg struct {
@@ -1090,6 +1212,7 @@ func streamClaudeCode(ctx context.Context, p *model.Provider, query, sessionID s
 		default:
 		}
 	})
+	tools.flush()
 
 	// Build metadata JSON from accumulated steps
 	var metadataJSON string
@@ -1334,7 +1457,7 @@ func sendAttentionFeedback(sessionID int64, message string) {
 
 	// Trigger AI response
 	triggerMsgID := userMsg.ID
-	go runStream(session, message, false, triggerMsgID)
+	go runStream(session, message, false, triggerMsgID, core.PriorityBackground)
 }
 
 // ============================================================================
@@ -1458,7 +1581,7 @@ func runAttentionV2Flow(parentSession *model.Session, userMessage string) {
 // runAttentionV3Flow orchestrates the simplified attention mode execution
 // Phase 1: Attention AI queries info and generates preprocessing text
 // Phase 2: Send enhanced message (wrapped context + user message) to parent session
-func runAttentionV3Flow(parentSession *model.Session, userMessage string) {
+func runAttentionV3Flow(parentSession *model.Session, userMessage, source string, sourceID int64) {
 	parentID := parentSession.ID
 	log.Printf("[attention-v3] session %d: starting flow", parentID)
 
@@ -1520,6 +1643,9 @@ func runAttentionV3Flow(parentSession *model.Session, userMessage string) {
 				Content:          content,
 				AttentionContext: attentionContext,
 			}
+			if role == "user" {
+				msg.Source, msg.SourceID = source, sourceID
+			}
 			return store.AddMessage(msg)
 		},
 	}
@@ -1648,7 +1774,7 @@ func runShadowStream(ctx context.Context, shadowSession *model.Session, query st
 		promptParts = append(promptParts, core.RenderTemplateWithVars(rules, tplVars))
 	}
 	// Structured memory injection (Issue #210)
-	if memBlock := buildStructuredMemoryInjection(query); memBlock != "" {
+	if memBlock := buildStructuredMemoryInjection(broadcastAsID, query); memBlock != "" {
 		promptParts = append(promptParts, memBlock)
 	}
 
@@ -1672,7 +1798,7 @@ func runShadowStream(ctx context.Context, shadowSession *model.Session, query st
 		req.SystemPrompt = strings.Join(promptParts, "\n\n---\n\n")
 	}
 	// For non-Anthropic API providers, append web_search disable hint
-	if provider.BaseURL != "" && !strings.Contains(provider.BaseURL, "api.anthropic.com") {
+	if provider.Mode == model.ModeClaudeCode && provider.BaseURL != "" && !strings.Contains(provider.BaseURL, "api.anthropic.com") {
 		webSearchHint := "\n\n重要：当前 API 不支持 web_search 工具，请勿使用。如需搜索信息，请使用其他方式（如 MCP 浏览器工具）。"
 		req.SystemPrompt += webSearchHint
 	}
@@ -1695,7 +1821,7 @@ func runShadowStream(ctx context.Context, shadowSession *model.Session, query st
 	toolInputs := make(map[int]string)
 	var assistantFullText string
 
-	err := claudeClient.StreamPersistent(ctx, req, func(line string) {
+	err := core.BackendFor(provider.Mode).StreamTurn(ctx, req, func(line string) {
 		// Parse the streaming event
 		var wrapper struct {
 			Type    string          `json:"type"`
@@ -1859,7 +1985,7 @@ func runSilentStream(ctx context.Context, session *model.Session, query string,
 		}
 	}
 	// Structured memory injection (Issue #210)
-	if memBlock := buildStructuredMemoryInjection(query); memBlock != "" {
+	if memBlock := buildStructuredMemoryInjection(session.ID, query); memBlock != "" {
 		promptParts = append(promptParts, memBlock)
 	}
 
@@ -1883,7 +2009,7 @@ func runSilentStream(ctx context.Context, session *model.Session, query string,
 		req.SystemPrompt = strings.Join(promptParts, "\n\n---\n\n")
 	}
 	// For non-Anthropic API providers, append web_search disable hint
-	if provider.BaseURL != "" && !strings.Contains(provider.BaseURL, "api.anthropic.com") {
+	if provider.Mode == model.ModeClaudeCode && provider.BaseURL != "" && !strings.Contains(provider.BaseURL, "api.anthropic.com") {
 		webSearchHint := "\n\n重要：当前 API 不支持 web_search 工具，请勿使用。如需搜索信息，请使用其他方式（如 MCP 浏览器工具）。"
 		req.SystemPrompt += webSearchHint
 	}
@@ -1891,7 +2017,7 @@ func runSilentStream(ctx context.Context, session *model.Session, query string,
 	var fullResponse string
 	var assistantFullText string
 
-	err := claudeClient.StreamPersistent(ctx, req, func(line string) {
+	err := core.BackendFor(provider.Mode).StreamTurn(ctx, req, func(line string) {
 		var wrapper struct {
 			Type    string          `json:"type"`
 			Subtype string          `json:"subtype"`
@@ -1959,7 +2085,8 @@ func truncateString(s string, maxLen int) string {
 }
 
 // fireMessageReceivedHook fires message.received and message.count hooks.
-func fireMessageReceivedHook(sessionID int64, content string) {
+// source is the message's origin (core.Source*), empty for a user's message.
+func fireMessageReceivedHook(sessionID int64, content, source string) {
 	// Get message count for message.count hooks
 	msgCount, _ := store.GetMessagesCount(sessionID)
 
@@ -1969,6 +2096,7 @@ func fireMessageReceivedHook(sessionID int64, content string) {
 		SourceSessionID: sessionID,
 		Content:         content,
 		MessageCount:    msgCount,
+		Source:          source,
 	})
 
 	// Fire message.count
@@ -1977,13 +2105,6 @@ func fireMessageReceivedHook(sessionID int64, content string) {
 		SourceSessionID: sessionID,
 		Content:         content,
 		MessageCount:    msgCount,
-	})
-}
-
-// initHookStreamCallback registers the stream callback for hook-triggered messages.
-// Must be called during api initialization.
-func initHookStreamCallback() {
-	core.SetHookStreamCallback(func(session *model.Session, content string, triggerMsgID int64) {
-		go runStream(session, content, false, triggerMsgID)
+		Source:          source,
 	})
 }
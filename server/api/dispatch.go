@@ -0,0 +1,74 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"log"
+)
+
+// chatDispatcher delivers in-process messages (triggers, hooks, channels,
+// shadow AI) the same way /chat/send delivers a user's message.
+type chatDispatcher struct{}
+
+func (chatDispatcher) Dispatch(req core.DispatchRequest) (*core.DispatchResult, error) {
+	session, err := store.GetSession(req.SessionID)
+	if err != nil {
+		return nil, core.ErrSessionNotFound
+	}
+	return deliverMessage(session, req.Content, req.Source, req.SourceID, req.Priority)
+}
+
+// initDispatcher registers the in-process message dispatcher.
+// Must be called during api initialization.
+func initDispatcher() {
+	core.SetDispatcher(chatDispatcher{})
+}
+
+// deliverMessage saves a user message to an existing session and starts the
+// AI turn, or queues the message when the session is already streaming.
+// Attention mode reviews user, trigger and shadow messages and rejects them
+// with core.ErrSessionBusy while a turn is running; hook and channel messages
+// are delivered directly. Hook messages do not fire message hooks, so hooks
+// cannot trigger each other in a loop.
+func deliverMessage(session *model.Session, content, source string, sourceID int64, priority int) (*core.DispatchResult, error) {
+	result := &core.DispatchResult{SessionID: session.ID}
+	direct := source == core.SourceHook || source == core.SourceChannel
+
+	// Attention system V3: the flow saves the user message at the end (clean sync)
+	if session.AttentionEnabled && !direct {
+		if IsSessionStreaming(session.ID) {
+			return nil, core.ErrSessionBusy
+		}
+		go runAttentionV3Flow(session, content, source, sourceID)
+		result.Status, result.Mode = "started", "attention_v3"
+		return result, nil
+	}
+
+	userMsg := &model.Message{
+		SessionID: session.ID,
+		Role:      "user",
+		Content:   content,
+		Source:    source,
+		SourceID:  sourceID,
+	}
+	if err := store.AddMessage(userMsg); err != nil {
+		return nil, err
+	}
+	result.MessageID = userMsg.ID
+
+	// Queue instead of rejecting — processQueuedMessages picks it up after the turn
+	if IsSessionStreaming(session.ID) {
+		log.Printf("[chat] session %d is streaming, message queued (msg_id=%d source=%s)", session.ID, userMsg.ID, source)
+		broadcast(WSMessage{Type: "message_queued", SessionID: session.ID, Content: content})
+		result.Status = "queued"
+		return result, nil
+	}
+
+	if source != core.SourceHook {
+		go fireMessageReceivedHook(session.ID, content, source)
+	}
+	go runStream(session, content, false, userMsg.ID, priority)
+	result.Status = "started"
+	return result, nil
+}
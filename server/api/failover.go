@@ -0,0 +1,325 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// FailoverHop records one failed attempt of a turn (persisted in message metadata).
+type FailoverHop struct {
+	ProviderID   string `json:"provider_id"`
+	ProviderName string `json:"provider_name"`
+	Attempt      int    `json:"attempt"`
+	Kind         string `json:"kind"`
+	Error        string `json:"error"`
+	Action       string `json:"action"` // "retry" | "failover" | "give_up"
+}
+
+// turnResult is the outcome of one runStream turn after retries/failover.
+type turnResult struct {
+	Provider           *model.Provider
+	FullResponse       string
+	MetadataJSON       string
+	UsageInput         int64
+	UsageOutput        int64
+	UsageCacheCreation int64
+	UsageCacheRead     int64
+	Err                error
+}
+
+// providerChain returns the primary provider followed by the configured
+// fallbacks (session chain, else group chain), skipping unknown/duplicate IDs.
+func providerChain(session *model.Session, primary *model.Provider) []*model.Provider {
+	chain := []*model.Provider{primary}
+	seen := map[string]bool{primary.ID: true}
+	for _, id := range store.ResolveProviderChain(session.ID, session.GroupName) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		p, err := store.GetProvider(id)
+		if err != nil {
+			log.Printf("[failover] session %d: chain provider %s not found, skipped", session.ID, id)
+			continue
+		}
+		chain = append(chain, p)
+	}
+	return chain
+}
+
+// streamWithFailover runs streamClaudeCode, retrying transient upstream
+// failures (429 / 5xx / overloaded) with exponential backoff, then falling
+// over to the next provider in the chain. Retries only happen while the turn
+// has produced no output, so tool side effects are never replayed.
+func streamWithFailover(ctx context.Context, session *model.Session, primary *model.Provider, query string, isResume bool, send func(WSMessage), progressMsgID int64) turnResult {
+	chain := providerChain(session, primary)
+	var hops []FailoverHop
+	var res turnResult
+	var lastFailure string
+
+	for i, p := range chain {
+		if i > 0 {
+			// Switching provider needs a fresh CLI process and session (same as SwitchProvider)
+			core.Pool.Kill(session.ID)
+			newUUID := uuid.New().String()
+			if err := store.UpdateClaudeSessionID(session.ID, newUUID); err == nil {
+				session.ClaudeSessionID = newUUID
+			}
+			// The hop lasts for this turn only: sessions.provider_id keeps the
+			// primary and the next turn switches back (see restorePrimaryProvider)
+			markFailoverRestore(session.ID)
+			if isResume {
+				if seed := failoverRecoverySeed(session.ID, progressMsgID); seed != "" {
+					query = seed + "\n\n---\n\n" + query
+				}
+			}
+			isResume = false
+			log.Printf("[failover] session %d: switched to provider %s (%s)", session.ID, p.Name, p.ID)
+			broadcast(WSMessage{Type: "failover", SessionID: session.ID, Content: p.Name, Detail: p.ID})
+		}
+
+		for attempt := 0; ; attempt++ {
+			var upstreamErr, upstreamType string
+			suppressed := false
+			// Hold back retryable error events: the client only sees the final outcome
+			sendFn := func(msg WSMessage) {
+				if msg.Type == "error" {
+					upstreamErr, upstreamType = msg.Content, msg.Detail
+					if _, retryable := core.ClassifyFailure(msg.Detail, msg.Content); retryable {
+						suppressed = true
+						return
+					}
+				}
+				send(msg)
+			}
+
+			res = turnResult{Provider: p}
+			res.FullResponse, res.MetadataJSON, res.UsageInput, res.UsageOutput, res.UsageCacheCreation, res.UsageCacheRead, res.Err =
+				streamClaudeCode(ctx, p, query, session.ClaudeSessionID, isResume, sendFn, session.ID, session.WorkDir, session.GroupName, progressMsgID)
+
+			// Prefer the upstream error event: it carries error.type
+			failure, failureType := upstreamErr, upstreamType
+			if failure == "" && res.Err != nil {
+				failure = res.Err.Error()
+			}
+			kind, retryable := core.ClassifyFailure(failureType, failure)
+			produced := res.FullResponse != "" || res.MetadataJSON != ""
+			if ctx.Err() != nil || failure == "" || !retryable || produced {
+				if suppressed && ctx.Err() == nil {
+					send(WSMessage{Type: "error", SessionID: session.ID, Content: upstreamErr})
+				}
+				res.MetadataJSON = withFailoverHops(res.MetadataJSON, hops)
+				return res
+			}
+
+			lastFailure = failure
+			hop := FailoverHop{ProviderID: p.ID, ProviderName: p.Name, Attempt: attempt + 1, Kind: kind, Error: truncateRunes(failure, 300)}
+			switch {
+			case attempt < core.FailoverMaxRetries:
+				hop.Action = "retry"
+			case i < len(chain)-1:
+				hop.Action = "failover"
+			default:
+				hop.Action = "give_up"
+			}
+			hops = append(hops, hop)
+			recordFailoverHop(session.ID, progressMsgID, hop)
+
+			if hop.Action != "retry" {
+				break
+			}
+			delay := core.FailoverBackoff(attempt)
+			log.Printf("[failover] session %d: provider %s %s (attempt %d), retrying in %s", session.ID, p.Name, kind, attempt+1, delay)
+			if !core.SleepCtx(ctx, delay) {
+				res.MetadataJSON = withFailoverHops(res.MetadataJSON, hops)
+				return res
+			}
+		}
+	}
+
+	res.Err = fmt.Errorf("all providers failed (%d attempts): %s", len(hops), lastFailure)
+	res.MetadataJSON = withFailoverHops(res.MetadataJSON, hops)
+	return res
+}
+
+var (
+	failoverRestore   = make(map[int64]bool)
+	failoverRestoreMu sync.Mutex
+)
+
+func markFailoverRestore(sessionID int64) {
+	failoverRestoreMu.Lock()
+	failoverRestore[sessionID] = true
+	failoverRestoreMu.Unlock()
+}
+
+// restorePrimaryProvider runs at the start of a turn: when the previous turn
+// failed over, the CLI process and session belong to the fallback provider,
+// so it resets them like SwitchProvider does and seeds the primary with the
+// history before the current turn (messages with ID < beforeID).
+func restorePrimaryProvider(session *model.Session, beforeID int64) {
+	failoverRestoreMu.Lock()
+	restore := failoverRestore[session.ID]
+	delete(failoverRestore, session.ID)
+	failoverRestoreMu.Unlock()
+	if !restore {
+		return
+	}
+	core.Pool.Kill(session.ID)
+	newUUID := uuid.New().String()
+	if err := store.UpdateClaudeSessionID(session.ID, newUUID); err == nil {
+		session.ClaudeSessionID = newUUID
+	}
+	markForceFreshRun(session.ID)
+	msgs, _ := store.GetMessages(session.ID)
+	var prior []model.Message
+	for _, m := range msgs {
+		if m.ID < beforeID && strings.TrimSpace(m.Content) != "" {
+			prior = append(prior, m)
+		}
+	}
+	if len(prior) > 0 {
+		setPendingRecoverySeed(session.ID, buildRecoverySeed(prior, "故障转移后切回主供应商"))
+	}
+	log.Printf("[failover] session %d: back on primary provider %s", session.ID, session.ProviderID)
+}
+
+// recordFailoverHop logs a hop to ai_errors so it shows up in error stats.
+func recordFailoverHop(sessionID, messageID int64, hop FailoverHop) {
+	e := &model.AIError{
+		SessionID: sessionID,
+		MessageID: messageID,
+		Level:     "warning",
+		Summary:   fmt.Sprintf("[failover:%s] %s attempt %d: %s (%s)", hop.Action, hop.ProviderName, hop.Attempt, hop.Kind, hop.Error),
+	}
+	if err := store.AddAIError(e); err != nil {
+		log.Printf("[failover] save ai_error failed: %v", err)
+	}
+}
+
+// withFailoverHops merges hops into the steps metadata JSON.
+func withFailoverHops(metadataJSON string, hops []FailoverHop) string {
+	if len(hops) == 0 {
+		return metadataJSON
+	}
+	var meta StepsMetadata
+	if metadataJSON != "" {
+		json.Unmarshal([]byte(metadataJSON), &meta)
+	}
+	meta.Failover = hops
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return metadataJSON
+	}
+	return string(b)
+}
+
+// failoverRecoverySeed rebuilds context for the fallback provider from the
+// stored messages before the current turn's placeholder.
+func failoverRecoverySeed(sessionID, progressMsgID int64) string {
+	msgs, err := store.GetMessages(sessionID)
+	if err != nil {
+		return ""
+	}
+	var prior []model.Message
+	for _, m := range msgs {
+		if m.ID < progressMsgID && strings.TrimSpace(m.Content) != "" {
+			prior = append(prior, m)
+		}
+	}
+	if len(prior) == 0 {
+		return ""
+	}
+	return buildRecoverySeed(prior, "供应商故障切换后恢复")
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
+
+// GetSessionFailover handles GET /api/v1/sessions/:id/failover
+func GetSessionFailover(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	session, err := store.GetSession(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	own := store.GetProviderChain(store.ChainScopeSession, strconv.FormatInt(id, 10))
+	if own == nil {
+		own = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"provider_ids": own,
+		"effective":    store.ResolveProviderChain(id, session.GroupName),
+	})
+}
+
+// PutSessionFailover handles PUT /api/v1/sessions/:id/failover {provider_ids}
+func PutSessionFailover(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	if _, err := store.GetSession(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	putProviderChain(c, store.ChainScopeSession, strconv.FormatInt(id, 10))
+}
+
+// GetGroupFailover handles GET /api/v1/groups/:name/failover
+func GetGroupFailover(c *gin.Context) {
+	ids := store.GetProviderChain(store.ChainScopeGroup, c.Param("name"))
+	if ids == nil {
+		ids = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"provider_ids": ids})
+}
+
+// PutGroupFailover handles PUT /api/v1/groups/:name/failover {provider_ids}
+func PutGroupFailover(c *gin.Context) {
+	putProviderChain(c, store.ChainScopeGroup, c.Param("name"))
+}
+
+func putProviderChain(c *gin.Context, scope, key string) {
+	var req struct {
+		ProviderIDs []string `json:"provider_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, id := range req.ProviderIDs {
+		if _, err := store.GetProvider(id); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "provider not found: " + id})
+			return
+		}
+	}
+	if err := store.SetProviderChain(scope, key, req.ProviderIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "provider_ids": req.ProviderIDs})
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"ai-hub/server/core"
 	"ai-hub/server/model"
 	"ai-hub/server/store"
 	"fmt"
@@ -236,6 +237,9 @@ func UpdateSessionGroup(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if session.GroupName != req.GroupName {
+		core.Pool.Kill(id) // respawn under the new group's tool policy
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "session moved",
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"ai-hub/server/core"
 	"ai-hub/server/model"
 	"ai-hub/server/store"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -29,6 +31,12 @@ func ListHooks(c *gin.Context) {
 	c.JSON(http.StatusOK, list)
 }
 
+// ListHookEvents GET /api/v1/hooks/events
+// Returns the event catalogue with each event's payload variables.
+func ListHookEvents(c *gin.Context) {
+	c.JSON(http.StatusOK, core.HookEvents)
+}
+
 // GetHook GET /api/v1/hooks/:id
 func GetHook(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -57,14 +65,11 @@ func CreateHook(c *gin.Context) {
 		return
 	}
 	// Validate event type
-	validEvents := map[string]bool{
-		"session.created":  true,
-		"message.received": true,
-		"message.count":    true,
-		"session.error":    true,
+	if !core.IsHookEvent(h.Event) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event type. Valid: " + core.HookEventTypes()})
+		return
 	}
-	if !validEvents[h.Event] {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event type. Valid: session.created, message.received, message.count, session.error"})
+	if !validHookCondition(c, h.Condition) {
 		return
 	}
 	// Validate target session exists
@@ -104,9 +109,16 @@ func UpdateHook(c *gin.Context) {
 		return
 	}
 	if req.Event != nil {
+		if !core.IsHookEvent(*req.Event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event type. Valid: " + core.HookEventTypes()})
+			return
+		}
 		existing.Event = *req.Event
 	}
 	if req.Condition != nil {
+		if !validHookCondition(c, *req.Condition) {
+			return
+		}
 		existing.Condition = *req.Condition
 	}
 	if req.TargetSession != nil {
@@ -122,9 +134,79 @@ func UpdateHook(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	core.ForgetHookCondition(id)
 	c.JSON(http.StatusOK, existing)
 }
 
+// validHookCondition parses a hook condition and writes a 400 with the error
+// position when it is invalid.
+func validHookCondition(c *gin.Context, condition string) bool {
+	_, err := core.ParseHookCondition(condition)
+	if err == nil {
+		return true
+	}
+	resp := gin.H{"error": err.Error()}
+	var ce *core.ConditionError
+	if errors.As(err, &ce) {
+		resp["position"] = ce.Pos
+	}
+	c.JSON(http.StatusBadRequest, resp)
+	return false
+}
+
+// TestHook POST /api/v1/hooks/:id/test
+// Dry-runs the hook against a sample event: reports whether it would fire and
+// the payload it would send, without sending it. "condition" tests an unsaved
+// condition instead of the hook's own.
+func TestHook(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	h, err := store.GetHook(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "hook not found"})
+		return
+	}
+	var req struct {
+		Event           string            `json:"event"`
+		SourceSessionID int64             `json:"source_session_id"`
+		Content         string            `json:"content"`
+		MessageCount    int64             `json:"message_count"`
+		Source          string            `json:"source"`
+		Vars            map[string]string `json:"vars"`
+		Condition       *string           `json:"condition"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Event != "" && !core.IsHookEvent(req.Event) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid event type. Valid: " + core.HookEventTypes()})
+		return
+	}
+	if req.Condition != nil {
+		if !validHookCondition(c, *req.Condition) {
+			return
+		}
+		h.Condition = *req.Condition
+	}
+	result, err := core.DryRunHook(h, core.HookEvent{
+		Type:            req.Event,
+		SourceSessionID: req.SourceSessionID,
+		Content:         req.Content,
+		MessageCount:    req.MessageCount,
+		Source:          req.Source,
+		Vars:            req.Vars,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // DeleteHook DELETE /api/v1/hooks/:id
 func DeleteHook(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -136,6 +218,7 @@ func DeleteHook(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	core.ForgetHookCondition(id)
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMemoryPolicies GET /api/v1/memory/policies
+func ListMemoryPolicies(c *gin.Context) {
+	list, err := store.ListMemoryPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": list})
+}
+
+// SaveMemoryPolicy PUT /api/v1/memory/policies
+// Creates or replaces the policy of body.scope ("*" for every scope without
+// its own policy).
+func SaveMemoryPolicy(c *gin.Context) {
+	var req model.MemoryPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if err := core.ValidateMemoryPolicy(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Scope != "*" && !isValidScope(req.Scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope"})
+		return
+	}
+	if err := store.SaveMemoryPolicy(&req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	core.ReloadMemoryPolicies()
+	c.JSON(http.StatusOK, req)
+}
+
+// DeleteMemoryPolicy DELETE /api/v1/memory/policies/:id
+func DeleteMemoryPolicy(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ok, err := store.DeleteMemoryPolicy(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "policy not found"})
+		return
+	}
+	core.ReloadMemoryPolicies()
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// MemoryPolicyReport GET /api/v1/memory/policies/report?scope=xxx
+// Dry run: lists what each policy would deprecate or archive right now,
+// including disabled policies. Nothing is changed.
+func MemoryPolicyReport(c *gin.Context) {
+	scope := c.Query("scope")
+	if scope != "" && !isValidScope(scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope"})
+		return
+	}
+	if !waitVectorReady(c) {
+		return
+	}
+	reports, err := core.MemoryPolicyReport(scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"dry_run": true, "reports": reports})
+}
+
+// RunMemoryPolicies POST /api/v1/memory/policies/run {"scope": "..."}
+// Enforces the enabled policies now instead of waiting for the hourly run.
+func RunMemoryPolicies(c *gin.Context) {
+	var req struct {
+		Scope string `json:"scope"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.Scope != "" && !isValidScope(req.Scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope"})
+		return
+	}
+	if !waitVectorReady(c) {
+		return
+	}
+	reports, err := core.EnforceMemoryPolicies(req.Scope)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "reports": reports})
+}
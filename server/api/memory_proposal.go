@@ -0,0 +1,131 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMemoryProposals GET /api/v1/memory/proposals?status=pending&scope=xxx&limit=50
+func ListMemoryProposals(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	list, err := store.ListMemoryProposals(c.Query("status"), c.Query("scope"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"proposals": list})
+}
+
+// GetMemoryProposal GET /api/v1/memory/proposals/:id
+// Includes the current content of the proposal's files.
+func GetMemoryProposal(c *gin.Context) {
+	p := memoryProposalParam(c)
+	if p == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"proposal": p, "files": core.ProposalFiles(p)})
+}
+
+// ApproveMemoryProposal POST /api/v1/memory/proposals/:id/approve
+// Body (all optional): {"keep": "file to keep", "content": "final content", "note": "..."}.
+// Merges keep the proposal's target with its merged version unless
+// overridden; conflicts need keep or content.
+func ApproveMemoryProposal(c *gin.Context) {
+	var req struct {
+		Keep    string `json:"keep"`
+		Content string `json:"content"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p := memoryProposalParam(c)
+	if p == nil {
+		return
+	}
+	if p.Status != model.ProposalPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "proposal is already " + p.Status})
+		return
+	}
+	if err := core.ApplyMemoryProposal(p, req.Keep, req.Content, 0); err != nil {
+		if errors.Is(err, core.ErrProposalStale) {
+			store.ReviewMemoryProposal(p.ID, model.ProposalStale, err.Error())
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": model.ProposalStale})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	store.ReviewMemoryProposal(p.ID, model.ProposalApproved, req.Note)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// RejectMemoryProposal POST /api/v1/memory/proposals/:id/reject
+// A rejected cluster is not proposed again until one of its files changes.
+func RejectMemoryProposal(c *gin.Context) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&req)
+	p := memoryProposalParam(c)
+	if p == nil {
+		return
+	}
+	ok, err := store.ReviewMemoryProposal(p.ID, model.ProposalRejected, req.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "proposal is already " + p.Status})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ConsolidateMemory POST /api/v1/memory/consolidate {"scope": "..."}
+// Runs the consolidation job now; an empty scope scans every memory scope.
+func ConsolidateMemory(c *gin.Context) {
+	var req struct {
+		Scope string `json:"scope"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.Scope != "" && !isValidScope(req.Scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope"})
+		return
+	}
+	if !waitVectorReady(c) {
+		return
+	}
+	created, err := core.ConsolidateMemory(req.Scope)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "proposals": created})
+}
+
+func memoryProposalParam(c *gin.Context) *model.MemoryProposal {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil
+	}
+	p, err := store.GetMemoryProposal(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "proposal not found"})
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"ai-hub/server/store"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchAllMessages handles GET /api/v1/search/messages?q=&group=&role=&since=&limit=
+// Full-text search over all sessions' chat history, ranked by relevance.
+// since accepts a date (2006-01-02), RFC3339, or a relative age (7d, 12h).
+func SearchAllMessages(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	role := c.Query("role")
+	if role != "" && role != "user" && role != "assistant" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be user or assistant"})
+		return
+	}
+	var since time.Time
+	if s := c.Query("since"); s != "" {
+		t, err := parseSince(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since = t
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 20
+	}
+
+	hits, err := store.SearchAllMessages(store.MessageSearchQuery{
+		Query: q,
+		Group: c.Query("group"),
+		Role:  role,
+		Since: since,
+		Limit: limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	mode := "fts"
+	if !store.FTSEnabled() {
+		mode = "like"
+	}
+	c.JSON(http.StatusOK, gin.H{"results": hits, "total": len(hits), "mode": mode})
+}
+
+// parseSince parses an absolute time or a relative age like "30d" / "12h".
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q (use 2006-01-02, RFC3339, or 7d / 12h)", s)
+}
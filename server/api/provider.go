@@ -23,6 +23,16 @@ func normalizeProviderInput(p *model.Provider) {
 	if p.AuthMode == "oauth" {
 		p.ModelID = ""
 	}
+	// OAuth only exists for the Claude CLI; OpenAI-compatible backends use API keys.
+	if p.DetectMode() == model.ModeOpenAI {
+		p.AuthMode = "api_key"
+	}
+}
+
+// maskedProvider returns a copy of p safe to send to clients (API key masked).
+func maskedProvider(p model.Provider) model.Provider {
+	p.APIKey = store.MaskSecret(p.APIKey)
+	return p
 }
 
 func ListProviders(c *gin.Context) {
@@ -34,6 +44,9 @@ func ListProviders(c *gin.Context) {
 	if list == nil {
 		list = []model.Provider{}
 	}
+	for i := range list {
+		list[i] = maskedProvider(list[i])
+	}
 	c.JSON(http.StatusOK, list)
 }
 
@@ -48,7 +61,7 @@ func CreateProvider(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, p)
+	c.JSON(http.StatusCreated, maskedProvider(p))
 }
 
 func UpdateProvider(c *gin.Context) {
@@ -58,17 +71,22 @@ func UpdateProvider(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "provider not found"})
 		return
 	}
+	originalKey := existing.APIKey
 	if err := c.ShouldBindJSON(existing); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The edit form echoes back the masked key when it was left untouched
+	if originalKey != "" && existing.APIKey == store.MaskSecret(originalKey) {
+		existing.APIKey = originalKey
+	}
 	normalizeProviderInput(existing)
 	existing.ID = id
 	if err := store.UpdateProvider(existing); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, existing)
+	c.JSON(http.StatusOK, maskedProvider(*existing))
 }
 
 // SetProviderDefault handles PUT /api/v1/providers/:id/default
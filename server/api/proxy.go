@@ -1,6 +1,7 @@
 package api
 
 import (
+	"ai-hub/server/core"
 	"ai-hub/server/model"
 	"ai-hub/server/store"
 	"bufio"
@@ -167,9 +168,9 @@ func HandleAnthropicProxy(c *gin.Context) {
 		return
 	}
 
-	// Copy headers (except Host)
+	// Copy headers (except Host and the AI Hub token)
 	for key, vals := range c.Request.Header {
-		if strings.EqualFold(key, "Host") {
+		if strings.EqualFold(key, "Host") || strings.EqualFold(key, core.TokenHeader) {
 			continue
 		}
 		for _, v := range vals {
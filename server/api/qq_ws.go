@@ -468,5 +468,6 @@ func (c *qqWSConn) handleMessage(raw map[string]interface{}) {
 		return
 	}
 	log.Printf("[qq-ws] channel %d: forwarding to session %d: %s", c.channelID, targetSession, message)
-	forwardToSession(targetSession, forwarded)
+	rememberChannelOrigin(targetSession, qqOrigin(c.channelID, msgType, groupID, userID))
+	forwardToSession(targetSession, c.channelID, "qq", message, forwarded)
 }
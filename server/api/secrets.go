@@ -0,0 +1,34 @@
+package api
+
+import (
+	"ai-hub/server/store"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RotateMasterKey handles POST /api/v1/secrets/rotate-master {new_key?}
+// Re-encrypts provider API keys and channel secrets with a new master key.
+func RotateMasterKey(c *gin.Context) {
+	var req struct {
+		NewKey string `json:"new_key"` // base64 or hex, 32 bytes; empty = generate
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	count, err := store.RotateMasterKey(req.NewKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[secrets] master key rotated, %d secret(s) re-encrypted", count)
+	resp := gin.H{"ok": true, "reencrypted": count}
+	if store.MasterKeyFromEnv() {
+		resp["hint"] = "update AI_HUB_MASTER_KEY to the new key before the next restart"
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -142,7 +142,29 @@ func UpdateSession(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
 		return
 	}
-	if err := c.ShouldBindJSON(existing); err != nil {
+	group, providerID := existing.GroupName, existing.ProviderID
+	if info := authFrom(c); info != nil && info.SessionID > 0 {
+		// Session tokens may only change display fields: group and provider
+		// decide the session's tool policy.
+		var req struct {
+			Title              *string `json:"title"`
+			Icon               *string `json:"icon"`
+			AutoResetThreshold *int    `json:"auto_reset_threshold"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Title != nil {
+			existing.Title = *req.Title
+		}
+		if req.Icon != nil {
+			existing.Icon = *req.Icon
+		}
+		if req.AutoResetThreshold != nil {
+			existing.AutoResetThreshold = *req.AutoResetThreshold
+		}
+	} else if err := c.ShouldBindJSON(existing); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -151,6 +173,10 @@ func UpdateSession(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if existing.GroupName != group || existing.ProviderID != providerID {
+		// The running process was spawned with the old tool policy and provider.
+		core.Pool.Kill(id)
+	}
 	c.JSON(http.StatusOK, existing)
 }
 
@@ -441,6 +467,14 @@ func doCompress(session *model.Session, mode string) (string, error) {
 
 	// Notify all WS clients
 	broadcast(WSMessage{Type: "auto_compressed", SessionID: session.ID, Content: actualMode})
+	go core.FireHooks(core.HookEvent{
+		Type:            "compress.done",
+		SourceSessionID: session.ID,
+		Content:         actualMode,
+		MessageCount:    int64(len(msgs)),
+		Source:          core.TurnSource(session.ID),
+		Vars:            map[string]string{"compress_mode": actualMode},
+	})
 	return actualMode, nil
 }
 
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionTreeNode is one session in a fork tree.
+type SessionTreeNode struct {
+	ID        int64              `json:"id"`
+	Title     string             `json:"title"`
+	GroupName string             `json:"group_name"`
+	ParentID  int64              `json:"parent_id"`
+	ForkPoint int64              `json:"fork_point"`
+	CreatedAt time.Time          `json:"created_at"`
+	Children  []*SessionTreeNode `json:"children"`
+}
+
+// ForkSession handles POST /api/v1/sessions/:id/fork?from_msg_id=N {title}
+// Creates a new session with the history up to message N (default: latest)
+// and seeds its first turn with a recovery prompt. The source is untouched.
+func ForkSession(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	parent, err := store.GetSession(id)
+	if err != nil || parent.IsShadow {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	var body struct {
+		Title string `json:"title"`
+	}
+	c.ShouldBindJSON(&body) // body is optional
+
+	fromMsgID, _ := strconv.ParseInt(c.Query("from_msg_id"), 10, 64)
+	if fromMsgID <= 0 {
+		msgs, err := store.GetMessages(id)
+		if err != nil || len(msgs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "session has no messages to fork from"})
+			return
+		}
+		fromMsgID = msgs[len(msgs)-1].ID
+	}
+
+	fork, copied, err := store.ForkSession(parent, fromMsgID, body.Title)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rules, err := ReadSessionRules(id); err == nil && rules != "" {
+		if err := os.MkdirAll(sessionRulesDir(), 0755); err == nil {
+			os.WriteFile(sessionRulesPath(fork.ID), []byte(rules), 0644)
+		}
+	}
+
+	// The fork has history but a brand-new Claude session: seed it, never --resume
+	if msgs, err := store.GetMessages(fork.ID); err == nil && len(msgs) > 0 {
+		setPendingRecoverySeed(fork.ID, buildRecoverySeed(msgs, "从会话 #"+strconv.FormatInt(id, 10)+" 分叉"))
+	}
+	markForceFreshRun(fork.ID)
+
+	log.Printf("[fork] session %d forked from %d at message %d (%d messages copied)", fork.ID, id, fromMsgID, copied)
+	if data, err := json.Marshal(fork); err == nil {
+		broadcast(WSMessage{Type: "session_created", SessionID: fork.ID, Content: string(data)})
+	}
+	c.JSON(http.StatusCreated, gin.H{"session": fork, "copied_messages": copied})
+}
+
+// GetSessionTree handles GET /api/v1/sessions/:id/tree
+// Returns the whole fork tree containing the session, from its root.
+func GetSessionTree(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	s, err := store.GetSession(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	// Walk up to the root (parents may have been deleted; guard against cycles)
+	root := s
+	seen := map[int64]bool{s.ID: true}
+	for root.ParentID > 0 && !root.IsShadow {
+		p, err := store.GetSession(root.ParentID)
+		if err != nil || p.IsShadow || seen[p.ID] {
+			break
+		}
+		seen[p.ID] = true
+		root = p
+	}
+	c.JSON(http.StatusOK, gin.H{"session_id": id, "root": buildSessionTree(root, map[int64]bool{})})
+}
+
+func buildSessionTree(s *model.Session, visited map[int64]bool) *SessionTreeNode {
+	visited[s.ID] = true
+	node := &SessionTreeNode{
+		ID:        s.ID,
+		Title:     s.Title,
+		GroupName: s.GroupName,
+		ParentID:  s.ParentID,
+		ForkPoint: s.ForkPoint,
+		CreatedAt: s.CreatedAt,
+		Children:  []*SessionTreeNode{},
+	}
+	forks, _ := store.ListForks(s.ID)
+	for i := range forks {
+		if !visited[forks[i].ID] {
+			node.Children = append(node.Children, buildSessionTree(&forks[i], visited))
+		}
+	}
+	return node
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"ai-hub/server/core"
 	"ai-hub/server/model"
 	"ai-hub/server/store"
 	"net/http"
@@ -51,3 +52,142 @@ func UpdateCompressSettings(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
+
+// GetPoolSettings handles GET /api/v1/settings/pool
+// Returns the process limit together with live pool usage and the wait queue.
+func GetPoolSettings(c *gin.Context) {
+	cfg := store.GetPoolSettings(core.DefaultMaxProcesses)
+	_, running, queued := core.Pool.Limits()
+	queue := core.Pool.QueueStatus()
+	if queue == nil {
+		queue = []core.QueueInfo{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"max_processes": cfg.MaxProcesses,
+		"running":       running,
+		"queued":        queued,
+		"queue":         queue,
+	})
+}
+
+// UpdatePoolSettings handles PUT /api/v1/settings/pool
+func UpdatePoolSettings(c *gin.Context) {
+	var req model.PoolSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	// 0 means unlimited; otherwise keep it within a sane range
+	if req.MaxProcesses < 0 {
+		req.MaxProcesses = 0
+	}
+	if req.MaxProcesses > 256 {
+		req.MaxProcesses = 256
+	}
+	if err := store.SavePoolSettings(&req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	core.Pool.SetMaxProcesses(req.MaxProcesses)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// GetVectorChunkSettings handles GET /api/v1/settings/vector_chunk
+func GetVectorChunkSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, store.GetVectorChunkSettings(core.DefaultChunkSize, core.DefaultChunkOverlap))
+}
+
+// UpdateVectorChunkSettings handles PUT /api/v1/settings/vector_chunk
+// Watched memory files are re-chunked in the background.
+func UpdateVectorChunkSettings(c *gin.Context) {
+	var req model.VectorChunkSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	req.Size, req.Overlap = core.NormalizeChunkOptions(req.Size, req.Overlap)
+	if err := store.SaveVectorChunkSettings(&req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if core.Vector != nil {
+		core.Vector.SetChunkOptions(req.Size, req.Overlap)
+	}
+	if core.Watcher != nil {
+		core.Watcher.Resync()
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "size": req.Size, "overlap": req.Overlap})
+}
+
+// GetVectorEmbedderSettings handles GET /api/v1/settings/vector_embedder
+func GetVectorEmbedderSettings(c *gin.Context) {
+	cfg := store.GetVectorEmbedderSettings()
+	resp := gin.H{"type": cfg.Type, "model": cfg.Model, "provider_id": cfg.ProviderID}
+	if core.Vector != nil {
+		status := core.Vector.Status()
+		resp["active"] = status["embedder"]
+		resp["dim"] = status["dim"]
+		resp["reindex"] = status["reindex"]
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateVectorEmbedderSettings handles PUT /api/v1/settings/vector_embedder
+// The embedder is loaded (or its endpoint probed) before the setting is
+// saved; collections are then re-indexed in the background.
+func UpdateVectorEmbedderSettings(c *gin.Context) {
+	var req model.VectorEmbedderSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if err := core.NormalizeEmbedderSettings(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !waitVectorReady(c) {
+		return
+	}
+	if err := core.Vector.SetEmbedder(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.SaveVectorEmbedderSettings(&req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "status": core.Vector.Status()})
+}
+
+// GetMemoryConsolidationSettings handles GET /api/v1/settings/memory_consolidation
+func GetMemoryConsolidationSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, store.GetMemoryConsolidationSettings())
+}
+
+// UpdateMemoryConsolidationSettings handles PUT /api/v1/settings/memory_consolidation
+func UpdateMemoryConsolidationSettings(c *gin.Context) {
+	var req model.MemoryConsolidationSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if req.IntervalHours <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval_hours must be positive"})
+		return
+	}
+	if req.Threshold <= 0 || req.Threshold > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be in (0, 1]"})
+		return
+	}
+	if req.ProviderID != "" {
+		if _, err := store.GetProvider(req.ProviderID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "provider not found"})
+			return
+		}
+	}
+	if err := store.SaveMemoryConsolidationSettings(&req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
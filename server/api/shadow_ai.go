@@ -818,7 +818,7 @@ func getDefaultShadowRules() string {
 
 **步骤1：读取现有内容**
 ` + "`" + `bash
-curl -s http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category>
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -s http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category>
 ` + "`" + `
 返回 JSON：` + "`" + `{"category": "identity", "label": "用户身份画像", "content": "现有内容"}` + "`" + `
 
@@ -829,7 +829,7 @@ curl -s http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category>
 
 **步骤3：写回**
 ` + "`" + `bash
-curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category> \
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category> \
   -H 'Content-Type: application/json' \
   -d '{"content": "合并后的完整内容"}'
 ` + "`" + `
@@ -905,19 +905,19 @@ curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category>
 
 5. 验证写入成功：
    ` + "`" + `bash
-   curl -s http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category> | grep "新增的关键词"
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -s http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory/<category> | grep "新增的关键词"
    ` + "`" + `
 
 ### 注入路由管理（可选，首次启动已自动创建）
 
 查看现有路由：
 ` + "`" + `bash
-curl -s http://localhost:{{AI_HUB_PORT}}/api/v1/injection-router
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -s http://localhost:{{AI_HUB_PORT}}/api/v1/injection-router
 ` + "`" + `
 
 如需新增关键词映射：
 ` + "`" + `bash
-curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/injection-router \
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/injection-router \
   -H 'Content-Type: application/json' \
   -d '{"keywords": "新关键词|同义词", "inject_categories": "domain,lessons"}'
 ` + "`" + `
@@ -953,10 +953,10 @@ curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/injection-router \
 **更新方法**：
 ` + "`" + `bash
 # 先读取现有内容
-curl -s http://localhost:{{AI_HUB_PORT}}/api/v1/files/content?path=memory/shadow/status.md
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -s http://localhost:{{AI_HUB_PORT}}/api/v1/files/content?path=memory/shadow/status.md
 
 # 更新对应字段后写回
-curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
   -H 'Content-Type: application/json' \
   -d '{"path": "memory/shadow/status.md", "content": "更新后的完整内容"}'
 ` + "`" + `
@@ -982,10 +982,10 @@ curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
 **更新方法（追加模式）**：
 ` + "`" + `bash
 # 读取现有日志
-curl -s http://localhost:{{AI_HUB_PORT}}/api/v1/files/content?path=memory/shadow/work-log.md
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -s http://localhost:{{AI_HUB_PORT}}/api/v1/files/content?path=memory/shadow/work-log.md
 
 # 在末尾追加新条目后写回
-curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
   -H 'Content-Type: application/json' \
   -d '{"path": "memory/shadow/work-log.md", "content": "原内容 + 新条目"}'
 ` + "`" + `
@@ -1015,7 +1015,7 @@ curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
 
 **更新方法**：
 ` + "`" + `bash
-curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
   -H 'Content-Type: application/json' \
   -d '{"path": "memory/shadow/patrol-result.md", "content": "最新巡检结果"}'
 ` + "`" + `
@@ -1095,7 +1095,7 @@ ai-hub rules set <session_id> --content "原规则内容 + 新增规则"
 每次执行巡检、提炼、深度扫描、自清理任务后，必须调用活动记录接口：
 
 ` + "`" + `bash
-curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
+curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
   -H 'Content-Type: application/json' \
   -d '{
     "type": "patrol",
@@ -1131,7 +1131,7 @@ curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
 7. 追加一条到 memory/shadow/work-log.md
 8. 【必须】记录活动到数据库（验证返回 ok: true）：
    ` + "`" + `bash
-   curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
      -H 'Content-Type: application/json' \
      -d '{"type": "patrol", "summary": "巡检 #N：发现 X 个新增错误"}'
    ` + "`" + `
@@ -1147,7 +1147,7 @@ curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
 7. 追加一条到 memory/shadow/work-log.md（记录提炼了哪些分类）
 8. 【必须】记录活动到数据库（验证返回 ok: true）：
    ` + "`" + `bash
-   curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
      -H 'Content-Type: application/json' \
      -d '{"type": "extract", "summary": "提炼 #N：从 X 个会话提取记忆，更新 domain/lessons"}'
    ` + "`" + `
@@ -1198,10 +1198,10 @@ curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
 6. 记录修改历史到 memory/shadow/rule-changes.md：
    ` + "```bash" + `
    # 读取现有历史
-   curl -s http://localhost:{{AI_HUB_PORT}}/api/v1/files/content?scope=global&path=memory/shadow/rule-changes.md
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -s http://localhost:{{AI_HUB_PORT}}/api/v1/files/content?scope=global&path=memory/shadow/rule-changes.md
 
    # 追加新记录后写回
-   curl -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X PUT http://localhost:{{AI_HUB_PORT}}/api/v1/files/content \
      -H 'Content-Type: application/json' \
      -d '{
        "scope": "global",
@@ -1216,7 +1216,7 @@ curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
 
 9. 【必须】记录活动到数据库（验证返回 ok: true）：
    ` + "```bash" + `
-   curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
      -H 'Content-Type: application/json' \
      -d '{"type": "error_correction", "summary": "纠正 #N：修复会话 #X 的 Y 类错误规则，基于 Z 次同类错误"}'
    ` + "```" + `
@@ -1231,14 +1231,14 @@ curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
 ### 【深度巡检】触发时（每6小时）
 
 1. 全面检查所有会话健康度：` + "`" + `ai-hub sessions` + "`" + ` 查看 health_score
-2. 检查结构化记忆完整性：` + "`" + `curl http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory` + "`" + `
-3. 检查注入路由配置：` + "`" + `curl http://localhost:{{AI_HUB_PORT}}/api/v1/injection-router` + "`" + `
+2. 检查结构化记忆完整性：` + "`" + `curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" http://localhost:{{AI_HUB_PORT}}/api/v1/structured-memory` + "`" + `
+3. 检查注入路由配置：` + "`" + `curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" http://localhost:{{AI_HUB_PORT}}/api/v1/injection-router` + "`" + `
 4. 评估是否需要新增 Schema 或调整路由
 5. 更新 memory/shadow/status.md（更新"最后深扫"时间）
 6. 追加一条到 memory/shadow/work-log.md
 7. 【必须】记录活动到数据库（验证返回 ok: true）：
    ` + "`" + `bash
-   curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
      -H 'Content-Type: application/json' \
      -d '{"type": "deep_scan", "summary": "深扫 #N：检查 X 个会话，Y 个健康度低于 0.7"}'
    ` + "`" + `
@@ -1252,7 +1252,7 @@ curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
 5. 追加一条到 memory/shadow/work-log.md
 6. 【必须】记录活动到数据库（验证返回 ok: true）：
    ` + "`" + `bash
-   curl -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
+   curl -H "X-AI-Hub-Token: $AI_HUB_TOKEN" -X POST http://localhost:{{AI_HUB_PORT}}/api/v1/shadow-ai/activity \
      -H 'Content-Type: application/json' \
      -d '{"type": "self_clean", "summary": "清理 #N：归档日志 X 行，清理临时数据"}'
    ` + "`" + `
@@ -14,8 +14,8 @@ var dataDir string
 
 func InitDataDir(dir string) {
 	dataDir = dir
-	// Initialize hook stream callback (Issue #211)
-	initHookStreamCallback()
+	// In-process message delivery for triggers, hooks and channels (Issue #211)
+	initDispatcher()
 }
 
 type SkillInfo struct {
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// toolResultPreviewRunes caps the output carried by the tool_result WS event;
+// the full record is available from GET /sessions/:id/messages/:msg_id/tools.
+const toolResultPreviewRunes = 4000
+
+// ToolResultDetail is the JSON in the Detail field of a tool_result WS event.
+type ToolResultDetail struct {
+	IsError    bool  `json:"is_error"`
+	DurationMs int64 `json:"duration_ms"`
+	OutputSize int   `json:"output_size"`
+	Truncated  bool  `json:"truncated"`
+}
+
+// toolCallTracker pairs tool_use blocks from stream events with the
+// tool_result blocks of the CLI's "user" lines and persists complete records.
+type toolCallTracker struct {
+	sessID  int64
+	msgID   int64
+	send    func(WSMessage)
+	started map[string]time.Time
+	pending map[string]*model.ToolCall // tool_use_id → input complete, waiting for result
+}
+
+func newToolCallTracker(sessID, msgID int64, send func(WSMessage)) *toolCallTracker {
+	return &toolCallTracker{
+		sessID:  sessID,
+		msgID:   msgID,
+		send:    send,
+		started: make(map[string]time.Time),
+		pending: make(map[string]*model.ToolCall),
+	}
+}
+
+// start is called on content_block_start of a tool_use block.
+func (t *toolCallTracker) start(toolUseID string) {
+	t.started[toolUseID] = time.Now()
+}
+
+// inputDone is called on content_block_stop with the complete input JSON.
+func (t *toolCallTracker) inputDone(toolUseID, name, input string) {
+	startedAt, ok := t.started[toolUseID]
+	if !ok {
+		startedAt = time.Now()
+	}
+	t.pending[toolUseID] = &model.ToolCall{
+		SessionID: t.sessID,
+		MessageID: t.msgID,
+		ToolUseID: toolUseID,
+		Name:      name,
+		Input:     input,
+		StartedAt: startedAt.Format(time.RFC3339),
+	}
+}
+
+// handleUserLine consumes the tool_result blocks of a stream-json "user" line.
+func (t *toolCallTracker) handleUserLine(line string) {
+	var uMsg struct {
+		Message struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(line), &uMsg); err != nil {
+		return
+	}
+	var blocks []struct {
+		Type      string          `json:"type"`
+		ToolUseID string          `json:"tool_use_id"`
+		Content   json.RawMessage `json:"content"`
+		IsError   bool            `json:"is_error"`
+	}
+	// Plain string content is a user prompt, not tool results
+	if json.Unmarshal(uMsg.Message.Content, &blocks) != nil {
+		return
+	}
+	for _, b := range blocks {
+		if b.Type == "tool_result" {
+			t.finish(b.ToolUseID, toolResultText(b.Content), b.IsError)
+		}
+	}
+}
+
+// finish persists a tool call and pushes its result to the client.
+// Results of tools we did not see start (e.g. subagent calls) are ignored.
+func (t *toolCallTracker) finish(toolUseID, output string, isError bool) {
+	tc, ok := t.pending[toolUseID]
+	if !ok {
+		return
+	}
+	delete(t.pending, toolUseID)
+	if startedAt, ok := t.started[toolUseID]; ok {
+		tc.DurationMs = time.Since(startedAt).Milliseconds()
+		delete(t.started, toolUseID)
+	}
+	tc.Output, tc.IsError = output, isError
+	go core.FireHooks(core.HookEvent{
+		Type:            "tool.used",
+		SourceSessionID: t.sessID,
+		Content:         output,
+		Source:          core.TurnSource(t.sessID),
+		Vars: map[string]string{
+			"tool_name":   tc.Name,
+			"tool_input":  tc.Input,
+			"is_error":    strconv.FormatBool(isError),
+			"duration_ms": strconv.FormatInt(tc.DurationMs, 10),
+			"message_id":  strconv.FormatInt(t.msgID, 10),
+		},
+	})
+	if t.msgID > 0 {
+		if err := store.AddToolCall(tc); err != nil {
+			log.Printf("[tool-calls] session %d: save %s failed: %v", t.sessID, tc.Name, err)
+		}
+	} else {
+		tc.OutputSize = len(output)
+	}
+
+	detail, _ := json.Marshal(ToolResultDetail{
+		IsError:    tc.IsError,
+		DurationMs: tc.DurationMs,
+		OutputSize: tc.OutputSize,
+		Truncated:  tc.Truncated || len([]rune(output)) > toolResultPreviewRunes,
+	})
+	t.send(WSMessage{
+		Type:      "tool_result",
+		SessionID: t.sessID,
+		ToolID:    toolUseID,
+		ToolName:  tc.Name,
+		Content:   truncateRunes(output, toolResultPreviewRunes),
+		Detail:    string(detail),
+	})
+}
+
+// flush records tools that never produced a result (turn stopped or failed).
+func (t *toolCallTracker) flush() {
+	for id := range t.pending {
+		t.finish(id, "(no result: turn ended before the tool returned)", true)
+	}
+}
+
+// toolResultText flattens tool_result content: a string, or a list of
+// blocks of which text is kept and other types (images) are noted.
+func toolResultText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &blocks) != nil {
+		return string(raw)
+	}
+	parts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		} else {
+			parts = append(parts, "["+b.Type+"]")
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// GetMessageToolCalls handles GET /api/v1/sessions/:id/messages/:msg_id/tools[?full=true]
+// full=true loads truncated outputs from their overflow files.
+func GetMessageToolCalls(c *gin.Context) {
+	sessionID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	msgID, err := strconv.ParseInt(c.Param("msg_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+	list, err := store.ListToolCalls(msgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	full := c.Query("full") == "true" || c.Query("full") == "1"
+	result := make([]model.ToolCall, 0, len(list))
+	for _, tc := range list {
+		if tc.SessionID != sessionID {
+			continue
+		}
+		if full && tc.Truncated {
+			if out, err := store.ReadToolOutputFile(&tc); err == nil {
+				tc.Output = out
+			}
+		}
+		result = append(result, tc)
+	}
+	c.JSON(http.StatusOK, result)
+}
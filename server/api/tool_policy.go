@@ -0,0 +1,146 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSessionToolPolicy handles GET /api/v1/sessions/:id/tool-policy
+// Returns the session's own policy, the effective one (session > group) and the compiled CLI flags.
+func GetSessionToolPolicy(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	session, err := store.GetSession(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	own := store.GetToolPolicy(store.PolicyScopeSession, strconv.FormatInt(id, 10))
+	effective := store.ResolveToolPolicy(id, session.GroupName)
+	source := "none"
+	switch {
+	case own != nil:
+		source = "session"
+	case effective != nil:
+		source = "group"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"policy":    own,
+		"effective": effective,
+		"source":    source,
+		"cli_args":  core.PermissionArgs(effective, []string{"EnterPlanMode", "ExitPlanMode"}),
+	})
+}
+
+// PutSessionToolPolicy handles PUT /api/v1/sessions/:id/tool-policy {preset | policy fields}
+func PutSessionToolPolicy(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	if _, err := store.GetSession(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	putToolPolicy(c, store.PolicyScopeSession, strconv.FormatInt(id, 10), []int64{id})
+}
+
+// DeleteSessionToolPolicy handles DELETE /api/v1/sessions/:id/tool-policy (falls back to the group policy)
+func DeleteSessionToolPolicy(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+	if err := store.SetToolPolicy(store.PolicyScopeSession, strconv.FormatInt(id, 10), nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	core.Pool.Kill(id)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// GetGroupToolPolicy handles GET /api/v1/groups/:name/tool-policy
+func GetGroupToolPolicy(c *gin.Context) {
+	p := store.GetToolPolicy(store.PolicyScopeGroup, c.Param("name"))
+	c.JSON(http.StatusOK, gin.H{
+		"policy":   p,
+		"cli_args": core.PermissionArgs(p, []string{"EnterPlanMode", "ExitPlanMode"}),
+	})
+}
+
+// PutGroupToolPolicy handles PUT /api/v1/groups/:name/tool-policy {preset | policy fields}
+func PutGroupToolPolicy(c *gin.Context) {
+	name := c.Param("name")
+	putToolPolicy(c, store.PolicyScopeGroup, name, groupSessionIDs(name))
+}
+
+// DeleteGroupToolPolicy handles DELETE /api/v1/groups/:name/tool-policy
+func DeleteGroupToolPolicy(c *gin.Context) {
+	name := c.Param("name")
+	if err := store.SetToolPolicy(store.PolicyScopeGroup, name, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, id := range groupSessionIDs(name) {
+		core.Pool.Kill(id)
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func groupSessionIDs(group string) []int64 {
+	sessions, err := store.ListSessionsByGroup(group)
+	if err != nil {
+		return nil
+	}
+	ids := make([]int64, 0, len(sessions))
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+// putToolPolicy saves a policy (or a named preset) and restarts the affected
+// processes: permission flags are fixed when the CLI process is spawned.
+func putToolPolicy(c *gin.Context, scope, key string, affected []int64) {
+	var req struct {
+		Preset string `json:"preset"`
+		model.ToolPolicy
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy := req.ToolPolicy
+	if req.Preset != "" {
+		preset, ok := core.ToolPolicyPresets[req.Preset]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown preset: " + req.Preset})
+			return
+		}
+		policy = preset
+	}
+	if err := core.NormalizeToolPolicy(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := store.SetToolPolicy(scope, key, &policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, id := range affected {
+		core.Pool.Kill(id)
+	}
+	log.Printf("[tool-policy] %s %s updated (mode=%s allowed=%d denied=%d)", scope, key, policy.PermissionMode, len(policy.AllowedTools), len(policy.DeniedTools))
+	c.JSON(http.StatusOK, gin.H{"ok": true, "policy": policy})
+}
@@ -6,6 +6,7 @@ import (
 	"ai-hub/server/store"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -53,7 +54,11 @@ func CreateTrigger(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "session_id, content, trigger_time required"})
 		return
 	}
-	if errMsg := core.ValidateTriggerTime(t.TriggerTime); errMsg != "" {
+	if _, errMsg := core.ValidateTriggerTime(&t, 1); errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	if errMsg := core.ValidateTriggerPolicy(&t); errMsg != "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
 		return
 	}
@@ -95,10 +100,15 @@ func UpdateTrigger(c *gin.Context) {
 		return
 	}
 	var req struct {
-		Content     *string `json:"content"`
-		TriggerTime *string `json:"trigger_time"`
-		MaxFires    *int    `json:"max_fires"`
-		Enabled     *bool   `json:"enabled"`
+		Content     *string   `json:"content"`
+		TriggerTime *string   `json:"trigger_time"`
+		Timezone    *string   `json:"timezone"`
+		Exclusions  *[]string `json:"exclusions"`
+		MaxFires    *int      `json:"max_fires"`
+		Misfire     *string   `json:"misfire"`
+		RetryLimit  *int      `json:"retry_limit"`
+		RetryDelay  *string   `json:"retry_delay"`
+		Enabled     *bool     `json:"enabled"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -107,16 +117,39 @@ func UpdateTrigger(c *gin.Context) {
 	if req.Content != nil {
 		existing.Content = *req.Content
 	}
-	if req.TriggerTime != nil {
-		if errMsg := core.ValidateTriggerTime(*req.TriggerTime); errMsg != "" {
+	if req.TriggerTime != nil || req.Timezone != nil || req.Exclusions != nil {
+		if req.TriggerTime != nil {
+			existing.TriggerTime = *req.TriggerTime
+		}
+		if req.Timezone != nil {
+			existing.Timezone = *req.Timezone
+		}
+		if req.Exclusions != nil {
+			existing.Exclusions = *req.Exclusions
+		}
+		if _, errMsg := core.ValidateTriggerTime(existing, 1); errMsg != "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
 			return
 		}
-		existing.TriggerTime = *req.TriggerTime
 	}
 	if req.MaxFires != nil {
 		existing.MaxFires = *req.MaxFires
 	}
+	if req.Misfire != nil || req.RetryLimit != nil || req.RetryDelay != nil {
+		if req.Misfire != nil {
+			existing.Misfire = *req.Misfire
+		}
+		if req.RetryLimit != nil {
+			existing.RetryLimit = *req.RetryLimit
+		}
+		if req.RetryDelay != nil {
+			existing.RetryDelay = *req.RetryDelay
+		}
+		if errMsg := core.ValidateTriggerPolicy(existing); errMsg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+			return
+		}
+	}
 	if req.Enabled != nil {
 		existing.Enabled = *req.Enabled
 	}
@@ -147,3 +180,88 @@ func DeleteTrigger(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
+
+// ListTriggerRuns GET /api/v1/triggers/:id/runs?limit=50
+// Returns the trigger's runs (fire time, outcome, error, message ID), newest first.
+func ListTriggerRuns(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if _, err := store.GetTrigger(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "trigger not found"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit > 500 {
+		limit = 500
+	}
+	runs, err := store.ListTriggerRuns(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// PreviewTrigger POST /api/v1/triggers/preview
+// Body: {"trigger_time": "0 9 * * 1-5", "timezone": "...", "exclusions": [...], "count": 5}.
+// Validates the schedule and returns its next fire times without saving.
+func PreviewTrigger(c *gin.Context) {
+	var req struct {
+		model.Trigger
+		Count int `json:"count"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TriggerTime == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "trigger_time required"})
+		return
+	}
+	if req.Count <= 0 {
+		req.Count = 5
+	}
+	if req.Count > 100 {
+		req.Count = 100
+	}
+	next, errMsg := core.ValidateTriggerTime(&req.Trigger, req.Count)
+	if errMsg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"next": next})
+}
+
+// GetTriggerCalendars GET /api/v1/settings/trigger_calendars
+func GetTriggerCalendars(c *gin.Context) {
+	c.JSON(http.StatusOK, store.GetTriggerCalendars())
+}
+
+// UpdateTriggerCalendars PUT /api/v1/settings/trigger_calendars
+// Body: {"cn-holidays": ["2026-10-01..2026-10-07", "01-01"], ...}; replaces
+// all holiday lists, which triggers exclude with "@name".
+func UpdateTriggerCalendars(c *gin.Context) {
+	var req map[string][]string
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request: " + err.Error()})
+		return
+	}
+	for name, days := range req {
+		if name == "" || strings.ContainsAny(name, "@ ") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid holiday list name: " + name})
+			return
+		}
+		if err := core.ValidateExclusions(days); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + ": " + err.Error()})
+			return
+		}
+	}
+	if err := store.SaveTriggerCalendars(req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
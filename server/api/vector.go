@@ -136,20 +136,39 @@ func isValidScope(scope string) bool {
 // POST /api/v1/vector/search
 func SearchVector(c *gin.Context) {
 	var req struct {
-		Scope     string   `json:"scope"`
-		Query     string   `json:"query"`
-		TopK      int      `json:"top_k"`
-		SessionID int64    `json:"session_id"` // optional: auto-resolve team scope
-		Tags      []string `json:"tags"`       // optional: post-filter by tags
+		Scope     string             `json:"scope"`
+		Scopes    []core.ScopeWeight `json:"scopes"` // optional: federated search over weighted scopes (overrides scope)
+		Query     string             `json:"query"`
+		TopK      int                `json:"top_k"`
+		SessionID int64              `json:"session_id"` // optional: auto-resolve team scope
+		Tags      []string           `json:"tags"`       // optional: documents with any of these tags
+		Mode      string             `json:"mode"`       // hybrid (default) | semantic | keyword
+		Filter    json.RawMessage    `json:"filter"`     // optional: metadata filter, see core/vector_filter.go
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	mode, err := core.NormalizeSearchMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := searchFilter(req.Filter, req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if req.Scope != "" && !isValidScope(req.Scope) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be 'memory' or '<groupname>/memory'"})
 		return
 	}
+	for _, sw := range req.Scopes {
+		if !isValidScope(sw.Scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope: " + sw.Scope})
+			return
+		}
+	}
 	if req.Query == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
 		return
@@ -163,22 +182,16 @@ func SearchVector(c *gin.Context) {
 	if !waitVectorReady(c) {
 		return
 	}
-	// Fetch extra candidates when filtering by tags
-	fetchK := req.TopK
-	if len(req.Tags) > 0 {
-		fetchK = req.TopK * 3
+	var results []map[string]interface{}
+	if len(req.Scopes) > 0 {
+		results, err = core.Vector.FederatedSearch(req.Scopes, req.Query, req.TopK, mode, filter)
+	} else {
+		results, err = core.Vector.Search(req.Scope, req.Query, req.TopK, mode, filter)
 	}
-	results, err := core.Vector.Search(req.Scope, req.Query, fetchK)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if len(req.Tags) > 0 {
-		results = filterByTags(results, req.Tags)
-		if len(results) > req.TopK {
-			results = results[:req.TopK]
-		}
-	}
 	c.JSON(http.StatusOK, gin.H{"results": results})
 }
 
@@ -269,16 +282,37 @@ func sortPriority(r map[string]interface{}, sessionID int64) int {
 
 func vectorSearch(c *gin.Context, defaultScope string) {
 	var req struct {
-		Query     string   `json:"query"`
-		TopK      int      `json:"top_k"`
-		Scope     string   `json:"scope"`      // optional: explicit scope override
-		SessionID int64    `json:"session_id"` // optional: auto-resolve team scope + sorting
-		Tags      []string `json:"tags"`       // optional: post-filter by tags
+		Query     string             `json:"query"`
+		TopK      int                `json:"top_k"`
+		Scope     string             `json:"scope"`      // optional: explicit scope override
+		Scopes    []core.ScopeWeight `json:"scopes"`     // optional: federated search over weighted scopes
+		SessionID int64              `json:"session_id"` // optional: auto-resolve team scope + sorting
+		Tags      []string           `json:"tags"`       // optional: documents with any of these tags
+		Mode      string             `json:"mode"`       // hybrid (default) | semantic | keyword
+		Filter    json.RawMessage    `json:"filter"`     // optional: metadata filter, see core/vector_filter.go
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	mode, err := core.NormalizeSearchMode(req.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := searchFilter(req.Filter, req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Hybrid and keyword modes rank exact terms with BM25 already; the
+	// substring scan only supplements pure semantic search
+	keywordScan := func(scope string, k int) []map[string]interface{} {
+		if mode != core.SearchSemantic {
+			return nil
+		}
+		return core.Vector.KeywordSearch(scope, req.Query, k, filter)
+	}
 	if req.Query == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
 		return
@@ -290,12 +324,6 @@ func vectorSearch(c *gin.Context, defaultScope string) {
 		return
 	}
 
-	// Determine fetch multiplier for tag filtering
-	fetchK := req.TopK
-	if len(req.Tags) > 0 {
-		fetchK = req.TopK * 3
-	}
-
 	// Determine type label from scope suffix
 	scopeType := defaultScope // "memory"
 
@@ -310,14 +338,11 @@ func vectorSearch(c *gin.Context, defaultScope string) {
 		scopeType = parts[len(parts)-1]
 		scopeLevel := detectScopeLevel(req.Scope)
 
-		results, err := core.Vector.Search(req.Scope, req.Query, fetchK)
+		results, err := core.Vector.Search(req.Scope, req.Query, req.TopK, mode, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		if len(req.Tags) > 0 {
-			results = filterByTags(results, req.Tags)
-		}
 		// Merge keyword search results
 		seen := make(map[string]bool)
 		enriched := make([]map[string]interface{}, 0, len(results))
@@ -329,7 +354,7 @@ func vectorSearch(c *gin.Context, defaultScope string) {
 			seen[id] = true
 			enriched = append(enriched, e)
 		}
-		kwResults := core.Vector.KeywordSearch(req.Scope, req.Query, fetchK)
+		kwResults := keywordScan(req.Scope, req.TopK)
 		for _, r := range kwResults {
 			id, _ := r["id"].(string)
 			if !seen[id] {
@@ -347,148 +372,82 @@ func vectorSearch(c *gin.Context, defaultScope string) {
 		return
 	}
 
-	// Auto-resolve: three-layer merge (session → team → global)
-	var sessionGroup string
-	if req.SessionID > 0 {
-		if sess, err := store.GetSession(req.SessionID); err == nil {
-			sessionGroup = sess.GroupName
-			if sessionGroup == "" {
-				sessionGroup = "_standalone"
-			}
-		}
+	// Federated: the requested scopes, or session → team → global (just
+	// global without a session) searched in parallel
+	scopes := req.Scopes
+	prioritySort := false
+	if len(scopes) == 0 {
+		scopes = core.SessionScopes(req.SessionID, defaultScope)
+		prioritySort = true
 	}
-
-	if sessionGroup != "" {
-		var merged []map[string]interface{}
-		seen := make(map[string]bool)
-
-		// 1. Search session scope
-		sessionScope := sessionGroup + "/sessions/" + strconv.FormatInt(req.SessionID, 10) + "/" + defaultScope
-		sessionResults, err := core.Vector.Search(sessionScope, req.Query, fetchK)
-		if err != nil {
-			log.Printf("[vector] session search error (scope=%s): %v", sessionScope, err)
-		} else {
-			for _, r := range sessionResults {
-				e := enrichResult(r, scopeType, "session")
-				id, _ := e["id"].(string)
-				seen[id] = true
-				merged = append(merged, e)
-			}
-		}
-		// Keyword search in session scope
-		kwResults := core.Vector.KeywordSearch(sessionScope, req.Query, fetchK)
-		for _, r := range kwResults {
-			id, _ := r["id"].(string)
-			if !seen[id] {
-				e := enrichResult(r, scopeType, "session")
-				seen[id] = true
-				merged = append(merged, e)
-			}
-		}
-
-		// 2. Search team scope
-		teamScope := sessionGroup + "/" + defaultScope
-		teamResults, err2 := core.Vector.Search(teamScope, req.Query, fetchK)
-		if err2 != nil {
-			log.Printf("[vector] team search error (scope=%s): %v", teamScope, err2)
-		} else {
-			for _, r := range teamResults {
-				id, _ := r["id"].(string)
-				if !seen[id] {
-					e := enrichResult(r, scopeType, "team")
-					seen[id] = true
-					merged = append(merged, e)
-				}
-			}
-		}
-		kwResults = core.Vector.KeywordSearch(teamScope, req.Query, fetchK)
-		for _, r := range kwResults {
-			id, _ := r["id"].(string)
-			if !seen[id] {
-				e := enrichResult(r, scopeType, "team")
-				seen[id] = true
-				merged = append(merged, e)
-			}
-		}
-
-		// 3. Search global scope
-		globalResults, err3 := core.Vector.Search(defaultScope, req.Query, fetchK)
-		if err3 != nil {
-			log.Printf("[vector] global search error (scope=%s): %v", defaultScope, err3)
-		} else {
-			for _, r := range globalResults {
-				id, _ := r["id"].(string)
-				if !seen[id] {
-					e := enrichResult(r, scopeType, "global")
-					merged = append(merged, e)
-					seen[id] = true
-				}
-			}
+	merged, err := federatedSearch(scopes, req.Query, req.TopK, mode, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	seen := make(map[string]bool)
+	for _, r := range merged {
+		scope, _ := r["scope"].(string)
+		id, _ := r["id"].(string)
+		seen[scope+"/"+id] = true
+	}
+	for _, sw := range scopes {
+		origin := sw.Origin
+		if origin == "" {
+			origin = core.ScopeOrigin(sw.Scope)
 		}
-		kwResults = core.Vector.KeywordSearch(defaultScope, req.Query, fetchK)
-		for _, r := range kwResults {
+		for _, r := range keywordScan(sw.Scope, req.TopK) {
 			id, _ := r["id"].(string)
-			if !seen[id] {
-				e := enrichResult(r, scopeType, "global")
+			if !seen[sw.Scope+"/"+id] {
+				e := enrichResult(r, scopeSuffix(sw.Scope), origin)
+				e["scope"] = sw.Scope
+				seen[sw.Scope+"/"+id] = true
 				merged = append(merged, e)
-				seen[id] = true
 			}
 		}
+	}
 
-		// Tag filter before sorting
-		if len(req.Tags) > 0 {
-			merged = filterByTags(merged, req.Tags)
-		}
-
-		// Sort: self(0) > session(1) > team(2) > global(3)
+	// Layered search sorts self(0) > session(1) > team(2) > global(3);
+	// explicit scopes keep the weighted ranking
+	if prioritySort {
 		sortResults(merged, req.SessionID)
+	}
 
-		// Trim to topK and remove internal _origin field
-		if len(merged) > req.TopK {
-			merged = merged[:req.TopK]
-		}
-		for _, r := range merged {
-			r["origin"] = r["_origin"]
-			delete(r, "_origin")
-		}
-		c.JSON(http.StatusOK, gin.H{"results": merged})
-		return
+	// Trim to topK and remove internal _origin field
+	if len(merged) > req.TopK {
+		merged = merged[:req.TopK]
+	}
+	for _, r := range merged {
+		r["origin"] = r["_origin"]
+		delete(r, "_origin")
 	}
+	c.JSON(http.StatusOK, gin.H{"results": merged})
+}
 
-	// Default: search global scope only
-	results, err := core.Vector.Search(defaultScope, req.Query, fetchK)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// federatedSearch runs a weighted multi-scope search and enriches each hit
+// like enrichResult, keeping _origin for sortResults.
+func federatedSearch(scopes []core.ScopeWeight, query string, topK int, mode string, filter *core.Filter) ([]map[string]interface{}, error) {
+	for _, sw := range scopes {
+		if !isValidScope(sw.Scope) {
+			return nil, fmt.Errorf("invalid scope: %s", sw.Scope)
+		}
 	}
-	if len(req.Tags) > 0 {
-		results = filterByTags(results, req.Tags)
+	results, err := core.Vector.FederatedSearch(scopes, query, topK, mode, filter)
+	if err != nil {
+		return nil, err
 	}
-	seen := make(map[string]bool)
 	enriched := make([]map[string]interface{}, 0, len(results))
 	for _, r := range results {
-		e := enrichResult(r, scopeType, "global")
-		e["origin"] = e["_origin"]
-		delete(e, "_origin")
-		id, _ := e["id"].(string)
-		seen[id] = true
-		enriched = append(enriched, e)
-	}
-	kwResults := core.Vector.KeywordSearch(defaultScope, req.Query, fetchK)
-	for _, r := range kwResults {
-		id, _ := r["id"].(string)
-		if !seen[id] {
-			e := enrichResult(r, scopeType, "global")
-			e["origin"] = e["_origin"]
-			delete(e, "_origin")
-			seen[id] = true
-			enriched = append(enriched, e)
-		}
-	}
-	if len(enriched) > req.TopK {
-		enriched = enriched[:req.TopK]
+		scope, _ := r["scope"].(string)
+		origin, _ := r["origin"].(string)
+		enriched = append(enriched, enrichResult(r, scopeSuffix(scope), origin))
 	}
-	c.JSON(http.StatusOK, gin.H{"results": enriched})
+	return enriched, nil
+}
+
+// scopeSuffix returns a scope's type, e.g. "memory" for "team/memory".
+func scopeSuffix(scope string) string {
+	return scope[strings.LastIndex(scope, "/")+1:]
 }
 
 // sortResults sorts results in-place: self > team > global, same priority keeps original order.
@@ -506,56 +465,15 @@ func sortResults(results []map[string]interface{}, sessionID int64) {
 	}
 }
 
-// filterByTags filters vector results to only include those whose metadata contains
-// at least one of the requested tags. Tags in metadata are stored as a JSON-encoded
-// string array (e.g. "[\"deploy\",\"sop\"]") due to ChromaDB limitations.
-func filterByTags(results []map[string]interface{}, tags []string) []map[string]interface{} {
-	if len(tags) == 0 {
-		return results
-	}
-	tagSet := make(map[string]bool, len(tags))
-	for _, t := range tags {
-		tagSet[strings.TrimSpace(t)] = true
-	}
-
-	var filtered []map[string]interface{}
-	for _, r := range results {
-		meta, ok := r["metadata"].(map[string]interface{})
-		if !ok {
-			continue
-		}
-		tagsRaw, ok := meta["mem_tags"]
-		if !ok {
-			// Also check "tags" key for non-mem records
-			tagsRaw, ok = meta["tags"]
-			if !ok {
-				continue
-			}
-		}
-		// Parse tags: may be JSON string or []interface{} depending on storage
-		var docTags []string
-		switch v := tagsRaw.(type) {
-		case string:
-			if err := json.Unmarshal([]byte(v), &docTags); err != nil {
-				continue
-			}
-		case []interface{}:
-			for _, t := range v {
-				if s, ok := t.(string); ok {
-					docTags = append(docTags, s)
-				}
-			}
-		default:
-			continue
-		}
-		for _, dt := range docTags {
-			if tagSet[dt] {
-				filtered = append(filtered, r)
-				break
-			}
-		}
+// searchFilter parses a request's metadata filter and folds in its tags.
+// Tags in metadata are a JSON-encoded string array (e.g. "[\"deploy\",\"sop\"]")
+// under mem_tags, or tags for non-mem records.
+func searchFilter(raw json.RawMessage, tags []string) (*core.Filter, error) {
+	filter, err := core.ParseFilter(raw)
+	if err != nil {
+		return nil, err
 	}
-	return filtered
+	return core.AndFilters(filter, core.TagsFilter(tags)), nil
 }
 
 // ReadMemory reads a memory file's full content
@@ -863,11 +781,13 @@ func VectorHealth(c *gin.Context) {
 	status := core.Vector.Status()
 	ready, _ := status["ready"].(bool)
 	disabled, _ := status["disabled"].(bool)
+	degraded, _ := status["degraded"].(bool)
 	errMsg, _ := status["error"].(string)
 
 	health := gin.H{
 		"ready":    ready,
 		"disabled": disabled,
+		"degraded": degraded,
 	}
 	if errMsg != "" {
 		health["error"] = errMsg
@@ -880,6 +800,10 @@ func VectorHealth(c *gin.Context) {
 		} else {
 			health["fix_hint"] = "engine_not_ready"
 		}
+	} else if degraded {
+		// 模型不可用：记忆仍可写入，检索降级为关键词
+		health["fix_hint"] = "model_missing"
+		health["pending_embeddings"] = status["pending_embeddings"]
 	}
 
 	c.JSON(http.StatusOK, health)
@@ -935,7 +859,10 @@ type VectorFileItem struct {
 }
 
 // ListVectorFilesRich lists .md files with preview, type, source_session_id, origin, and updated_at.
-// GET /api/v1/vector/list_files?session_id=<id>&scope=<optional>&list_global=<bool>&type=<memory|all>&level=<session|team|global|all>
+// GET /api/v1/vector/list_files?session_id=<id>&scope=<optional>&list_global=<bool>&type=<memory|all>&level=<session|team|global|all>&tag=<tag>&filter=<json>
+//
+// filter is a metadata filter (see core/vector_filter.go), ANDed with tag.
+// Files without vector metadata are skipped when either is set.
 //
 // level parameter:
 //   - "session": only session-level files
@@ -952,6 +879,12 @@ func ListVectorFilesRich(c *gin.Context) {
 	levelFilter := strings.TrimSpace(c.Query("level")) // "session" | "team" | "global" | "all" | ""
 	tagFilter := strings.TrimSpace(c.Query("tag"))     // optional: filter by tag
 
+	filter, err := searchFilter(json.RawMessage(c.Query("filter")), []string{tagFilter})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if levelFilter == "" {
 		levelFilter = "all"
 	}
@@ -1032,7 +965,7 @@ func ListVectorFilesRich(c *gin.Context) {
 		// Get vector metadata for source_session_id (best-effort, nil if engine not ready)
 		var metaMap map[string]map[string]interface{}
 		if core.Vector != nil {
-			metaMap = core.Vector.ListMetadata(se.scope)
+			metaMap = core.Vector.ListMetadata(se.scope, filter)
 		}
 
 		for _, e := range entries {
@@ -1071,39 +1004,10 @@ func ListVectorFilesRich(c *gin.Context) {
 				}
 			}
 
-			// Tag filter: skip files that don't match the requested tag
-			if tagFilter != "" && metaMap != nil {
-				if meta, ok := metaMap[e.Name()]; ok {
-					matched := false
-					for _, key := range []string{"mem_tags", "tags"} {
-						if tagsRaw, ok := meta[key]; ok {
-							var docTags []string
-							switch v := tagsRaw.(type) {
-							case string:
-								json.Unmarshal([]byte(v), &docTags)
-							case []interface{}:
-								for _, t := range v {
-									if s, ok := t.(string); ok {
-										docTags = append(docTags, s)
-									}
-								}
-							}
-							for _, dt := range docTags {
-								if dt == tagFilter {
-									matched = true
-									break
-								}
-							}
-						}
-						if matched {
-							break
-						}
-					}
-					if !matched {
-						continue
-					}
-				} else {
-					continue // no metadata = no tags = skip
+			// Metadata filter: ListMetadata only returned matching files
+			if filter != nil && metaMap != nil {
+				if _, ok := metaMap[e.Name()]; !ok {
+					continue
 				}
 			}
 
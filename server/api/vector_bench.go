@@ -0,0 +1,49 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// vectorBenchRunning allows one benchmark at a time: it saturates a CPU core.
+var vectorBenchRunning atomic.Bool
+
+// BenchmarkVector compares the HNSW index with brute-force search
+// (recall@k and latency) on synthetic data or a stored scope.
+// POST /api/v1/vector/benchmark {sizes, dim, queries, top_k, ef_search, scope}
+func BenchmarkVector(c *gin.Context) {
+	if core.Vector == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vector engine not initialized"})
+		return
+	}
+	var opts core.ANNBenchOptions
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if opts.Scope != "" && !isValidScope(opts.Scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scope"})
+		return
+	}
+	if err := core.NormalizeANNBench(&opts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !vectorBenchRunning.CompareAndSwap(false, true) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a benchmark is already running"})
+		return
+	}
+	defer vectorBenchRunning.Store(false)
+
+	results, err := core.Vector.RunANNBenchmark(opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"options": opts, "results": results})
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"ai-hub/server/core"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportVectorModel installs the embedding model from a tarball, for
+// machines that cannot download it. Either upload the file (multipart
+// field "file") or name a tarball already on the server.
+// POST /api/v1/vector/model/import  (multipart "file" | {"path": "/abs/model.tar.gz"})
+func ImportVectorModel(c *gin.Context) {
+	if core.Vector == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "vector engine not initialized"})
+		return
+	}
+
+	var src io.Reader
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		src = f
+	} else {
+		var req struct {
+			Path string `json:"path"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil || req.Path == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path or multipart file is required"})
+			return
+		}
+		if !filepath.IsAbs(req.Path) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "path must be absolute"})
+			return
+		}
+		f, err := os.Open(req.Path)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		src = f
+	}
+
+	if err := core.Vector.ImportModel(src); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "status": core.Vector.Status()})
+}
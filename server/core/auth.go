@@ -0,0 +1,163 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TokenPrefix marks AI Hub API tokens. Used to tell them apart from provider
+// credentials that travel in the same Authorization header (e.g. via the proxy).
+const TokenPrefix = "aih_"
+
+// TokenHeader is the dedicated request header for AI Hub tokens.
+const TokenHeader = "X-AI-Hub-Token"
+
+var (
+	internalToken     string
+	internalTokenOnce sync.Once
+)
+
+// AuthEnabled reports whether API authentication is enforced.
+// Set AI_HUB_AUTH=off to disable (local development only).
+func AuthEnabled() bool {
+	return !strings.EqualFold(strings.TrimSpace(os.Getenv("AI_HUB_AUTH")), "off")
+}
+
+// GenerateToken returns a new random token and its storage hash.
+func GenerateToken() (plain, hash string) {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	plain = TokenPrefix + hex.EncodeToString(buf)
+	return plain, HashToken(plain)
+}
+
+// HashToken returns the hex SHA-256 of a token (only hashes are persisted).
+func HashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// InternalToken returns the in-memory admin token used by in-process callers
+// that go through the HTTP API; their requests are marked AuthInfo.Internal.
+// Never persisted.
+func InternalToken() string {
+	internalTokenOnce.Do(func() {
+		internalToken, _ = GenerateToken()
+	})
+	return internalToken
+}
+
+// IsInternalToken checks a token against the in-memory internal token.
+func IsInternalToken(tok string) bool {
+	return tok != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(InternalToken())) == 1
+}
+
+// BootstrapTokenPath returns <data-dir>/auth.token, the file holding the
+// first admin token. The CLI reads it when AI_HUB_TOKEN is not set.
+func BootstrapTokenPath() string {
+	return filepath.Join(GetDataDir(), "auth.token")
+}
+
+// InitAuth revokes stale session tokens and makes sure at least one admin
+// token exists. When a new admin token is minted it is written to
+// BootstrapTokenPath (0600) and its path is returned.
+func InitAuth() (string, error) {
+	store.DeleteAllSessionAPITokens()
+	if store.CountAdminAPITokens() > 0 {
+		return "", nil
+	}
+	plain, hash := GenerateToken()
+	t := &model.APIToken{
+		Name:      "bootstrap",
+		Role:      model.RoleAdmin,
+		Prefix:    plain[:len(TokenPrefix)+6],
+		TokenHash: hash,
+	}
+	if err := store.CreateAPIToken(t); err != nil {
+		return "", fmt.Errorf("create bootstrap token: %w", err)
+	}
+	path := BootstrapTokenPath()
+	if err := os.WriteFile(path, []byte(plain+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("write bootstrap token: %w", err)
+	}
+	log.Printf("[auth] bootstrap admin token written to %s", path)
+	return path, nil
+}
+
+var (
+	sessionTokens   = make(map[int64]string) // hubSessionID → plaintext (process lifetime)
+	sessionTokensMu sync.Mutex
+)
+
+// IssueSessionToken returns the token scoped to one hub session, minting it on
+// first use. Injected into Claude subprocesses as AI_HUB_TOKEN so the
+// `ai-hub` CLI and curl calls made by the agent act only as that session.
+// Session tokens are reused across processes of the same session and revoked
+// on server restart (InitAuth) or session deletion.
+func IssueSessionToken(hubSessionID int64) string {
+	if hubSessionID <= 0 {
+		return ""
+	}
+	sessionTokensMu.Lock()
+	defer sessionTokensMu.Unlock()
+	if tok, ok := sessionTokens[hubSessionID]; ok {
+		if _, err := store.GetAPITokenByHash(HashToken(tok)); err == nil {
+			return tok
+		}
+	}
+	store.DeleteSessionAPITokens(hubSessionID)
+	plain, hash := GenerateToken()
+	t := &model.APIToken{
+		Name:      fmt.Sprintf("session-%d", hubSessionID),
+		Role:      model.RoleOperator,
+		SessionID: hubSessionID,
+		Prefix:    plain[:len(TokenPrefix)+6],
+		TokenHash: hash,
+	}
+	if err := store.CreateAPIToken(t); err != nil {
+		log.Printf("[auth] session %d: failed to issue token: %v", hubSessionID, err)
+		return ""
+	}
+	sessionTokens[hubSessionID] = plain
+	return plain
+}
+
+// appendSessionTokenEnv injects the session token into a subprocess env:
+// AI_HUB_TOKEN for the CLI, and a header line in ANTHROPIC_CUSTOM_HEADERS so
+// the Claude CLI authenticates against the local Anthropic proxy. Headers
+// already set there (e.g. for a corporate gateway) are kept; the proxy strips
+// only the token before forwarding.
+func appendSessionTokenEnv(env []string, hubSessionID int64) []string {
+	tok := IssueSessionToken(hubSessionID)
+	if tok == "" {
+		return env
+	}
+	env = append(env, "AI_HUB_TOKEN="+tok)
+	const key = "ANTHROPIC_CUSTOM_HEADERS="
+	var lines []string
+	for i := 0; i < len(env); i++ {
+		if !strings.HasPrefix(env[i], key) {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimPrefix(env[i], key), "\n") {
+			name, _, _ := strings.Cut(line, ":")
+			if strings.TrimSpace(line) != "" && !strings.EqualFold(strings.TrimSpace(name), TokenHeader) {
+				lines = append(lines, line)
+			}
+		}
+		env = append(env[:i], env[i+1:]...)
+		i--
+	}
+	lines = append(lines, TokenHeader+": "+tok)
+	return append(env, key+strings.Join(lines, "\n"))
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"context"
+	"sync"
+)
+
+// AgentBackend runs one conversation turn for a hub session.
+//
+// Backends report progress as Claude Code stream-json lines (stream_event /
+// assistant / result), the event format the chat layer already parses.
+// Backends that talk to other APIs translate their native stream into it.
+type AgentBackend interface {
+	// Name is the provider mode this backend serves (model.Mode*).
+	Name() string
+	// StreamTurn sends req.Query (with req.SystemPrompt) and calls onLine
+	// for every stream-json event until the turn completes.
+	StreamTurn(ctx context.Context, req ClaudeCodeRequest, onLine func(string)) error
+}
+
+var (
+	backends   = make(map[string]AgentBackend)
+	backendsMu sync.RWMutex
+)
+
+func init() {
+	RegisterBackend(NewClaudeCodeClient())
+	RegisterBackend(NewOpenAIBackend(NewOpenAIClient()))
+}
+
+// RegisterBackend adds (or replaces) the backend for its mode.
+func RegisterBackend(b AgentBackend) {
+	backendsMu.Lock()
+	backends[b.Name()] = b
+	backendsMu.Unlock()
+}
+
+// BackendFor returns the backend for a provider mode, defaulting to Claude Code.
+func BackendFor(mode string) AgentBackend {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	if b, ok := backends[mode]; ok {
+		return b
+	}
+	return backends[model.ModeClaudeCode]
+}
+
+// Name implements AgentBackend.
+func (c *ClaudeCodeClient) Name() string { return model.ModeClaudeCode }
+
+// StreamTurn implements AgentBackend using the persistent process pool.
+func (c *ClaudeCodeClient) StreamTurn(ctx context.Context, req ClaudeCodeRequest, onLine func(string)) error {
+	return c.StreamPersistent(ctx, req, onLine)
+}
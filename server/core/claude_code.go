@@ -1,6 +1,7 @@
 package core
 
 import (
+	"ai-hub/server/model"
 	"bufio"
 	"bytes"
 	"context"
@@ -52,9 +53,10 @@ type ClaudeCodeRequest struct {
 	AuthMode     string // "api_key" | "oauth"
 	ProxyURL     string // optional subprocess proxy, e.g. http://127.0.0.1:7890
 	ModelID      string
-	WorkDir      string // 工作目录，空 = home
-	HubSessionID int64  // AI Hub 会话 ID，注入为环境变量
-	GroupName    string // 团队名，注入为 AI_HUB_GROUP_NAME 环境变量
+	WorkDir      string            // 工作目录，空 = home
+	HubSessionID int64             // AI Hub 会话 ID，注入为环境变量
+	GroupName    string            // 团队名，注入为 AI_HUB_GROUP_NAME 环境变量
+	ToolPolicy   *model.ToolPolicy // 工具权限策略，nil = 不限制（--dangerously-skip-permissions）
 }
 
 func NewClaudeCodeClient() *ClaudeCodeClient {
@@ -82,12 +84,12 @@ func (c *ClaudeCodeClient) Stream(ctx context.Context, req ClaudeCodeRequest, on
 	// Build flags first, query last — matches documented CLI patterns
 	args := []string{
 		"-p",
-		"--dangerously-skip-permissions",
 		"--verbose",
 		"--output-format", "stream-json",
 		"--include-partial-messages",
-		"--disallowed-tools", "EnterPlanMode,ExitPlanMode",
 	}
+	args = append(args, PermissionArgs(req.ToolPolicy, []string{"EnterPlanMode", "ExitPlanMode"})...)
+	args = append(args, approvalArgs(req)...)
 
 	if req.SessionID != "" {
 		if req.Resume {
@@ -156,12 +158,15 @@ func (c *ClaudeCodeClient) Stream(ctx context.Context, req ClaudeCodeRequest, on
 	// OAuth mode: API key not injected; Bearer token handled by Claude CLI's local auth cache
 	if req.HubSessionID > 0 {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("AI_HUB_SESSION_ID=%d", req.HubSessionID))
+		// Session-scoped API token for the ai-hub CLI and the local proxy
+		cmd.Env = appendSessionTokenEnv(cmd.Env, req.HubSessionID)
 	}
 	cmd.Env = append(cmd.Env, "AI_HUB_GROUP_NAME="+req.GroupName)
 	if p := GetPort(); p != "" {
 		cmd.Env = append(cmd.Env, "AI_HUB_PORT="+p)
 	}
 	// Inject ~/.ai-hub/bin into PATH so subprocess can use `ai-hub` CLI
+	cmd.Env = approvalEnv(cmd.Env, req)
 	cmd.Env = injectCLIPath(cmd.Env)
 
 	log.Printf("[claude] cmd: %s %s", c.BinaryPath, strings.Join(args, " "))
@@ -229,8 +234,12 @@ func (c *ClaudeCodeClient) StreamPersistent(ctx context.Context, req ClaudeCodeR
 		return c.Stream(ctx, req, onData)
 	}
 
-	proc, err := Pool.GetOrCreate(req, req.Resume)
+	proc, err := Pool.GetOrCreate(ctx, req, req.Resume)
 	if err != nil {
+		// Cancelled while queued for a slot: do not bypass the limit with a one-shot process
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		log.Printf("[pool] GetOrCreate failed, falling back: %v", err)
 		return c.Stream(ctx, req, onData)
 	}
@@ -246,7 +255,7 @@ func (c *ClaudeCodeClient) StreamPersistent(ctx context.Context, req ClaudeCodeR
 		Pool.Kill(req.HubSessionID)
 		req.Resume = false
 		req.SessionID = "" // force new CLI session
-		proc, err = Pool.GetOrCreate(req, false)
+		proc, err = Pool.GetOrCreate(ctx, req, false)
 		if err != nil {
 			log.Printf("[pool] new session failed, falling back: %v", err)
 			return c.Stream(ctx, req, onData)
@@ -261,7 +270,7 @@ func (c *ClaudeCodeClient) StreamPersistent(ctx context.Context, req ClaudeCodeR
 		// First retry: resume existing session
 		log.Printf("[pool] process died, retrying with --resume for session %d", req.HubSessionID)
 		req.Resume = true
-		proc, err = Pool.GetOrCreate(req, true)
+		proc, err = Pool.GetOrCreate(ctx, req, true)
 		if err == nil {
 			err = proc.SendAndStream(ctx, req.Query, onData)
 			if err == nil {
@@ -273,7 +282,7 @@ func (c *ClaudeCodeClient) StreamPersistent(ctx context.Context, req ClaudeCodeR
 				Pool.Kill(req.HubSessionID)
 				req.Resume = false
 				req.SessionID = ""
-				proc, err = Pool.GetOrCreate(req, false)
+				proc, err = Pool.GetOrCreate(ctx, req, false)
 				if err != nil {
 					return c.Stream(ctx, req, onData)
 				}
@@ -286,7 +295,7 @@ func (c *ClaudeCodeClient) StreamPersistent(ctx context.Context, req ClaudeCodeR
 			Pool.Kill(req.HubSessionID)
 			log.Printf("[pool] resume failed, retrying with new session for session %d", req.HubSessionID)
 			req.Resume = false
-			proc, err = Pool.GetOrCreate(req, false)
+			proc, err = Pool.GetOrCreate(ctx, req, false)
 			if err != nil {
 				log.Printf("[pool] new session failed, falling back: %v", err)
 				return c.Stream(ctx, req, onData)
@@ -41,6 +41,14 @@ type ProcessPool struct {
 	stopCh        chan struct{}
 	OnStateChange func(hubSessionID int64, alive bool, state string)
 	IsStreaming   func(hubSessionID int64) bool // injected by api layer to check activeStreams
+	OnQueueUpdate func(hubSessionID int64, info QueueInfo)
+
+	// Concurrency limit (see pool_queue.go)
+	maxProcs int           // 0 = unlimited
+	reserved int           // slots granted to waiters that have not spawned yet
+	waiters  waiterQueue   // sessions waiting for a slot, by priority
+	seq      uint64        // FIFO tie-breaker within a priority
+	avgTurn  time.Duration // moving average of turn duration, for wait estimates
 }
 
 // Pool is the global process pool instance
@@ -52,6 +60,7 @@ func InitPool(client *ClaudeCodeClient) {
 		processes: make(map[int64]*PersistentProcess),
 		client:    client,
 		stopCh:    make(chan struct{}),
+		maxProcs:  DefaultMaxProcesses,
 	}
 	go Pool.idleReaper()
 	log.Println("[pool] initialized")
@@ -69,11 +78,20 @@ func (p *ProcessPool) ShutdownPool() {
 	log.Println("[pool] shutdown complete")
 }
 
-// GetOrCreate returns an existing live process or spawns a new one
-func (p *ProcessPool) GetOrCreate(req ClaudeCodeRequest, isResume bool) (*PersistentProcess, error) {
+// GetOrCreate returns an existing live process or spawns a new one.
+// When the pool is full it evicts the least recently used idle process, or
+// waits in the priority queue (see WithPriority) until a slot frees up or ctx ends.
+func (p *ProcessPool) GetOrCreate(ctx context.Context, req ClaudeCodeRequest, isResume bool) (*PersistentProcess, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if proc, ok := p.processes[req.HubSessionID]; ok && !proc.IsDead() {
+		return proc, nil
+	}
+	if err := p.acquireSlotLocked(ctx, req.HubSessionID, priorityFrom(ctx)); err != nil {
+		return nil, err
+	}
+
 	if proc, ok := p.processes[req.HubSessionID]; ok {
 		if !proc.IsDead() {
 			return proc, nil
@@ -87,6 +105,7 @@ func (p *ProcessPool) GetOrCreate(req ClaudeCodeRequest, isResume bool) (*Persis
 
 	proc, err := p.spawnProcess(req, isResume)
 	if err != nil {
+		p.dispatchLocked()
 		return nil, err
 	}
 	p.processes[req.HubSessionID] = proc
@@ -122,6 +141,7 @@ func (p *ProcessPool) Kill(hubSessionID int64) {
 	if p.OnStateChange != nil {
 		go p.OnStateChange(hubSessionID, false, "")
 	}
+	p.dispatchLocked()
 }
 
 // HasProcess returns true if a live (non-dead) process exists for the given hub session.
@@ -191,6 +211,7 @@ func (p *ProcessPool) idleReaper() {
 					}
 				}
 			}
+			p.dispatchLocked()
 			p.mu.Unlock()
 		}
 	}
@@ -207,13 +228,13 @@ func (p *ProcessPool) spawnProcess(req ClaudeCodeRequest, isResume bool) (*Persi
 
 	args := []string{
 		"-p",
-		"--dangerously-skip-permissions",
 		"--verbose",
 		"--input-format", "stream-json",
 		"--output-format", "stream-json",
 		"--include-partial-messages",
-		"--disallowed-tools", strings.Join(disallowed, ","),
 	}
+	args = append(args, PermissionArgs(req.ToolPolicy, disallowed)...)
+	args = append(args, approvalArgs(req)...)
 	if req.SessionID != "" {
 		if isResume {
 			args = append(args, "--resume", req.SessionID)
@@ -278,12 +299,15 @@ func (p *ProcessPool) spawnProcess(req ClaudeCodeRequest, isResume bool) (*Persi
 	// OAuth mode: API key not injected; Bearer token handled by Claude CLI's local auth cache
 	if req.HubSessionID > 0 {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("AI_HUB_SESSION_ID=%d", req.HubSessionID))
+		// Session-scoped API token for the ai-hub CLI and the local proxy
+		cmd.Env = appendSessionTokenEnv(cmd.Env, req.HubSessionID)
 	}
 	cmd.Env = append(cmd.Env, "AI_HUB_GROUP_NAME="+req.GroupName)
 	if port := GetPort(); port != "" {
 		cmd.Env = append(cmd.Env, "AI_HUB_PORT="+port)
 	}
 	// Inject ~/.ai-hub/bin into PATH so subprocess can use `ai-hub` CLI
+	cmd.Env = approvalEnv(cmd.Env, req)
 	cmd.Env = injectCLIPath(cmd.Env)
 
 	stdin, err := cmd.StdinPipe()
@@ -386,6 +410,7 @@ func (proc *PersistentProcess) SendAndStream(ctx context.Context, query string,
 	proc.state = "busy"
 	proc.lastActive = time.Now()
 	proc.mu.Unlock()
+	turnStart := time.Now()
 
 	defer func() {
 		proc.mu.Lock()
@@ -396,16 +421,19 @@ func (proc *PersistentProcess) SendAndStream(ctx context.Context, query string,
 		}
 		proc.mu.Unlock()
 		// Execute deferred kill outside proc lock
+		Pool.mu.Lock()
+		Pool.recordTurnLocked(time.Since(turnStart))
 		if pending {
 			log.Printf("[pool] session %d: executing deferred kill after SendAndStream", proc.hubSessionID)
-			Pool.mu.Lock()
 			proc.kill()
 			delete(Pool.processes, proc.hubSessionID)
-			Pool.mu.Unlock()
 			if Pool.OnStateChange != nil {
 				go Pool.OnStateChange(proc.hubSessionID, false, "")
 			}
 		}
+		// The process is idle (or gone): a queued session may take its slot
+		Pool.dispatchLocked()
+		Pool.mu.Unlock()
 	}()
 
 	// Write NDJSON message to stdin
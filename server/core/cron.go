@@ -0,0 +1,205 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // IANA trigger time zones on hosts without a zoneinfo database (Windows)
+)
+
+// Cron expressions for triggers: 5 fields (minute hour day-of-month month
+// day-of-week) or 6 with a leading seconds field. Fields accept *, ?,
+// lists, ranges, steps (*/15, 1-5/2, 10/5) and month / weekday names.
+// Day-of-month also accepts L (last day); day-of-week accepts 7 for Sunday
+// and n#k for the k-th weekday n of the month ("MON#1" = first Monday).
+// When both day fields are restricted a day matching either one fires, as in
+// standard cron. Descriptors: @yearly @monthly @weekly @daily @hourly.
+
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	lastDom                               bool     // "L" in day-of-month
+	nth                                   [7]uint8 // bit k: k-th weekday of the month
+	domStar, dowStar                      bool
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonths = map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}
+
+var cronWeekdays = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+
+// parseCron parses a 5- or 6-field cron expression or a descriptor.
+func parseCron(spec string) (*cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron expression needs 5 or 6 fields, got %d", len(fields))
+	}
+
+	s := &cronSchedule{}
+	var err error
+	if s.second, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("second: %w", err)
+	}
+	if s.minute, err = parseCronField(fields[1], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[2], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.month, err = parseCronField(fields[4], 1, 12, cronMonths); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+
+	dom := strings.ToUpper(fields[3])
+	s.domStar = dom == "*" || dom == "?"
+	var domParts []string
+	for _, part := range strings.Split(dom, ",") {
+		if part == "L" {
+			s.lastDom = true
+		} else {
+			domParts = append(domParts, part)
+		}
+	}
+	if len(domParts) > 0 {
+		if s.dom, err = parseCronField(strings.Join(domParts, ","), 1, 31, nil); err != nil {
+			return nil, fmt.Errorf("day of month: %w", err)
+		}
+	}
+
+	dow := strings.ToUpper(fields[5])
+	s.dowStar = dow == "*" || dow == "?"
+	var dowParts []string
+	for _, part := range strings.Split(dow, ",") {
+		day, nth, found := strings.Cut(part, "#")
+		if !found {
+			dowParts = append(dowParts, part)
+			continue
+		}
+		d, err := cronValue(day, cronWeekdays)
+		k, kerr := strconv.Atoi(nth)
+		if err != nil || kerr != nil || d < 0 || d > 7 || k < 1 || k > 5 {
+			return nil, fmt.Errorf("day of week: invalid %q", part)
+		}
+		s.nth[d%7] |= 1 << k
+	}
+	if len(dowParts) > 0 {
+		if s.dow, err = parseCronField(strings.Join(dowParts, ","), 0, 7, cronWeekdays); err != nil {
+			return nil, fmt.Errorf("day of week: %w", err)
+		}
+		if s.dow&(1<<7) != 0 {
+			s.dow |= 1 // 7 = Sunday
+		}
+	}
+	return s, nil
+}
+
+// parseCronField returns the bit set of values a field matches.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(strings.ToUpper(field), ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(a, names); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(b, names); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := cronValue(rng, names)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// next returns the first time after t matching the schedule, in t's
+// location, or the zero time if there is none within five years.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Second).Add(time.Second)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		case s.second&(1<<uint(t.Second())) == 0:
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	day := t.Day()
+	lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	domMatch := s.dom&(1<<uint(day)) != 0 || (s.lastDom && day == lastDay)
+	wd := int(t.Weekday())
+	dowMatch := s.dow&(1<<uint(wd)) != 0 || s.nth[wd]&(1<<uint((day-1)/7+1)) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Message sources recorded on model.Message.Source. Messages typed by a user
+// have no source.
+const (
+	SourceTrigger = "trigger"
+	SourceHook    = "hook"
+	SourceChannel = "channel"
+	SourceShadow  = "shadow"
+)
+
+// Dispatch errors.
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionBusy: the session cannot take a message now (attention mode
+	// is reviewing a turn); try again later.
+	ErrSessionBusy = errors.New("session busy")
+)
+
+// DispatchRequest is a message sent to a session from inside the server.
+type DispatchRequest struct {
+	SessionID int64
+	Content   string
+	Source    string // SourceTrigger | SourceHook | SourceChannel | SourceShadow
+	SourceID  int64  // trigger / hook / channel ID
+	Priority  int    // process pool priority (PriorityBackground, ...)
+}
+
+// DispatchResult describes what happened to a dispatched message.
+type DispatchResult struct {
+	SessionID int64  `json:"session_id"`
+	MessageID int64  `json:"message_id"`     // 0 when attention mode saves it after review
+	Status    string `json:"status"`         // "started" | "queued" (session was streaming)
+	Mode      string `json:"mode,omitempty"` // "attention_v3" when attention mode reviews it
+}
+
+// Dispatcher delivers messages to sessions: it saves the user message and
+// starts (or queues) the AI turn.
+type Dispatcher interface {
+	Dispatch(req DispatchRequest) (*DispatchResult, error)
+}
+
+var dispatcher Dispatcher
+
+// SetDispatcher registers the dispatcher. Called from the api package during
+// initialization to break the import cycle.
+func SetDispatcher(d Dispatcher) {
+	dispatcher = d
+}
+
+// Dispatch sends a message to a session through the registered dispatcher.
+func Dispatch(req DispatchRequest) (*DispatchResult, error) {
+	if dispatcher == nil {
+		return nil, fmt.Errorf("no dispatcher registered")
+	}
+	return dispatcher.Dispatch(req)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Failure kinds that trigger retry / provider failover.
+const (
+	FailureRateLimit  = "rate_limit"
+	FailureOverloaded = "overloaded"
+	FailureServer     = "server_error"
+	FailureNetwork    = "network"
+)
+
+// Failover tuning: retries per provider before moving to the next one.
+const (
+	FailoverMaxRetries = 2
+	failoverBaseDelay  = 2 * time.Second
+	failoverMaxDelay   = 30 * time.Second
+)
+
+var (
+	// "API Error: 529 {...}" in result / error text
+	apiStatusRe = regexp.MustCompile(`(?i)\b(?:api error|status(?: code)?|http)[:\s]+(\d{3})\b`)
+	// error.type of an Anthropic error body embedded in the message
+	errorTypeRe = regexp.MustCompile(`"type"\s*:\s*"([a-z_]+_error)"`)
+)
+
+// errorTypeKinds maps Anthropic error.type values to transient failure kinds.
+// Other types (invalid_request_error, authentication_error, ...) are permanent.
+var errorTypeKinds = map[string]string{
+	"overloaded_error": FailureOverloaded,
+	"rate_limit_error": FailureRateLimit,
+	"api_error":        FailureServer,
+}
+
+var statusKinds = map[int]string{
+	429: FailureRateLimit,
+	529: FailureOverloaded,
+	500: FailureServer,
+	502: FailureServer,
+	503: FailureServer,
+	504: FailureServer,
+}
+
+// textFailures is the last resort for messages without a type or status
+// (proxies, network errors); patterns are word-bounded so request IDs, paths
+// and token counts do not match.
+var textFailures = []struct {
+	re   *regexp.Regexp
+	kind string
+}{
+	{regexp.MustCompile(`(?i)\boverloaded\b`), FailureOverloaded},
+	{regexp.MustCompile(`(?i)\brate[ _-]?limit(?:ed)?\b|\btoo many requests\b`), FailureRateLimit},
+	{regexp.MustCompile(`(?i)\binternal server error\b|\bbad gateway\b|\bservice unavailable\b|\bgateway timeout\b`), FailureServer},
+	{regexp.MustCompile(`(?i)\bconnection (?:refused|reset)\b|\beof\b|\bi/o timeout\b|\bno such host\b`), FailureNetwork},
+}
+
+// ClassifyFailure reports whether an upstream failure is transient and worth
+// retrying, and of which kind. errType is the error.type of a stream-json
+// "error" event when known; otherwise it is read from the Anthropic error
+// body in msg, then the HTTP status ("API Error: 429 ..."), and only then the
+// message text.
+func ClassifyFailure(errType, msg string) (kind string, retryable bool) {
+	if errType == "" {
+		if m := errorTypeRe.FindStringSubmatch(msg); m != nil {
+			errType = m[1]
+		}
+	}
+	if errType != "" {
+		kind, retryable = errorTypeKinds[errType]
+		return kind, retryable
+	}
+	if m := apiStatusRe.FindStringSubmatch(msg); m != nil {
+		status, _ := strconv.Atoi(m[1])
+		kind, retryable = statusKinds[status]
+		return kind, retryable
+	}
+	for _, f := range textFailures {
+		if f.re.MatchString(msg) {
+			return f.kind, true
+		}
+	}
+	return "", false
+}
+
+// FailoverBackoff returns the exponential delay before retry #attempt (0-based).
+func FailoverBackoff(attempt int) time.Duration {
+	d := failoverBaseDelay << uint(attempt)
+	if d > failoverMaxDelay || d <= 0 {
+		d = failoverMaxDelay
+	}
+	return d
+}
+
+// SleepCtx waits for d or until ctx is cancelled. Returns false if cancelled.
+func SleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -5,22 +5,128 @@ import (
 	"ai-hub/server/store"
 	"fmt"
 	"log"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // HookEvent represents an event that can trigger hooks.
 type HookEvent struct {
-	Type            string // session.created | message.received | message.count | session.error
+	Type            string // one of HookEvents
 	SourceSessionID int64
-	Content         string // message content or error summary
-	MessageCount    int64  // for message.count events
+	Content         string            // message content, response, error summary, ...
+	MessageCount    int64             // for message.* events
+	Source          string            // origin of the message behind the event (Source*), "" = user
+	Vars            map[string]string // event-specific payload variables (see HookEvents)
+}
+
+// HookEventSpec documents an event type: what {content} holds and which
+// payload variables it sets besides {source_session_id}, {event_type} and
+// {content}.
+type HookEventSpec struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Content     string   `json:"content"`
+	Variables   []string `json:"variables"`
+}
+
+// HookEvents is the catalogue of events hooks can subscribe to.
+var HookEvents = []HookEventSpec{
+	{Type: "session.created", Description: "New session created", Content: "first message", Variables: []string{}},
+	{Type: "message.received", Description: "Message received by a session (not from hooks)", Content: "message", Variables: []string{"message_count"}},
+	{Type: "message.count", Description: "Message received; filter with count_gt:N", Content: "message", Variables: []string{"message_count"}},
+	{Type: "session.error", Description: "Error recorded in session", Content: "error summary", Variables: []string{}},
+	{Type: "stream.completed", Description: "AI turn finished", Content: "response text", Variables: []string{"message_id", "provider", "input_tokens", "output_tokens", "cache_read_tokens", "cache_creation_tokens"}},
+	{Type: "stream.failed", Description: "AI turn failed", Content: "error", Variables: []string{"message_id", "provider", "partial_response"}},
+	{Type: "tool.used", Description: "Tool call finished", Content: "tool output", Variables: []string{"tool_name", "tool_input", "is_error", "duration_ms", "message_id"}},
+	{Type: "trigger.fired", Description: "Trigger delivered its message", Content: "trigger instruction", Variables: []string{"trigger_id", "scheduled_at", "message_id", "attempts"}},
+	{Type: "trigger.failed", Description: "Trigger run failed (after retries)", Content: "error", Variables: []string{"trigger_id", "scheduled_at", "attempts", "trigger_content"}},
+	{Type: "service.died", Description: "Managed service stopped responding", Content: "service command", Variables: []string{"service_id", "service_name", "port", "log_path"}},
+	{Type: "memory.written", Description: "Memory file created, updated or deleted", Content: "diff", Variables: []string{"scope", "file_name", "change_type", "version"}},
+	{Type: "compress.done", Description: "Session context compressed", Content: "compress mode", Variables: []string{"compress_mode", "message_count"}},
+	{Type: "channel.message", Description: "Feishu / QQ message forwarded to a session", Content: "message text", Variables: []string{"channel_id", "platform"}},
+}
+
+// IsHookEvent reports whether t is a known hook event type.
+func IsHookEvent(t string) bool {
+	for _, e := range HookEvents {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// HookEventTypes returns the known event types, comma-separated.
+func HookEventTypes() string {
+	types := make([]string, len(HookEvents))
+	for i, e := range HookEvents {
+		types[i] = e.Type
+	}
+	return strings.Join(types, ", ")
+}
+
+// selfTriggeredEvents are caused by an AI turn. Events of a turn that a hook
+// message started fire no hooks, so two hooks cannot bounce turns between
+// their sessions; hooks targeting the event's own session skip them too.
+var selfTriggeredEvents = map[string]bool{
+	"stream.completed": true,
+	"stream.failed":    true,
+	"tool.used":        true,
+	"memory.written":   true,
+	"compress.done":    true,
+}
+
+var (
+	turnSources   = make(map[int64]string)
+	turnSourcesMu sync.Mutex
+)
+
+// SetTurnSource records the source of the message that started a session's
+// current AI turn ("" = user); ClearTurnSource forgets it when the turn ends.
+func SetTurnSource(sessionID int64, source string) {
+	turnSourcesMu.Lock()
+	turnSources[sessionID] = source
+	turnSourcesMu.Unlock()
+}
+
+func ClearTurnSource(sessionID int64) {
+	turnSourcesMu.Lock()
+	delete(turnSources, sessionID)
+	turnSourcesMu.Unlock()
+}
+
+// TurnSource returns the source of the session's running turn ("" when it
+// was started by a user or no turn is running).
+func TurnSource(sessionID int64) string {
+	turnSourcesMu.Lock()
+	defer turnSourcesMu.Unlock()
+	return turnSources[sessionID]
+}
+
+func init() {
+	store.SetChangelogHook(func(cl *model.MemoryChangelog) {
+		go FireHooks(HookEvent{
+			Type:            "memory.written",
+			SourceSessionID: cl.SessionID,
+			Content:         cl.Diff,
+			Source:          TurnSource(cl.SessionID),
+			Vars: map[string]string{
+				"scope":       cl.Scope,
+				"file_name":   cl.FileName,
+				"change_type": cl.ChangeType,
+				"version":     strconv.Itoa(cl.Version),
+			},
+		})
+	})
 }
 
 // FireHooks checks all enabled hooks for the given event and fires matching ones.
 // This should be called asynchronously (go FireHooks(...)) to avoid blocking.
 func FireHooks(event HookEvent) {
+	if selfTriggeredEvents[event.Type] && event.Source == SourceHook {
+		return
+	}
 	hooks, err := store.ListHooksByEvent(event.Type)
 	if err != nil {
 		log.Printf("[hooks] failed to list hooks for event %s: %v", event.Type, err)
@@ -31,77 +137,71 @@ func FireHooks(event HookEvent) {
 		if !hook.Enabled {
 			continue
 		}
-		if !matchCondition(hook.Condition, event) {
+		if selfTriggeredEvents[event.Type] && hook.TargetSession == event.SourceSessionID {
+			continue
+		}
+		if !matchCondition(&hook, event) {
 			continue
 		}
 
 		// Build the payload with variable substitution
 		payload := expandPayload(hook.Payload, event)
 
-		// Send message to target session via the internal chat/send API
 		log.Printf("[hooks] hook #%d fired: event=%s target_session=%d", hook.ID, event.Type, hook.TargetSession)
 
-		go sendHookMessage(hook.TargetSession, payload)
+		go sendHookMessage(hook.ID, hook.TargetSession, payload)
 
 		// Increment fired count
 		store.IncrementHookFiredCount(hook.ID)
 	}
 }
 
-// matchCondition checks if the event matches the hook's condition.
-// Condition formats:
-//   - "" (empty) → always match
-//   - "content_match:pattern1|pattern2" → match if content contains any pattern
-//   - "count_gt:N" → match if message count > N
-func matchCondition(condition string, event HookEvent) bool {
-	condition = strings.TrimSpace(condition)
-	if condition == "" {
-		return true
-	}
+// HookTestResult is the outcome of a hook dry run.
+type HookTestResult struct {
+	Matched bool   `json:"matched"`
+	Reason  string `json:"reason,omitempty"` // why it would not fire
+	Payload string `json:"payload,omitempty"`
+}
 
-	parts := strings.SplitN(condition, ":", 2)
-	if len(parts) != 2 {
-		return false
+// DryRunHook evaluates hook against a sample event the way FireHooks would,
+// without sending anything. event.Type defaults to the hook's event.
+func DryRunHook(hook *model.Hook, event HookEvent) (*HookTestResult, error) {
+	if event.Type == "" {
+		event.Type = hook.Event
 	}
-
-	condType := parts[0]
-	condValue := parts[1]
-
-	switch condType {
-	case "content_match":
-		// Match if content contains any of the pipe-separated patterns
-		patterns := strings.Split(condValue, "|")
-		for _, p := range patterns {
-			p = strings.TrimSpace(p)
-			if p == "" {
-				continue
-			}
-			// Try as regex first, fall back to simple contains
-			re, err := regexp.Compile(p)
-			if err != nil {
-				// Simple substring match
-				if strings.Contains(event.Content, p) {
-					return true
-				}
-			} else {
-				if re.MatchString(event.Content) {
-					return true
-				}
-			}
-		}
-		return false
-
-	case "count_gt":
-		threshold, err := strconv.ParseInt(condValue, 10, 64)
-		if err != nil {
-			return false
-		}
-		return event.MessageCount > threshold
-
+	cond, err := ParseHookCondition(hook.Condition)
+	if err != nil {
+		return nil, err
+	}
+	res := &HookTestResult{}
+	switch {
+	case event.Type != hook.Event:
+		res.Reason = fmt.Sprintf("hook listens to %s, not %s", hook.Event, event.Type)
+	case !hook.Enabled:
+		res.Reason = "hook is disabled"
+	case selfTriggeredEvents[event.Type] && event.Source == SourceHook:
+		res.Reason = "event comes from a turn started by a hook message"
+	case selfTriggeredEvents[event.Type] && hook.TargetSession == event.SourceSessionID:
+		res.Reason = "source session is the hook's target session"
+	case !cond.Match(event):
+		res.Reason = "condition is false"
 	default:
-		log.Printf("[hooks] unknown condition type: %s", condType)
+		res.Matched = true
+		res.Payload = expandPayload(hook.Payload, event)
+	}
+	return res, nil
+}
+
+// matchCondition checks if the event matches the hook's condition (see
+// ParseHookCondition). An empty condition always matches; a condition that
+// does not parse never does.
+func matchCondition(hook *model.Hook, event HookEvent) bool {
+	c, err := hookCondition(hook)
+	if err != nil {
+		log.Printf("[hooks] hook #%d: invalid condition %q: %v", hook.ID, hook.Condition, err)
 		return false
 	}
+	return c.Match(event)
 }
 
 // expandPayload replaces template variables in the payload string.
@@ -110,14 +210,19 @@ func matchCondition(condition string, event HookEvent) bool {
 //   - {event_type} → the event type
 //   - {content} → the message content or error summary (truncated)
 //   - {message_count} → the message count (for message.count events)
+//   - the event's own variables, listed in HookEvents (values truncated)
 func expandPayload(payload string, event HookEvent) string {
-	r := strings.NewReplacer(
+	var pairs []string
+	for k, v := range event.Vars {
+		pairs = append(pairs, "{"+k+"}", truncateForPayload(v, 500))
+	}
+	pairs = append(pairs,
 		"{source_session_id}", fmt.Sprintf("%d", event.SourceSessionID),
 		"{event_type}", event.Type,
 		"{content}", truncateForPayload(event.Content, 500),
 		"{message_count}", fmt.Sprintf("%d", event.MessageCount),
 	)
-	return r.Replace(payload)
+	return strings.NewReplacer(pairs...).Replace(payload)
 }
 
 func truncateForPayload(s string, maxLen int) string {
@@ -128,46 +233,18 @@ func truncateForPayload(s string, maxLen int) string {
 	return s
 }
 
-// sendHookMessage sends a message to the target session via the internal API.
-// This uses store directly instead of HTTP to avoid circular dependencies.
-func sendHookMessage(targetSessionID int64, content string) {
-	session, err := store.GetSession(targetSessionID)
-	if err != nil {
-		log.Printf("[hooks] target session %d not found: %v", targetSessionID, err)
-		return
-	}
-
-	// Save the user message
-	msg := &model.Message{
+// sendHookMessage delivers a hook's message to its target session.
+func sendHookMessage(hookID, targetSessionID int64, content string) {
+	result, err := Dispatch(DispatchRequest{
 		SessionID: targetSessionID,
-		Role:      "user",
 		Content:   content,
-	}
-	if err := store.AddMessage(msg); err != nil {
-		log.Printf("[hooks] failed to add message to session %d: %v", targetSessionID, err)
+		Source:    SourceHook,
+		SourceID:  hookID,
+		Priority:  PriorityBackground,
+	})
+	if err != nil {
+		log.Printf("[hooks] hook #%d: deliver to session %d failed: %v", hookID, targetSessionID, err)
 		return
 	}
-
-	// If the session has a provider, we could trigger a stream.
-	// For now, hooks just deliver the message; the AI will pick it up if the session is active.
-	// If the session is not streaming, we need to trigger it.
-	if session.ProviderID != "" {
-		// Use the HookStreamCallback if set (avoids import cycle with api package)
-		if hookStreamCb != nil {
-			hookStreamCb(session, content, msg.ID)
-		} else {
-			log.Printf("[hooks] message delivered to session %d (no stream callback)", targetSessionID)
-		}
-	}
-}
-
-// HookStreamFunc is the callback type for triggering a stream from hooks.
-type HookStreamFunc func(session *model.Session, content string, triggerMsgID int64)
-
-var hookStreamCb HookStreamFunc
-
-// SetHookStreamCallback registers the callback for triggering streams from hooks.
-// Called from the api package during initialization to break the import cycle.
-func SetHookStreamCallback(cb HookStreamFunc) {
-	hookStreamCb = cb
+	log.Printf("[hooks] hook #%d: message %d delivered to session %d (%s)", hookID, result.MessageID, targetSessionID, result.Status)
 }
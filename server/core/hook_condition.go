@@ -0,0 +1,634 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Hook conditions are boolean expressions over the event:
+//
+//	event.session.group == "ops" && content =~ /error|panic/i && !(source == "trigger")
+//
+// Operators: || && ! ( ) and the comparisons == != < <= > >= =~ !~ (regex
+// literal /.../ with optional flags i, m, s on the right). A field alone is
+// true when non-empty / non-zero. Fields (the "event." prefix is optional):
+//
+//	event, event.type          event type (string)
+//	content                    {content} of the event (string)
+//	source                     origin of the message behind the event:
+//	                           trigger | hook | channel | shadow, "" = user
+//	message_count              number
+//	session.id                 number (the source session)
+//	session.group / .title / .provider (string), session.shadow (bool)
+//	vars.<name> or <name>      event variable, e.g. tool_name (see HookEvents);
+//	                           compared as a number or bool when the other
+//	                           side is one
+//
+// The legacy forms "content_match:a|b" and "count_gt:N" are still accepted.
+
+// ConditionError is a condition syntax or type error at Pos (1-based column).
+type ConditionError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("condition error at position %d: %s", e.Pos, e.Msg)
+}
+
+// HookCondition is a parsed condition. A nil condition always matches.
+type HookCondition struct {
+	root condNode
+}
+
+// Match evaluates the condition against event.
+func (c *HookCondition) Match(event HookEvent) bool {
+	if c == nil || c.root == nil {
+		return true
+	}
+	return c.root.eval(&hookContext{event: event})
+}
+
+// ParseHookCondition parses and type-checks a condition.
+func ParseHookCondition(src string) (*HookCondition, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	if legacy, ok, err := parseLegacyCondition(src); ok {
+		return legacy, err
+	}
+	p := &condParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+	return &HookCondition{root: root}, nil
+}
+
+// cachedCondition is a hook's parsed condition, kept while its text is unchanged.
+type cachedCondition struct {
+	src  string
+	cond *HookCondition
+	err  error
+}
+
+var (
+	conditionCache   = make(map[int64]cachedCondition) // hook ID -> parsed condition
+	conditionCacheMu sync.Mutex
+)
+
+// hookCondition returns the hook's parsed condition, parsing it once per
+// condition text.
+func hookCondition(hook *model.Hook) (*HookCondition, error) {
+	conditionCacheMu.Lock()
+	defer conditionCacheMu.Unlock()
+	if c, ok := conditionCache[hook.ID]; ok && c.src == hook.Condition {
+		return c.cond, c.err
+	}
+	cond, err := ParseHookCondition(hook.Condition)
+	conditionCache[hook.ID] = cachedCondition{src: hook.Condition, cond: cond, err: err}
+	return cond, err
+}
+
+// ForgetHookCondition drops a hook's cached condition (hook updated or deleted).
+func ForgetHookCondition(hookID int64) {
+	conditionCacheMu.Lock()
+	delete(conditionCache, hookID)
+	conditionCacheMu.Unlock()
+}
+
+// parseLegacyCondition translates "content_match:p1|p2" (any pattern
+// matches; each must be a valid regex) and "count_gt:N".
+func parseLegacyCondition(src string) (*HookCondition, bool, error) {
+	trimmed := strings.TrimLeft(src, " \t\r\n")
+	base := len(src) - len(trimmed) // offset of kind in src
+	kind, value, found := strings.Cut(strings.TrimRight(trimmed, " \t\r\n"), ":")
+	if !found {
+		return nil, false, nil
+	}
+	valuePos := base + len(kind) + 1 // 0-based offset of value in src
+	switch kind {
+	case "content_match":
+		var root condNode
+		off := valuePos
+		for _, p := range strings.Split(value, "|") {
+			pos := off + len(p) - len(strings.TrimLeft(p, " \t"))
+			off += len(p) + 1
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, true, &ConditionError{Pos: pos + 1, Msg: fmt.Sprintf("invalid regex %q: %v", p, err)}
+			}
+			var n condNode = &condCompare{left: condOperand{field: "content", kind: valString}, op: "=~", re: re}
+			if root != nil {
+				n = &condOr{root, n}
+			}
+			root = n
+		}
+		if root == nil {
+			return nil, true, &ConditionError{Pos: valuePos + 1, Msg: "content_match needs a pattern"}
+		}
+		return &HookCondition{root: root}, true, nil
+	case "count_gt":
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, true, &ConditionError{Pos: valuePos + 1, Msg: "count_gt needs a number"}
+		}
+		return &HookCondition{root: &condCompare{
+			left:  condOperand{field: "message_count", kind: valNumber},
+			op:    ">",
+			right: condOperand{lit: true, kind: valNumber, num: n},
+		}}, true, nil
+	}
+	return nil, false, nil
+}
+
+// ---- evaluation ----
+
+type valueKind int
+
+const (
+	valString valueKind = iota
+	valNumber
+	valBool
+	valVar // event variable: a string coerced to the other side's kind
+)
+
+func (k valueKind) String() string {
+	return [...]string{"string", "number", "bool", "variable"}[k]
+}
+
+type hookContext struct {
+	event   HookEvent
+	session *model.Session
+	loaded  bool
+}
+
+func (c *hookContext) sess() *model.Session {
+	if !c.loaded {
+		c.loaded = true
+		if c.event.SourceSessionID > 0 {
+			c.session, _ = store.GetSession(c.event.SourceSessionID)
+		}
+	}
+	return c.session
+}
+
+// field returns a field's value as a string (numbers and bools formatted).
+func (c *hookContext) field(name string) string {
+	switch name {
+	case "type":
+		return c.event.Type
+	case "content":
+		return c.event.Content
+	case "source":
+		return c.event.Source
+	case "message_count":
+		return strconv.FormatInt(c.event.MessageCount, 10)
+	case "session.id":
+		return strconv.FormatInt(c.event.SourceSessionID, 10)
+	}
+	if strings.HasPrefix(name, "session.") {
+		s := c.sess()
+		if s == nil {
+			return ""
+		}
+		switch name {
+		case "session.group":
+			return s.GroupName
+		case "session.title":
+			return s.Title
+		case "session.provider":
+			return s.ProviderID
+		case "session.shadow":
+			return strconv.FormatBool(s.IsShadow)
+		}
+	}
+	return c.event.Vars[strings.TrimPrefix(name, "vars.")]
+}
+
+type condNode interface {
+	eval(c *hookContext) bool
+}
+
+type condOr struct{ l, r condNode }
+type condAnd struct{ l, r condNode }
+type condNot struct{ x condNode }
+
+func (n *condOr) eval(c *hookContext) bool  { return n.l.eval(c) || n.r.eval(c) }
+func (n *condAnd) eval(c *hookContext) bool { return n.l.eval(c) && n.r.eval(c) }
+func (n *condNot) eval(c *hookContext) bool { return !n.x.eval(c) }
+
+type condOperand struct {
+	field string // canonical field name; empty for literals
+	lit   bool
+	kind  valueKind
+	str   string
+	num   float64
+	b     bool
+}
+
+func (o condOperand) value(c *hookContext) string {
+	if !o.lit {
+		return c.field(o.field)
+	}
+	switch o.kind {
+	case valNumber:
+		return strconv.FormatFloat(o.num, 'f', -1, 64)
+	case valBool:
+		return strconv.FormatBool(o.b)
+	}
+	return o.str
+}
+
+// condTruthy is a lone operand: true when non-empty, non-zero and not false.
+type condTruthy struct{ x condOperand }
+
+func (n *condTruthy) eval(c *hookContext) bool {
+	v := n.x.value(c)
+	return v != "" && v != "0" && v != "false"
+}
+
+type condCompare struct {
+	left, right condOperand
+	op          string
+	re          *regexp.Regexp // =~ !~
+}
+
+func (n *condCompare) eval(c *hookContext) bool {
+	l := n.left.value(c)
+	switch n.op {
+	case "=~":
+		return n.re.MatchString(l)
+	case "!~":
+		return !n.re.MatchString(l)
+	}
+	r := n.right.value(c)
+	kind := n.left.kind
+	if kind == valVar {
+		kind = n.right.kind
+	}
+	switch kind {
+	case valNumber:
+		a, err1 := strconv.ParseFloat(l, 64)
+		b, err2 := strconv.ParseFloat(r, 64)
+		if err1 != nil || err2 != nil {
+			return n.op == "!="
+		}
+		switch n.op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		case "<":
+			return a < b
+		case "<=":
+			return a <= b
+		case ">":
+			return a > b
+		case ">=":
+			return a >= b
+		}
+	case valBool:
+		a, err1 := strconv.ParseBool(l)
+		b, err2 := strconv.ParseBool(r)
+		if err1 != nil || err2 != nil {
+			return n.op == "!="
+		}
+		return (a == b) == (n.op == "==")
+	}
+	return (l == r) == (n.op == "==")
+}
+
+// ---- fields ----
+
+var condFieldKinds = map[string]valueKind{
+	"type":             valString,
+	"content":          valString,
+	"source":           valString,
+	"message_count":    valNumber,
+	"session.id":       valNumber,
+	"session.group":    valString,
+	"session.title":    valString,
+	"session.provider": valString,
+	"session.shadow":   valBool,
+}
+
+// resolveField maps a field path to its canonical name and kind.
+func resolveField(path string) (string, valueKind, bool) {
+	if path == "event" {
+		return "type", valString, true
+	}
+	name := strings.TrimPrefix(path, "event.")
+	if kind, ok := condFieldKinds[name]; ok {
+		return name, kind, true
+	}
+	if v := strings.TrimPrefix(name, "vars."); v != name && v != "" {
+		return name, valVar, true
+	}
+	for _, e := range HookEvents {
+		for _, v := range e.Variables {
+			if v == name {
+				return "vars." + name, valVar, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// ---- lexer ----
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokRegex
+	tokOp
+)
+
+type condToken struct {
+	kind tokKind
+	text string // identifier, operator, decoded string or regex source
+	pos  int    // 0-based byte offset
+}
+
+func (t condToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of condition"
+	case tokString:
+		return strconv.Quote(t.text)
+	case tokRegex:
+		return "/" + t.text + "/"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type condParser struct {
+	src string
+	off int
+	tok condToken
+}
+
+func (p *condParser) errorf(format string, args ...interface{}) error {
+	return &ConditionError{Pos: p.tok.pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+var twoCharOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~"}
+
+// next scans the next token into p.tok.
+func (p *condParser) next() error {
+	for p.off < len(p.src) && unicode.IsSpace(rune(p.src[p.off])) {
+		p.off++
+	}
+	start := p.off
+	if p.off >= len(p.src) {
+		p.tok = condToken{kind: tokEOF, pos: start}
+		return nil
+	}
+	ch := p.src[p.off]
+	for _, op := range twoCharOps {
+		if strings.HasPrefix(p.src[p.off:], op) {
+			p.off += 2
+			p.tok = condToken{kind: tokOp, text: op, pos: start}
+			return nil
+		}
+	}
+	switch {
+	case strings.ContainsRune("!<>()", rune(ch)):
+		p.off++
+		p.tok = condToken{kind: tokOp, text: string(ch), pos: start}
+	case ch == '"':
+		end := p.off + 1
+		for end < len(p.src) && p.src[end] != '"' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			return &ConditionError{Pos: start + 1, Msg: "unterminated string"}
+		}
+		s, err := strconv.Unquote(p.src[start : end+1])
+		if err != nil {
+			return &ConditionError{Pos: start + 1, Msg: "invalid string " + p.src[start:end+1]}
+		}
+		p.off = end + 1
+		p.tok = condToken{kind: tokString, text: s, pos: start}
+	case ch == '/':
+		var b strings.Builder
+		end := p.off + 1
+		for ; end < len(p.src) && p.src[end] != '/'; end++ {
+			if p.src[end] == '\\' && end+1 < len(p.src) && p.src[end+1] == '/' {
+				end++
+			}
+			b.WriteByte(p.src[end])
+		}
+		if end >= len(p.src) {
+			return &ConditionError{Pos: start + 1, Msg: "unterminated regex"}
+		}
+		end++
+		flags := ""
+		for end < len(p.src) && strings.IndexByte("ims", p.src[end]) >= 0 {
+			flags += string(p.src[end])
+			end++
+		}
+		src := b.String()
+		if flags != "" {
+			src = "(?" + flags + ")" + src
+		}
+		p.off = end
+		p.tok = condToken{kind: tokRegex, text: src, pos: start}
+	case ch == '-' || ch == '.' || (ch >= '0' && ch <= '9'):
+		end := p.off + 1
+		for end < len(p.src) && (p.src[end] == '.' || (p.src[end] >= '0' && p.src[end] <= '9')) {
+			end++
+		}
+		p.off = end
+		p.tok = condToken{kind: tokNumber, text: p.src[start:end], pos: start}
+	case ch == '_' || unicode.IsLetter(rune(ch)):
+		end := p.off + 1
+		for end < len(p.src) && (p.src[end] == '_' || p.src[end] == '.' ||
+			unicode.IsLetter(rune(p.src[end])) || unicode.IsDigit(rune(p.src[end]))) {
+			end++
+		}
+		p.off = end
+		p.tok = condToken{kind: tokIdent, text: p.src[start:end], pos: start}
+	default:
+		return &ConditionError{Pos: start + 1, Msg: fmt.Sprintf("unexpected character %q", ch)}
+	}
+	return nil
+}
+
+// ---- parser ----
+
+func (p *condParser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *condParser) parseOr() (condNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &condOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (condNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &condAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseUnary() (condNode, error) {
+	if p.isOp("!") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &condNot{x}, nil
+	}
+	if p.isOp("(") {
+		open := p.tok
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOp(")") {
+			return nil, &ConditionError{Pos: open.pos + 1, Msg: "unclosed ("}
+		}
+		return x, p.next()
+	}
+	return p.parseComparison()
+}
+
+var comparisonOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true, "!~": true}
+
+func (p *condParser) parseComparison() (condNode, error) {
+	leftTok := p.tok
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokOp || !comparisonOps[p.tok.text] {
+		if left.lit && left.kind != valBool {
+			return nil, &ConditionError{Pos: leftTok.pos + 1, Msg: "expected a comparison after " + leftTok.String()}
+		}
+		return &condTruthy{left}, nil
+	}
+	opTok := p.tok
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	n := &condCompare{left: left, op: opTok.text}
+	typeErr := func(msg string) error { return &ConditionError{Pos: opTok.pos + 1, Msg: msg} }
+
+	if n.op == "=~" || n.op == "!~" {
+		if p.tok.kind != tokRegex {
+			return nil, p.errorf("%s needs a /regex/ on the right, got %s", n.op, p.tok)
+		}
+		re, err := regexp.Compile(p.tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid regex: %v", err)
+		}
+		if left.kind != valString && left.kind != valVar {
+			return nil, typeErr(fmt.Sprintf("%s needs a string on the left, %s is a %s", n.op, leftTok, left.kind))
+		}
+		n.re = re
+		return n, p.next()
+	}
+
+	rightTok := p.tok
+	if n.right, err = p.parseOperand(); err != nil {
+		return nil, err
+	}
+	lk, rk := left.kind, n.right.kind
+	switch {
+	case lk == valVar || rk == valVar:
+	case lk != rk:
+		return nil, typeErr(fmt.Sprintf("cannot compare %s (%s) with %s (%s)", leftTok, lk, rightTok, rk))
+	}
+	ordered := n.op == "<" || n.op == "<=" || n.op == ">" || n.op == ">="
+	if ordered && lk != valNumber && rk != valNumber {
+		return nil, typeErr(n.op + " needs a number on one side")
+	}
+	if ordered && (lk == valBool || rk == valBool || lk == valString || rk == valString) {
+		return nil, typeErr(n.op + " only compares numbers")
+	}
+	return n, nil
+}
+
+func (p *condParser) parseOperand() (condOperand, error) {
+	t := p.tok
+	var o condOperand
+	switch t.kind {
+	case tokString:
+		o = condOperand{lit: true, kind: valString, str: t.text}
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return o, p.errorf("invalid number %q", t.text)
+		}
+		o = condOperand{lit: true, kind: valNumber, num: n}
+	case tokIdent:
+		if t.text == "true" || t.text == "false" {
+			o = condOperand{lit: true, kind: valBool, b: t.text == "true"}
+			break
+		}
+		name, kind, ok := resolveField(t.text)
+		if !ok {
+			return o, p.errorf("unknown field %q", t.text)
+		}
+		o = condOperand{field: name, kind: kind}
+	case tokRegex:
+		return o, p.errorf("a regex can only follow =~ or !~")
+	default:
+		return o, p.errorf("expected a field or value, got %s", t)
+	}
+	return o, p.next()
+}
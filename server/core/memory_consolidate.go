@@ -0,0 +1,554 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Memory consolidation: agents write memory independently, so the same fact
+// ends up in several files. A background job clusters near-identical
+// documents within each memory scope and queues proposals for review
+// (store/memory_proposal.go): merges of duplicates, and conflicts between
+// decision / preference records on the same topic. Nothing changes on disk
+// until a proposal is approved; approved changes go to the memory changelog.
+
+const (
+	consolidateMaxDocs = 3000 // most recently updated documents compared per scope
+	// decision / preference records on one topic often differ in wording
+	// exactly because they disagree; they cluster at a lower similarity
+	consolidateConflictMargin = 0.07
+	consolidateCheckInterval  = 10 * time.Minute
+	consolidateMergeTimeout   = 2 * time.Minute
+	consolidateMaxMergeInput  = 24000 // bytes of documents sent to the provider
+)
+
+var (
+	consolidateRunning atomic.Bool
+	proposalApplyMu    sync.Mutex
+
+	// ErrProposalStale means a proposal's files changed since it was made.
+	ErrProposalStale = errors.New("memory files changed since the proposal was made")
+)
+
+// StartMemoryConsolidation runs the consolidation job in the background
+// whenever it is enabled and its interval has passed.
+func StartMemoryConsolidation() {
+	go func() {
+		for {
+			time.Sleep(consolidateCheckInterval)
+			cfg := store.GetMemoryConsolidationSettings()
+			if !cfg.Enabled {
+				continue
+			}
+			last, _ := store.GetSetting("memory.consolidate_last_run")
+			if t, err := time.Parse(time.RFC3339, last); err == nil && time.Since(t) < time.Duration(cfg.IntervalHours)*time.Hour {
+				continue
+			}
+			store.SetSetting("memory.consolidate_last_run", time.Now().Format(time.RFC3339))
+			if created, err := ConsolidateMemory(""); err != nil {
+				log.Printf("[consolidate] %v", err)
+			} else {
+				log.Printf("[consolidate] %d new proposal(s)", len(created))
+			}
+		}
+	}()
+}
+
+// ConsolidateMemory scans scope (every watched memory scope when empty) and
+// queues proposals for clusters not proposed before. Returns the new
+// proposals.
+func ConsolidateMemory(scope string) ([]model.MemoryProposal, error) {
+	if Vector == nil || !Vector.IsReady() {
+		return nil, fmt.Errorf("vector engine not ready")
+	}
+	if !consolidateRunning.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("memory consolidation is already running")
+	}
+	defer consolidateRunning.Store(false)
+
+	scopes := []string{scope}
+	if scope == "" {
+		scopes = nil
+		if Watcher != nil {
+			for _, sc := range Watcher.Scopes() {
+				if sc == "memory" || strings.HasSuffix(sc, "/memory") {
+					scopes = append(scopes, sc)
+				}
+			}
+		}
+	}
+	cfg := store.GetMemoryConsolidationSettings()
+	created := []model.MemoryProposal{}
+	for _, sc := range scopes {
+		docs := Vector.memoryDocs(sc)
+		for _, cl := range clusterMemoryDocs(docs, cfg.Threshold) {
+			p := buildProposal(sc, cl)
+			if store.HasMemoryProposal(p.Fingerprint) {
+				continue
+			}
+			if p.Kind == model.ProposalMerge && cfg.UseProvider {
+				if err := writeMergedVersion(p, cl, cfg); err != nil {
+					log.Printf("[consolidate] merged version for %s: %v", strings.Join(p.Files, ", "), err)
+				}
+			}
+			if err := store.CreateMemoryProposal(p); err != nil {
+				return created, err
+			}
+			created = append(created, *p)
+		}
+	}
+	return created, nil
+}
+
+// memoryDoc is one document of a scope, with the normalised mean of its
+// chunk vectors.
+type memoryDoc struct {
+	id      string
+	vector  []float64
+	meta    map[string]interface{}
+	text    string
+	hits    int
+	updated string
+}
+
+// memoryDocs returns a scope's embedded documents, newest first, at most
+// consolidateMaxDocs. Text-only documents (degraded mode) are skipped.
+func (v *VectorEngine) memoryDocs(scope string) []memoryDoc {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	records := v.collections[scopeToFileName(scope)]
+	byDoc := make(map[string][]*VectorRecord)
+	for _, r := range records {
+		byDoc[parentDocID(r)] = append(byDoc[parentDocID(r)], r)
+	}
+
+	var docs []memoryDoc
+	for id := range byDoc {
+		recs := docRecordsLocked(records, id)
+		if len(recs) == 0 {
+			continue
+		}
+		var mean []float64
+		for _, r := range recs {
+			if len(r.Vector) == 0 {
+				mean = nil
+				break
+			}
+			if mean == nil {
+				mean = make([]float64, len(r.Vector))
+			}
+			for i, x := range r.Vector {
+				mean[i] += x
+			}
+		}
+		n := vecNorm(mean)
+		if n == 0 {
+			continue
+		}
+		for i := range mean {
+			mean[i] /= n
+		}
+		head := headRecordLocked(records, id)
+		if head == nil {
+			continue
+		}
+		docs = append(docs, memoryDoc{id: id, vector: mean, meta: head.Metadata, text: assembleDocument(recs),
+			hits: head.HitCount, updated: head.UpdatedAt})
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].updated != docs[j].updated {
+			return docs[i].updated > docs[j].updated
+		}
+		return docs[i].id < docs[j].id
+	})
+	if len(docs) > consolidateMaxDocs {
+		docs = docs[:consolidateMaxDocs]
+	}
+	return docs
+}
+
+type docCluster struct {
+	docs       []memoryDoc
+	similarity float64 // weakest link
+}
+
+func isOpinionRecord(meta map[string]interface{}) bool {
+	t, _ := meta["mem_type"].(string)
+	return t == "decision" || t == "preference"
+}
+
+// clusterMemoryDocs links documents whose similarity reaches threshold
+// (decision / preference pairs: threshold - consolidateConflictMargin) and
+// returns the connected groups of two or more.
+func clusterMemoryDocs(docs []memoryDoc, threshold float64) []docCluster {
+	parent := make([]int, len(docs))
+	weakest := make([]float64, len(docs))
+	for i := range parent {
+		parent[i] = i
+		weakest[i] = 1
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i := range docs {
+		for j := i + 1; j < len(docs); j++ {
+			if len(docs[i].vector) != len(docs[j].vector) {
+				continue
+			}
+			var sim float64
+			for k, x := range docs[i].vector {
+				sim += x * docs[j].vector[k]
+			}
+			limit := threshold
+			if isOpinionRecord(docs[i].meta) && isOpinionRecord(docs[j].meta) {
+				limit -= consolidateConflictMargin
+			}
+			if sim < limit {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			w := min(weakest[ri], weakest[rj], sim)
+			if ri != rj {
+				parent[rj] = ri
+			}
+			weakest[ri] = w
+		}
+	}
+
+	groups := make(map[int][]memoryDoc)
+	for i, d := range docs {
+		root := find(i)
+		groups[root] = append(groups[root], d)
+	}
+	var out []docCluster
+	for root, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool { return g[i].id < g[j].id })
+		out = append(out, docCluster{docs: g, similarity: weakest[root]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].docs[0].id < out[j].docs[0].id })
+	return out
+}
+
+// buildProposal classifies a cluster: differing decision / preference
+// records are a conflict, anything else a merge into the most used document.
+func buildProposal(scope string, cl docCluster) *model.MemoryProposal {
+	p := &model.MemoryProposal{Scope: scope, Similarity: cl.similarity, Kind: model.ProposalMerge}
+	var opinions []memoryDoc
+	for _, d := range cl.docs {
+		p.Files = append(p.Files, d.id)
+		if isOpinionRecord(d.meta) {
+			opinions = append(opinions, d)
+		}
+	}
+	p.Fingerprint = clusterFingerprint(scope, cl.docs)
+	p.Target = mergeTarget(cl.docs)
+
+	if reason := opinionConflict(opinions); reason != "" {
+		p.Kind = model.ProposalConflict
+		p.Reason = reason
+		return p
+	}
+	p.Reason = fmt.Sprintf("%d near-identical documents (similarity >= %.2f); keep %s", len(cl.docs), cl.similarity, p.Target)
+	return p
+}
+
+// opinionConflict describes why decision / preference records may
+// contradict each other, or returns "" when they agree.
+func opinionConflict(docs []memoryDoc) string {
+	if len(docs) < 2 {
+		return ""
+	}
+	// Structured preferences: same key, different value
+	values := make(map[string]map[string][]string) // key -> value -> files
+	for _, d := range docs {
+		raw, _ := d.meta["mem_content"].(string)
+		var content struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}
+		if json.Unmarshal([]byte(raw), &content) == nil && content.Key != "" {
+			if values[content.Key] == nil {
+				values[content.Key] = make(map[string][]string)
+			}
+			values[content.Key][content.Value] = append(values[content.Key][content.Value], d.id)
+		}
+	}
+	var reasons []string
+	for key, byValue := range values {
+		if len(byValue) < 2 {
+			continue
+		}
+		var parts []string
+		for value, files := range byValue {
+			parts = append(parts, fmt.Sprintf("%q (%s)", value, strings.Join(files, ", ")))
+		}
+		sort.Strings(parts)
+		reasons = append(reasons, fmt.Sprintf("preference %q has different values: %s", key, strings.Join(parts, " vs ")))
+	}
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		return strings.Join(reasons, "; ")
+	}
+
+	// Other records on one topic conflict unless their texts are the same
+	base := textShingles(docs[0].text)
+	for _, d := range docs[1:] {
+		if jaccard(base, textShingles(d.text)) < federatedDupThreshold {
+			var ids []string
+			for _, o := range docs {
+				ids = append(ids, o.id)
+			}
+			return "decisions/preferences on the same topic differ; check whether one supersedes the others: " + strings.Join(ids, ", ")
+		}
+	}
+	return ""
+}
+
+// mergeTarget picks the document to keep: most hits, then newest.
+func mergeTarget(docs []memoryDoc) string {
+	best := docs[0]
+	for _, d := range docs[1:] {
+		if d.hits > best.hits || (d.hits == best.hits && d.updated > best.updated) {
+			best = d
+		}
+	}
+	return best.id
+}
+
+func metaInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// clusterFingerprint identifies a cluster by its files and their content,
+// so an edited cluster is proposed again but an unchanged one is not.
+func clusterFingerprint(scope string, docs []memoryDoc) string {
+	parts := []string{scope}
+	for _, d := range docs {
+		hash, _ := d.meta["content_hash"].(string)
+		parts = append(parts, d.id+"\x00"+hash)
+	}
+	sort.Strings(parts[1:])
+	sum := sha1.Sum([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeMergedVersion asks a provider to merge the cluster's documents into
+// one. The provider is that of the session that wrote the kept document,
+// else the configured one, else the default provider.
+func writeMergedVersion(p *model.MemoryProposal, cl docCluster, cfg *model.MemoryConsolidationSettings) error {
+	provider := consolidationProvider(cl, p.Target, cfg)
+	if provider == nil {
+		return fmt.Errorf("no provider available")
+	}
+
+	var b strings.Builder
+	for _, d := range cl.docs {
+		fmt.Fprintf(&b, "=== %s ===\n%s\n\n", d.id, d.text)
+		if b.Len() > consolidateMaxMergeInput {
+			break
+		}
+	}
+	systemPrompt := `你是一个记忆整理助手。下面是若干份内容高度重复的记忆文档。任务：把它们合并成一份完整、准确、无重复的 Markdown 记忆文档。
+
+要求：
+1. 保留所有文档中的事实、步骤、命令、路径和约束，不要编造新内容
+2. 各文档说法不一致时，以更新、更具体的为准，并在文末「待确认」小节列出分歧
+3. 沿用原文档的标题结构和语言
+4. 直接输出合并后的文档内容，不加前言或解释`
+
+	ctx, cancel := context.WithTimeout(context.Background(), consolidateMergeTimeout)
+	defer cancel()
+	merged, err := completeWithProvider(ctx, provider, systemPrompt, b.String())
+	if err != nil {
+		return err
+	}
+	merged = strings.TrimSpace(merged)
+	if merged == "" {
+		return fmt.Errorf("provider returned an empty merge")
+	}
+	p.MergedContent = merged + "\n"
+	p.ProviderID = provider.ID
+	return nil
+}
+
+func consolidationProvider(cl docCluster, target string, cfg *model.MemoryConsolidationSettings) *model.Provider {
+	for _, d := range cl.docs {
+		if d.id != target {
+			continue
+		}
+		if sid := int64(metaInt(d.meta["source_session_id"])); sid > 0 {
+			if sess, err := store.GetSession(sid); err == nil && sess.ProviderID != "" {
+				if p, err := store.GetProvider(sess.ProviderID); err == nil {
+					return p
+				}
+			}
+		}
+	}
+	if cfg.ProviderID != "" {
+		if p, err := store.GetProvider(cfg.ProviderID); err == nil {
+			return p
+		}
+	}
+	if p, err := store.GetDefaultProvider(); err == nil {
+		return p
+	}
+	return nil
+}
+
+// completeWithProvider sends one prompt to a provider and returns the
+// answer: /chat/completions for OpenAI-compatible providers, the Anthropic
+// Messages API otherwise.
+func completeWithProvider(ctx context.Context, p *model.Provider, systemPrompt, userMessage string) (string, error) {
+	if p.DetectMode() != model.ModeOpenAI {
+		return CallAnthropicMessagesAPI(ctx, p, userMessage, systemPrompt, 4096)
+	}
+	var out strings.Builder
+	err := NewOpenAIClient().Stream(ctx, OpenAIRequest{
+		BaseURL:  p.BaseURL,
+		APIKey:   p.APIKey,
+		ModelID:  p.ModelID,
+		ProxyURL: p.ProxyURL,
+		Messages: []ChatMessage{{Role: "system", Content: systemPrompt}, {Role: "user", Content: userMessage}},
+	}, func(s string) { out.WriteString(s) })
+	return out.String(), err
+}
+
+// ApplyMemoryProposal carries out an approved proposal: the kept file gets
+// content (the merged version when empty, or unchanged if there is none)
+// and the cluster's other files are deleted. keep overrides the proposal's
+// target; conflicts need keep or content. Every file change is recorded in
+// the memory changelog. Returns ErrProposalStale if the files changed.
+func ApplyMemoryProposal(p *model.MemoryProposal, keep, content string, sessionID int64) error {
+	proposalApplyMu.Lock()
+	defer proposalApplyMu.Unlock()
+
+	if Vector == nil || !Vector.IsReady() {
+		return fmt.Errorf("vector engine not ready")
+	}
+	if keep == "" {
+		if p.Kind == model.ProposalConflict && content == "" {
+			return fmt.Errorf("a conflict needs the file to keep, or the resolved content")
+		}
+		keep = p.Target
+	}
+	found := false
+	for _, f := range p.Files {
+		found = found || f == keep
+	}
+	if !found {
+		return fmt.Errorf("%s is not part of the proposal", keep)
+	}
+	if content == "" && keep == p.Target {
+		content = p.MergedContent
+	}
+
+	// The files must be exactly those the proposal was made from
+	current := make(map[string]memoryDoc)
+	for _, d := range Vector.memoryDocs(p.Scope) {
+		current[d.id] = d
+	}
+	var docs []memoryDoc
+	for _, f := range p.Files {
+		d, ok := current[f]
+		if !ok {
+			return ErrProposalStale
+		}
+		docs = append(docs, d)
+	}
+	if clusterFingerprint(p.Scope, docs) != p.Fingerprint {
+		return ErrProposalStale
+	}
+
+	dir := ScopeDir(p.Scope)
+	note := fmt.Sprintf("memory proposal #%d (%s of %s)", p.ID, p.Kind, strings.Join(p.Files, ", "))
+	if content != "" {
+		path := filepath.Join(dir, keep)
+		old, _ := os.ReadFile(path)
+		if content != string(old) {
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				return err
+			}
+			SyncFileToVector(p.Scope, path, sessionID)
+			// Rewriting the text resets metadata; keep the structured memory fields
+			memFields := make(map[string]interface{})
+			for k, val := range current[keep].meta {
+				if strings.HasPrefix(k, "mem_") {
+					memFields[k] = val
+				}
+			}
+			if len(memFields) > 0 {
+				Vector.UpdateMetadata(p.Scope, keep, memFields)
+			}
+			store.AddChangelog(&model.MemoryChangelog{
+				FileName:   keep,
+				Scope:      p.Scope,
+				ChangeType: "update",
+				SessionID:  sessionID,
+				Diff:       "consolidated by " + note,
+				Content:    content,
+			})
+		}
+	}
+	for _, f := range p.Files {
+		if f == keep {
+			continue
+		}
+		path := filepath.Join(dir, f)
+		old, _ := os.ReadFile(path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		Vector.Delete(p.Scope, f)
+		store.AddChangelog(&model.MemoryChangelog{
+			FileName:   f,
+			Scope:      p.Scope,
+			ChangeType: "delete",
+			SessionID:  sessionID,
+			Diff:       "merged into " + keep + " by " + note,
+			Content:    string(old),
+		})
+	}
+	return nil
+}
+
+// ProposalFiles returns the current content of a proposal's files.
+func ProposalFiles(p *model.MemoryProposal) map[string]string {
+	out := make(map[string]string, len(p.Files))
+	dir := ScopeDir(p.Scope)
+	for _, f := range p.Files {
+		if data, err := os.ReadFile(filepath.Join(dir, f)); err == nil {
+			out[f] = string(data)
+		}
+	}
+	return out
+}
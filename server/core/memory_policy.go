@@ -0,0 +1,348 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Memory lifecycle policies (store/memory_policy.go), one per scope with "*"
+// as the fallback. A policy ranks documents lower the longer they go unused
+// (decay), and the enforcer deprecates or archives documents unused for
+// expire_days or never hit within unused_days of creation. Archived files
+// move to <scope dir>/.archive/, which the watcher does not scan.
+
+const (
+	policyCheckInterval = time.Hour
+	policyArchiveDir    = ".archive"
+	// decayMinFactor keeps long-unused documents findable at all
+	decayMinFactor = 0.2
+)
+
+type compiledPolicy struct {
+	*model.MemoryPolicy
+	filter *Filter
+}
+
+var (
+	policyCache struct {
+		sync.RWMutex
+		loaded  bool
+		byScope map[string]*compiledPolicy
+	}
+	policyRunning atomic.Bool
+)
+
+// PolicyAction is one change a policy makes (or would make) to a document.
+type PolicyAction struct {
+	DocID      string `json:"doc_id"`
+	Action     string `json:"action"`
+	Reason     string `json:"reason"`
+	LastUsedAt string `json:"last_used_at"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PolicyReport lists a policy's actions on one scope.
+type PolicyReport struct {
+	Scope    string         `json:"scope"`
+	PolicyID int64          `json:"policy_id"`
+	Enabled  bool           `json:"enabled"`
+	Actions  []PolicyAction `json:"actions"`
+}
+
+// ValidateMemoryPolicy normalises a policy before it is saved.
+func ValidateMemoryPolicy(p *model.MemoryPolicy) error {
+	p.Scope = strings.TrimSpace(p.Scope)
+	if p.Scope == "" {
+		return fmt.Errorf("scope required (\"*\" for all scopes)")
+	}
+	if p.Action == "" {
+		p.Action = model.PolicyDeprecate
+	}
+	if p.Action != model.PolicyDeprecate && p.Action != model.PolicyArchive {
+		return fmt.Errorf("action must be %q or %q", model.PolicyDeprecate, model.PolicyArchive)
+	}
+	if p.ExpireDays < 0 || p.UnusedDays < 0 || p.DecayHalfLifeDays < 0 {
+		return fmt.Errorf("expire_days, unused_days and decay_half_life_days must not be negative")
+	}
+	if _, err := ParseFilter(p.Filter); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReloadMemoryPolicies drops the cached policies; call after changing them.
+func ReloadMemoryPolicies() {
+	policyCache.Lock()
+	policyCache.loaded = false
+	policyCache.Unlock()
+}
+
+// memoryPolicyFor returns the policy governing scope, or nil.
+func memoryPolicyFor(scope string) *compiledPolicy {
+	policyCache.RLock()
+	loaded := policyCache.loaded
+	policyCache.RUnlock()
+	if !loaded {
+		list, err := store.ListMemoryPolicies()
+		if err != nil {
+			return nil
+		}
+		byScope := make(map[string]*compiledPolicy, len(list))
+		for i := range list {
+			f, err := ParseFilter(list[i].Filter)
+			if err != nil {
+				log.Printf("[memory-policy] %s: %v", list[i].Scope, err)
+				continue
+			}
+			byScope[list[i].Scope] = &compiledPolicy{MemoryPolicy: &list[i], filter: f}
+		}
+		policyCache.Lock()
+		policyCache.byScope, policyCache.loaded = byScope, true
+		policyCache.Unlock()
+	}
+	policyCache.RLock()
+	defer policyCache.RUnlock()
+	if p := policyCache.byScope[scope]; p != nil {
+		return p
+	}
+	return policyCache.byScope["*"]
+}
+
+// decays reports whether p lowers the ranking of unused documents.
+func (p *compiledPolicy) decays() bool {
+	return p != nil && p.Enabled && p.DecayHalfLifeDays > 0
+}
+
+// decayFactorsLocked returns the ranking multiplier of each ranked document
+// under p. Caller holds v.mu.
+func (v *VectorEngine) decayFactorsLocked(p *compiledPolicy, fileName string, results []rankedChunk) map[string]float64 {
+	now := time.Now()
+	records := v.collections[fileName]
+	factors := make(map[string]float64)
+	for _, r := range results {
+		doc := parentDocID(r.record)
+		if _, done := factors[doc]; done {
+			continue
+		}
+		factors[doc] = 1
+		head := headRecordLocked(records, doc)
+		if head == nil || !p.filter.Match(doc, head.Metadata) {
+			continue
+		}
+		if last, ok := lastUsed(head); ok {
+			days := now.Sub(last).Hours() / 24
+			factors[doc] = math.Max(math.Pow(0.5, days/p.DecayHalfLifeDays), decayMinFactor)
+		}
+	}
+	return factors
+}
+
+// lastUsed is the latest of a document's update, hit, read and mem feedback
+// times.
+func lastUsed(head *VectorRecord) (time.Time, bool) {
+	var latest time.Time
+	fb, _ := head.Metadata["mem_last_used_at"].(string)
+	for _, s := range []string{head.UpdatedAt, head.LastHitAt, head.LastReadAt, fb} {
+		if t, ok := parseMemoryTime(s); ok && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+func parseMemoryTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// planMemoryPolicy lists what p would do to scope's documents at now.
+func (v *VectorEngine) planMemoryPolicy(scope string, p *compiledPolicy, now time.Time) []PolicyAction {
+	if p.ExpireDays <= 0 && p.UnusedDays <= 0 {
+		return []PolicyAction{}
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	actions := []PolicyAction{}
+	for _, r := range v.collections[scopeToFileName(scope)] {
+		if !isHeadRecord(r) {
+			continue
+		}
+		doc := parentDocID(r)
+		if !p.filter.Match(doc, r.Metadata) {
+			continue
+		}
+		if status, _ := r.Metadata["mem_status"].(string); status == "deprecated" && p.Action == model.PolicyDeprecate {
+			continue
+		}
+		last, ok := lastUsed(r)
+		if !ok {
+			continue
+		}
+		idle := int(now.Sub(last).Hours() / 24)
+		var reason string
+		if p.ExpireDays > 0 && idle >= p.ExpireDays {
+			reason = fmt.Sprintf("unused for %d days (expire_days=%d)", idle, p.ExpireDays)
+		} else if created, ok := parseMemoryTime(r.CreatedAt); ok && p.UnusedDays > 0 && r.HitCount == 0 && r.ReadCount == 0 {
+			if age := int(now.Sub(created).Hours() / 24); age >= p.UnusedDays {
+				reason = fmt.Sprintf("never hit or read in %d days (unused_days=%d)", age, p.UnusedDays)
+			}
+		}
+		if reason != "" {
+			actions = append(actions, PolicyAction{DocID: doc, Action: p.Action, Reason: reason, LastUsedAt: last.Format(time.RFC3339)})
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].DocID < actions[j].DocID })
+	return actions
+}
+
+// policyScopes returns the watched memory scopes governed by a policy, or
+// just scope when given.
+func policyScopes(scope string) []string {
+	if scope != "" {
+		return []string{scope}
+	}
+	var scopes []string
+	if Watcher != nil {
+		for _, sc := range Watcher.Scopes() {
+			if (sc == "memory" || strings.HasSuffix(sc, "/memory")) && memoryPolicyFor(sc) != nil {
+				scopes = append(scopes, sc)
+			}
+		}
+	}
+	return scopes
+}
+
+// MemoryPolicyReport is a dry run: what the policies of scope (every
+// governed memory scope when empty) would do now, whether enabled or not.
+func MemoryPolicyReport(scope string) ([]PolicyReport, error) {
+	if Vector == nil || !Vector.IsReady() {
+		return nil, fmt.Errorf("vector engine not ready")
+	}
+	reports := []PolicyReport{}
+	now := time.Now()
+	for _, sc := range policyScopes(scope) {
+		p := memoryPolicyFor(sc)
+		if p == nil {
+			continue
+		}
+		reports = append(reports, PolicyReport{Scope: sc, PolicyID: p.ID, Enabled: p.Enabled, Actions: Vector.planMemoryPolicy(sc, p, now)})
+	}
+	return reports, nil
+}
+
+// EnforceMemoryPolicies applies the enabled policies of scope (every
+// governed memory scope when empty) and returns what was done.
+func EnforceMemoryPolicies(scope string) ([]PolicyReport, error) {
+	if Vector == nil || !Vector.IsReady() {
+		return nil, fmt.Errorf("vector engine not ready")
+	}
+	if !policyRunning.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("memory policies are already being enforced")
+	}
+	defer policyRunning.Store(false)
+
+	reports := []PolicyReport{}
+	now := time.Now()
+	for _, sc := range policyScopes(scope) {
+		p := memoryPolicyFor(sc)
+		if p == nil || !p.Enabled {
+			continue
+		}
+		actions := Vector.planMemoryPolicy(sc, p, now)
+		for i := range actions {
+			if err := applyPolicyAction(sc, p, &actions[i]); err != nil {
+				actions[i].Error = err.Error()
+				log.Printf("[memory-policy] %s/%s: %v", sc, actions[i].DocID, err)
+			}
+		}
+		reports = append(reports, PolicyReport{Scope: sc, PolicyID: p.ID, Enabled: true, Actions: actions})
+	}
+	return reports, nil
+}
+
+func applyPolicyAction(scope string, p *compiledPolicy, a *PolicyAction) error {
+	dir := ScopeDir(scope)
+	path := filepath.Join(dir, a.DocID)
+	content, _ := os.ReadFile(path)
+	note := fmt.Sprintf("memory policy #%d: %s", p.ID, a.Reason)
+
+	if a.Action == model.PolicyDeprecate {
+		// Keep updated_at: bumping it would make the document look fresh again.
+		if _, err := Vector.updateMetadata(scope, a.DocID, map[string]interface{}{"mem_status": "deprecated"}, false); err != nil {
+			return err
+		}
+		return store.AddChangelog(&model.MemoryChangelog{
+			FileName:   a.DocID,
+			Scope:      scope,
+			ChangeType: "update",
+			Diff:       "deprecated by " + note,
+			Content:    string(content),
+		})
+	}
+
+	// The archive mirrors the scope's layout, so a/b.md goes to <archive>/a/b.md.
+	archiveDir := filepath.Join(dir, policyArchiveDir)
+	dest := filepath.Join(archiveDir, a.DocID)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		dest = filepath.Join(filepath.Dir(dest), time.Now().Format("20060102-150405-")+filepath.Base(dest))
+	}
+	if err := os.Rename(path, dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := Vector.Delete(scope, a.DocID); err != nil {
+		return err
+	}
+	rel, _ := filepath.Rel(archiveDir, dest)
+	return store.AddChangelog(&model.MemoryChangelog{
+		FileName:   a.DocID,
+		Scope:      scope,
+		ChangeType: "delete",
+		Diff:       "archived to " + filepath.ToSlash(filepath.Join(policyArchiveDir, rel)) + " by " + note,
+		Content:    string(content),
+	})
+}
+
+// StartMemoryPolicies enforces the enabled policies every hour.
+func StartMemoryPolicies() {
+	go func() {
+		for {
+			time.Sleep(policyCheckInterval)
+			if Vector == nil || !Vector.IsReady() {
+				continue
+			}
+			reports, err := EnforceMemoryPolicies("")
+			if err != nil {
+				log.Printf("[memory-policy] %v", err)
+				continue
+			}
+			for _, r := range reports {
+				if len(r.Actions) > 0 {
+					log.Printf("[memory-policy] %s: %d document(s) expired", r.Scope, len(r.Actions))
+				}
+			}
+		}
+	}()
+}
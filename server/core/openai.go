@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -27,33 +28,60 @@ type OpenAIRequest struct {
 	BaseURL  string
 	APIKey   string
 	ModelID  string
+	ProxyURL string // optional HTTP(S) proxy for this provider
 	Messages []ChatMessage
 }
 
 type openAIStreamChunk struct {
 	Choices []struct {
 		Delta struct {
-			Content string `json:"content"`
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"` // vLLM / DeepSeek reasoning models
+			Reasoning        string `json:"reasoning"`         // Ollama / llama.cpp reasoning models
 		} `json:"delta"`
 		FinishReason *string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *OpenAIUsage `json:"usage"`
+}
+
+// OpenAIUsage is the token usage reported in the final stream chunk.
+type OpenAIUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// OpenAIDelta is one streamed increment: answer text, reasoning text, or final usage.
+type OpenAIDelta struct {
+	Content   string
+	Reasoning string
+	Usage     *OpenAIUsage
 }
 
 // Stream sends a chat completion request and streams back content
 func (c *OpenAIClient) Stream(ctx context.Context, req OpenAIRequest, onData func(string)) error {
-	url := strings.TrimRight(req.BaseURL, "/") + "/chat/completions"
+	return c.StreamDeltas(ctx, req, func(d OpenAIDelta) {
+		if d.Content != "" {
+			onData(d.Content)
+		}
+	})
+}
+
+// StreamDeltas is Stream with reasoning and usage deltas included.
+func (c *OpenAIClient) StreamDeltas(ctx context.Context, req OpenAIRequest, onDelta func(OpenAIDelta)) error {
+	endpoint := strings.TrimRight(req.BaseURL, "/") + "/chat/completions"
 
 	body := map[string]interface{}{
-		"model":    req.ModelID,
-		"messages": req.Messages,
-		"stream":   true,
+		"model":          req.ModelID,
+		"messages":       req.Messages,
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
 	}
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonBody))
 	if err != nil {
 		return err
 	}
@@ -62,7 +90,13 @@ func (c *OpenAIClient) Stream(ctx context.Context, req OpenAIRequest, onData fun
 		httpReq.Header.Set("Authorization", "Bearer "+req.APIKey)
 	}
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	httpClient := http.DefaultClient
+	if req.ProxyURL != "" {
+		if pu, err := url.Parse(req.ProxyURL); err == nil {
+			httpClient = &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(pu)}}
+		}
+	}
+	resp, err := httpClient.Do(httpReq)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -94,8 +128,18 @@ func (c *OpenAIClient) Stream(ctx context.Context, req OpenAIRequest, onData fun
 		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
 			continue
 		}
-		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
-			onData(chunk.Choices[0].Delta.Content)
+		if len(chunk.Choices) > 0 {
+			d := chunk.Choices[0].Delta
+			reasoning := d.ReasoningContent
+			if reasoning == "" {
+				reasoning = d.Reasoning
+			}
+			if d.Content != "" || reasoning != "" {
+				onDelta(OpenAIDelta{Content: d.Content, Reasoning: reasoning})
+			}
+		}
+		if chunk.Usage != nil {
+			onDelta(OpenAIDelta{Usage: chunk.Usage})
 		}
 	}
 	return nil
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// openAIMaxHistory caps the number of prior messages replayed per turn.
+const openAIMaxHistory = 40
+
+// OpenAIBackend runs sessions directly against an OpenAI-compatible
+// /chat/completions endpoint (vLLM, llama.cpp, Ollama, ...) without the
+// Claude CLI. There is no server-side conversation state: every turn replays
+// the session history from the messages table.
+type OpenAIBackend struct {
+	client *OpenAIClient
+
+	// historyStart records, per hub session, the first message of the current
+	// conversation (set on fresh runs after a reset/compress/provider switch),
+	// keyed by the session's ClaudeSessionID so a later reset invalidates it.
+	mu           sync.Mutex
+	historyStart map[int64]historyAnchor
+}
+
+type historyAnchor struct {
+	sessionID string
+	fromMsgID int64
+}
+
+func NewOpenAIBackend(client *OpenAIClient) *OpenAIBackend {
+	return &OpenAIBackend{client: client, historyStart: make(map[int64]historyAnchor)}
+}
+
+// Name implements AgentBackend.
+func (b *OpenAIBackend) Name() string { return model.ModeOpenAI }
+
+// StreamTurn implements AgentBackend.
+func (b *OpenAIBackend) StreamTurn(ctx context.Context, req ClaudeCodeRequest, onLine func(string)) error {
+	if strings.TrimSpace(req.BaseURL) == "" {
+		return fmt.Errorf("OpenAI 兼容后端需要配置 API 地址")
+	}
+	messages := b.buildMessages(req)
+	log.Printf("[openai] session %d: model=%s messages=%d resume=%v", req.HubSessionID, req.ModelID, len(messages), req.Resume)
+
+	emit := func(v interface{}) {
+		if data, err := json.Marshal(v); err == nil {
+			onLine(string(data))
+		}
+	}
+	var full strings.Builder
+	var usage OpenAIUsage
+	err := b.client.StreamDeltas(ctx, OpenAIRequest{
+		BaseURL:  openAIBaseURL(req.BaseURL),
+		APIKey:   req.APIKey,
+		ModelID:  req.ModelID,
+		ProxyURL: req.ProxyURL,
+		Messages: messages,
+	}, func(d OpenAIDelta) {
+		if d.Reasoning != "" {
+			emit(streamDelta("thinking_delta", "thinking", d.Reasoning))
+		}
+		if d.Content != "" {
+			full.WriteString(d.Content)
+			emit(streamDelta("text_delta", "text", d.Content))
+		}
+		if d.Usage != nil {
+			usage = *d.Usage
+		}
+	})
+	if err != nil {
+		return err
+	}
+	emit(map[string]interface{}{
+		"type":    "result",
+		"subtype": "success",
+		"result":  full.String(),
+		"usage": map[string]int64{
+			"input_tokens":  usage.PromptTokens,
+			"output_tokens": usage.CompletionTokens,
+		},
+	})
+	return nil
+}
+
+// streamDelta builds a stream-json content_block_delta event.
+func streamDelta(deltaType, field, text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "stream_event",
+		"event": map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]string{"type": deltaType, field: text},
+		},
+	}
+}
+
+// buildMessages assembles system prompt + history + current query.
+// The current turn's user message(s) are already stored (and possibly merged
+// or seeded into req.Query), so trailing user messages are replaced by it.
+func (b *OpenAIBackend) buildMessages(req ClaudeCodeRequest) []ChatMessage {
+	var messages []ChatMessage
+	if strings.TrimSpace(req.SystemPrompt) != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: req.SystemPrompt})
+	}
+
+	var history []model.Message
+	if req.HubSessionID > 0 {
+		history, _ = store.GetMessages(req.HubSessionID)
+	}
+	// Drop the pre-inserted empty assistant placeholder and the pending user turn
+	turnStart := len(history)
+	for turnStart > 0 {
+		m := history[turnStart-1]
+		if m.Role == "user" || strings.TrimSpace(m.Content) == "" {
+			turnStart--
+			continue
+		}
+		break
+	}
+	var turnFirstID int64
+	if turnStart < len(history) {
+		turnFirstID = history[turnStart].ID
+	}
+	history = history[:turnStart]
+
+	b.mu.Lock()
+	if !req.Resume {
+		// Fresh run: the previous context is carried by req.Query (recovery seed), if at all
+		b.historyStart[req.HubSessionID] = historyAnchor{sessionID: req.SessionID, fromMsgID: turnFirstID}
+		history = nil
+	} else if a, ok := b.historyStart[req.HubSessionID]; ok && a.sessionID == req.SessionID {
+		start := len(history)
+		for i, m := range history {
+			if m.ID >= a.fromMsgID {
+				start = i
+				break
+			}
+		}
+		history = history[start:]
+	}
+	b.mu.Unlock()
+
+	if len(history) > openAIMaxHistory {
+		history = history[len(history)-openAIMaxHistory:]
+	}
+	for _, m := range history {
+		if strings.TrimSpace(m.Content) == "" || (m.Role != "user" && m.Role != "assistant") {
+			continue
+		}
+		// Merge consecutive same-role messages: many servers require alternation
+		if n := len(messages); n > 0 && messages[n-1].Role == m.Role {
+			messages[n-1].Content += "\n\n" + m.Content
+			continue
+		}
+		messages = append(messages, ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+		messages[n-1].Content += "\n\n" + req.Query
+	} else {
+		messages = append(messages, ChatMessage{Role: "user", Content: req.Query})
+	}
+	return messages
+}
+
+// openAIBaseURL adds the /v1 prefix Ollama needs for its OpenAI-compatible API.
+func openAIBaseURL(raw string) string {
+	base := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if isOllamaBaseURL(base) && !strings.HasSuffix(base, "/v1") {
+		base += "/v1"
+	}
+	return base
+}
@@ -0,0 +1,267 @@
+package core
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// DefaultMaxProcesses is the live Claude CLI process limit when not configured.
+const DefaultMaxProcesses = 8
+
+// Turn priorities for the process pool queue (higher runs first).
+const (
+	PriorityBackground  = 0 // triggers, hooks, session-to-session messages
+	PriorityChannel     = 1 // Feishu / QQ channel messages
+	PriorityInteractive = 2 // a user chatting in the web UI
+)
+
+// defaultTurnEstimate seeds wait estimates before any turn has completed.
+const defaultTurnEstimate = 60 * time.Second
+
+type priorityKey struct{}
+
+// WithPriority tags ctx with the queue priority of the turn it runs.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityFrom(ctx context.Context) int {
+	if v, ok := ctx.Value(priorityKey{}).(int); ok {
+		return v
+	}
+	return PriorityBackground
+}
+
+// QueueInfo is pushed to the UI while a session waits for a process slot.
+// Position 0 means the session left the queue (got a slot or gave up).
+type QueueInfo struct {
+	Position         int   `json:"position"`
+	QueueLength      int   `json:"queue_length"`
+	Priority         int   `json:"priority"`
+	EstimatedWaitSec int64 `json:"estimated_wait_sec"`
+}
+
+// poolWaiter is a session blocked in GetOrCreate.
+type poolWaiter struct {
+	hubSessionID int64
+	priority     int
+	seq          uint64
+	ready        chan struct{} // closed when a slot is reserved for it
+	granted      bool
+	index        int // heap index, -1 once popped
+}
+
+// waiterQueue is a max-heap on priority, FIFO within the same priority.
+type waiterQueue []*poolWaiter
+
+func (q waiterQueue) Len() int { return len(q) }
+func (q waiterQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+func (q waiterQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *waiterQueue) Push(x interface{}) {
+	w := x.(*poolWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+func (q *waiterQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
+
+// SetMaxProcesses changes the live process limit (0 = unlimited). Idle
+// processes above a lowered limit are evicted; busy ones finish their turn.
+func (p *ProcessPool) SetMaxProcesses(n int) {
+	if p == nil {
+		return
+	}
+	if n < 0 {
+		n = 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxProcs = n
+	for p.maxProcs > 0 && len(p.processes)+p.reserved > p.maxProcs {
+		if !p.evictIdleLocked(0) {
+			break
+		}
+	}
+	p.dispatchLocked()
+	log.Printf("[pool] max processes set to %d", n)
+}
+
+// Limits returns the process limit, live process count and queue length.
+func (p *ProcessPool) Limits() (maxProcs, running, queued int) {
+	if p == nil {
+		return 0, 0, 0
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.maxProcs, len(p.processes), p.waiters.Len()
+}
+
+// QueueStatus returns the waiting sessions in dispatch order.
+func (p *ProcessPool) QueueStatus() []QueueInfo {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	order := p.queueOrderLocked()
+	result := make([]QueueInfo, len(order))
+	for i, w := range order {
+		result[i] = p.queueInfoLocked(w, i+1, len(order))
+	}
+	return result
+}
+
+// hasRoomLocked reports whether another process may be spawned.
+func (p *ProcessPool) hasRoomLocked() bool {
+	return p.maxProcs <= 0 || len(p.processes)+p.reserved < p.maxProcs
+}
+
+// acquireSlotLocked makes room for a new process for hubSessionID: free slot,
+// else LRU eviction of an idle process, else wait in the priority queue.
+// Called with p.mu held; the lock is released while waiting and held again on return.
+func (p *ProcessPool) acquireSlotLocked(ctx context.Context, hubSessionID int64, priority int) error {
+	if p.waiters.Len() == 0 && (p.hasRoomLocked() || p.evictIdleLocked(hubSessionID)) {
+		return nil
+	}
+
+	p.seq++
+	w := &poolWaiter{hubSessionID: hubSessionID, priority: priority, seq: p.seq, ready: make(chan struct{})}
+	heap.Push(&p.waiters, w)
+	log.Printf("[pool] session %d queued (priority=%d, waiting=%d, max=%d)", hubSessionID, priority, p.waiters.Len(), p.maxProcs)
+	p.dispatchLocked()
+
+	p.mu.Unlock()
+	select {
+	case <-w.ready:
+		p.mu.Lock()
+	case <-ctx.Done():
+		p.mu.Lock()
+		if w.granted {
+			// Slot was reserved just as we gave up: hand it to the next waiter
+			p.reserved--
+		} else if w.index >= 0 {
+			heap.Remove(&p.waiters, w.index)
+		}
+		p.notifyQueueLocked(w.hubSessionID, QueueInfo{Priority: w.priority})
+		p.dispatchLocked()
+		return ctx.Err()
+	}
+	p.reserved--
+	return nil
+}
+
+// dispatchLocked hands free (or evictable) slots to queued sessions in
+// priority order, then pushes the new queue positions. Called with p.mu held.
+func (p *ProcessPool) dispatchLocked() {
+	for p.waiters.Len() > 0 {
+		next := p.waiters[0]
+		if !p.hasRoomLocked() && !p.evictIdleLocked(next.hubSessionID) {
+			break
+		}
+		w := heap.Pop(&p.waiters).(*poolWaiter)
+		w.granted = true
+		p.reserved++
+		close(w.ready)
+		log.Printf("[pool] session %d dequeued (priority=%d)", w.hubSessionID, w.priority)
+		p.notifyQueueLocked(w.hubSessionID, QueueInfo{Priority: w.priority})
+	}
+	order := p.queueOrderLocked()
+	for i, w := range order {
+		p.notifyQueueLocked(w.hubSessionID, p.queueInfoLocked(w, i+1, len(order)))
+	}
+}
+
+// evictIdleLocked kills the least recently used idle (or dead) process, never
+// the one belonging to keep. Returns false if every process is busy.
+func (p *ProcessPool) evictIdleLocked(keep int64) bool {
+	var victimID int64
+	var victim *PersistentProcess
+	var victimDead bool
+	var oldest time.Time
+	for id, proc := range p.processes {
+		if id == keep {
+			continue
+		}
+		proc.mu.Lock()
+		dead, idle, last := proc.dead, proc.state == "idle" && !proc.pendingKill, proc.lastActive
+		proc.mu.Unlock()
+		if !dead && !idle {
+			continue
+		}
+		// Dead processes go first, then the idle one unused for the longest time
+		if victim == nil || (dead && !victimDead) || (dead == victimDead && last.Before(oldest)) {
+			victimID, victim, victimDead, oldest = id, proc, dead, last
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	victim.kill()
+	delete(p.processes, victimID)
+	log.Printf("[pool] evicted process for session %d (dead=%v, idle %s) to free a slot", victimID, victimDead, time.Since(oldest).Round(time.Second))
+	if p.OnStateChange != nil {
+		go p.OnStateChange(victimID, false, "")
+	}
+	return true
+}
+
+// recordTurnLocked folds a finished turn into the moving average used for wait estimates.
+func (p *ProcessPool) recordTurnLocked(d time.Duration) {
+	if p.avgTurn == 0 {
+		p.avgTurn = d
+		return
+	}
+	p.avgTurn = (p.avgTurn*4 + d) / 5
+}
+
+func (p *ProcessPool) queueOrderLocked() []*poolWaiter {
+	order := make([]*poolWaiter, len(p.waiters))
+	copy(order, p.waiters)
+	sort.Slice(order, func(i, j int) bool { return waiterQueue(order).Less(i, j) })
+	return order
+}
+
+// queueInfoLocked estimates the wait as the number of "rounds" of turns ahead
+// of this position times the average turn duration.
+func (p *ProcessPool) queueInfoLocked(w *poolWaiter, position, length int) QueueInfo {
+	turn := p.avgTurn
+	if turn == 0 {
+		turn = defaultTurnEstimate
+	}
+	slots := p.maxProcs
+	if slots <= 0 {
+		slots = 1
+	}
+	rounds := (position + slots - 1) / slots
+	return QueueInfo{
+		Position:         position,
+		QueueLength:      length,
+		Priority:         w.priority,
+		EstimatedWaitSec: int64((turn * time.Duration(rounds)).Seconds()),
+	}
+}
+
+func (p *ProcessPool) notifyQueueLocked(hubSessionID int64, info QueueInfo) {
+	if p.OnQueueUpdate != nil {
+		go p.OnQueueUpdate(hubSessionID, info)
+	}
+}
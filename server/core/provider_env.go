@@ -26,7 +26,8 @@ func filterAnthropicEnv(env []string) []string {
 	for _, e := range env {
 		if strings.HasPrefix(e, "ANTHROPIC_API_KEY=") ||
 			strings.HasPrefix(e, "ANTHROPIC_AUTH_TOKEN=") ||
-			strings.HasPrefix(e, "ANTHROPIC_BASE_URL=") {
+			strings.HasPrefix(e, "ANTHROPIC_BASE_URL=") ||
+			strings.HasPrefix(e, "AI_HUB_TOKEN=") {
 			continue
 		}
 		out = append(out, e)
@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -169,6 +170,18 @@ func (m *ServiceManager) checkAll() {
 			if m.callback != nil {
 				m.callback(svc)
 			}
+			if newStatus == "dead" && oldStatus == "running" {
+				go FireHooks(HookEvent{
+					Type:    "service.died",
+					Content: svc.Command,
+					Vars: map[string]string{
+						"service_id":   strconv.FormatInt(svc.ID, 10),
+						"service_name": svc.Name,
+						"port":         strconv.Itoa(svc.Port),
+						"log_path":     svc.LogPath,
+					},
+				})
+			}
 		}
 	}
 }
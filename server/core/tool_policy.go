@@ -0,0 +1,178 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Interactive approval: tools that are neither allowed nor denied are sent by
+// the CLI to this MCP tool (--permission-prompt-tool), served by AI Hub itself.
+const (
+	ApprovalMCPServer  = "aihub_approval"
+	ApprovalPromptTool = "mcp__" + ApprovalMCPServer + "__approval_prompt"
+
+	DefaultApprovalTimeout = 5 * time.Minute
+)
+
+// Claude CLI permission modes accepted in a ToolPolicy.
+var validPermissionModes = map[string]bool{
+	"default":           true,
+	"acceptEdits":       true,
+	"plan":              true,
+	"bypassPermissions": true,
+}
+
+// ToolPolicyPresets are ready-made policies selectable by name.
+var ToolPolicyPresets = map[string]model.ToolPolicy{
+	// readonly: browse files and the web, no shell, no writes.
+	// Meant for sessions bound to untrusted channels (e.g. public QQ groups).
+	"readonly": {
+		PermissionMode: "default",
+		AllowedTools:   []string{"Read", "Grep", "Glob", "LS", "WebFetch", "WebSearch", "TodoWrite"},
+		DeniedTools:    []string{"Bash", "Edit", "MultiEdit", "Write", "NotebookEdit", "KillShell"},
+	},
+	// workspace: edits limited to the working directory, a few safe shell commands.
+	"workspace": {
+		PermissionMode: "default",
+		AllowedTools:   []string{"Read", "Grep", "Glob", "LS", "WebFetch", "WebSearch", "TodoWrite"},
+		BashPatterns:   []string{"ls:*", "cat:*", "git status", "git diff:*", "git log:*"},
+		WritablePaths:  []string{"./**"},
+	},
+}
+
+// NormalizeToolPolicy trims empty entries and validates the permission mode.
+func NormalizeToolPolicy(p *model.ToolPolicy) error {
+	p.PermissionMode = strings.TrimSpace(p.PermissionMode)
+	if p.PermissionMode == "" {
+		p.PermissionMode = "default"
+	}
+	if !validPermissionModes[p.PermissionMode] {
+		return fmt.Errorf("invalid permission_mode %q (valid: default, acceptEdits, plan, bypassPermissions)", p.PermissionMode)
+	}
+	p.AllowedTools = cleanList(p.AllowedTools)
+	p.DeniedTools = cleanList(p.DeniedTools)
+	p.BashPatterns = cleanList(p.BashPatterns)
+	p.WritablePaths = cleanList(p.WritablePaths)
+	p.ApprovalTools = cleanList(p.ApprovalTools)
+	if p.ApprovalTimeoutSec < 0 {
+		p.ApprovalTimeoutSec = 0
+	}
+	for _, list := range [][]string{p.AllowedTools, p.DeniedTools, p.BashPatterns, p.WritablePaths} {
+		for _, v := range list {
+			// The CLI takes comma-separated lists; a comma would split a rule
+			if strings.Contains(v, ",") {
+				return fmt.Errorf("invalid entry %q: commas are not allowed", v)
+			}
+		}
+	}
+	return nil
+}
+
+func cleanList(in []string) []string {
+	out := []string{}
+	seen := make(map[string]bool)
+	for _, v := range in {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+// PermissionArgs compiles a tool policy into Claude CLI flags. baseDisallowed
+// are tools AI Hub always disables (plan mode etc.). A nil policy keeps the
+// unrestricted behaviour: --dangerously-skip-permissions.
+func PermissionArgs(p *model.ToolPolicy, baseDisallowed []string) []string {
+	if p == nil {
+		return []string{
+			"--dangerously-skip-permissions",
+			"--disallowed-tools", strings.Join(baseDisallowed, ","),
+		}
+	}
+
+	mode := p.PermissionMode
+	if mode == "" {
+		mode = "default"
+	}
+	args := []string{"--permission-mode", mode}
+
+	allowed := append([]string{}, p.AllowedTools...)
+	for _, pattern := range p.BashPatterns {
+		allowed = append(allowed, "Bash("+pattern+")")
+	}
+	for _, path := range p.WritablePaths {
+		allowed = append(allowed, "Edit("+path+")", "Write("+path+")")
+	}
+	if len(allowed) > 0 {
+		args = append(args, "--allowedTools", strings.Join(allowed, ","))
+	}
+
+	denied := append(append([]string{}, baseDisallowed...), p.DeniedTools...)
+	if len(denied) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(denied, ","))
+	}
+	return args
+}
+
+// NeedsApproval reports whether a policy routes permission prompts to a human.
+func NeedsApproval(p *model.ToolPolicy) bool {
+	return p != nil && len(p.ApprovalTools) > 0
+}
+
+// ApprovalRequired reports whether a call to toolName should wait for a human
+// decision (as opposed to being denied outright).
+func ApprovalRequired(p *model.ToolPolicy, toolName string) bool {
+	if p == nil {
+		return false
+	}
+	for _, t := range p.ApprovalTools {
+		if t == "*" || t == toolName {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalTimeout returns the policy's approval timeout (default 5 minutes).
+func ApprovalTimeout(p *model.ToolPolicy) time.Duration {
+	if p != nil && p.ApprovalTimeoutSec > 0 {
+		return time.Duration(p.ApprovalTimeoutSec) * time.Second
+	}
+	return DefaultApprovalTimeout
+}
+
+// approvalArgs adds the permission prompt tool and the local MCP server that
+// serves it. The CLI authenticates with the session-scoped token.
+func approvalArgs(req ClaudeCodeRequest) []string {
+	port := GetPort()
+	if !NeedsApproval(req.ToolPolicy) || req.HubSessionID <= 0 || port == "" {
+		return nil
+	}
+	server := map[string]interface{}{
+		"type": "http",
+		"url":  fmt.Sprintf("http://127.0.0.1:%s/api/v1/sessions/%d/approval-mcp", port, req.HubSessionID),
+	}
+	if AuthEnabled() {
+		server["headers"] = map[string]string{TokenHeader: IssueSessionToken(req.HubSessionID)}
+	}
+	cfg, _ := json.Marshal(map[string]interface{}{
+		"mcpServers": map[string]interface{}{ApprovalMCPServer: server},
+	})
+	return []string{"--mcp-config", string(cfg), "--permission-prompt-tool", ApprovalPromptTool}
+}
+
+// approvalEnv raises the CLI's MCP tool timeout above the approval timeout,
+// so the CLI keeps waiting while a human decides.
+func approvalEnv(env []string, req ClaudeCodeRequest) []string {
+	if !NeedsApproval(req.ToolPolicy) {
+		return env
+	}
+	ms := (ApprovalTimeout(req.ToolPolicy) + time.Minute).Milliseconds()
+	return append(env, fmt.Sprintf("MCP_TOOL_TIMEOUT=%d", ms))
+}
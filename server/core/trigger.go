@@ -3,12 +3,11 @@ package core
 import (
 	"ai-hub/server/model"
 	"ai-hub/server/store"
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -23,9 +22,25 @@ const (
 	kindExact    triggerKind = iota // "2026-02-17 10:30:00"
 	kindDaily                       // "10:30:00"
 	kindInterval                    // "1h30m"
+	kindCron                        // "0 9 * * 1-5", "0 30 9 * * MON#1", "@daily"
 	kindInvalid
 )
 
+// maxExcludedSkips bounds the search for a fire time outside the exclusions.
+const maxExcludedSkips = 5000
+
+// Missed fire times and busy sessions. A fire time more than misfireGrace
+// late (the server was down, or an earlier run was still queued) is a
+// misfire and handled by the trigger's misfire policy. A run whose session is
+// busy is retried after retry_delay, doubling up to maxRetryDelay.
+const (
+	misfireGrace      = 2 * time.Minute
+	maxMisfireRuns    = 50
+	defaultRetryLimit = 10
+	defaultRetryDelay = time.Minute
+	maxRetryDelay     = time.Hour
+)
+
 func parseTriggerKind(s string) triggerKind {
 	if _, err := time.ParseInLocation(timeLayout, s, bjLoc); err == nil {
 		return kindExact
@@ -36,31 +51,145 @@ func parseTriggerKind(s string) triggerKind {
 	if _, err := time.ParseDuration(s); err == nil {
 		return kindInterval
 	}
+	if _, err := parseCron(s); err == nil {
+		return kindCron
+	}
 	return kindInvalid
 }
 
-// ValidateTriggerTime checks if the trigger_time format is supported.
+// triggerLocation returns the trigger's IANA time zone; empty means CST+8.
+func triggerLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return bjLoc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// ValidateTriggerTime checks a trigger's time, timezone and exclusions and
+// previews its next n fire times in the trigger's time zone.
 // Returns an error message if invalid, empty string if valid.
-func ValidateTriggerTime(s string) string {
-	if parseTriggerKind(s) == kindInvalid {
-		return "不支持的 trigger_time 格式，支持: \"2006-01-02 15:04:05\"(精确时间), \"15:04:05\"(每日), \"1h30m\"(间隔)"
+func ValidateTriggerTime(t *model.Trigger, n int) ([]string, string) {
+	kind := parseTriggerKind(t.TriggerTime)
+	if kind == kindInvalid {
+		msg := "不支持的 trigger_time 格式，支持: \"2006-01-02 15:04:05\"(精确时间), \"15:04:05\"(每日), \"1h30m\"(间隔), cron 表达式(\"0 9 * * 1-5\", 6 段含秒, @daily 等)"
+		if len(strings.Fields(t.TriggerTime)) >= 3 || strings.HasPrefix(t.TriggerTime, "@") {
+			if _, err := parseCron(t.TriggerTime); err != nil {
+				msg = "cron 表达式无效: " + err.Error()
+			}
+		}
+		return nil, msg
+	}
+	if kind == kindInterval {
+		if dur, _ := time.ParseDuration(t.TriggerTime); dur <= 0 {
+			return nil, "间隔必须大于 0"
+		}
+	}
+	loc, err := triggerLocation(t.Timezone)
+	if err != nil {
+		return nil, err.Error()
+	}
+	times, err := NextFireTimes(t, time.Now(), n)
+	if err != nil {
+		return nil, err.Error()
+	}
+	preview := make([]string, len(times))
+	for i, ft := range times {
+		preview[i] = ft.In(loc).Format(timeLayout + " Z07:00 Mon")
+	}
+	return preview, ""
+}
+
+// ValidateTriggerPolicy checks a trigger's misfire and retry settings.
+// Returns an error message if invalid, empty string if valid.
+func ValidateTriggerPolicy(t *model.Trigger) string {
+	switch t.Misfire {
+	case "", model.MisfireFireOnce, model.MisfireFireAll, model.MisfireSkip:
+	default:
+		return "misfire 必须是 fire_once, fire_all 或 skip"
+	}
+	if t.RetryLimit < -1 {
+		return "retry_limit 必须 >= -1（-1 = 一直排队）"
+	}
+	if t.RetryDelay != "" {
+		if d, err := time.ParseDuration(t.RetryDelay); err != nil || d <= 0 {
+			return "retry_delay 必须是正的时长，如 \"30s\", \"5m\""
+		}
 	}
 	return ""
 }
 
+// retryDelay returns how long to wait before attempt n+1 of a run.
+func retryDelay(t *model.Trigger, attempts int) time.Duration {
+	d := defaultRetryDelay
+	if t.RetryDelay != "" {
+		if v, err := time.ParseDuration(t.RetryDelay); err == nil && v > 0 {
+			d = v
+		}
+	}
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
 func CalcNextFireAt(t *model.Trigger, now time.Time) string {
+	times, err := NextFireTimes(t, now, 1)
+	if err != nil || len(times) == 0 {
+		return ""
+	}
+	return times[0].In(bjLoc).Format(timeLayout)
+}
+
+// NextFireTimes returns up to n fire times of t from now on, skipping its
+// exclusion dates. Daily and cron times are wall-clock times in the
+// trigger's time zone; exact times too. An exact time is returned even when
+// past (it fires at once), unless excluded.
+func NextFireTimes(t *model.Trigger, now time.Time, n int) ([]time.Time, error) {
+	loc, err := triggerLocation(t.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := compileExclusions(t.Exclusions, loc)
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(loc)
+	var out []time.Time
+
 	switch parseTriggerKind(t.TriggerTime) {
 	case kindExact:
-		return t.TriggerTime
+		fire, _ := time.ParseInLocation(timeLayout, t.TriggerTime, loc)
+		if !excluded(fire) && n > 0 {
+			out = append(out, fire)
+		}
 	case kindDaily:
 		parsed, _ := time.Parse("15:04:05", t.TriggerTime)
-		fire := time.Date(now.Year(), now.Month(), now.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, bjLoc)
-		if now.After(fire) {
-			fire = fire.AddDate(0, 0, 1)
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+		fireOn := func(d time.Time) time.Time {
+			return time.Date(d.Year(), d.Month(), d.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0, loc)
+		}
+		if now.After(fireOn(day)) {
+			day = day.AddDate(0, 0, 1)
+		}
+		for skips := 0; len(out) < n && skips < maxExcludedSkips; day = day.AddDate(0, 0, 1) {
+			if fire := fireOn(day); excluded(fire) {
+				skips++
+			} else {
+				out = append(out, fire)
+			}
 		}
-		return fire.Format(timeLayout)
 	case kindInterval:
 		dur, _ := time.ParseDuration(t.TriggerTime)
+		if dur <= 0 {
+			return nil, fmt.Errorf("interval must be positive")
+		}
 		var base time.Time
 		if t.LastFiredAt != "" {
 			base, _ = time.ParseInLocation(timeLayout, t.LastFiredAt, bjLoc)
@@ -70,12 +199,44 @@ func CalcNextFireAt(t *model.Trigger, now time.Time) string {
 			base = now
 		}
 		next := base.Add(dur)
-		for next.Before(now) {
-			next = next.Add(dur)
+		if next.Before(now) {
+			next = next.Add(now.Sub(next).Truncate(dur))
+			if next.Before(now) {
+				next = next.Add(dur)
+			}
 		}
-		return next.Format(timeLayout)
+		for skips := 0; len(out) < n && skips < maxExcludedSkips; next = next.Add(dur) {
+			if excluded(next) {
+				skips++
+			} else {
+				out = append(out, next.In(loc))
+			}
+		}
+	case kindCron:
+		sched, err := parseCron(t.TriggerTime)
+		if err != nil {
+			return nil, err
+		}
+		// Start just before now so a fire time equal to now counts, like daily
+		next := sched.next(now.Add(-time.Second))
+		if next.Before(now) {
+			next = sched.next(next)
+		}
+		for skips := 0; len(out) < n && !next.IsZero() && skips < maxExcludedSkips; {
+			if !excluded(next) {
+				out = append(out, next)
+				next = sched.next(next)
+				continue
+			}
+			skips++
+			// Jump past the excluded day
+			dayEnd := time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+			next = sched.next(dayEnd.Add(-time.Second))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported trigger_time %q", t.TriggerTime)
 	}
-	return ""
+	return out, nil
 }
 
 func shouldFire(t *model.Trigger, now time.Time) bool {
@@ -95,27 +256,28 @@ func shouldFire(t *model.Trigger, now time.Time) bool {
 	return !now.Before(nextTime)
 }
 
-func fireTrigger(t *model.Trigger, port int) error {
-	url := fmt.Sprintf("http://localhost:%d/api/v1/chat/send", port)
-	body, _ := json.Marshal(map[string]interface{}{
-		"session_id": t.SessionID,
-		"content":    t.Content,
-	})
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("http error: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode == 404 {
-		return fmt.Errorf("session %d not found", t.SessionID)
+// fireTrigger sends the trigger's content to its session and returns the ID
+// of the user message (0 when attention mode saves it later). Triggers of
+// shadow AI sessions are recorded as shadow messages.
+func fireTrigger(t *model.Trigger) (int64, error) {
+	source := SourceTrigger
+	if session, err := store.GetSession(t.SessionID); err == nil && session.IsShadow {
+		source = SourceShadow
 	}
-	if resp.StatusCode == 409 {
-		return fmt.Errorf("session %d busy", t.SessionID)
+	result, err := Dispatch(DispatchRequest{
+		SessionID: t.SessionID,
+		Content:   t.Content,
+		Source:    source,
+		SourceID:  t.ID,
+		Priority:  PriorityBackground,
+	})
+	if errors.Is(err, ErrSessionNotFound) {
+		return 0, fmt.Errorf("session %d not found", t.SessionID)
 	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("status %d", resp.StatusCode)
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return result.MessageID, nil
 }
 
 // extractActivityType extracts activity type from trigger content
@@ -151,19 +313,19 @@ func getActivityLabel(actType string) string {
 	}
 }
 
-func StartTriggerLoop(port int) {
+func StartTriggerLoop() {
 	ticker := time.NewTicker(1 * time.Minute)
 	go func() {
-		checkTriggers(port)
+		checkTriggers()
 		for range ticker.C {
-			checkTriggers(port)
+			checkTriggers()
 		}
 	}()
 	fmt.Fprintf(os.Stderr, "[DEBUG] trigger scheduler started, checking every 1 minute\n")
 	log.Printf("[trigger] scheduler started, checking every 1 minute")
 }
 
-func checkTriggers(port int) {
+func checkTriggers() {
 	triggers, err := store.ListTriggers()
 	if err != nil {
 		log.Printf("[trigger] list error: %v", err)
@@ -177,74 +339,260 @@ func checkTriggers(port int) {
 	log.Printf("[trigger] checking %d triggers", len(triggers))
 
 	now := time.Now().In(bjLoc)
+	pending, err := store.TriggersWithPendingRuns()
+	if err != nil {
+		log.Printf("[trigger] runs error: %v", err)
+		return
+	}
 
+	byID := make(map[int64]*model.Trigger, len(triggers))
+	dirty := make(map[int64]bool)
 	for i := range triggers {
 		t := &triggers[i]
-		dirty := false
+		byID[t.ID] = t
 
 		// 同步 enabled <-> status
 		if !t.Enabled && t.Status != "disabled" {
 			t.Status = "disabled"
-			dirty = true
+			dirty[t.ID] = true
 		}
 		if t.Enabled && t.Status == "disabled" {
 			t.Status = "active"
-			dirty = true
+			dirty[t.ID] = true
 		}
 		if t.Status == "fired" {
 			t.Status = "active"
-			dirty = true
+			dirty[t.ID] = true
+		}
+
+		// 还有排队中的执行：保持 next_fire_at 不动，排完后按 misfire 策略补
+		if pending[t.ID] {
+			continue
 		}
 
 		// 先用当前 next_fire_at 判断是否该触发（不要提前刷新）
-		if shouldFire(t, now) {
-			fmt.Fprintf(os.Stderr, "[DEBUG] firing trigger: id=%d session=%d\n", t.ID, t.SessionID)
-			log.Printf("[trigger] firing: id=%d session=%d", t.ID, t.SessionID)
-			if err := fireTrigger(t, port); err != nil {
-				log.Printf("[trigger] failed: id=%d err=%v", t.ID, err)
-				t.Status = "failed"
-				store.UpdateTrigger(t)
-				continue
-			}
+		if shouldFire(t, now) && scheduleRuns(t, now) {
+			dirty[t.ID] = true
+		}
+
+		// 再刷新 next_fire_at，为下一轮做准备
+		newNext := CalcNextFireAt(t, now)
+		if newNext != t.NextFireAt {
+			t.NextFireAt = newNext
+			dirty[t.ID] = true
+		}
+	}
 
-			// Auto-record shadow AI activity
-			log.Printf("[trigger] checking shadow AI activity recording for session=%d", t.SessionID)
-			if session, err := store.GetSession(t.SessionID); err == nil && session != nil && session.IsShadow {
-				actType := extractActivityType(t.Content)
-				if actType != "" {
-					timestamp := now.Format(time.RFC3339)
-					summary := fmt.Sprintf("%s触发 #%d", getActivityLabel(actType), t.FiredCount+1)
-
-					_, err := store.DB.Exec(
-						"INSERT INTO shadow_activities (timestamp, type, summary, created_at) VALUES (?, ?, ?, ?)",
-						timestamp, actType, summary, timestamp,
-					)
-					if err != nil {
-						log.Printf("[trigger] failed to record activity: %v", err)
-					} else {
-						log.Printf("[trigger] recorded activity: session=%d type=%s count=%d", t.SessionID, actType, t.FiredCount+1)
-					}
-				}
+	runs, err := store.DueTriggerRuns(now.Format(timeLayout))
+	if err != nil {
+		log.Printf("[trigger] runs error: %v", err)
+	}
+	busy := make(map[int64]bool) // sessions sent to (or busy) in this round
+	for i := range runs {
+		r := &runs[i]
+		t := byID[r.TriggerID]
+		if t != nil && busy[t.SessionID] {
+			continue
+		}
+		if executeRun(r, t, now) {
+			dirty[t.ID] = true
+		}
+		if t != nil && r.Status != model.TriggerRunSkipped {
+			busy[t.SessionID] = true
+		}
+	}
+
+	for id := range dirty {
+		store.UpdateTrigger(byID[id])
+	}
+}
+
+// scheduleRuns queues the fire times of t due at now as pending runs,
+// applying the trigger's misfire policy to late ones. Returns whether t
+// changed.
+func scheduleRuns(t *model.Trigger, now time.Time) bool {
+	next, err := time.ParseInLocation(timeLayout, t.NextFireAt, bjLoc)
+	if err != nil {
+		return false
+	}
+	due := []time.Time{next}
+	if more, err := NextFireTimes(t, next.Add(time.Second), maxMisfireRuns); err == nil {
+		for _, ft := range more {
+			if ft.After(now) || len(due) >= maxMisfireRuns {
+				break
 			}
+			if ft.After(due[len(due)-1]) {
+				due = append(due, ft)
+			}
+		}
+	}
+	var missed, onTime []time.Time
+	for _, ft := range due {
+		if now.Sub(ft) > misfireGrace {
+			missed = append(missed, ft)
+		} else {
+			onTime = append(onTime, ft)
+		}
+	}
+
+	queue := func(ft time.Time, status, note string) {
+		r := &model.TriggerRun{
+			TriggerID:   t.ID,
+			SessionID:   t.SessionID,
+			ScheduledAt: ft.In(bjLoc).Format(timeLayout),
+			Status:      status,
+			Note:        note,
+		}
+		if status == model.TriggerRunPending {
+			r.NextAttemptAt = now.Format(timeLayout)
+		}
+		if err := store.CreateTriggerRun(r); err != nil {
+			log.Printf("[trigger] create run failed: id=%d err=%v", t.ID, err)
+		}
+	}
 
-			t.FiredCount++
-			t.LastFiredAt = now.Format(timeLayout)
-			t.Status = "fired"
-			if t.MaxFires > 0 && t.FiredCount >= t.MaxFires {
-				t.Status = "completed"
+	if len(missed) > 0 {
+		log.Printf("[trigger] misfire: id=%d missed=%d policy=%q", t.ID, len(missed), t.Misfire)
+	}
+	switch t.Misfire {
+	case model.MisfireFireAll:
+		for _, ft := range due {
+			note := ""
+			if now.Sub(ft) > misfireGrace {
+				note = "misfire: fired late"
 			}
-			dirty = true
+			queue(ft, model.TriggerRunPending, note)
+		}
+	case model.MisfireSkip:
+		for _, ft := range missed {
+			queue(ft, model.TriggerRunSkipped, "misfire: skipped")
 		}
+		for _, ft := range onTime {
+			queue(ft, model.TriggerRunPending, "")
+		}
+		// A skipped one-shot trigger has nothing left to fire
+		if len(onTime) == 0 && parseTriggerKind(t.TriggerTime) == kindExact {
+			t.Status = "completed"
+			return true
+		}
+	default: // fire_once
+		note := ""
+		if len(missed) > 0 {
+			note = fmt.Sprintf("misfire: %d missed fire time(s) fired once", len(missed))
+		}
+		queue(due[len(due)-1], model.TriggerRunPending, note)
+	}
+	return false
+}
 
-		// 触发后（或未触发）再刷新 next_fire_at，为下一轮做准备
-		newNext := CalcNextFireAt(t, now)
-		if newNext != t.NextFireAt {
-			t.NextFireAt = newNext
-			dirty = true
+// executeRun sends a pending run and records the outcome on the run and on
+// t (nil when the trigger was deleted). Returns whether t changed.
+func executeRun(r *model.TriggerRun, t *model.Trigger, now time.Time) bool {
+	skip := ""
+	switch {
+	case t == nil:
+		skip = "trigger deleted"
+	case !t.Enabled:
+		skip = "trigger disabled"
+	case t.MaxFires > 0 && t.FiredCount >= t.MaxFires:
+		skip = "max_fires reached"
+	}
+	if skip != "" {
+		r.Status = model.TriggerRunSkipped
+		r.Error = skip
+		r.NextAttemptAt = ""
+		store.UpdateTriggerRun(r)
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "[DEBUG] firing trigger: id=%d session=%d\n", t.ID, t.SessionID)
+	log.Printf("[trigger] firing: id=%d session=%d run=%d attempt=%d", t.ID, t.SessionID, r.ID, r.Attempts+1)
+	r.Attempts++
+	msgID, err := fireTrigger(t)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrSessionBusy):
+		limit := t.RetryLimit
+		if limit == 0 {
+			limit = defaultRetryLimit
+		}
+		if limit < 0 || r.Attempts <= limit {
+			delay := retryDelay(t, r.Attempts)
+			r.Error = err.Error()
+			r.NextAttemptAt = now.Add(delay).Format(timeLayout)
+			store.UpdateTriggerRun(r)
+			log.Printf("[trigger] session busy: id=%d run=%d retry in %s", t.ID, r.ID, delay)
+			t.Status = "queued"
+			return true
 		}
+		err = fmt.Errorf("session %d still busy after %d attempts", t.SessionID, r.Attempts)
+		fallthrough
+	default:
+		log.Printf("[trigger] failed: id=%d err=%v", t.ID, err)
+		r.Status = model.TriggerRunFailed
+		r.Error = err.Error()
+		r.NextAttemptAt = ""
+		store.UpdateTriggerRun(r)
+		t.Status = "failed"
+		go FireHooks(HookEvent{
+			Type:            "trigger.failed",
+			SourceSessionID: t.SessionID,
+			Content:         r.Error,
+			Source:          SourceTrigger,
+			Vars: map[string]string{
+				"trigger_id":      strconv.FormatInt(t.ID, 10),
+				"scheduled_at":    r.ScheduledAt,
+				"attempts":        strconv.Itoa(r.Attempts),
+				"trigger_content": t.Content,
+			},
+		})
+		return true
+	}
 
-		if dirty {
-			store.UpdateTrigger(t)
+	r.Status = model.TriggerRunSuccess
+	r.FiredAt = now.Format(timeLayout)
+	r.MessageID = msgID
+	r.Error = ""
+	r.NextAttemptAt = ""
+	store.UpdateTriggerRun(r)
+	go FireHooks(HookEvent{
+		Type:            "trigger.fired",
+		SourceSessionID: t.SessionID,
+		Content:         t.Content,
+		Source:          SourceTrigger,
+		Vars: map[string]string{
+			"trigger_id":   strconv.FormatInt(t.ID, 10),
+			"scheduled_at": r.ScheduledAt,
+			"message_id":   strconv.FormatInt(msgID, 10),
+			"attempts":     strconv.Itoa(r.Attempts),
+		},
+	})
+
+	// Auto-record shadow AI activity
+	log.Printf("[trigger] checking shadow AI activity recording for session=%d", t.SessionID)
+	if session, err := store.GetSession(t.SessionID); err == nil && session != nil && session.IsShadow {
+		actType := extractActivityType(t.Content)
+		if actType != "" {
+			timestamp := now.Format(time.RFC3339)
+			summary := fmt.Sprintf("%s触发 #%d", getActivityLabel(actType), t.FiredCount+1)
+
+			_, err := store.DB.Exec(
+				"INSERT INTO shadow_activities (timestamp, type, summary, created_at) VALUES (?, ?, ?, ?)",
+				timestamp, actType, summary, timestamp,
+			)
+			if err != nil {
+				log.Printf("[trigger] failed to record activity: %v", err)
+			} else {
+				log.Printf("[trigger] recorded activity: session=%d type=%s count=%d", t.SessionID, actType, t.FiredCount+1)
+			}
 		}
 	}
+
+	t.FiredCount++
+	t.LastFiredAt = now.Format(timeLayout)
+	t.Status = "fired"
+	if t.MaxFires > 0 && t.FiredCount >= t.MaxFires {
+		t.Status = "completed"
+	}
+	return true
 }
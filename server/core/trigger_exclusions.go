@@ -0,0 +1,97 @@
+package core
+
+import (
+	"ai-hub/server/store"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Trigger exclusions: days on which a trigger does not fire. Entries are
+//
+//	"2026-10-01"              a date
+//	"2026-10-01..2026-10-07"  a date range (inclusive)
+//	"12-25"                   the same day every year
+//	"@cn-holidays"            a named holiday list (settings trigger_calendars)
+//
+// Days are judged in the trigger's time zone.
+
+const dateLayout = "2006-01-02"
+
+// ValidateExclusions checks the entries of a holiday list, which cannot
+// refer to other lists.
+func ValidateExclusions(entries []string) error {
+	for _, e := range entries {
+		if _, err := parseExclusion(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileExclusions returns a predicate reporting whether a time falls on
+// an excluded day.
+func compileExclusions(entries []string, loc *time.Location) (func(time.Time) bool, error) {
+	var matchers []func(string) bool
+	var calendars map[string][]string
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if name, ok := strings.CutPrefix(e, "@"); ok {
+			if calendars == nil {
+				calendars = store.GetTriggerCalendars()
+			}
+			days, found := calendars[name]
+			if !found {
+				return nil, fmt.Errorf("unknown holiday list %q", e)
+			}
+			for _, d := range days {
+				m, err := parseExclusion(d)
+				if err != nil {
+					return nil, fmt.Errorf("holiday list %q: %w", name, err)
+				}
+				matchers = append(matchers, m)
+			}
+			continue
+		}
+		m, err := parseExclusion(e)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return func(t time.Time) bool {
+		day := t.In(loc).Format(dateLayout)
+		for _, m := range matchers {
+			if m(day) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// parseExclusion returns a matcher over "2006-01-02" day strings.
+func parseExclusion(e string) (func(string) bool, error) {
+	e = strings.TrimSpace(e)
+	if from, to, ok := strings.Cut(e, ".."); ok {
+		a, err1 := time.Parse(dateLayout, strings.TrimSpace(from))
+		b, err2 := time.Parse(dateLayout, strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || b.Before(a) {
+			return nil, fmt.Errorf("invalid exclusion range %q (want 2006-01-02..2006-01-31)", e)
+		}
+		lo, hi := a.Format(dateLayout), b.Format(dateLayout)
+		return func(day string) bool { return day >= lo && day <= hi }, nil
+	}
+	if d, err := time.Parse(dateLayout, e); err == nil {
+		date := d.Format(dateLayout)
+		return func(day string) bool { return day == date }, nil
+	}
+	if d, err := time.Parse("01-02", e); err == nil {
+		md := d.Format("01-02")
+		return func(day string) bool { return day[5:] == md }, nil
+	}
+	return nil, fmt.Errorf("invalid exclusion %q (want 2006-01-02, 2006-01-02..2006-01-31, 01-02 or @list)", e)
+}
@@ -4,25 +4,22 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/nlpodyssey/cybertron/pkg/models/bert"
-	"github.com/nlpodyssey/cybertron/pkg/tasks"
-	"github.com/nlpodyssey/cybertron/pkg/tasks/textencoding"
 )
 
 const (
-	// DefaultModelName is the Chinese embedding model
+	// DefaultModelName is the builtin Chinese embedding model
 	DefaultModelName = "BAAI/bge-small-zh-v1.5"
-	// VectorDimension is the output dimension of the model
+	// VectorDimension is the output dimension of the builtin model
 	VectorDimension = 512
 	// HuggingFace mirror for China
 	HFMirrorEndpoint = "https://hf-mirror.com"
@@ -40,6 +37,13 @@ type VectorRecord struct {
 	LastHitAt  string                 `json:"last_hit_at"`
 	ReadCount  int                    `json:"read_count"`
 	LastReadAt string                 `json:"last_read_at"`
+
+	// Chunk records (see vector_chunk.go): the document the chunk belongs to,
+	// its position, heading path and byte offset in the document
+	ParentID string `json:"parent_id,omitempty"`
+	Chunk    int    `json:"chunk,omitempty"`
+	Heading  string `json:"heading,omitempty"`
+	Start    int    `json:"start,omitempty"`
 }
 
 // VectorEngine manages the Go-native vector engine
@@ -49,13 +53,35 @@ type VectorEngine struct {
 	disabled bool
 	err      string
 
-	// model
-	model    textencoding.Interface
-	modelDir string
+	// embedding: the current embedder, plus old ones still serving
+	// collections that are waiting to be re-indexed (see vector_embedder.go)
+	embedder  Embedder
+	embedders map[string]Embedder
+	reindex   reindexState
+	modelDir  string
 
 	// storage: scope -> (docID -> record)
 	collections map[string]map[string]*VectorRecord
 	dataDir     string
+
+	// ANN: scope -> HNSW index (only scopes with >= annMinRecords records)
+	indexes       map[string]*hnswIndex
+	indexBuilding map[string]bool
+	// keyword: scope -> BM25 index over the chunk records
+	keyword map[string]*bm25Index
+
+	// on-disk stores: scope -> vec / meta / wal files (see vector_store.go)
+	stores    map[string]*collectionStore
+	flushOnce sync.Once
+
+	// chunking of embedded documents, in runes
+	chunkSize    int
+	chunkOverlap int
+
+	// degraded mode (see vector_degraded.go)
+	modelWatching  bool
+	backlogRunning atomic.Bool
+	importMu       sync.Mutex
 }
 
 var Vector *VectorEngine
@@ -67,9 +93,16 @@ func InitVectorEngine(_ string) {
 	dataDir := filepath.Join(baseDir, "vector-data")
 
 	Vector = &VectorEngine{
-		modelDir:    modelDir,
-		dataDir:     dataDir,
-		collections: make(map[string]map[string]*VectorRecord),
+		modelDir:      modelDir,
+		dataDir:       dataDir,
+		collections:   make(map[string]map[string]*VectorRecord),
+		indexes:       make(map[string]*hnswIndex),
+		indexBuilding: make(map[string]bool),
+		keyword:       make(map[string]*bm25Index),
+		stores:        make(map[string]*collectionStore),
+		embedders:     make(map[string]Embedder),
+		chunkSize:     DefaultChunkSize,
+		chunkOverlap:  DefaultChunkOverlap,
 	}
 
 	go Vector.bootstrap()
@@ -78,22 +111,29 @@ func InitVectorEngine(_ string) {
 func (v *VectorEngine) bootstrap() {
 	log.Println("[vector] starting bootstrap...")
 
-	// Step 1: Load embedding model
-	if err := v.loadModel(); err != nil {
-		v.setDisabled("model load failed: " + err.Error())
-		return
+	// Step 1: Load the configured embedder. Without one, memory keeps working
+	// on keyword search (degraded) until a model is installed.
+	modelErr := v.loadEmbedder(false)
+	if modelErr == nil {
+		log.Println("[vector] embedding model loaded")
 	}
-	log.Println("[vector] embedding model loaded")
 
 	// Step 2: Load existing data
 	if err := v.loadData(); err != nil {
 		log.Printf("[vector] warning: failed to load existing data: %v", err)
 	}
+	v.flushOnce.Do(func() { go v.statsFlushLoop() })
 
 	v.mu.Lock()
 	v.ready = true
 	v.mu.Unlock()
+	if modelErr != nil {
+		v.setDegraded("model load failed: " + modelErr.Error())
+		return
+	}
 	log.Println("[vector] engine ready")
+	// Collections of a previously configured embedder, and text-only records
+	go v.Reindex()
 }
 
 // Reload reinitializes the vector engine (hot reload)
@@ -117,88 +157,16 @@ func (v *VectorEngine) ReloadWithOptions(forceDownload bool) {
 	v.mu.Unlock()
 
 	// Reload model
-	if err := v.loadModelWithRetry(forceDownload); err != nil {
-		v.setDisabled("model reload failed: " + err.Error())
-		return
-	}
+	err := v.loadEmbedder(forceDownload)
 
 	v.mu.Lock()
 	v.ready = true
 	v.mu.Unlock()
-	log.Println("[vector] reload complete")
-}
-
-func (v *VectorEngine) loadModel() error {
-	return v.loadModelWithRetry(false)
-}
-
-func (v *VectorEngine) loadModelWithRetry(forceDownload bool) error {
-	os.MkdirAll(v.modelDir, 0755)
-
-	// Check if model exists locally
-	modelPath := filepath.Join(v.modelDir, strings.ReplaceAll(DefaultModelName, "/", string(os.PathSeparator)))
-	spagoModel := filepath.Join(modelPath, "spago_model.bin")
-
-	var downloadPolicy tasks.DownloadPolicy
-	modelExists := false
-
-	if _, err := os.Stat(spagoModel); err == nil && !forceDownload {
-		// Model exists, use offline mode
-		downloadPolicy = tasks.DownloadNever
-		modelExists = true
-		log.Printf("[vector] using cached model: %s", modelPath)
-	} else {
-		// Model doesn't exist or force download requested
-		downloadPolicy = tasks.DownloadMissing
-
-		if forceDownload {
-			log.Printf("[vector] force download requested, removing existing model...")
-			os.RemoveAll(modelPath)
-		}
-
-		log.Printf("[vector] downloading model: %s", DefaultModelName)
-
-		// Check if HuggingFace is accessible, if not use mirror
-		if !isHuggingFaceAccessible() {
-			log.Println("[vector] HuggingFace not accessible, using mirror: " + HFMirrorEndpoint)
-			os.Setenv("HF_ENDPOINT", HFMirrorEndpoint)
-		}
-	}
-
-	// Try to load model with retry for download failures
-	var model textencoding.Interface
-	var err error
-	maxRetries := 1
-	if !modelExists {
-		maxRetries = 3 // Retry up to 3 times for downloads
-	}
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		model, err = tasks.Load[textencoding.Interface](&tasks.Config{
-			ModelsDir:      v.modelDir,
-			ModelName:      DefaultModelName,
-			DownloadPolicy: downloadPolicy,
-		})
-		if err == nil {
-			break
-		}
-
-		if attempt < maxRetries {
-			log.Printf("[vector] model load attempt %d/%d failed: %v, retrying in 3s...", attempt, maxRetries, err)
-			time.Sleep(3 * time.Second)
-		}
-	}
-
 	if err != nil {
-		// Provide detailed error and manual download instructions
-		log.Printf("[vector] ERROR: model load failed after %d attempts: %v", maxRetries, err)
-		return fmt.Errorf("模型加载失败: %w\n\n可能原因:\n1. 网络连接问题（无法访问 HuggingFace 或镜像站）\n2. 磁盘空间不足\n3. 模型文件损坏\n\n解决方法:\n1. 检查网络连接，确保可以访问 %s\n2. 运行 ai-hub reload vector --force-download 强制重新下载\n3. 手动下载: 访问 %s/%s 下载所有文件到 %s",
-			err, HFMirrorEndpoint, HFMirrorEndpoint, DefaultModelName, modelPath)
+		v.setDegraded("model reload failed: " + err.Error())
+		return
 	}
-
-	v.model = model
-	log.Printf("[vector] model loaded successfully")
-	return nil
+	log.Println("[vector] reload complete")
 }
 
 // isHuggingFaceAccessible checks if huggingface.co is accessible (3s timeout)
@@ -221,53 +189,123 @@ func (v *VectorEngine) loadData() error {
 		return err
 	}
 
+	// Binary collections first; a legacy .json is migrated only when no
+	// manifest exists for it
+	manifests := make(map[string]bool)
 	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
-			scope := strings.TrimSuffix(entry.Name(), ".json")
-			if err := v.loadCollection(scope); err != nil {
-				log.Printf("[vector] failed to load collection %s: %v", scope, err)
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".manifest") {
+			manifests[strings.TrimSuffix(entry.Name(), ".manifest")] = true
+		}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".manifest") {
+			if err := v.loadCollection(strings.TrimSuffix(name, ".manifest"), false); err != nil {
+				log.Printf("[vector] failed to load collection %s: %v", name, err)
+			}
+		} else if strings.HasSuffix(name, ".json") && !manifests[strings.TrimSuffix(name, ".json")] {
+			if err := v.loadCollection(strings.TrimSuffix(name, ".json"), true); err != nil {
+				log.Printf("[vector] failed to migrate collection %s: %v", name, err)
 			}
 		}
 	}
 	return nil
 }
 
-func (v *VectorEngine) loadCollection(scope string) error {
-	filePath := filepath.Join(v.dataDir, scope+".json")
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return err
+func (v *VectorEngine) loadCollection(scope string, legacyJSON bool) error {
+	v.mu.RLock()
+	loaded := v.stores[scope] != nil
+	v.mu.RUnlock()
+	if loaded {
+		// Restart: memory and disk are already in sync
+		return nil
 	}
 
+	var store *collectionStore
 	var records map[string]*VectorRecord
-	if err := json.Unmarshal(data, &records); err != nil {
+	var err error
+	if legacyJSON {
+		store, records, err = migrateJSONCollection(v.dataDir, scope)
+	} else {
+		store, records, err = openCollectionStore(v.dataDir, scope)
+	}
+	if err != nil {
 		return err
 	}
 
 	v.mu.Lock()
 	v.collections[scope] = records
+	v.stores[scope] = store
+	v.keyword[scope] = buildBM25Index(records)
+	v.ensureIndexLocked(scope)
 	v.mu.Unlock()
 
 	log.Printf("[vector] loaded collection %s with %d records", scope, len(records))
 	return nil
 }
 
-func (v *VectorEngine) saveCollection(scope string) error {
-	v.mu.RLock()
-	records := v.collections[scope]
-	v.mu.RUnlock()
+// storeLocked returns the scope's store, creating it for a new scope with
+// the embedder e (nil: not known yet, the store adopts the first one used).
+// Caller holds v.mu (write).
+func (v *VectorEngine) storeLocked(scope string, e Embedder) (*collectionStore, error) {
+	if st := v.stores[scope]; st != nil {
+		return st, nil
+	}
+	dim, id := VectorDimension, ""
+	if e != nil {
+		dim, id = e.Dim(), e.ID()
+	}
+	st, err := createCollectionStore(v.dataDir, scope, dim, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	v.stores[scope] = st
+	return st, nil
+}
 
-	if records == nil {
-		return nil
+// statsFlushInterval batches the hit / read counters, which change on every
+// search, into one WAL append per scope.
+const statsFlushInterval = 5 * time.Second
+
+func (v *VectorEngine) statsFlushLoop() {
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		v.flushStats()
 	}
+}
 
-	data, err := json.MarshalIndent(records, "", "  ")
-	if err != nil {
-		return err
+func (v *VectorEngine) flushStats() {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for scope, st := range v.stores {
+		if err := st.flushStats(v.collections[scope]); err != nil {
+			log.Printf("[vector] flush stats %s failed: %v", scope, err)
+		}
+		v.maybeCompact(scope, st)
 	}
+}
 
-	filePath := filepath.Join(v.dataDir, scope+".json")
-	return os.WriteFile(filePath, data, 0644)
+// maybeCompact starts a background compaction once the WAL or dead rows
+// have grown enough.
+func (v *VectorEngine) maybeCompact(scope string, st *collectionStore) {
+	if !st.claimCompaction() {
+		return
+	}
+	go func() {
+		start := time.Now()
+		v.mu.RLock()
+		err := st.compact(v.collections[scope])
+		v.mu.RUnlock()
+		if err != nil {
+			log.Printf("[vector] compact %s failed: %v", scope, err)
+			return
+		}
+		log.Printf("[vector] compacted %s in %s", scope, time.Since(start).Round(time.Millisecond))
+	}()
 }
 
 // scopeToFileName converts scope to safe filename
@@ -276,52 +314,18 @@ func scopeToFileName(scope string) string {
 		return "memory"
 	}
 	// Team scope: "TeamName/memory" -> "team_memory_<hash>"
+	// Session scope: "TeamName/sessions/21/memory" -> "team_sessions_21_memory_<hash>"
 	parts := strings.SplitN(scope, "/", 2)
 	if len(parts) == 2 {
 		h := md5.Sum([]byte(scope))
-		return fmt.Sprintf("team_%s_%s", parts[1], hex.EncodeToString(h[:6]))
+		return fmt.Sprintf("team_%s_%s", strings.ReplaceAll(parts[1], "/", "_"), hex.EncodeToString(h[:6]))
 	}
 	return scope
 }
 
-func (v *VectorEngine) encode(text string) ([]float64, error) {
-	result, err := v.model.Encode(context.Background(), text, int(bert.MeanPooling))
-	if err != nil {
-		return nil, err
-	}
-	return result.Vector.Data().F64(), nil
-}
-
-// cosineSimilarity calculates cosine similarity between two vectors
-func cosineSimilarity(a, b []float64) float64 {
-	if len(a) != len(b) {
-		return 0
-	}
-	var dotProduct, normA, normB float64
-	for i := range a {
-		dotProduct += a[i] * b[i]
-		normA += a[i] * a[i]
-		normB += b[i] * b[i]
-	}
-	if normA == 0 || normB == 0 {
-		return 0
-	}
-	return dotProduct / (sqrt(normA) * sqrt(normB))
-}
-
-func sqrt(x float64) float64 {
-	if x <= 0 {
-		return 0
-	}
-	z := x
-	for i := 0; i < 10; i++ {
-		z = (z + x/z) / 2
-	}
-	return z
-}
-
 // Stop shuts down the vector engine
 func (v *VectorEngine) Stop() {
+	v.flushStats()
 	v.mu.Lock()
 	defer v.mu.Unlock()
 	v.ready = false
@@ -386,78 +390,177 @@ func (v *VectorEngine) Status() map[string]interface{} {
 	}
 	v.mu.RLock()
 	defer v.mu.RUnlock()
-	return map[string]interface{}{
-		"ready":    v.ready,
-		"disabled": v.disabled,
-		"error":    v.err,
-		"model":    DefaultModelName,
+	pending := 0
+	for _, records := range v.collections {
+		for _, r := range records {
+			if len(r.Vector) == 0 {
+				pending++
+			}
+		}
 	}
-}
-
-func (v *VectorEngine) setDisabled(reason string) {
-	v.mu.Lock()
-	defer v.mu.Unlock()
-	v.disabled = true
-	v.err = reason
-	log.Printf("[vector] disabled: %s", reason)
-}
-
-// Embed adds or updates a vector record
+	model, embedder, dim := DefaultModelName, "", 0
+	if v.embedder != nil {
+		embedder, dim = v.embedder.ID(), v.embedder.Dim()
+		model = strings.SplitN(embedder, ":", 2)[1]
+	}
+	return map[string]interface{}{
+		"ready":              v.ready,
+		"disabled":           v.disabled,
+		"degraded":           v.ready && v.embedder == nil,
+		"error":              v.err,
+		"model":              model,
+		"embedder":           embedder,
+		"dim":                dim,
+		"ann_indexes":        len(v.indexes),
+		"pending_embeddings": pending,
+		"reindex":            v.reindexStatusLocked(),
+	}
+}
+
+// Embed adds or updates a document. The text is split into chunks, each
+// stored as a child record "<docID>#<n>"; re-embedding replaces only this
+// document's chunks.
 func (v *VectorEngine) Embed(scope, docID, text string, metadata map[string]interface{}) error {
 	if !v.IsReady() {
 		return fmt.Errorf("vector engine not ready")
 	}
 
-	vector, err := v.encode(text)
-	if err != nil {
-		return fmt.Errorf("encode failed: %w", err)
+	size, overlap := v.chunkOptions()
+	fileName := scopeToFileName(scope)
+
+	// Unchanged text with the same chunking: keep the vectors, refresh metadata
+	hash := contentHash(text, size, overlap)
+	v.mu.RLock()
+	head := headRecordLocked(v.collections[fileName], docID)
+	emb := v.embedderForLocked(fileName)
+	// (a text-only record is re-encoded once a model is available)
+	unchanged := head != nil && head.ParentID != "" && head.Metadata["content_hash"] == hash &&
+		(len(head.Vector) > 0 || emb == nil)
+	metaSame := unchanged && metadataContains(head.Metadata, metadata)
+	v.mu.RUnlock()
+	if metaSame {
+		return nil
+	}
+	if unchanged {
+		_, err := v.UpdateMetadata(scope, docID, metadata)
+		return err
+	}
+
+	// Degraded: store text only; EmbedBacklog adds vectors once a model loads
+	chunks := chunkMarkdown(text, size, overlap)
+	vectors := make([][]float64, len(chunks))
+	for i, c := range chunks {
+		if emb == nil {
+			break
+		}
+		vector, err := emb.Embed(context.Background(), chunkEmbedText(docID, c.Heading, text[c.Start:c.End]))
+		if err != nil {
+			return fmt.Errorf("encode failed: %w", err)
+		}
+		vectors[i] = vector
 	}
 
 	now := time.Now().Format("2006-01-02T15:04:05")
-	fileName := scopeToFileName(scope)
 
 	v.mu.Lock()
 	if v.collections[fileName] == nil {
 		v.collections[fileName] = make(map[string]*VectorRecord)
 	}
+	records := v.collections[fileName]
+	old := docRecordsLocked(records, docID)
 
-	existing := v.collections[fileName][docID]
-	record := &VectorRecord{
-		ID:        docID,
-		Document:  text,
-		Vector:    vector,
-		Metadata:  metadata,
-		UpdatedAt: now,
+	fresh := make([]*VectorRecord, len(chunks))
+	for i, c := range chunks {
+		meta := make(map[string]interface{}, len(metadata)+10)
+		for k, val := range metadata {
+			meta[k] = val
+		}
+		meta["parent_id"] = docID
+		meta["chunk_index"] = i
+		meta["chunk_count"] = len(chunks)
+		meta["heading"] = c.Heading
+		meta["content_hash"] = hash
+		record := &VectorRecord{
+			ID:        chunkID(docID, i),
+			Document:  text[c.Start:c.End],
+			Vector:    vectors[i],
+			Metadata:  meta,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ParentID:  docID,
+			Chunk:     i,
+			Heading:   c.Heading,
+			Start:     c.Start,
+		}
+		// The document's counters live on chunk 0
+		if len(old) > 0 {
+			record.CreatedAt = old[0].CreatedAt
+			if i == 0 {
+				record.HitCount = old[0].HitCount
+				record.LastHitAt = old[0].LastHitAt
+				record.ReadCount = old[0].ReadCount
+				record.LastReadAt = old[0].LastReadAt
+			}
+		}
+		syncRecordMetadata(record)
+		fresh[i] = record
 	}
 
-	if existing != nil {
-		record.CreatedAt = existing.CreatedAt
-		record.HitCount = existing.HitCount
-		record.LastHitAt = existing.LastHitAt
-		record.ReadCount = existing.ReadCount
-		record.LastReadAt = existing.LastReadAt
-	} else {
-		record.CreatedAt = now
+	// Old chunks not overwritten by the new ones (and a pre-chunking record)
+	var stale []string
+	for _, r := range old {
+		if r.ParentID == "" || r.Chunk >= len(fresh) {
+			stale = append(stale, r.ID)
+		}
 	}
 
-	if record.Metadata == nil {
-		record.Metadata = make(map[string]interface{})
+	st, err := v.storeLocked(fileName, emb)
+	if err == nil && emb != nil {
+		// The scope switched embedders while encoding: store text only
+		var ok bool
+		if ok, err = v.acceptVectorsLocked(st, emb); !ok {
+			for _, record := range fresh {
+				record.Vector = nil
+			}
+		}
+	}
+	for _, record := range fresh {
+		if err == nil {
+			err = st.put(record, true)
+		}
+	}
+	for _, id := range stale {
+		if err == nil {
+			err = st.remove(id)
+		}
+	}
+	if err != nil {
+		v.mu.Unlock()
+		return fmt.Errorf("persist failed: %w", err)
+	}
+	for _, id := range stale {
+		delete(records, id)
+		v.indexRemoveLocked(fileName, id)
+	}
+	for _, record := range fresh {
+		records[record.ID] = record
+		v.indexUpsertLocked(fileName, record)
 	}
-	record.Metadata["created_at"] = record.CreatedAt
-	record.Metadata["updated_at"] = record.UpdatedAt
-	record.Metadata["hit_count"] = record.HitCount
-	record.Metadata["last_hit_time"] = record.LastHitAt
-	record.Metadata["read_count"] = record.ReadCount
-	record.Metadata["last_read_at"] = record.LastReadAt
-
-	v.collections[fileName][docID] = record
 	v.mu.Unlock()
 
-	return v.saveCollection(fileName)
+	v.maybeCompact(fileName, st)
+	v.saveIndex(fileName)
+	return nil
 }
 
-// UpdateMetadata merges updates into existing metadata
+// UpdateMetadata merges updates into existing metadata (of every chunk)
 func (v *VectorEngine) UpdateMetadata(scope, docID string, updates map[string]interface{}) (map[string]interface{}, error) {
+	return v.updateMetadata(scope, docID, updates, true)
+}
+
+// updateMetadata merges updates into every chunk's metadata; touch bumps
+// updated_at (memory policies leave it alone, it is their age signal).
+func (v *VectorEngine) updateMetadata(scope, docID string, updates map[string]interface{}, touch bool) (map[string]interface{}, error) {
 	if !v.IsReady() {
 		return nil, fmt.Errorf("vector engine not ready")
 	}
@@ -467,29 +570,35 @@ func (v *VectorEngine) UpdateMetadata(scope, docID string, updates map[string]in
 	v.mu.Lock()
 	defer v.mu.Unlock()
 
-	if v.collections[fileName] == nil {
+	recs := docRecordsLocked(v.collections[fileName], docID)
+	if len(recs) == 0 {
 		return nil, fmt.Errorf("doc not found: %s", docID)
 	}
 
-	record := v.collections[fileName][docID]
-	if record == nil {
-		return nil, fmt.Errorf("doc not found: %s", docID)
-	}
+	now := time.Now().Format("2006-01-02T15:04:05")
+	st := v.stores[fileName]
+	for _, record := range recs {
+		if record.Metadata == nil {
+			record.Metadata = make(map[string]interface{})
+		}
+		for k, val := range updates {
+			record.Metadata[k] = val
+		}
+		if touch {
+			record.UpdatedAt = now
+			record.Metadata["updated_at"] = record.UpdatedAt
+		}
 
-	if record.Metadata == nil {
-		record.Metadata = make(map[string]interface{})
-	}
-	for k, val := range updates {
-		record.Metadata[k] = val
+		if st != nil {
+			if err := st.put(record, false); err != nil {
+				return nil, fmt.Errorf("persist failed: %w", err)
+			}
+		}
 	}
-	record.UpdatedAt = time.Now().Format("2006-01-02T15:04:05")
-	record.Metadata["updated_at"] = record.UpdatedAt
-
-	go v.saveCollection(fileName)
-	return record.Metadata, nil
+	return recs[0].Metadata, nil
 }
 
-// GetDoc retrieves a single document
+// GetDoc retrieves a single document, reassembled from its chunks
 func (v *VectorEngine) GetDoc(scope, docID string) (map[string]interface{}, error) {
 	if !v.IsReady() {
 		return nil, fmt.Errorf("vector engine not ready")
@@ -500,101 +609,179 @@ func (v *VectorEngine) GetDoc(scope, docID string) (map[string]interface{}, erro
 	v.mu.RLock()
 	defer v.mu.RUnlock()
 
-	if v.collections[fileName] == nil {
-		return nil, fmt.Errorf("doc not found: %s", docID)
-	}
-
-	record := v.collections[fileName][docID]
-	if record == nil {
+	recs := docRecordsLocked(v.collections[fileName], docID)
+	if len(recs) == 0 {
 		return nil, fmt.Errorf("doc not found: %s", docID)
 	}
 
 	return map[string]interface{}{
-		"id":       record.ID,
-		"document": record.Document,
-		"metadata": record.Metadata,
+		"id":       docID,
+		"document": assembleDocument(recs),
+		"metadata": recs[0].Metadata,
+		"chunks":   len(recs),
 	}, nil
 }
 
-// Search performs semantic search
-func (v *VectorEngine) Search(scope, query string, topK int) ([]map[string]interface{}, error) {
+// Search ranks a scope's documents for query. mode is hybrid (default),
+// semantic or keyword; see vector_bm25.go. Chunk hits are aggregated per
+// document: each result is a document with its best-matching chunk as the
+// snippet. A non-nil filter restricts the documents before ranking (see
+// vector_filter.go).
+func (v *VectorEngine) Search(scope, query string, topK int, mode string, filter *Filter) ([]map[string]interface{}, error) {
 	if !v.IsReady() {
 		return nil, fmt.Errorf("vector engine not ready")
 	}
-
-	queryVector, err := v.encode(query)
+	mode, err := NormalizeSearchMode(mode)
 	if err != nil {
-		return nil, fmt.Errorf("encode query failed: %w", err)
+		return nil, err
 	}
-
 	fileName := scopeToFileName(scope)
 
-	v.mu.RLock()
-	records := v.collections[fileName]
-	v.mu.RUnlock()
-
-	if records == nil || len(records) == 0 {
-		return []map[string]interface{}{}, nil
+	// Several chunks of one document may rank high; fetch extra to fill topK documents
+	fetchK := max(topK*4, topK+20)
+
+	// A re-index may switch the scope's embedder mid-query; rank again so
+	// the query vector and the stored vectors come from the same model
+	var results []rankedChunk
+	for attempt := 0; ; attempt++ {
+		v.mu.RLock()
+		emb := v.embedderForLocked(fileName)
+		v.mu.RUnlock()
+		if mode != SearchKeyword && (emb == nil || attempt == 2) {
+			if mode == SearchSemantic {
+				return nil, fmt.Errorf("semantic search unavailable: %w", errModelUnavailable)
+			}
+			mode = SearchKeyword // degraded: hybrid falls back to BM25
+		}
+		results, err = v.rankChunks(fileName, query, mode, fetchK, emb, filter)
+		if err != nil {
+			return nil, err
+		}
+		v.mu.RLock()
+		same := mode == SearchKeyword || v.embedderForLocked(fileName) == emb
+		v.mu.RUnlock()
+		if same {
+			break
+		}
 	}
-
-	// Calculate similarities
-	type scored struct {
-		record     *VectorRecord
-		similarity float64
+	if len(results) == 0 {
+		return []map[string]interface{}{}, nil
 	}
-	var results []scored
 
-	for _, record := range records {
-		sim := cosineSimilarity(queryVector, record.Vector)
-		results = append(results, scored{record: record, similarity: sim})
+	// Memory policy decay: documents unused for long rank lower
+	if p := memoryPolicyFor(scope); p.decays() {
+		v.mu.RLock()
+		factors := v.decayFactorsLocked(p, fileName, results)
+		v.mu.RUnlock()
+		for i := range results {
+			results[i].score *= factors[parentDocID(results[i].record)]
+		}
+		sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
 	}
 
-	// Sort by similarity (descending)
-	for i := 0; i < len(results)-1; i++ {
-		for j := i + 1; j < len(results); j++ {
-			if results[j].similarity > results[i].similarity {
-				results[i], results[j] = results[j], results[i]
+	// results are sorted by score: the first chunk seen is a document's best
+	var order []string
+	best := make(map[string]rankedChunk)
+	matched := make(map[string]int)
+	for _, r := range results {
+		doc := parentDocID(r.record)
+		if _, seen := best[doc]; !seen {
+			if len(order) == topK {
+				continue
 			}
+			order = append(order, doc)
+			best[doc] = r
 		}
+		matched[doc]++
 	}
 
-	// Take top K
-	if topK > len(results) {
-		topK = len(results)
-	}
-	results = results[:topK]
-
 	// Record hits and format output
-	items := make([]map[string]interface{}, 0, len(results))
+	items := make([]map[string]interface{}, 0, len(order))
 	now := time.Now().Format("2006-01-02T15:04:05")
 
 	v.mu.Lock()
-	for _, r := range results {
-		r.record.HitCount++
-		r.record.LastHitAt = now
-		if r.record.Metadata != nil {
-			r.record.Metadata["hit_count"] = r.record.HitCount
-			r.record.Metadata["last_hit_time"] = r.record.LastHitAt
+	st := v.stores[fileName]
+	for _, doc := range order {
+		r := best[doc]
+		head := headRecordLocked(v.collections[fileName], doc)
+		if head == nil {
+			head = r.record // deleted meanwhile
+		}
+		if st != nil {
+			st.markDirty(head.ID)
+		}
+		head.HitCount++
+		head.LastHitAt = now
+		if head.Metadata != nil {
+			head.Metadata["hit_count"] = head.HitCount
+			head.Metadata["last_hit_time"] = head.LastHitAt
 		}
 
 		items = append(items, map[string]interface{}{
-			"id":          r.record.ID,
-			"document":    r.record.Document,
-			"similarity":  r.similarity,
-			"metadata":    r.record.Metadata,
-			"hit_count":   r.record.HitCount,
-			"read_count":  r.record.ReadCount,
-			"created_at":  r.record.CreatedAt,
-			"updated_at":  r.record.UpdatedAt,
+			"id":             doc,
+			"document":       r.record.Document,
+			"similarity":     r.similarity,
+			"score":          r.score,
+			"bm25":           r.bm25,
+			"mode":           mode,
+			"metadata":       head.Metadata,
+			"hit_count":      head.HitCount,
+			"read_count":     head.ReadCount,
+			"created_at":     head.CreatedAt,
+			"updated_at":     head.UpdatedAt,
+			"chunk":          r.record.Chunk,
+			"heading":        r.record.Heading,
+			"matched_chunks": matched[doc],
 		})
 	}
 	v.mu.Unlock()
 
-	go v.saveCollection(fileName)
-
 	return items, nil
 }
 
+// rankChunks ranks a scope's chunks by the mode's signals; emb encodes the
+// query for the semantic ranking. Only chunks of documents passing filter
+// are ranked.
+func (v *VectorEngine) rankChunks(fileName, query, mode string, fetchK int, emb Embedder, filter *Filter) ([]rankedChunk, error) {
+	var keep func(*VectorRecord) bool
+	if filter != nil {
+		v.mu.RLock()
+		allowed := v.filterDocsLocked(fileName, filter)
+		v.mu.RUnlock()
+		if len(allowed) == 0 {
+			return nil, nil
+		}
+		keep = func(r *VectorRecord) bool { return allowed[parentDocID(r)] }
+	}
+
+	var queryVector []float64
+	var semantic, keyword []scoredRecord
+	if mode != SearchKeyword {
+		var err error
+		queryVector, err = emb.Embed(context.Background(), query)
+		if err != nil {
+			return nil, fmt.Errorf("encode query failed: %w", err)
+		}
+		// Large scopes use the HNSW index; small ones (or while it builds) brute
+		// force. Filtered queries also brute force the allowed chunks: the graph
+		// cannot skip excluded nodes, and post-filtering its top hits would
+		// drop matches.
+		var ok bool
+		if keep == nil {
+			semantic, ok = v.annSearch(fileName, queryVector, fetchK)
+		}
+		if !ok {
+			v.mu.RLock()
+			semantic = bruteForceTopK(v.collections[fileName], queryVector, fetchK, keep)
+			v.mu.RUnlock()
+		}
+	}
+	if mode != SearchSemantic {
+		keyword = v.keywordTopK(fileName, query, fetchK, keep)
+	}
+	return fuseRankings(mode, semantic, keyword, queryVector), nil
+}
+
 // IncrementReadCount increments the read count for a document
 func (v *VectorEngine) IncrementReadCount(scope, docID string) {
 	if !v.IsReady() {
@@ -605,43 +792,58 @@ func (v *VectorEngine) IncrementReadCount(scope, docID string) {
 	now := time.Now().Format("2006-01-02T15:04:05")
 
 	v.mu.Lock()
-	if v.collections[fileName] != nil {
-		if record := v.collections[fileName][docID]; record != nil {
-			record.ReadCount++
-			record.LastReadAt = now
-			if record.Metadata != nil {
-				record.Metadata["read_count"] = record.ReadCount
-				record.Metadata["last_read_at"] = record.LastReadAt
-			}
+	if record := headRecordLocked(v.collections[fileName], docID); record != nil {
+		record.ReadCount++
+		record.LastReadAt = now
+		if record.Metadata != nil {
+			record.Metadata["read_count"] = record.ReadCount
+			record.Metadata["last_read_at"] = record.LastReadAt
+		}
+		if st := v.stores[fileName]; st != nil {
+			st.markDirty(record.ID)
 		}
 	}
 	v.mu.Unlock()
-
-	go v.saveCollection(fileName)
 }
 
 // KeywordSearch performs keyword-based content search across a scope.
-// Returns matching records with context snippets (about 50 chars before/after match).
-func (v *VectorEngine) KeywordSearch(scope, keyword string, topK int) []map[string]interface{} {
+// Returns matching documents with context snippets (about 50 chars before/after match).
+// Documents not passing filter are skipped.
+func (v *VectorEngine) KeywordSearch(scope, keyword string, topK int, filter *Filter) []map[string]interface{} {
 	fileName := scopeToFileName(scope)
 
 	v.mu.RLock()
+	defer v.mu.RUnlock()
 	records := v.collections[fileName]
-	v.mu.RUnlock()
 
 	if records == nil || len(records) == 0 {
 		return nil
 	}
 
+	var allowed map[string]bool
+	if filter != nil {
+		allowed = v.filterDocsLocked(fileName, filter)
+	}
+
 	lowerKeyword := strings.ToLower(keyword)
 	var results []map[string]interface{}
+	seen := make(map[string]bool)
 
 	for _, record := range records {
+		doc := parentDocID(record)
+		if seen[doc] || (allowed != nil && !allowed[doc]) {
+			continue
+		}
 		lowerDoc := strings.ToLower(record.Document)
 		byteIdx := strings.Index(lowerDoc, lowerKeyword)
 		if byteIdx < 0 {
 			continue
 		}
+		seen[doc] = true
+		head := headRecordLocked(records, doc)
+		if head == nil {
+			head = record
+		}
 
 		// Convert byte index to rune index for proper snippet extraction
 		runes := []rune(record.Document)
@@ -667,14 +869,16 @@ func (v *VectorEngine) KeywordSearch(scope, keyword string, topK int) []map[stri
 		}
 
 		results = append(results, map[string]interface{}{
-			"id":         record.ID,
+			"id":         doc,
 			"document":   record.Document,
 			"snippet":    snippet,
-			"hit_count":  record.HitCount,
-			"read_count": record.ReadCount,
-			"created_at": record.CreatedAt,
-			"updated_at": record.UpdatedAt,
-			"metadata":   record.Metadata,
+			"hit_count":  head.HitCount,
+			"read_count": head.ReadCount,
+			"created_at": head.CreatedAt,
+			"updated_at": head.UpdatedAt,
+			"metadata":   head.Metadata,
+			"chunk":      record.Chunk,
+			"heading":    record.Heading,
 		})
 
 		if topK > 0 && len(results) >= topK {
@@ -685,7 +889,7 @@ func (v *VectorEngine) KeywordSearch(scope, keyword string, topK int) []map[stri
 	return results
 }
 
-// Delete removes a vector record
+// Delete removes a document and all its chunks
 func (v *VectorEngine) Delete(scope, docID string) error {
 	if !v.IsReady() {
 		return fmt.Errorf("vector engine not ready")
@@ -694,16 +898,30 @@ func (v *VectorEngine) Delete(scope, docID string) error {
 	fileName := scopeToFileName(scope)
 
 	v.mu.Lock()
-	if v.collections[fileName] != nil {
-		delete(v.collections[fileName], docID)
+	st := v.stores[fileName]
+	recs := docRecordsLocked(v.collections[fileName], docID)
+	for _, r := range recs {
+		if st != nil {
+			if err := st.remove(r.ID); err != nil {
+				v.mu.Unlock()
+				return fmt.Errorf("persist failed: %w", err)
+			}
+		}
+		delete(v.collections[fileName], r.ID)
+		v.indexRemoveLocked(fileName, r.ID)
 	}
 	v.mu.Unlock()
 
-	return v.saveCollection(fileName)
+	if st != nil {
+		v.maybeCompact(fileName, st)
+	}
+	v.saveIndex(fileName)
+	return nil
 }
 
-// ListMetadata returns all records' metadata for a scope
-func (v *VectorEngine) ListMetadata(scope string) map[string]map[string]interface{} {
+// ListMetadata returns each document's metadata for a scope, limited to
+// documents passing filter (nil for all)
+func (v *VectorEngine) ListMetadata(scope string, filter *Filter) map[string]map[string]interface{} {
 	if !v.IsReady() {
 		return nil
 	}
@@ -719,13 +937,15 @@ func (v *VectorEngine) ListMetadata(scope string) map[string]map[string]interfac
 	}
 
 	result := make(map[string]map[string]interface{})
-	for id, record := range records {
-		result[id] = record.Metadata
+	for _, record := range records {
+		if isHeadRecord(record) && filter.Match(parentDocID(record), record.Metadata) {
+			result[parentDocID(record)] = record.Metadata
+		}
 	}
 	return result
 }
 
-// Stats returns hit statistics
+// Stats returns hit statistics per document
 func (v *VectorEngine) Stats(scope string) (map[string]interface{}, error) {
 	if !v.IsReady() {
 		return nil, fmt.Errorf("vector engine not ready")
@@ -743,24 +963,23 @@ func (v *VectorEngine) Stats(scope string) (map[string]interface{}, error) {
 
 	var statRecords []map[string]interface{}
 	for _, record := range records {
+		if !isHeadRecord(record) {
+			continue
+		}
 		statRecords = append(statRecords, map[string]interface{}{
-			"id":            record.ID,
+			"id":            parentDocID(record),
 			"hit_count":     record.HitCount,
 			"last_hit_time": record.LastHitAt,
 		})
 	}
 
 	// Sort by hit_count descending
-	for i := 0; i < len(statRecords)-1; i++ {
-		for j := i + 1; j < len(statRecords); j++ {
-			if statRecords[j]["hit_count"].(int) > statRecords[i]["hit_count"].(int) {
-				statRecords[i], statRecords[j] = statRecords[j], statRecords[i]
-			}
-		}
-	}
+	sort.SliceStable(statRecords, func(i, j int) bool {
+		return statRecords[i]["hit_count"].(int) > statRecords[j]["hit_count"].(int)
+	})
 
 	return map[string]interface{}{
-		"total":   len(records),
+		"total":   len(statRecords),
 		"records": statRecords,
 	}, nil
 }
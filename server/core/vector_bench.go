@@ -0,0 +1,222 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ANNBenchOptions configures RunANNBenchmark. With Scope set, the scope's
+// stored vectors are the dataset (Sizes and Dim are ignored); otherwise
+// clustered synthetic vectors are generated for each size.
+type ANNBenchOptions struct {
+	Sizes    []int  `json:"sizes"`
+	Dim      int    `json:"dim"`
+	Queries  int    `json:"queries"`
+	TopK     int    `json:"top_k"`
+	EfSearch []int  `json:"ef_search"`
+	Scope    string `json:"scope"`
+}
+
+// ANNBenchResult compares HNSW against brute force for one dataset size and ef.
+type ANNBenchResult struct {
+	Size       int     `json:"size"`
+	Dim        int     `json:"dim"`
+	EfSearch   int     `json:"ef_search"`
+	BuildMs    int64   `json:"build_ms"`
+	Recall     float64 `json:"recall"` // mean recall@k against exact results
+	BruteAvgUs float64 `json:"brute_avg_us"`
+	BruteP95Us float64 `json:"brute_p95_us"`
+	ANNAvgUs   float64 `json:"ann_avg_us"`
+	ANNP95Us   float64 `json:"ann_p95_us"`
+	Speedup    float64 `json:"speedup"`
+}
+
+// Benchmark limits keep a single run from tying up the server.
+const (
+	annBenchMaxSize    = 50000
+	annBenchMaxDim     = 2048
+	annBenchMaxQueries = 1000
+)
+
+// NormalizeANNBench fills defaults and validates limits.
+func NormalizeANNBench(o *ANNBenchOptions) error {
+	if len(o.Sizes) == 0 {
+		o.Sizes = []int{1000, 5000, 20000}
+	}
+	if o.Dim <= 0 {
+		o.Dim = VectorDimension
+	}
+	if o.Queries <= 0 {
+		o.Queries = 200
+	}
+	if o.TopK <= 0 {
+		o.TopK = 10
+	}
+	if len(o.EfSearch) == 0 {
+		o.EfSearch = []int{32, annEfSearch, 128}
+	}
+	for _, n := range o.Sizes {
+		if n <= 0 || n > annBenchMaxSize {
+			return fmt.Errorf("size %d out of range (1..%d)", n, annBenchMaxSize)
+		}
+	}
+	if o.Dim > annBenchMaxDim {
+		return fmt.Errorf("dim %d too large (max %d)", o.Dim, annBenchMaxDim)
+	}
+	if o.Queries > annBenchMaxQueries {
+		return fmt.Errorf("queries %d too large (max %d)", o.Queries, annBenchMaxQueries)
+	}
+	return nil
+}
+
+// RunANNBenchmark measures recall@k and query latency of the HNSW index
+// against the brute-force search used for small scopes.
+func (v *VectorEngine) RunANNBenchmark(o ANNBenchOptions) ([]ANNBenchResult, error) {
+	if err := NormalizeANNBench(&o); err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(42))
+
+	if o.Scope != "" {
+		fileName := scopeToFileName(o.Scope)
+		v.mu.RLock()
+		records := make(map[string]*VectorRecord, len(v.collections[fileName]))
+		for id, r := range v.collections[fileName] {
+			if len(r.Vector) > 0 {
+				records[id] = r
+			}
+		}
+		v.mu.RUnlock()
+		if len(records) == 0 {
+			return nil, fmt.Errorf("scope %s has no vectors", o.Scope)
+		}
+		return benchDataset(records, o, rng), nil
+	}
+
+	var out []ANNBenchResult
+	for _, n := range o.Sizes {
+		out = append(out, benchDataset(syntheticRecords(n, o.Dim, rng), o, rng)...)
+	}
+	return out, nil
+}
+
+func benchDataset(records map[string]*VectorRecord, o ANNBenchOptions, rng *rand.Rand) []ANNBenchResult {
+	dataset := make([]*VectorRecord, 0, len(records))
+	for _, r := range records {
+		dataset = append(dataset, r)
+	}
+	sort.Slice(dataset, func(i, j int) bool { return dataset[i].ID < dataset[j].ID })
+	dim := len(dataset[0].Vector)
+
+	start := time.Now()
+	idx := newHNSWIndex(annM, annEfConstruction)
+	for _, r := range dataset {
+		idx.insert(r.ID, r.UpdatedAt, r.Vector)
+	}
+	buildMs := time.Since(start).Milliseconds()
+
+	// Queries: dataset points with noise, so they are near but not on a vector
+	queries := make([][]float64, o.Queries)
+	for i := range queries {
+		base := dataset[rng.Intn(len(dataset))].Vector
+		q := make([]float64, len(base))
+		for j := range base {
+			q[j] = base[j] + rng.NormFloat64()*0.5
+		}
+		queries[i] = q
+	}
+
+	exact := make([]map[string]bool, len(queries))
+	bruteTimes := make([]time.Duration, len(queries))
+	for i, q := range queries {
+		t := time.Now()
+		top := bruteForceTopK(records, q, o.TopK, nil)
+		bruteTimes[i] = time.Since(t)
+		exact[i] = make(map[string]bool, len(top))
+		for _, s := range top {
+			exact[i][s.record.ID] = true
+		}
+	}
+	bruteAvg, bruteP95 := latencyStats(bruteTimes)
+
+	var out []ANNBenchResult
+	for _, ef := range o.EfSearch {
+		annTimes := make([]time.Duration, len(queries))
+		var recall float64
+		for i, q := range queries {
+			t := time.Now()
+			hits := idx.search(q, o.TopK, ef)
+			annTimes[i] = time.Since(t)
+			found := 0
+			for _, h := range hits {
+				if exact[i][h.id] {
+					found++
+				}
+			}
+			if len(exact[i]) > 0 {
+				recall += float64(found) / float64(len(exact[i]))
+			}
+		}
+		annAvg, annP95 := latencyStats(annTimes)
+		res := ANNBenchResult{
+			Size:       len(dataset),
+			Dim:        dim,
+			EfSearch:   ef,
+			BuildMs:    buildMs,
+			Recall:     recall / float64(len(queries)),
+			BruteAvgUs: bruteAvg,
+			BruteP95Us: bruteP95,
+			ANNAvgUs:   annAvg,
+			ANNP95Us:   annP95,
+		}
+		if annAvg > 0 {
+			res.Speedup = bruteAvg / annAvg
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+// syntheticRecords generates clustered Gaussian vectors, which resemble
+// embedding distributions far better than uniform noise.
+func syntheticRecords(n, dim int, rng *rand.Rand) map[string]*VectorRecord {
+	clusters := n/50 + 1
+	centers := make([][]float64, clusters)
+	for c := range centers {
+		centers[c] = make([]float64, dim)
+		for j := range centers[c] {
+			centers[c][j] = rng.NormFloat64()
+		}
+	}
+	records := make(map[string]*VectorRecord, n)
+	for i := 0; i < n; i++ {
+		center := centers[rng.Intn(clusters)]
+		vec := make([]float64, dim)
+		for j := range vec {
+			vec[j] = center[j] + rng.NormFloat64()*2
+		}
+		id := "doc-" + strconv.Itoa(i)
+		records[id] = &VectorRecord{ID: id, Vector: vec}
+	}
+	return records
+}
+
+// latencyStats returns mean and p95 in microseconds.
+func latencyStats(d []time.Duration) (avg, p95 float64) {
+	if len(d) == 0 {
+		return 0, 0
+	}
+	sorted := append([]time.Duration(nil), d...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, x := range sorted {
+		total += x
+	}
+	avg = float64(total) / float64(time.Microsecond) / float64(len(sorted))
+	i := (len(sorted)*95+99)/100 - 1 // nearest-rank percentile
+	p95 = float64(sorted[i]) / float64(time.Microsecond)
+	return avg, p95
+}
@@ -0,0 +1,297 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Search modes for VectorEngine.Search.
+const (
+	SearchHybrid   = "hybrid"   // BM25 + cosine, fused by reciprocal rank
+	SearchSemantic = "semantic" // cosine only
+	SearchKeyword  = "keyword"  // BM25 only; needs no embedding
+)
+
+// BM25 / RRF parameters (the usual defaults).
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	rrfK   = 60
+)
+
+// NormalizeSearchMode maps "" to hybrid and rejects unknown modes.
+func NormalizeSearchMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return SearchHybrid, nil
+	case SearchHybrid, SearchSemantic, SearchKeyword:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mode %q (hybrid, semantic or keyword)", mode)
+}
+
+// bm25Index is an inverted index over one scope's chunk records.
+// Guarded by VectorEngine.mu like the collections.
+type bm25Index struct {
+	postings map[string]map[string]int // term → record ID → term frequency
+	docTerms map[string][]string       // record ID → distinct terms, for removal
+	docLen   map[string]int
+	totalLen int
+}
+
+func newBM25Index() *bm25Index {
+	return &bm25Index{
+		postings: make(map[string]map[string]int),
+		docTerms: make(map[string][]string),
+		docLen:   make(map[string]int),
+	}
+}
+
+func buildBM25Index(records map[string]*VectorRecord) *bm25Index {
+	x := newBM25Index()
+	for _, r := range records {
+		x.add(r)
+	}
+	return x
+}
+
+// add indexes (or re-indexes) a record: its document name, heading path and text.
+func (x *bm25Index) add(r *VectorRecord) {
+	x.remove(r.ID)
+	tokens := bm25Tokens(chunkEmbedText(parentDocID(r), r.Heading, r.Document), false)
+	tf := make(map[string]int)
+	for _, t := range tokens {
+		tf[t]++
+	}
+	terms := make([]string, 0, len(tf))
+	for t, n := range tf {
+		if x.postings[t] == nil {
+			x.postings[t] = make(map[string]int)
+		}
+		x.postings[t][r.ID] = n
+		terms = append(terms, t)
+	}
+	x.docTerms[r.ID] = terms
+	x.docLen[r.ID] = len(tokens)
+	x.totalLen += len(tokens)
+}
+
+func (x *bm25Index) remove(id string) {
+	terms, ok := x.docTerms[id]
+	if !ok {
+		return
+	}
+	for _, t := range terms {
+		delete(x.postings[t], id)
+		if len(x.postings[t]) == 0 {
+			delete(x.postings, t)
+		}
+	}
+	x.totalLen -= x.docLen[id]
+	delete(x.docTerms, id)
+	delete(x.docLen, id)
+}
+
+type bm25Hit struct {
+	id    string
+	score float64
+}
+
+// search returns the k best-scoring records for query, considering only
+// those keep accepts when it is non-nil.
+func (x *bm25Index) search(query string, k int, keep func(id string) bool) []bm25Hit {
+	n := len(x.docLen)
+	if n == 0 || k <= 0 {
+		return nil
+	}
+	avgLen := float64(x.totalLen) / float64(n)
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, t := range bm25Tokens(query, true) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		posting := x.postings[t]
+		if len(posting) == 0 {
+			continue
+		}
+		df := float64(len(posting))
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		for id, tf := range posting {
+			f := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(x.docLen[id])/avgLen
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+	hits := make([]bm25Hit, 0, len(scores))
+	for id, s := range scores {
+		if keep != nil && !keep(id) {
+			continue
+		}
+		hits = append(hits, bm25Hit{id: id, score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].id < hits[j].id
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// bm25Tokens lowercases and tokenises text. Runs of letters and digits form
+// words; identifiers joined by - _ . : / (error codes, hostnames, paths)
+// are kept whole and also split into their parts. CJK runs become bigrams;
+// documents additionally index single characters so one-character queries
+// still match.
+func bm25Tokens(text string, query bool) []string {
+	var tokens []string
+	runes := []rune(strings.ToLower(text))
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isCJK(r):
+			j := i
+			for j < len(runes) && isCJK(runes[j]) {
+				j++
+			}
+			run := runes[i:j]
+			if len(run) == 1 {
+				tokens = append(tokens, string(run))
+			}
+			for k := 0; k+1 < len(run); k++ {
+				tokens = append(tokens, string(run[k:k+2]))
+			}
+			if !query && len(run) > 1 {
+				for _, c := range run {
+					tokens = append(tokens, string(c))
+				}
+			}
+			i = j
+		case isWordRune(r):
+			j := i
+			for j < len(runes) && (isWordRune(runes[j]) ||
+				(isJoinRune(runes[j]) && j+1 < len(runes) && isWordRune(runes[j+1]) && j > i)) {
+				j++
+			}
+			word := string(runes[i:j])
+			tokens = append(tokens, word)
+			if parts := strings.FieldsFunc(word, isJoinRune); len(parts) > 1 {
+				tokens = append(tokens, parts...)
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isCJK(r)
+}
+
+func isJoinRune(r rune) bool {
+	return r == '-' || r == '_' || r == '.' || r == ':' || r == '/'
+}
+
+// keywordTopK ranks a scope's chunks by BM25. The similarity field of the
+// returned records holds the BM25 score. keep, when non-nil, selects the
+// chunks that may rank.
+func (v *VectorEngine) keywordTopK(fileName, query string, k int, keep func(*VectorRecord) bool) []scoredRecord {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	x := v.keyword[fileName]
+	if x == nil {
+		return nil
+	}
+	records := v.collections[fileName]
+	var accept func(string) bool
+	if keep != nil {
+		accept = func(id string) bool {
+			r := records[id]
+			return r != nil && keep(r)
+		}
+	}
+	var out []scoredRecord
+	for _, h := range x.search(query, k, accept) {
+		if r := records[h.id]; r != nil {
+			out = append(out, scoredRecord{record: r, similarity: h.score})
+		}
+	}
+	return out
+}
+
+// rankedChunk is a chunk in the final ranking of a search.
+type rankedChunk struct {
+	record     *VectorRecord
+	similarity float64 // cosine similarity (0 in keyword mode)
+	bm25       float64
+	score      float64 // ranking score in [0,1]
+}
+
+// fuseRankings combines the semantic and BM25 rankings. Hybrid mode uses
+// reciprocal-rank fusion, normalised so rank 1 in both lists scores 1.
+// q is needed to fill in cosine similarity for keyword-only hits.
+func fuseRankings(mode string, semantic, keyword []scoredRecord, q []float64) []rankedChunk {
+	var out []rankedChunk
+	switch mode {
+	case SearchSemantic:
+		for _, s := range semantic {
+			out = append(out, rankedChunk{record: s.record, similarity: s.similarity, score: s.similarity})
+		}
+		return out
+	case SearchKeyword:
+		for _, s := range keyword {
+			out = append(out, rankedChunk{record: s.record, bm25: s.similarity, score: s.similarity / keyword[0].similarity})
+		}
+		return out
+	}
+
+	byID := make(map[string]*rankedChunk)
+	get := func(r *VectorRecord) *rankedChunk {
+		c := byID[r.ID]
+		if c == nil {
+			c = &rankedChunk{record: r, similarity: math.NaN()}
+			byID[r.ID] = c
+		}
+		return c
+	}
+	for i, s := range semantic {
+		c := get(s.record)
+		c.similarity = s.similarity
+		c.score += 1 / float64(rrfK+i+1)
+	}
+	for i, s := range keyword {
+		c := get(s.record)
+		c.bm25 = s.similarity
+		c.score += 1 / float64(rrfK+i+1)
+	}
+	qNorm := vecNorm(q)
+	best := 2 / float64(rrfK+1)
+	for _, c := range byID {
+		if math.IsNaN(c.similarity) {
+			c.similarity = 1 - cosineDist(q, qNorm, c.record.Vector, vecNorm(c.record.Vector))
+		}
+		c.score /= best
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].score != out[j].score {
+			return out[i].score > out[j].score
+		}
+		return out[i].similarity > out[j].similarity
+	})
+	return out
+}
@@ -0,0 +1,346 @@
+package core
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunking defaults, in runes. bge-small-zh reads at most 512 tokens and
+// Chinese text is roughly one token per character.
+const (
+	DefaultChunkSize    = 400
+	DefaultChunkOverlap = 60
+	minChunkSize        = 50
+	maxChunkSize        = 2000
+)
+
+// textChunk is a byte range of the source document plus its heading path.
+type textChunk struct {
+	Start   int
+	End     int
+	Heading string // "Title > Section > Subsection"
+	whole   bool   // the chunk is an entire section
+}
+
+var mdHeadingRe = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+
+// NormalizeChunkOptions clamps size / overlap to usable values.
+func NormalizeChunkOptions(size, overlap int) (int, int) {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	size = max(minChunkSize, min(size, maxChunkSize))
+	if overlap < 0 {
+		overlap = 0
+	}
+	if overlap > size/2 {
+		overlap = size / 2
+	}
+	return size, overlap
+}
+
+// chunkMarkdown splits text at markdown headings (outside code fences),
+// packs paragraphs into chunks of at most size runes, and repeats the last
+// overlap runes of a chunk at the start of the next one when a section is
+// split. A section too short to embed well on its own (e.g. a title and one
+// line) is merged into the chunk after it.
+func chunkMarkdown(text string, size, overlap int) []textChunk {
+	var chunks []textChunk
+	for _, sec := range markdownSections(text) {
+		for _, c := range packSection(text, sec, size, overlap) {
+			if strings.TrimSpace(text[c.Start:c.End]) == "" {
+				continue
+			}
+			if n := len(chunks); n > 0 && chunks[n-1].whole && chunks[n-1].End == c.Start &&
+				utf8.RuneCountInString(text[chunks[n-1].Start:chunks[n-1].End]) < size/4 &&
+				utf8.RuneCountInString(text[chunks[n-1].Start:c.End]) <= size {
+				chunks[n-1].End = c.End
+				chunks[n-1].whole = c.whole
+				// A parent section takes its child's heading path, which includes it
+				if strings.HasPrefix(c.Heading, chunks[n-1].Heading) {
+					chunks[n-1].Heading = c.Heading
+				}
+				continue
+			}
+			chunks = append(chunks, c)
+		}
+	}
+	if len(chunks) == 0 {
+		chunks = append(chunks, textChunk{Start: 0, End: len(text)})
+	}
+	return chunks
+}
+
+// markdownSections returns one range per heading (the heading line included).
+func markdownSections(text string) []textChunk {
+	var sections []textChunk
+	var path []string // heading titles by level
+	cur := textChunk{}
+	fence := ""
+	for pos := 0; pos < len(text); {
+		end := strings.IndexByte(text[pos:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += pos + 1
+		}
+		line := strings.TrimRight(text[pos:end], "\r\n")
+		trimmed := strings.TrimLeft(line, " ")
+
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			fence = "```"
+		case strings.HasPrefix(trimmed, "~~~"):
+			fence = "~~~"
+		default:
+			if m := mdHeadingRe.FindStringSubmatch(line); m != nil {
+				if pos > cur.Start {
+					cur.End = pos
+					sections = append(sections, cur)
+				}
+				level := len(m[1])
+				for len(path) < level {
+					path = append(path, "")
+				}
+				path = append(path[:level-1], m[2])
+				cur = textChunk{Start: pos, Heading: joinHeadings(path)}
+			}
+		}
+		pos = end
+	}
+	cur.End = len(text)
+	if cur.End > cur.Start {
+		sections = append(sections, cur)
+	}
+	return sections
+}
+
+func joinHeadings(path []string) string {
+	parts := make([]string, 0, len(path))
+	for _, h := range path {
+		if h != "" {
+			parts = append(parts, h)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+// packSection splits one section into chunks of at most size runes.
+func packSection(text string, sec textChunk, size, overlap int) []textChunk {
+	if utf8.RuneCountInString(text[sec.Start:sec.End]) <= size {
+		sec.whole = true
+		return []textChunk{sec}
+	}
+	paragraphs := splitParagraphs(text, sec.Start, sec.End)
+	// Keep the heading line with the paragraph below it
+	if sec.Heading != "" && len(paragraphs) > 1 && !strings.Contains(strings.TrimSpace(text[paragraphs[0].Start:paragraphs[0].End]), "\n") {
+		paragraphs[1].Start = paragraphs[0].Start
+		paragraphs = paragraphs[1:]
+	}
+	var pieces []textChunk
+	for _, p := range paragraphs {
+		// Windows leave room for the overlap carried into each chunk
+		pieces = append(pieces, splitLong(text, p, size-overlap)...)
+	}
+
+	var out []textChunk
+	start, runes := sec.Start, 0
+	for _, p := range pieces {
+		n := utf8.RuneCountInString(text[p.Start:p.End])
+		if runes > 0 && runes+n > size {
+			out = append(out, textChunk{Start: start, End: p.Start, Heading: sec.Heading})
+			// Carry the tail of the previous chunk over, without exceeding size
+			start = runeBack(text, p.Start, min(overlap, size-n), start)
+			runes = utf8.RuneCountInString(text[start:p.Start])
+		}
+		runes += n
+	}
+	out = append(out, textChunk{Start: start, End: sec.End, Heading: sec.Heading})
+	return out
+}
+
+// splitParagraphs cuts [start,end) after blank lines; trailing blank lines
+// stay with the paragraph before them.
+func splitParagraphs(text string, start, end int) []textChunk {
+	var out []textChunk
+	pStart := start
+	for pos := start; pos < end; {
+		i := strings.Index(text[pos:end], "\n\n")
+		if i < 0 {
+			break
+		}
+		pos += i + 2
+		for pos < end && (text[pos] == '\n' || text[pos] == '\r') {
+			pos++
+		}
+		out = append(out, textChunk{Start: pStart, End: pos})
+		pStart = pos
+	}
+	if pStart < end {
+		out = append(out, textChunk{Start: pStart, End: end})
+	}
+	return out
+}
+
+// splitLong cuts a paragraph longer than size runes, preferring sentence
+// ends and line breaks in the second half of each window.
+func splitLong(text string, p textChunk, size int) []textChunk {
+	var out []textChunk
+	for utf8.RuneCountInString(text[p.Start:p.End]) > size {
+		limit := runeForward(text, p.Start, size)
+		cut := limit
+		half := runeForward(text, p.Start, size/2)
+		for i := limit; i > half; {
+			r, w := utf8.DecodeLastRuneInString(text[:i])
+			if strings.ContainsRune("\n。！？；.!?;", r) {
+				cut = i
+				break
+			}
+			i -= w
+		}
+		out = append(out, textChunk{Start: p.Start, End: cut})
+		p.Start = cut
+	}
+	return append(out, p)
+}
+
+// runeForward returns the byte offset n runes after pos.
+func runeForward(text string, pos, n int) int {
+	for ; n > 0 && pos < len(text); n-- {
+		_, w := utf8.DecodeRuneInString(text[pos:])
+		pos += w
+	}
+	return pos
+}
+
+// runeBack returns the byte offset n runes before pos, not before floor.
+func runeBack(text string, pos, n, floor int) int {
+	for ; n > 0 && pos > floor; n-- {
+		_, w := utf8.DecodeLastRuneInString(text[:pos])
+		pos -= w
+	}
+	return pos
+}
+
+// chunkID names the i-th chunk record of a document.
+func chunkID(docID string, i int) string {
+	return docID + "#" + strconv.Itoa(i)
+}
+
+// parentDocID returns the document a record belongs to.
+func parentDocID(r *VectorRecord) string {
+	if r.ParentID != "" {
+		return r.ParentID
+	}
+	return r.ID
+}
+
+// docRecordsLocked returns a document's records in chunk order: its chunks,
+// or the whole-document record written before chunking existed.
+// Caller holds v.mu.
+func docRecordsLocked(records map[string]*VectorRecord, docID string) []*VectorRecord {
+	var out []*VectorRecord
+	if r := records[docID]; r != nil && r.ParentID == "" {
+		out = append(out, r)
+	}
+	for i := 0; ; i++ {
+		r := records[chunkID(docID, i)]
+		if r == nil || r.ParentID != docID {
+			break
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// headRecordLocked returns the record carrying a document's counters and
+// metadata: chunk 0 (or the legacy whole-document record).
+func headRecordLocked(records map[string]*VectorRecord, docID string) *VectorRecord {
+	if r := records[chunkID(docID, 0)]; r != nil && r.ParentID == docID {
+		return r
+	}
+	if r := records[docID]; r != nil && r.ParentID == "" {
+		return r
+	}
+	return nil
+}
+
+// isHeadRecord reports whether r represents its document in listings.
+func isHeadRecord(r *VectorRecord) bool {
+	return r.ParentID == "" || r.Chunk == 0
+}
+
+// assembleDocument rebuilds the document text from its chunks, dropping the
+// overlapping parts.
+func assembleDocument(recs []*VectorRecord) string {
+	if len(recs) == 1 {
+		return recs[0].Document
+	}
+	var b strings.Builder
+	pos := 0
+	for _, r := range recs {
+		end := r.Start + len(r.Document)
+		switch {
+		case r.Start > pos:
+			if pos > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString(r.Document)
+		case end > pos:
+			b.WriteString(r.Document[pos-r.Start:])
+		}
+		pos = max(pos, end)
+	}
+	return b.String()
+}
+
+// chunkEmbedText is what gets encoded for a chunk: the document name and
+// heading path give short chunks their context.
+func chunkEmbedText(docID, heading, body string) string {
+	if heading == "" {
+		return docID + "\n" + body
+	}
+	return docID + "\n" + heading + "\n" + body
+}
+
+// contentHash identifies a document's text under given chunk settings, so
+// re-syncing an unchanged file skips encoding.
+func contentHash(text string, size, overlap int) string {
+	h := md5.Sum([]byte(fmt.Sprintf("%d/%d\n%s", size, overlap, text)))
+	return hex.EncodeToString(h[:])
+}
+
+// metadataContains reports whether every key in want has the same value in
+// have. Values are compared by their printed form: numbers come back from
+// disk as float64.
+func metadataContains(have, want map[string]interface{}) bool {
+	for k, val := range want {
+		if fmt.Sprint(have[k]) != fmt.Sprint(val) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetChunkOptions changes how documents embedded from now on are split.
+func (v *VectorEngine) SetChunkOptions(size, overlap int) {
+	size, overlap = NormalizeChunkOptions(size, overlap)
+	v.mu.Lock()
+	v.chunkSize, v.chunkOverlap = size, overlap
+	v.mu.Unlock()
+}
+
+func (v *VectorEngine) chunkOptions() (int, int) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return NormalizeChunkOptions(v.chunkSize, v.chunkOverlap)
+}
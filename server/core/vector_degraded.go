@@ -0,0 +1,341 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Degraded mode: when the embedding model cannot be loaded (offline box,
+// HuggingFace and mirror blocked) the engine still starts. Documents are
+// stored text-only, search falls back to BM25, and once a model shows up
+// (reload, ImportModel, or files copied into the model dir) EmbedBacklog
+// encodes the text-only records.
+
+var errModelUnavailable = errors.New("embedding model unavailable (degraded mode)")
+
+// Model import limits.
+const (
+	modelImportMaxBytes   = 4 << 30
+	modelImportMaxEntries = 1000
+	modelWatchInterval    = time.Minute
+)
+
+// HasModel reports whether an embedding model is loaded.
+func (v *VectorEngine) HasModel() bool {
+	if v == nil {
+		return false
+	}
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.embedder != nil
+}
+
+func (v *VectorEngine) setDegraded(reason string) {
+	v.mu.Lock()
+	v.err = reason
+	start := !v.modelWatching
+	v.modelWatching = true
+	v.mu.Unlock()
+	log.Printf("[vector] degraded (keyword search only): %s", reason)
+	if start {
+		go v.modelWatchLoop()
+	}
+}
+
+// modelWatchLoop loads the model once its files appear in the model dir,
+// e.g. copied there by hand on an air-gapped machine.
+func (v *VectorEngine) modelWatchLoop() {
+	defer func() {
+		v.mu.Lock()
+		v.modelWatching = false
+		v.mu.Unlock()
+	}()
+	var tried time.Time
+	for {
+		time.Sleep(modelWatchInterval)
+		if v.HasModel() {
+			return
+		}
+		// A local model is retried when its files change, a remote one every time
+		cfg := store.GetVectorEmbedderSettings()
+		if cfg.Type != model.EmbedderOpenAI {
+			name := DefaultModelName
+			if cfg.Type == model.EmbedderHuggingFace && cfg.Model != "" {
+				name = cfg.Model
+			}
+			mod := modelFilesModTime(v.modelPathFor(name))
+			if mod.IsZero() || !mod.After(tried) {
+				continue
+			}
+			tried = mod
+		}
+		if err := v.loadEmbedder(false); err != nil {
+			log.Printf("[vector] embedder still unavailable: %v", err)
+			continue
+		}
+		log.Println("[vector] model became available, leaving degraded mode")
+		return
+	}
+}
+
+func (v *VectorEngine) modelPathFor(name string) string {
+	return filepath.Join(v.modelDir, strings.ReplaceAll(name, "/", string(os.PathSeparator)))
+}
+
+// modelFilesPresent reports whether dir holds a loadable model: a converted
+// spago_model.bin, or the HuggingFace files cybertron converts on load.
+func modelFilesPresent(dir string) bool {
+	return !modelFilesModTime(dir).IsZero()
+}
+
+func modelFilesModTime(dir string) time.Time {
+	if info, err := os.Stat(filepath.Join(dir, "spago_model.bin")); err == nil {
+		return info.ModTime()
+	}
+	var latest time.Time
+	for _, name := range []string{"config.json", "vocab.txt", "pytorch_model.bin"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return time.Time{}
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// EmbedBacklog encodes records stored text-only while no model was
+// available. Safe to call any time; only one run is active.
+func (v *VectorEngine) EmbedBacklog() {
+	if !v.HasModel() || !v.backlogRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer v.backlogRunning.Store(false)
+
+	type job struct {
+		fileName string
+		record   *VectorRecord
+		emb      Embedder
+	}
+	var jobs []job
+	v.mu.RLock()
+	for fileName, records := range v.collections {
+		// A scope waiting for re-index is embedded with its own (old) model
+		emb := v.embedderForLocked(fileName)
+		if emb == nil {
+			continue
+		}
+		for _, r := range records {
+			if len(r.Vector) == 0 {
+				jobs = append(jobs, job{fileName, r, emb})
+			}
+		}
+	}
+	v.mu.RUnlock()
+	if len(jobs) == 0 {
+		return
+	}
+
+	log.Printf("[vector] embedding backlog: %d text-only chunks", len(jobs))
+	start := time.Now()
+	done := 0
+	touched := make(map[string]bool)
+	for _, j := range jobs {
+		r := j.record
+		vec, err := j.emb.Embed(context.Background(), chunkEmbedText(parentDocID(r), r.Heading, r.Document))
+		if err != nil {
+			log.Printf("[vector] backlog stopped after %d chunks: %v", done, err)
+			break
+		}
+
+		v.mu.Lock()
+		// Skip records replaced or deleted meanwhile, and scopes that
+		// switched embedders
+		st := v.stores[j.fileName]
+		if st != nil && v.collections[j.fileName][r.ID] == r {
+			embedded := *r
+			embedded.Vector = vec
+			ok, perr := v.acceptVectorsLocked(st, j.emb)
+			if ok && perr == nil {
+				perr = st.put(&embedded, true)
+			}
+			switch {
+			case perr != nil:
+				log.Printf("[vector] backlog persist %s failed: %v", r.ID, perr)
+			case ok: // (otherwise left text-only for the re-index)
+				v.collections[j.fileName][r.ID] = &embedded
+				v.indexUpsertLocked(j.fileName, &embedded)
+				touched[j.fileName] = true
+				done++
+			}
+		}
+		v.mu.Unlock()
+	}
+
+	for fileName := range touched {
+		v.mu.RLock()
+		st := v.stores[fileName]
+		v.mu.RUnlock()
+		if st != nil {
+			v.maybeCompact(fileName, st)
+		}
+		v.saveIndex(fileName)
+	}
+	log.Printf("[vector] backlog embedded %d/%d chunks in %s", done, len(jobs), time.Since(start).Round(time.Millisecond))
+}
+
+// ImportModel installs the builtin embedding model from a tarball (.tar or
+// .tar.gz) holding the HuggingFace files (config.json, vocab.txt,
+// pytorch_model.bin) or a converted spago_model.bin, at the root or in one
+// directory. The previous model is restored if the new one fails to load.
+// The model is used right away when the builtin embedder is configured.
+func (v *VectorEngine) ImportModel(r io.Reader) error {
+	if !v.importMu.TryLock() {
+		return fmt.Errorf("a model import is already running")
+	}
+	defer v.importMu.Unlock()
+
+	br := bufio.NewReader(r)
+	var tr *tar.Reader
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("gzip: %w", err)
+		}
+		defer gz.Close()
+		tr = tar.NewReader(gz)
+	} else {
+		tr = tar.NewReader(br)
+	}
+
+	if err := os.MkdirAll(v.modelDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(v.modelDir, ".import-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractTar(tr, tmp); err != nil {
+		return err
+	}
+	root := findModelRoot(tmp)
+	if root == "" {
+		return fmt.Errorf("tarball has no model: need spago_model.bin, or config.json + vocab.txt + pytorch_model.bin")
+	}
+
+	modelPath := v.modelPathFor(DefaultModelName)
+	backup := modelPath + ".bak"
+	os.RemoveAll(backup)
+	if err := os.MkdirAll(filepath.Dir(modelPath), 0755); err != nil {
+		return err
+	}
+	hadModel := os.Rename(modelPath, backup) == nil
+	restore := func() {
+		os.RemoveAll(modelPath)
+		if hadModel {
+			os.Rename(backup, modelPath)
+		}
+	}
+	if err := os.Rename(root, modelPath); err != nil {
+		restore()
+		return err
+	}
+	e, err := v.loadBertModel(DefaultModelName, false, false)
+	if err != nil {
+		restore()
+		return err
+	}
+	os.RemoveAll(backup)
+	log.Printf("[vector] model imported into %s", modelPath)
+
+	cfg := store.GetVectorEmbedderSettings()
+	if NormalizeEmbedderSettings(cfg) == nil && (cfg.Type == model.EmbedderBuiltin ||
+		(cfg.Type == model.EmbedderHuggingFace && cfg.Model == DefaultModelName)) {
+		v.useEmbedder(e)
+	}
+	return nil
+}
+
+// extractTar unpacks regular files and directories below dir, rejecting
+// paths that escape it.
+func extractTar(tr *tar.Reader, dir string) error {
+	var total int64
+	for n := 0; ; n++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tar: %w", err)
+		}
+		if n >= modelImportMaxEntries {
+			return fmt.Errorf("tarball has more than %d entries", modelImportMaxEntries)
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(os.PathSeparator)) {
+			return fmt.Errorf("tar entry %q escapes the archive", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += hdr.Size
+			if total > modelImportMaxBytes {
+				return fmt.Errorf("tarball larger than %d bytes", int64(modelImportMaxBytes))
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.CopyN(f, tr, hdr.Size)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+		// links and special files are skipped
+	}
+}
+
+// findModelRoot returns the shallowest directory under dir with model files.
+func findModelRoot(dir string) string {
+	queue := []string{dir}
+	for depth := 0; depth < 4 && len(queue) > 0; depth++ {
+		var next []string
+		for _, d := range queue {
+			if modelFilesPresent(d) {
+				return d
+			}
+			entries, _ := os.ReadDir(d)
+			for _, e := range entries {
+				if e.IsDir() {
+					next = append(next, filepath.Join(d, e.Name()))
+				}
+			}
+		}
+		queue = next
+	}
+	return ""
+}
@@ -0,0 +1,491 @@
+package core
+
+import (
+	"ai-hub/server/model"
+	"ai-hub/server/store"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nlpodyssey/cybertron/pkg/models/bert"
+	"github.com/nlpodyssey/cybertron/pkg/tasks"
+	"github.com/nlpodyssey/cybertron/pkg/tasks/textencoding"
+)
+
+// Embedder turns text into vectors. Each collection records the ID and
+// dimension of the embedder that produced its vectors; vectors of different
+// embedders are never compared.
+type Embedder interface {
+	ID() string // e.g. "hf:BAAI/bge-small-zh-v1.5", "openai:<provider>/<model>"
+	Dim() int
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// builtinEmbedderID is the default model; collections written before
+// embedders were recorded hold its vectors.
+const builtinEmbedderID = "hf:" + DefaultModelName
+
+// bertEmbedder runs a HuggingFace BERT model in-process via cybertron.
+type bertEmbedder struct {
+	name  string
+	model textencoding.Interface
+	dim   int
+}
+
+func (e *bertEmbedder) ID() string { return "hf:" + e.name }
+func (e *bertEmbedder) Dim() int   { return e.dim }
+
+func (e *bertEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	result, err := e.model.Encode(ctx, text, int(bert.MeanPooling))
+	if err != nil {
+		return nil, err
+	}
+	return result.Vector.Data().F64(), nil
+}
+
+// newBertEmbedder wraps a loaded model, probing its output dimension.
+func newBertEmbedder(name string, m textencoding.Interface) (*bertEmbedder, error) {
+	e := &bertEmbedder{name: name, model: m}
+	vec, err := e.Embed(context.Background(), "dimension probe")
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", name, err)
+	}
+	e.dim = len(vec)
+	return e, nil
+}
+
+// openAIEmbedder calls an OpenAI-compatible POST /embeddings endpoint.
+type openAIEmbedder struct {
+	providerID string
+	baseURL    string
+	apiKey     string
+	model      string
+	dim        int
+	client     *http.Client
+}
+
+func (e *openAIEmbedder) ID() string { return "openai:" + e.providerID + "/" + e.model }
+func (e *openAIEmbedder) Dim() int   { return e.dim }
+
+func (e *openAIEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	body, _ := json.Marshal(map[string]interface{}{"model": e.model, "input": text})
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(e.baseURL, "/")+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if strings.TrimSpace(e.apiKey) != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(b))
+	}
+	var out struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode embeddings: %w", err)
+	}
+	if len(out.Data) == 0 || len(out.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("empty embedding in response")
+	}
+	vec := out.Data[0].Embedding
+	if e.dim > 0 && len(vec) != e.dim {
+		return nil, fmt.Errorf("embedding dimension changed from %d to %d", e.dim, len(vec))
+	}
+	return vec, nil
+}
+
+func newOpenAIEmbedder(providerID, modelID string) (*openAIEmbedder, error) {
+	if modelID == "" {
+		return nil, fmt.Errorf("model is required for openai embedders")
+	}
+	p, err := store.GetProvider(providerID)
+	if err != nil {
+		return nil, fmt.Errorf("provider %q not found", providerID)
+	}
+	if p.BaseURL == "" {
+		return nil, fmt.Errorf("provider %q has no base_url", providerID)
+	}
+	client := &http.Client{Timeout: 60 * time.Second}
+	if p.ProxyURL != "" {
+		if pu, err := url.Parse(p.ProxyURL); err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(pu)}
+		}
+	}
+	e := &openAIEmbedder{providerID: p.ID, baseURL: p.BaseURL, apiKey: p.APIKey, model: modelID, client: client}
+	vec, err := e.Embed(context.Background(), "dimension probe")
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", e.ID(), err)
+	}
+	e.dim = len(vec)
+	return e, nil
+}
+
+// NormalizeEmbedderSettings fills defaults and checks required fields.
+func NormalizeEmbedderSettings(cfg *model.VectorEmbedderSettings) error {
+	switch cfg.Type {
+	case "", model.EmbedderBuiltin:
+		cfg.Type, cfg.Model, cfg.ProviderID = model.EmbedderBuiltin, "", ""
+	case model.EmbedderHuggingFace:
+		cfg.ProviderID = ""
+		if cfg.Model == "" || strings.Contains(cfg.Model, "..") || strings.HasPrefix(cfg.Model, "/") {
+			return fmt.Errorf("model must be a HuggingFace name like BAAI/bge-base-zh-v1.5")
+		}
+	case model.EmbedderOpenAI:
+		if cfg.ProviderID == "" || cfg.Model == "" {
+			return fmt.Errorf("provider_id and model are required for openai embedders")
+		}
+	default:
+		return fmt.Errorf("invalid embedder type %q (builtin, huggingface or openai)", cfg.Type)
+	}
+	return nil
+}
+
+// newEmbedder loads the embedder described by cfg. Only the builtin model
+// is downloaded; other HuggingFace models must already be in the model dir.
+func (v *VectorEngine) newEmbedder(cfg *model.VectorEmbedderSettings, forceDownload bool) (Embedder, error) {
+	switch cfg.Type {
+	case model.EmbedderHuggingFace:
+		if cfg.Model == DefaultModelName {
+			return v.loadBertModel(DefaultModelName, true, forceDownload)
+		}
+		return v.loadBertModel(cfg.Model, false, false)
+	case model.EmbedderOpenAI:
+		return newOpenAIEmbedder(cfg.ProviderID, cfg.Model)
+	}
+	return v.loadBertModel(DefaultModelName, true, forceDownload)
+}
+
+// loadEmbedder loads the configured embedder and makes it current.
+func (v *VectorEngine) loadEmbedder(forceDownload bool) error {
+	cfg := store.GetVectorEmbedderSettings()
+	if err := NormalizeEmbedderSettings(cfg); err != nil {
+		return err
+	}
+	e, err := v.newEmbedder(cfg, forceDownload)
+	if err != nil {
+		return err
+	}
+	v.useEmbedder(e)
+	return nil
+}
+
+// useEmbedder makes e the embedder for new vectors. Collections holding
+// another embedder's vectors are re-indexed in the background.
+func (v *VectorEngine) useEmbedder(e Embedder) {
+	v.mu.Lock()
+	v.embedder = e
+	v.embedders[e.ID()] = e
+	v.err = ""
+	v.mu.Unlock()
+	log.Printf("[vector] embedder %s (dim %d)", e.ID(), e.Dim())
+	go v.Reindex()
+}
+
+// SetEmbedder loads the embedder described by cfg and switches to it.
+// Returns once the embedder is loaded; re-indexing continues in the
+// background and Status reports its progress.
+func (v *VectorEngine) SetEmbedder(cfg *model.VectorEmbedderSettings) error {
+	if err := NormalizeEmbedderSettings(cfg); err != nil {
+		return err
+	}
+	e, err := v.newEmbedder(cfg, false)
+	if err != nil {
+		return err
+	}
+	v.useEmbedder(e)
+	return nil
+}
+
+// EmbedderID returns the current embedder's ID ("" when none is loaded).
+func (v *VectorEngine) EmbedderID() string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.embedder == nil {
+		return ""
+	}
+	return v.embedder.ID()
+}
+
+// embedderForLocked returns the embedder matching a scope's stored vectors:
+// the store's own for a scope with vectors, the current one otherwise. nil
+// when that embedder is not loaded. Caller holds v.mu.
+func (v *VectorEngine) embedderForLocked(fileName string) Embedder {
+	if st := v.stores[fileName]; st != nil && st.hasVectorRows() {
+		return v.embedders[st.embedder]
+	}
+	return v.embedder
+}
+
+// acceptVectorsLocked reports whether vectors from embedder e may be stored
+// in st. A store without vector rows switches over to e; a store holding
+// another embedder's vectors does not take them (the caller stores the
+// records text-only and the re-index embeds them). Caller holds v.mu (write).
+func (v *VectorEngine) acceptVectorsLocked(st *collectionStore, e Embedder) (bool, error) {
+	if st.embedder == e.ID() && st.dim == e.Dim() {
+		return true, nil
+	}
+	if st.hasVectorRows() {
+		return false, nil
+	}
+	return true, st.adoptEmbedder(e.ID(), e.Dim())
+}
+
+// pruneEmbeddersLocked unloads embedders no collection needs any more.
+// Caller holds v.mu (write).
+func (v *VectorEngine) pruneEmbeddersLocked() {
+	used := make(map[string]bool)
+	if v.embedder != nil {
+		used[v.embedder.ID()] = true
+	}
+	for _, st := range v.stores {
+		used[st.embedder] = true
+	}
+	for id := range v.embedders {
+		if !used[id] {
+			delete(v.embedders, id)
+		}
+	}
+}
+
+// reindexState is the progress of the background re-index. Guarded by v.mu.
+type reindexState struct {
+	running    bool
+	again      bool // another embedder switch arrived while running
+	target     string
+	collection string
+	done       int
+	total      int
+	reindexed  int
+	lastError  string
+}
+
+// Reindex re-embeds, one collection at a time, every collection whose
+// vectors came from an embedder other than the current one. Until its
+// collection is switched, search keeps using the old vectors with the old
+// embedder (or keyword ranking if that embedder is gone).
+func (v *VectorEngine) Reindex() {
+	v.mu.Lock()
+	if v.reindex.running {
+		v.reindex.again = true
+		v.mu.Unlock()
+		return
+	}
+	v.reindex.running = true
+	v.mu.Unlock()
+
+	for {
+		for _, fileName := range v.staleCollections() {
+			if err := v.reindexCollection(fileName); err != nil {
+				log.Printf("[vector] reindex %s failed: %v", fileName, err)
+				v.mu.Lock()
+				v.reindex.lastError = fileName + ": " + err.Error()
+				v.mu.Unlock()
+			}
+		}
+		v.mu.Lock()
+		if !v.reindex.again {
+			v.reindex = reindexState{reindexed: v.reindex.reindexed, lastError: v.reindex.lastError}
+			v.pruneEmbeddersLocked()
+			v.mu.Unlock()
+			break
+		}
+		v.reindex.again = false
+		v.mu.Unlock()
+	}
+	v.EmbedBacklog()
+}
+
+// staleCollections lists scopes holding vectors of a non-current embedder.
+func (v *VectorEngine) staleCollections() []string {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if v.embedder == nil {
+		return nil
+	}
+	var out []string
+	for fileName, st := range v.stores {
+		if st.hasVectorRows() && (st.embedder != v.embedder.ID() || st.dim != v.embedder.Dim()) {
+			out = append(out, fileName)
+		}
+	}
+	return out
+}
+
+func (v *VectorEngine) reindexCollection(fileName string) error {
+	v.mu.Lock()
+	target := v.embedder
+	snapshot := make(map[string]*VectorRecord, len(v.collections[fileName]))
+	for id, r := range v.collections[fileName] {
+		snapshot[id] = r
+	}
+	v.reindex.target, v.reindex.collection = target.ID(), fileName
+	v.reindex.done, v.reindex.total = 0, len(snapshot)
+	v.mu.Unlock()
+
+	start := time.Now()
+	log.Printf("[vector] reindex %s: %d chunks with %s", fileName, len(snapshot), target.ID())
+	vectors := make(map[string][]float64, len(snapshot))
+	for id, r := range snapshot {
+		vec, err := target.Embed(context.Background(), chunkEmbedText(parentDocID(r), r.Heading, r.Document))
+		if err != nil {
+			return err
+		}
+		vectors[id] = vec
+		v.mu.Lock()
+		v.reindex.done++
+		switched := v.embedder != target
+		v.mu.Unlock()
+		if switched {
+			return nil // superseded; the next pass uses the new embedder
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	st := v.stores[fileName]
+	if v.embedder != target || st == nil {
+		return nil
+	}
+	// Records written while encoding hold old vectors (or none): they are
+	// stored text-only and picked up by EmbedBacklog
+	records := make(map[string]*VectorRecord, len(v.collections[fileName]))
+	for id, r := range v.collections[fileName] {
+		c := *r
+		c.Vector = nil
+		if snapshot[id] == r {
+			c.Vector = vectors[id]
+		}
+		records[id] = &c
+	}
+
+	// Drop the old graph first: after a crash it must not be reused
+	delete(v.indexes, fileName)
+	os.Remove(v.indexPath(fileName))
+	if err := st.switchEmbedder(target.ID(), target.Dim(), records); err != nil {
+		return err
+	}
+	v.collections[fileName] = records
+	v.ensureIndexLocked(fileName)
+	v.reindex.reindexed++
+	log.Printf("[vector] reindex %s done in %s", fileName, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// reindexStatusLocked reports re-index progress for Status. Caller holds v.mu.
+func (v *VectorEngine) reindexStatusLocked() map[string]interface{} {
+	pending := 0
+	if v.embedder != nil {
+		for _, st := range v.stores {
+			if st.hasVectorRows() && (st.embedder != v.embedder.ID() || st.dim != v.embedder.Dim()) {
+				pending++
+			}
+		}
+	}
+	out := map[string]interface{}{
+		"running":             v.reindex.running,
+		"pending_collections": pending,
+		"reindexed":           v.reindex.reindexed,
+	}
+	if v.reindex.running {
+		out["target"] = v.reindex.target
+		out["collection"] = v.reindex.collection
+		out["done"] = v.reindex.done
+		out["total"] = v.reindex.total
+	}
+	if v.reindex.lastError != "" {
+		out["error"] = v.reindex.lastError
+	}
+	return out
+}
+
+// loadBertModel loads a HuggingFace BERT model from the model dir. With
+// allowDownload, a missing model is fetched (through the mirror when
+// huggingface.co is unreachable).
+func (v *VectorEngine) loadBertModel(name string, allowDownload, forceDownload bool) (Embedder, error) {
+	os.MkdirAll(v.modelDir, 0755)
+	modelPath := v.modelPathFor(name)
+
+	var downloadPolicy tasks.DownloadPolicy
+	modelExists := false
+
+	if modelFilesPresent(modelPath) && !forceDownload {
+		// Model exists, use offline mode
+		downloadPolicy = tasks.DownloadNever
+		modelExists = true
+		log.Printf("[vector] using cached model: %s", modelPath)
+	} else if !allowDownload {
+		return nil, fmt.Errorf("model %s not found in %s (only %s is downloaded automatically)", name, modelPath, DefaultModelName)
+	} else {
+		// Model doesn't exist or force download requested
+		downloadPolicy = tasks.DownloadMissing
+
+		if forceDownload {
+			log.Printf("[vector] force download requested, removing existing model...")
+			os.RemoveAll(modelPath)
+		}
+
+		log.Printf("[vector] downloading model: %s", name)
+
+		// Check if HuggingFace is accessible, if not use mirror
+		if !isHuggingFaceAccessible() {
+			log.Println("[vector] HuggingFace not accessible, using mirror: " + HFMirrorEndpoint)
+			os.Setenv("HF_ENDPOINT", HFMirrorEndpoint)
+		}
+	}
+
+	// Try to load model with retry for download failures
+	var m textencoding.Interface
+	var err error
+	maxRetries := 1
+	if !modelExists {
+		maxRetries = 3 // Retry up to 3 times for downloads
+	}
+
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		m, err = tasks.Load[textencoding.Interface](&tasks.Config{
+			ModelsDir:      v.modelDir,
+			ModelName:      name,
+			DownloadPolicy: downloadPolicy,
+		})
+		if err == nil {
+			break
+		}
+
+		if attempt < maxRetries {
+			log.Printf("[vector] model load attempt %d/%d failed: %v, retrying in 3s...", attempt, maxRetries, err)
+			time.Sleep(3 * time.Second)
+		}
+	}
+
+	if err != nil {
+		// Provide detailed error and manual download instructions
+		log.Printf("[vector] ERROR: model load failed after %d attempts: %v", maxRetries, err)
+		return nil, fmt.Errorf("模型加载失败: %w\n\n可能原因:\n1. 网络连接问题（无法访问 HuggingFace 或镜像站）\n2. 磁盘空间不足\n3. 模型文件损坏\n\n解决方法:\n1. 检查网络连接，确保可以访问 %s\n2. 运行 ai-hub reload vector --force-download 强制重新下载\n3. 手动下载: 访问 %s/%s 下载所有文件到 %s",
+			err, HFMirrorEndpoint, HFMirrorEndpoint, name, modelPath)
+	}
+
+	e, err := newBertEmbedder(name, m)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[vector] model loaded successfully")
+	return e, nil
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"ai-hub/server/store"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Federated search: one query over several scopes (session, team, global
+// memory) in parallel. Each scope's scores are multiplied by its weight,
+// near-identical documents found in more than one scope are merged into the
+// best-weighted hit, and every hit is labelled with its scope and origin.
+
+// Default weights of the memory layers, closest first.
+const (
+	SessionScopeWeight = 1.0
+	TeamScopeWeight    = 0.9
+	GlobalScopeWeight  = 0.8
+
+	// federatedDupThreshold is the trigram Jaccard similarity above which
+	// two documents count as the same memory.
+	federatedDupThreshold = 0.9
+	federatedMaxScopes    = 16
+)
+
+// ScopeWeight is one scope of a federated search. Origin labels its hits
+// ("session" | "team" | "global"); ScopeOrigin derives it when empty.
+type ScopeWeight struct {
+	Scope  string  `json:"scope"`
+	Weight float64 `json:"weight,omitempty"` // default 1
+	Origin string  `json:"origin,omitempty"`
+}
+
+// ScopeOrigin returns the memory layer of a scope: "session" for
+// <group>/sessions/<id>/<suffix>, "team" for <group>/<suffix>, else "global".
+func ScopeOrigin(scope string) string {
+	parts := strings.Split(scope, "/")
+	switch {
+	case len(parts) == 4 && parts[1] == "sessions":
+		return "session"
+	case len(parts) == 2:
+		return "team"
+	}
+	return "global"
+}
+
+// SessionScopes returns the weighted session → team → global scopes for
+// suffix (e.g. "memory") as seen from a session. Without a session only the
+// global scope is returned.
+func SessionScopes(sessionID int64, suffix string) []ScopeWeight {
+	global := ScopeWeight{Scope: suffix, Weight: GlobalScopeWeight, Origin: "global"}
+	if sessionID <= 0 {
+		return []ScopeWeight{global}
+	}
+	sess, err := store.GetSession(sessionID)
+	if err != nil {
+		return []ScopeWeight{global}
+	}
+	group := sess.GroupName
+	if group == "" {
+		group = "_standalone"
+	}
+	return []ScopeWeight{
+		{Scope: group + "/sessions/" + strconv.FormatInt(sessionID, 10) + "/" + suffix, Weight: SessionScopeWeight, Origin: "session"},
+		{Scope: group + "/" + suffix, Weight: TeamScopeWeight, Origin: "team"},
+		global,
+	}
+}
+
+// FederatedSearch runs Search on every scope in parallel and merges the
+// hits by weighted score. Each hit gains "scope", "origin",
+// "weighted_score" and, when near-identical documents from other scopes
+// were folded into it, "duplicates" ([{scope, id}]). A scope that fails
+// (e.g. semantic mode while degraded) is skipped unless all of them fail.
+func (v *VectorEngine) FederatedSearch(scopes []ScopeWeight, query string, topK int, mode string, filter *Filter) ([]map[string]interface{}, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("no scopes to search")
+	}
+	if len(scopes) > federatedMaxScopes {
+		return nil, fmt.Errorf("at most %d scopes per search", federatedMaxScopes)
+	}
+
+	type scopeResult struct {
+		hits []map[string]interface{}
+		err  error
+	}
+	out := make([]scopeResult, len(scopes))
+	var wg sync.WaitGroup
+	for i, sw := range scopes {
+		wg.Add(1)
+		go func(i int, scope string) {
+			defer wg.Done()
+			hits, err := v.Search(scope, query, topK, mode, filter)
+			out[i] = scopeResult{hits, err}
+		}(i, sw.Scope)
+	}
+	wg.Wait()
+
+	type hit struct {
+		item     map[string]interface{}
+		weighted float64
+		scopeIdx int
+		shingles map[string]bool
+	}
+	var hits []*hit
+	var firstErr error
+	failed := 0
+	for i, sw := range scopes {
+		if out[i].err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", sw.Scope, out[i].err)
+			}
+			continue
+		}
+		weight := sw.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		origin := sw.Origin
+		if origin == "" {
+			origin = ScopeOrigin(sw.Scope)
+		}
+		for _, r := range out[i].hits {
+			score, _ := r["score"].(float64)
+			r["scope"] = sw.Scope
+			r["origin"] = origin
+			r["weighted_score"] = score * weight
+			hits = append(hits, &hit{item: r, weighted: score * weight, scopeIdx: i})
+		}
+	}
+	if failed == len(scopes) {
+		return nil, firstErr
+	}
+
+	// Best first; ties go to the scope listed first
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].weighted != hits[j].weighted {
+			return hits[i].weighted > hits[j].weighted
+		}
+		return hits[i].scopeIdx < hits[j].scopeIdx
+	})
+
+	// Fold near-identical documents into the best-ranked copy. Documents are
+	// compared in full, not by the matched chunk.
+	var kept []*hit
+	for _, h := range hits {
+		id, _ := h.item["id"].(string)
+		scope, _ := h.item["scope"].(string)
+		h.shingles = textShingles(v.documentText(scope, id, h.item))
+		var dupOf *hit
+		for _, k := range kept {
+			if jaccard(h.shingles, k.shingles) >= federatedDupThreshold {
+				dupOf = k
+				break
+			}
+		}
+		if dupOf == nil {
+			kept = append(kept, h)
+			continue
+		}
+		dups, _ := dupOf.item["duplicates"].([]map[string]interface{})
+		dupOf.item["duplicates"] = append(dups, map[string]interface{}{"scope": scope, "id": id})
+	}
+
+	if topK > 0 && len(kept) > topK {
+		kept = kept[:topK]
+	}
+	results := make([]map[string]interface{}, len(kept))
+	for i, h := range kept {
+		results[i] = h.item
+	}
+	return results, nil
+}
+
+// documentText returns a search hit's full document, or the matched chunk
+// if the document is gone.
+func (v *VectorEngine) documentText(scope, docID string, item map[string]interface{}) string {
+	v.mu.RLock()
+	recs := docRecordsLocked(v.collections[scopeToFileName(scope)], docID)
+	var text string
+	if len(recs) > 0 {
+		text = assembleDocument(recs)
+	}
+	v.mu.RUnlock()
+	if text == "" {
+		text, _ = item["document"].(string)
+	}
+	return text
+}
+
+// textShingles returns the character trigrams of text with case and
+// whitespace/punctuation differences removed.
+func textShingles(text string) map[string]bool {
+	var norm []rune
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			norm = append(norm, r)
+		}
+	}
+	set := make(map[string]bool)
+	if len(norm) < 3 {
+		if len(norm) > 0 {
+			set[string(norm)] = true
+		}
+		return set
+	}
+	for i := 0; i+3 <= len(norm); i++ {
+		set[string(norm[i:i+3])] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	inter := 0
+	for k := range a {
+		if b[k] {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metadata filter language for Search, KeywordSearch and ListMetadata.
+// A filter is a JSON object with exactly one operator:
+//
+//	{"and": [f, ...]}  {"or": [f, ...]}  {"not": f}
+//	{"eq": {"field": v}}  {"ne": ...}  {"gt": ...}  {"gte": ...}  {"lt": ...}  {"lte": ...}
+//	{"in": {"field": [v, ...]}}  {"contains": {"field": v}}  {"exists": "field"}
+//
+// Fields are metadata keys; "id" is the document ID. A list field (a JSON
+// array, or a string holding one such as mem_tags) matches eq/in when any
+// element does. Comparisons are numeric when both sides are numbers,
+// otherwise by string, so ISO dates compare chronologically. A missing
+// field fails every operator except ne (and not).
+//
+// Example: {"and":[{"eq":{"mem_type":"procedure"}},{"gt":{"updated_at":"2026-01-01"}}]}
+
+const (
+	filterMaxDepth = 32
+	filterMaxNodes = 256
+)
+
+// Filter is a parsed metadata filter. A nil *Filter matches everything.
+type Filter struct {
+	op       string
+	children []*Filter
+	field    string
+	value    interface{}
+	values   []interface{}
+}
+
+// ParseFilter parses a filter expression. Empty input and JSON null yield nil.
+func ParseFilter(raw json.RawMessage) (*Filter, error) {
+	s := strings.TrimSpace(string(raw))
+	if s == "" || s == "null" {
+		return nil, nil
+	}
+	var expr interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&expr); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	nodes := 0
+	f, err := parseFilterNode(expr, 0, &nodes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	return f, nil
+}
+
+func parseFilterNode(expr interface{}, depth int, nodes *int) (*Filter, error) {
+	if depth > filterMaxDepth {
+		return nil, fmt.Errorf("nested deeper than %d", filterMaxDepth)
+	}
+	if *nodes++; *nodes > filterMaxNodes {
+		return nil, fmt.Errorf("more than %d nodes", filterMaxNodes)
+	}
+	obj, ok := expr.(map[string]interface{})
+	if !ok || len(obj) != 1 {
+		return nil, fmt.Errorf("each filter must be an object with exactly one operator")
+	}
+	var op string
+	var arg interface{}
+	for op, arg = range obj {
+	}
+
+	f := &Filter{op: op}
+	switch op {
+	case "and", "or":
+		list, ok := arg.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("%s needs a non-empty array", op)
+		}
+		for _, e := range list {
+			c, err := parseFilterNode(e, depth+1, nodes)
+			if err != nil {
+				return nil, err
+			}
+			f.children = append(f.children, c)
+		}
+	case "not":
+		c, err := parseFilterNode(arg, depth+1, nodes)
+		if err != nil {
+			return nil, err
+		}
+		f.children = []*Filter{c}
+	case "exists":
+		field, ok := arg.(string)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("exists needs a field name")
+		}
+		f.field = field
+	case "eq", "ne", "gt", "gte", "lt", "lte", "contains", "in":
+		cond, ok := arg.(map[string]interface{})
+		if !ok || len(cond) != 1 {
+			return nil, fmt.Errorf("%s needs an object with exactly one field", op)
+		}
+		for f.field, f.value = range cond {
+		}
+		if f.field == "" {
+			return nil, fmt.Errorf("%s needs a field name", op)
+		}
+		if op == "in" {
+			if f.values, ok = f.value.([]interface{}); !ok {
+				return nil, fmt.Errorf("in needs an array of values")
+			}
+			f.value = nil
+			break
+		}
+		switch f.value.(type) {
+		case string, json.Number, bool, nil:
+		default:
+			return nil, fmt.Errorf("%s on %q needs a scalar value", op, f.field)
+		}
+		if f.value == nil && op != "eq" && op != "ne" {
+			return nil, fmt.Errorf("%s on %q needs a non-null value", op, f.field)
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+	return f, nil
+}
+
+// TagsFilter matches documents carrying any of tags in mem_tags or tags.
+// Returns nil when tags is empty.
+func TagsFilter(tags []string) *Filter {
+	var values []interface{}
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" {
+			values = append(values, t)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return &Filter{op: "or", children: []*Filter{
+		{op: "in", field: "mem_tags", values: values},
+		{op: "in", field: "tags", values: values},
+	}}
+}
+
+// AndFilters combines filters, skipping nil ones.
+func AndFilters(filters ...*Filter) *Filter {
+	var children []*Filter
+	for _, f := range filters {
+		if f != nil {
+			children = append(children, f)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	}
+	return &Filter{op: "and", children: children}
+}
+
+// Match reports whether a document passes the filter.
+func (f *Filter) Match(docID string, meta map[string]interface{}) bool {
+	if f == nil {
+		return true
+	}
+	switch f.op {
+	case "and":
+		for _, c := range f.children {
+			if !c.Match(docID, meta) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, c := range f.children {
+			if c.Match(docID, meta) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !f.children[0].Match(docID, meta)
+	}
+
+	val, ok := filterField(docID, meta, f.field)
+	switch f.op {
+	case "exists":
+		return ok
+	case "ne":
+		return !ok || !anyElem(val, func(e interface{}) bool { return filterEqual(e, f.value) })
+	}
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "eq":
+		return anyElem(val, func(e interface{}) bool { return filterEqual(e, f.value) })
+	case "in":
+		return anyElem(val, func(e interface{}) bool {
+			for _, want := range f.values {
+				if filterEqual(e, want) {
+					return true
+				}
+			}
+			return false
+		})
+	case "contains":
+		if list, isList := filterList(val); isList {
+			for _, e := range list {
+				if filterEqual(e, f.value) {
+					return true
+				}
+			}
+			return false
+		}
+		s, isStr := val.(string)
+		return isStr && strings.Contains(strings.ToLower(s), strings.ToLower(filterString(f.value)))
+	default: // gt, gte, lt, lte
+		c, comparable := filterCompare(val, f.value)
+		if !comparable {
+			return false
+		}
+		switch f.op {
+		case "gt":
+			return c > 0
+		case "gte":
+			return c >= 0
+		case "lt":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	}
+}
+
+func filterField(docID string, meta map[string]interface{}, field string) (interface{}, bool) {
+	if field == "id" || field == "doc_id" {
+		return docID, true
+	}
+	val, ok := meta[field]
+	return val, ok
+}
+
+// filterList returns the elements of a list value. Strings holding a JSON
+// array (how mem_tags is stored) count as lists.
+func filterList(val interface{}) ([]interface{}, bool) {
+	switch v := val.(type) {
+	case []interface{}:
+		return v, true
+	case []string:
+		out := make([]interface{}, len(v))
+		for i, s := range v {
+			out[i] = s
+		}
+		return out, true
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "[") {
+			return nil, false
+		}
+		var list []interface{}
+		if json.Unmarshal([]byte(v), &list) != nil {
+			return nil, false
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// anyElem applies pred to val, or to each element when val is a list.
+func anyElem(val interface{}, pred func(interface{}) bool) bool {
+	if pred(val) {
+		return true
+	}
+	if list, ok := filterList(val); ok {
+		for _, e := range list {
+			if pred(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func filterEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if c, ok := filterCompare(a, b); ok {
+		return c == 0
+	}
+	ab, aok := a.(bool)
+	bb, bok := b.(bool)
+	return aok && bok && ab == bb
+}
+
+// filterCompare orders a against b: numerically when both are numbers (a
+// numeric string counts against a number), otherwise as strings.
+func filterCompare(a, b interface{}) (int, bool) {
+	an, aNum := filterNumber(a, false)
+	bn, bNum := filterNumber(b, false)
+	if aNum || bNum {
+		if !aNum {
+			an, aNum = filterNumber(a, true)
+		}
+		if !bNum {
+			bn, bNum = filterNumber(b, true)
+		}
+		if aNum && bNum {
+			switch {
+			case an < bn:
+				return -1, true
+			case an > bn:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if !aok || !bok {
+		return 0, false
+	}
+	return strings.Compare(as, bs), true
+}
+
+// filterNumber converts numeric values; parseStrings also accepts numeric strings.
+func filterNumber(v interface{}, parseStrings bool) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		if parseStrings {
+			f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			return f, err == nil
+		}
+	}
+	return 0, false
+}
+
+func filterString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// filterDocsLocked returns the IDs of a scope's documents that pass f,
+// judged by each head record's metadata. Caller holds v.mu (read).
+func (v *VectorEngine) filterDocsLocked(fileName string, f *Filter) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, r := range v.collections[fileName] {
+		if isHeadRecord(r) {
+			doc := parentDocID(r)
+			if f.Match(doc, r.Metadata) {
+				allowed[doc] = true
+			}
+		}
+	}
+	return allowed
+}
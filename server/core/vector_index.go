@@ -0,0 +1,183 @@
+package core
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ANN index settings. Scopes below annMinRecords are searched by brute
+// force, which is exact and fast enough at that size.
+const (
+	annMinRecords        = 1000
+	annM                 = 16
+	annEfConstruction    = 100
+	annEfSearch          = 64
+	annMaxTombstoneRatio = 0.2 // rebuild the graph once this share of nodes is deleted
+)
+
+type scoredRecord struct {
+	record     *VectorRecord
+	similarity float64
+}
+
+// bruteForceTopK scores every record, or those keep accepts when it is
+// non-nil. Caller holds v.mu (read).
+func bruteForceTopK(records map[string]*VectorRecord, q []float64, topK int, keep func(*VectorRecord) bool) []scoredRecord {
+	qNorm := vecNorm(q)
+	results := make([]scoredRecord, 0, len(records))
+	for _, record := range records {
+		if len(record.Vector) == 0 {
+			continue // text-only, waiting for a model
+		}
+		if keep != nil && !keep(record) {
+			continue
+		}
+		sim := 1 - cosineDist(q, qNorm, record.Vector, vecNorm(record.Vector))
+		results = append(results, scoredRecord{record: record, similarity: sim})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].similarity > results[j].similarity })
+	if topK < 0 {
+		topK = 0
+	}
+	if topK < len(results) {
+		results = results[:topK]
+	}
+	return results
+}
+
+// annSearch queries the scope's HNSW index. ok is false when the scope has
+// no usable index (too small, still building) and the caller should fall back.
+func (v *VectorEngine) annSearch(fileName string, q []float64, topK int) (results []scoredRecord, ok bool) {
+	v.mu.RLock()
+	idx := v.indexes[fileName]
+	records := v.collections[fileName]
+	n := len(records)
+	v.mu.RUnlock()
+	if idx == nil || n < annMinRecords {
+		return nil, false
+	}
+
+	hits := idx.search(q, topK, annEfSearch)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, h := range hits {
+		if rec := records[h.id]; rec != nil {
+			results = append(results, scoredRecord{record: rec, similarity: 1 - h.dist})
+		}
+	}
+	// A degraded graph returning too few hits must not hide documents
+	if len(results) < min(topK, n) {
+		return nil, false
+	}
+	return results, true
+}
+
+func (v *VectorEngine) indexPath(fileName string) string {
+	return filepath.Join(v.dataDir, fileName+".hnsw")
+}
+
+// ensureIndexLocked creates, drops or rebuilds the scope's index after its
+// size changed. Builds run in the background; searches brute-force meanwhile.
+// Caller holds v.mu (write).
+func (v *VectorEngine) ensureIndexLocked(fileName string) {
+	records := v.collections[fileName]
+	if len(records) < annMinRecords {
+		if v.indexes[fileName] != nil {
+			delete(v.indexes, fileName)
+			os.Remove(v.indexPath(fileName))
+		}
+		return
+	}
+	if v.indexBuilding[fileName] {
+		return
+	}
+	idx := v.indexes[fileName]
+	if idx != nil && idx.tombstoneRatio() <= annMaxTombstoneRatio {
+		return
+	}
+
+	v.indexBuilding[fileName] = true
+	snapshot := make(map[string]*VectorRecord, len(records))
+	for id, r := range records {
+		snapshot[id] = r
+	}
+	// Only reuse the file at startup; a tombstone-heavy index is rebuilt fresh
+	go v.buildIndex(fileName, snapshot, idx == nil)
+}
+
+func (v *VectorEngine) buildIndex(fileName string, records map[string]*VectorRecord, tryLoad bool) {
+	start := time.Now()
+	path := v.indexPath(fileName)
+
+	var idx *hnswIndex
+	source := "built"
+	if tryLoad {
+		loaded, err := loadHNSWIndex(path, records)
+		if err == nil {
+			idx, source = loaded, "loaded"
+		} else if !os.IsNotExist(err) {
+			log.Printf("[vector] index %s unusable, rebuilding: %v", fileName, err)
+		}
+	}
+	if idx == nil {
+		idx = newHNSWIndex(annM, annEfConstruction)
+	}
+	idx.sync(records)
+
+	// Catch up with writes made while building, then publish
+	v.mu.Lock()
+	delete(v.indexBuilding, fileName)
+	live := v.collections[fileName]
+	if len(live) < annMinRecords {
+		v.mu.Unlock()
+		os.Remove(path)
+		return
+	}
+	idx.sync(live)
+	v.indexes[fileName] = idx
+	v.mu.Unlock()
+
+	if err := idx.save(path); err != nil {
+		log.Printf("[vector] save index %s failed: %v", fileName, err)
+	}
+	log.Printf("[vector] ANN index %s %s: %d vectors in %s", fileName, source, idx.Len(), time.Since(start).Round(time.Millisecond))
+}
+
+// indexUpsertLocked / indexRemoveLocked keep the live HNSW and BM25
+// indexes current. Caller holds v.mu (write).
+func (v *VectorEngine) indexUpsertLocked(fileName string, record *VectorRecord) {
+	if idx := v.indexes[fileName]; idx != nil {
+		idx.insert(record.ID, record.UpdatedAt, record.Vector)
+	}
+	if v.keyword[fileName] == nil {
+		v.keyword[fileName] = newBM25Index()
+	}
+	v.keyword[fileName].add(record)
+	v.ensureIndexLocked(fileName)
+}
+
+func (v *VectorEngine) indexRemoveLocked(fileName, docID string) {
+	if idx := v.indexes[fileName]; idx != nil {
+		idx.remove(docID)
+	}
+	if x := v.keyword[fileName]; x != nil {
+		x.remove(docID)
+	}
+	v.ensureIndexLocked(fileName)
+}
+
+func (v *VectorEngine) saveIndex(fileName string) {
+	v.mu.RLock()
+	idx := v.indexes[fileName]
+	v.mu.RUnlock()
+	if idx == nil {
+		return
+	}
+	if err := idx.save(v.indexPath(fileName)); err != nil {
+		log.Printf("[vector] save index %s failed: %v", fileName, err)
+	}
+}
@@ -0,0 +1,666 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// On-disk layout of a vector collection (all in vector-data/):
+//
+//	<name>.manifest      {"version":1,"gen":N,"dim":D,"embedder":ID} — replaced atomically, the commit point
+//	<name>.<N>.vec       16-byte header + float32 rows (one row per slot, append-only)
+//	<name>.<N>.meta      snapshot: one JSON record (without vector) per line
+//	<name>.<N>.wal       JSON ops appended since the snapshot: put / del / stats
+//
+// Puts append a row, then a WAL line; both are fsynced. Compaction writes
+// generation N+1 from memory and switches the manifest, so a crash at any
+// point leaves either the old or the new generation intact. Replay drops a
+// torn WAL tail and records whose row never reached the vector file.
+
+const (
+	vecMagic         = "AIHV"
+	vecFormatVersion = 1
+	vecHeaderSize    = 16
+
+	// Compact when the WAL outgrows the snapshot (and this floor), or when
+	// dead rows outnumber live ones.
+	compactMinWALBytes = 4 << 20
+	compactMinDeadRows = 1000
+
+	// noSlot marks a text-only record, stored while no embedding model is
+	// available (see vector_degraded.go)
+	noSlot = -1
+)
+
+type vectorManifest struct {
+	Version  int    `json:"version"`
+	Gen      int    `json:"gen"`
+	Dim      int    `json:"dim"`
+	Embedder string `json:"embedder,omitempty"` // embedder that produced the vectors (see vector_embedder.go)
+}
+
+// walEntry is one line of the .wal (and, with Op "put", of the .meta snapshot).
+type walEntry struct {
+	Op     string        `json:"op"` // put | del | stats
+	Slot   int64         `json:"slot,omitempty"`
+	Record *VectorRecord `json:"record,omitempty"`
+	ID     string        `json:"id,omitempty"`
+	Stats  *recordStats  `json:"stats,omitempty"`
+}
+
+type recordStats struct {
+	HitCount   int    `json:"hit_count"`
+	LastHitAt  string `json:"last_hit_at"`
+	ReadCount  int    `json:"read_count"`
+	LastReadAt string `json:"last_read_at"`
+}
+
+// collectionStore persists one collection. Lock order: VectorEngine.mu, then mu.
+type collectionStore struct {
+	mu   sync.Mutex
+	dir  string
+	name string
+	gen  int
+	dim  int
+	// ID of the embedder the vectors come from
+	embedder string
+
+	vecFile *os.File
+	rows    int64
+	walFile *os.File
+	walSize int64
+	// snapshot size, for the WAL growth check
+	metaSize int64
+
+	slots      map[string]int64 // docID → row in the vec file
+	dirty      map[string]bool  // docIDs with unflushed hit / read counters
+	compacting bool
+}
+
+func (s *collectionStore) path(ext string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.%d.%s", s.name, s.gen, ext))
+}
+
+func manifestPath(dir, name string) string {
+	return filepath.Join(dir, name+".manifest")
+}
+
+// createCollectionStore writes an empty generation for a new collection.
+func createCollectionStore(dir, name string, dim int, embedder string, records map[string]*VectorRecord) (*collectionStore, error) {
+	s := &collectionStore{dir: dir, name: name, dim: dim, embedder: embedder, slots: map[string]int64{}, dirty: map[string]bool{}}
+	if err := s.writeGeneration(1, records); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openCollectionStore loads a collection: snapshot + WAL replay + vectors.
+func openCollectionStore(dir, name string) (*collectionStore, map[string]*VectorRecord, error) {
+	data, err := os.ReadFile(manifestPath(dir, name))
+	if err != nil {
+		return nil, nil, err
+	}
+	var m vectorManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, fmt.Errorf("manifest: %w", err)
+	}
+	if m.Version != vecFormatVersion {
+		return nil, nil, fmt.Errorf("unsupported vector format version %d", m.Version)
+	}
+	if m.Embedder == "" {
+		m.Embedder = builtinEmbedderID // written before embedders were recorded
+	}
+	s := &collectionStore{dir: dir, name: name, gen: m.Gen, dim: m.Dim, embedder: m.Embedder, slots: map[string]int64{}, dirty: map[string]bool{}}
+
+	// Vectors: drop a torn trailing row
+	vecData, err := os.ReadFile(s.path("vec"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(vecData) < vecHeaderSize || string(vecData[:4]) != vecMagic {
+		return nil, nil, fmt.Errorf("%s: bad vector file header", s.path("vec"))
+	}
+	// Without rows the header may lag a dimension change (see adoptEmbedder)
+	headerDim := int(binary.LittleEndian.Uint32(vecData[8:12]))
+	if headerDim != s.dim && len(vecData) > vecHeaderSize {
+		return nil, nil, fmt.Errorf("%s: dim %d, manifest says %d", s.path("vec"), headerDim, s.dim)
+	}
+	rowBytes := int64(s.dim) * 4
+	if rowBytes > 0 {
+		s.rows = int64(len(vecData)-vecHeaderSize) / rowBytes
+	}
+
+	records := make(map[string]*VectorRecord)
+	apply := func(e *walEntry) {
+		switch e.Op {
+		case "put":
+			if e.Record != nil && e.Record.ID != "" {
+				records[e.Record.ID] = e.Record
+				s.slots[e.Record.ID] = e.Slot
+			}
+		case "del":
+			delete(records, e.ID)
+			delete(s.slots, e.ID)
+		case "stats":
+			if r := records[e.ID]; r != nil && e.Stats != nil {
+				r.HitCount, r.LastHitAt = e.Stats.HitCount, e.Stats.LastHitAt
+				r.ReadCount, r.LastReadAt = e.Stats.ReadCount, e.Stats.LastReadAt
+			}
+		}
+	}
+	if s.metaSize, err = replayLines(s.path("meta"), apply); err != nil {
+		return nil, nil, err
+	}
+	if s.walSize, err = replayLines(s.path("wal"), apply); err != nil {
+		return nil, nil, err
+	}
+
+	for id, r := range records {
+		slot, ok := s.slots[id]
+		if ok && slot == noSlot {
+			r.Vector = nil
+			syncRecordMetadata(r)
+			continue
+		}
+		if !ok || slot < 0 || slot >= s.rows {
+			log.Printf("[vector] %s: dropping %q, its vector was never written", name, id)
+			delete(records, id)
+			delete(s.slots, id)
+			continue
+		}
+		off := vecHeaderSize + slot*rowBytes
+		r.Vector = decodeRow(vecData[off:off+rowBytes], s.dim)
+		syncRecordMetadata(r)
+	}
+
+	if err := s.openFiles(); err != nil {
+		return nil, nil, err
+	}
+	if headerDim != s.dim {
+		if err := s.writeHeaderDim(); err != nil {
+			s.closeFiles()
+			return nil, nil, err
+		}
+	}
+	s.removeOtherGenerations()
+	return s, records, nil
+}
+
+// replayLines feeds each JSON line to apply. A torn final line (crash mid
+// write) is cut off so later appends start on a clean line.
+func replayLines(path string, apply func(*walEntry)) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 1<<20)
+	var good int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var e walEntry
+			if jerr := json.Unmarshal(line, &e); jerr != nil {
+				log.Printf("[vector] %s: corrupt entry at offset %d, truncating", filepath.Base(path), good)
+				break
+			}
+			apply(&e)
+			good += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if st, err := f.Stat(); err == nil && st.Size() > good {
+		if err := f.Truncate(good); err != nil {
+			return 0, err
+		}
+	}
+	return good, nil
+}
+
+func (s *collectionStore) openFiles() error {
+	var err error
+	if s.vecFile, err = os.OpenFile(s.path("vec"), os.O_RDWR, 0644); err != nil {
+		return err
+	}
+	// Cut a torn trailing row so new rows land on row boundaries
+	s.vecFile.Truncate(vecHeaderSize + s.rows*int64(s.dim)*4)
+	if s.walFile, err = os.OpenFile(s.path("wal"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644); err != nil {
+		s.vecFile.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *collectionStore) closeFiles() {
+	if s.vecFile != nil {
+		s.vecFile.Close()
+		s.vecFile = nil
+	}
+	if s.walFile != nil {
+		s.walFile.Close()
+		s.walFile = nil
+	}
+}
+
+// removeOtherGenerations deletes files left by older or aborted generations.
+func (s *collectionStore) removeOtherGenerations() {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, s.name+".*.*"))
+	prefix := s.name + "."
+	for _, p := range matches {
+		rest := strings.TrimPrefix(filepath.Base(p), prefix)
+		genStr, ext, ok := strings.Cut(rest, ".")
+		if !ok || (ext != "vec" && ext != "meta" && ext != "wal") {
+			continue
+		}
+		if g, err := strconv.Atoi(genStr); err == nil && g != s.gen {
+			os.Remove(p)
+		}
+	}
+}
+
+// put stores a record. With a vector the row is appended first; without one
+// (metadata-only update) the record keeps its current row. A record that has
+// no vector at all is stored text-only.
+func (s *collectionStore) put(r *VectorRecord, withVector bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slot, ok := s.slots[r.ID]
+	switch {
+	case len(r.Vector) == 0:
+		slot = noSlot
+	case withVector || !ok || slot == noSlot:
+		if len(r.Vector) != s.dim {
+			return fmt.Errorf("vector dimension %d does not match collection dimension %d", len(r.Vector), s.dim)
+		}
+		off := vecHeaderSize + s.rows*int64(s.dim)*4
+		if _, err := s.vecFile.WriteAt(encodeRow(r.Vector), off); err != nil {
+			return err
+		}
+		if err := s.vecFile.Sync(); err != nil {
+			return err
+		}
+		slot = s.rows
+		s.rows++
+	}
+	if err := s.appendWAL(true, walEntry{Op: "put", Slot: slot, Record: withoutVector(r)}); err != nil {
+		return err
+	}
+	s.slots[r.ID] = slot
+	delete(s.dirty, r.ID) // the put carries the current counters
+	return nil
+}
+
+func (s *collectionStore) remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.slots[id]; !ok {
+		return nil
+	}
+	if err := s.appendWAL(true, walEntry{Op: "del", ID: id}); err != nil {
+		return err
+	}
+	delete(s.slots, id)
+	delete(s.dirty, id)
+	return nil
+}
+
+// hasVectorRows reports whether the vec file holds any rows (live or dead).
+func (s *collectionStore) hasVectorRows() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rows > 0
+}
+
+// markDirty queues a record's counters for the next flush.
+func (s *collectionStore) markDirty(id string) {
+	s.mu.Lock()
+	s.dirty[id] = true
+	s.mu.Unlock()
+}
+
+// flushStats writes queued counters in one batch. Not fsynced: losing a
+// few seconds of hit counts in a crash is acceptable. Caller holds
+// VectorEngine.mu (read) so records are stable.
+func (s *collectionStore) flushStats(records map[string]*VectorRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dirty) == 0 {
+		return nil
+	}
+	var entries []walEntry
+	for id := range s.dirty {
+		if r := records[id]; r != nil {
+			entries = append(entries, walEntry{Op: "stats", ID: id, Stats: &recordStats{
+				HitCount: r.HitCount, LastHitAt: r.LastHitAt, ReadCount: r.ReadCount, LastReadAt: r.LastReadAt,
+			}})
+		}
+	}
+	if err := s.appendWAL(false, entries...); err != nil {
+		return err
+	}
+	s.dirty = map[string]bool{}
+	return nil
+}
+
+func (s *collectionStore) appendWAL(fsync bool, entries ...walEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+	n, err := s.walFile.Write(buf.Bytes())
+	s.walSize += int64(n)
+	if err != nil {
+		return err
+	}
+	if fsync {
+		return s.walFile.Sync()
+	}
+	return nil
+}
+
+// claimCompaction reports whether the WAL or dead rows have grown enough,
+// and if so reserves the compaction for the caller.
+func (s *collectionStore) claimCompaction() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.compacting {
+		return false
+	}
+	var live int64
+	for _, slot := range s.slots {
+		if slot != noSlot {
+			live++
+		}
+	}
+	dead := s.rows - live
+	s.compacting = (s.walSize > compactMinWALBytes && s.walSize > s.metaSize) ||
+		(dead > compactMinDeadRows && dead > live)
+	return s.compacting
+}
+
+// compact rewrites the live records as the next generation. Caller holds
+// VectorEngine.mu (read), so no writes race with it.
+func (s *collectionStore) compact(records map[string]*VectorRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.compacting = false }()
+	return s.writeGeneration(s.gen+1, records)
+}
+
+// writeGeneration writes vec + meta + empty wal for gen, fsyncs them, then
+// commits by replacing the manifest. Caller holds s.mu (or owns s).
+func (s *collectionStore) writeGeneration(gen int, records map[string]*VectorRecord) error {
+	next := &collectionStore{dir: s.dir, name: s.name, gen: gen, dim: s.dim}
+
+	ids := make([]string, 0, len(records))
+	var textOnly []string
+	for id, r := range records {
+		switch len(r.Vector) {
+		case s.dim:
+			ids = append(ids, id)
+		case 0:
+			textOnly = append(textOnly, id)
+		}
+	}
+
+	vec, err := os.Create(next.path("vec"))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(vec, 1<<20)
+	header := make([]byte, vecHeaderSize)
+	copy(header, vecMagic)
+	binary.LittleEndian.PutUint32(header[4:], vecFormatVersion)
+	binary.LittleEndian.PutUint32(header[8:], uint32(s.dim))
+	w.Write(header)
+	slots := make(map[string]int64, len(ids)+len(textOnly))
+	for i, id := range ids {
+		w.Write(encodeRow(records[id].Vector))
+		slots[id] = int64(i)
+	}
+	for _, id := range textOnly {
+		slots[id] = noSlot
+	}
+	if err := finishFile(vec, w); err != nil {
+		return err
+	}
+
+	meta, err := os.Create(next.path("meta"))
+	if err != nil {
+		return err
+	}
+	mw := bufio.NewWriterSize(meta, 1<<20)
+	enc := json.NewEncoder(mw)
+	enc.SetEscapeHTML(false)
+	for _, id := range append(ids, textOnly...) {
+		if err := enc.Encode(&walEntry{Op: "put", Slot: slots[id], Record: withoutVector(records[id])}); err != nil {
+			meta.Close()
+			return err
+		}
+	}
+	if err := finishFile(meta, mw); err != nil {
+		return err
+	}
+	wal, err := os.Create(next.path("wal"))
+	if err != nil {
+		return err
+	}
+	if err := finishFile(wal, nil); err != nil {
+		return err
+	}
+
+	// Commit point
+	if err := writeManifest(s.dir, s.name, vectorManifest{Version: vecFormatVersion, Gen: gen, Dim: s.dim, Embedder: s.embedder}); err != nil {
+		return err
+	}
+
+	st, _ := os.Stat(next.path("meta"))
+	s.closeFiles()
+	s.gen, s.rows, s.slots, s.walSize = gen, int64(len(ids)), slots, 0
+	if st != nil {
+		s.metaSize = st.Size()
+	}
+	if s.dirty == nil {
+		s.dirty = map[string]bool{}
+	} else {
+		// The snapshot carries the current counters
+		for id := range s.dirty {
+			delete(s.dirty, id)
+		}
+	}
+	if err := s.openFiles(); err != nil {
+		return err
+	}
+	s.removeOtherGenerations()
+	return nil
+}
+
+// adoptEmbedder switches a collection that has no vector rows yet (e.g.
+// created while only text-only records existed) to an embedder and its
+// dimension. The manifest is the commit point; open fixes a header left
+// behind by a crash.
+func (s *collectionStore) adoptEmbedder(embedder string, dim int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeManifest(s.dir, s.name, vectorManifest{Version: vecFormatVersion, Gen: s.gen, Dim: dim, Embedder: embedder}); err != nil {
+		return err
+	}
+	s.dim, s.embedder = dim, embedder
+	return s.writeHeaderDim()
+}
+
+// switchEmbedder rewrites the collection as the next generation with
+// vectors from another embedder. Caller holds VectorEngine.mu (write).
+func (s *collectionStore) switchEmbedder(embedder string, dim int, records map[string]*VectorRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldEmbedder, oldDim := s.embedder, s.dim
+	s.embedder, s.dim = embedder, dim
+	if err := s.writeGeneration(s.gen+1, records); err != nil {
+		s.embedder, s.dim = oldEmbedder, oldDim
+		return err
+	}
+	return nil
+}
+
+func (s *collectionStore) writeHeaderDim() error {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(s.dim))
+	if _, err := s.vecFile.WriteAt(buf, 8); err != nil {
+		return err
+	}
+	return s.vecFile.Sync()
+}
+
+// writeManifest replaces the manifest atomically.
+func writeManifest(dir, name string, m vectorManifest) error {
+	mdata, _ := json.Marshal(m)
+	tmp := manifestPath(dir, name) + ".tmp"
+	if err := os.WriteFile(tmp, mdata, 0644); err != nil {
+		return err
+	}
+	if f, err := os.Open(tmp); err == nil {
+		f.Sync()
+		f.Close()
+	}
+	if err := os.Rename(tmp, manifestPath(dir, name)); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+func finishFile(f *os.File, w *bufio.Writer) error {
+	var err error
+	if w != nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// syncDir makes a rename durable (no-op where directories cannot be synced).
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+func encodeRow(v []float64) []byte {
+	buf := make([]byte, len(v)*4)
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(x)))
+	}
+	return buf
+}
+
+func decodeRow(b []byte, dim int) []float64 {
+	v := make([]float64, dim)
+	for i := range v {
+		v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:])))
+	}
+	return v
+}
+
+func withoutVector(r *VectorRecord) *VectorRecord {
+	c := *r
+	c.Vector = nil
+	return &c
+}
+
+// syncRecordMetadata mirrors the counters into Metadata, as Embed does.
+func syncRecordMetadata(r *VectorRecord) {
+	if r.Metadata == nil {
+		r.Metadata = make(map[string]interface{})
+	}
+	r.Metadata["created_at"] = r.CreatedAt
+	r.Metadata["updated_at"] = r.UpdatedAt
+	r.Metadata["hit_count"] = r.HitCount
+	r.Metadata["last_hit_time"] = r.LastHitAt
+	r.Metadata["read_count"] = r.ReadCount
+	r.Metadata["last_read_at"] = r.LastReadAt
+}
+
+// migrateJSONCollection converts a legacy <name>.json collection into the
+// binary format and renames the JSON to <name>.json.migrated.
+func migrateJSONCollection(dir, name string) (*collectionStore, map[string]*VectorRecord, error) {
+	jsonPath := filepath.Join(dir, name+".json")
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var records map[string]*VectorRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, nil, err
+	}
+	if records == nil {
+		records = make(map[string]*VectorRecord)
+	}
+	dim := 0
+	for id, r := range records {
+		if r == nil || len(r.Vector) == 0 {
+			delete(records, id)
+			continue
+		}
+		if dim == 0 {
+			dim = len(r.Vector)
+		}
+	}
+	if dim == 0 {
+		dim = VectorDimension
+	}
+	for id, r := range records {
+		if len(r.Vector) != dim {
+			log.Printf("[vector] %s: dropping %q, dimension %d != %d", name, id, len(r.Vector), dim)
+			delete(records, id)
+		}
+	}
+	s, err := createCollectionStore(dir, name, dim, builtinEmbedderID, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.Rename(jsonPath, jsonPath+".migrated"); err != nil {
+		return nil, nil, errors.Join(fmt.Errorf("rename migrated json: %w", err), os.Remove(manifestPath(dir, name)))
+	}
+	// Vectors round-trip through float32 like every later load
+	for _, r := range records {
+		for i, x := range r.Vector {
+			r.Vector[i] = float64(float32(x))
+		}
+	}
+	log.Printf("[vector] migrated %s.json → binary format (%d records, %d bytes of JSON)", name, len(records), len(data))
+	return s, records, nil
+}
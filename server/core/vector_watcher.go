@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -86,6 +87,28 @@ func (w *VectorWatcher) AddWatchDir(dir, scope string) {
 	}
 }
 
+// Scopes returns the watched scopes, sorted.
+func (w *VectorWatcher) Scopes() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, scope := range w.dirs {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// Resync re-embeds every watched file in the background, e.g. after the
+// chunking settings changed.
+func (w *VectorWatcher) Resync() {
+	go w.fullSync()
+}
+
 func (w *VectorWatcher) Stop() {
 	close(w.stopCh)
 	log.Println("[vector-watcher] stopped")
@@ -124,7 +147,7 @@ func (w *VectorWatcher) fullSync() {
 	scopeMeta := make(map[string]map[string]map[string]interface{})
 	for _, scope := range w.dirs {
 		if _, fetched := scopeMeta[scope]; !fetched {
-			scopeMeta[scope] = Vector.ListMetadata(scope) // nil if unavailable
+			scopeMeta[scope] = Vector.ListMetadata(scope, nil) // nil if unavailable
 		}
 	}
 
@@ -196,7 +219,7 @@ func (w *VectorWatcher) poll() {
 				w.snapshots[path] = fileSnapshot{modTime: info.ModTime(), size: info.Size()}
 				// Lazy-fetch scope metadata once per scope per poll cycle
 				if _, fetched := scopeMetaCache[scope]; !fetched {
-					scopeMetaCache[scope] = Vector.ListMetadata(scope)
+					scopeMetaCache[scope] = Vector.ListMetadata(scope, nil)
 				}
 				sessionID := extractSessionID(scopeMetaCache[scope], e.Name())
 				syncFileToVector(scope, path, sessionID)
@@ -284,24 +307,16 @@ func syncFileToVector(scope, path string, sessionID int64) {
 		log.Printf("[vector-watcher] read error %s: %v", path, err)
 		return
 	}
-	content := string(data)
 	name := filepath.Base(path)
 
-	// 向量化内容：文件名 + 内容前200字符
-	text := name + "\n"
-	if len(content) > 200 {
-		text += content[:200]
-	} else {
-		text += content
-	}
-
+	// 向量化全文：Embed 按 markdown 标题分块，每块带文件名和标题路径
 	docID := name
 	meta := map[string]interface{}{
 		"file_path":         path,
 		"scope":             scope,
 		"source_session_id": sessionID,
 	}
-	if err := Vector.Embed(scope, docID, text, meta); err != nil {
+	if err := Vector.Embed(scope, docID, string(data), meta); err != nil {
 		log.Printf("[vector-watcher] embed error %s: %v", docID, err)
 	} else {
 		log.Printf("[vector-watcher] synced: %s/%s (session=%d)", scope, docID, sessionID)
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"net/url"
 	"strings"
 	"time"
@@ -11,7 +12,7 @@ import (
 type Provider struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
-	Mode      string    `json:"mode"`       // "claude-code" (fixed)
+	Mode      string    `json:"mode"`       // "claude-code" (default) | "openai"
 	AuthMode  string    `json:"auth_mode"`  // "api_key" (default) | "oauth" (Claude subscription)
 	UsageMode string    `json:"usage_mode"` // "upstream" (default) | "middleware"
 	ProxyURL  string    `json:"proxy_url"`  // optional: force HTTP(S) proxy for Claude CLI subprocess
@@ -23,9 +24,18 @@ type Provider struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// DetectMode 固定返回 Claude Code 模式。
+// Provider modes: which agent backend runs the session.
+const (
+	ModeClaudeCode = "claude-code" // Claude Code CLI subprocess
+	ModeOpenAI     = "openai"      // native OpenAI-compatible /chat/completions (vLLM, llama.cpp, Ollama)
+)
+
+// DetectMode 返回供应商的后端模式：显式指定 openai 时使用原生 OpenAI 兼容后端，其余一律 Claude Code。
 func (p *Provider) DetectMode() string {
-	return "claude-code"
+	if p.Mode == ModeOpenAI {
+		return ModeOpenAI
+	}
+	return ModeClaudeCode
 }
 
 func isOllamaBaseURL(raw string) bool {
@@ -57,7 +67,8 @@ type Session struct {
 	AttentionRules    string    `json:"attention_rules"`      // 注意力规则（会话级别）
 	// Shadow session fields (for attention mode)
 	IsShadow       bool  `json:"is_shadow"`        // 是否为影子会话
-	ParentID       int64 `json:"parent_id"`        // 本体会话 ID（影子会话专用）
+	ParentID       int64 `json:"parent_id"`        // 本体会话 ID（影子会话）/ 来源会话 ID（分叉会话）
+	ForkPoint      int64 `json:"fork_point"`       // 分叉会话：来源会话中分叉处的消息 ID（0 = 非分叉）
 	// Health fields (Issue #213)
 	HealthScore     string `json:"health_score"`      // green | yellow | red (empty = unset)
 	HealthUpdatedAt string `json:"health_updated_at"` // 最后评估时间
@@ -76,23 +87,93 @@ type Message struct {
 	Content          string    `json:"content"`
 	Metadata         string    `json:"metadata,omitempty"`          // JSON: 执行步骤持久化数据
 	AttentionContext string    `json:"attention_context,omitempty"` // 注意力模式预处理内容
+	Source           string    `json:"source,omitempty"`            // 消息来源：trigger | hook | channel | shadow，空 = 用户
+	SourceID         int64     `json:"source_id,omitempty"`         // 来源触发器 / hook / 渠道 ID
 	CreatedAt        time.Time `json:"created_at"`
 }
 
+// MessageSearchHit 全局消息搜索结果（跨会话）
+// Snippet 中命中的词以 <mark>…</mark> 包裹。
+type MessageSearchHit struct {
+	MessageID    int64     `json:"message_id"`
+	SessionID    int64     `json:"session_id"`
+	SessionTitle string    `json:"session_title"`
+	GroupName    string    `json:"group_name"`
+	Role         string    `json:"role"`
+	Snippet      string    `json:"snippet"`
+	Rank         float64   `json:"rank"` // bm25，越小越相关；LIKE 回退模式下为 0
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ToolCall 一次工具调用的完整记录（按 assistant 消息归档）
+// 输出超过上限时，数据库只保留前缀，完整内容写入 OutputFile。
+type ToolCall struct {
+	ID         int64  `json:"id"`
+	SessionID  int64  `json:"session_id"`
+	MessageID  int64  `json:"message_id"`
+	ToolUseID  string `json:"tool_use_id"`
+	Name       string `json:"name"`
+	Input      string `json:"input"`
+	Output     string `json:"output"`
+	OutputSize int    `json:"output_size"`           // 完整输出字节数
+	OutputFile string `json:"output_file,omitempty"` // 溢出文件路径（输出被截断时）
+	Truncated  bool   `json:"truncated"`
+	IsError    bool   `json:"is_error"`
+	DurationMs int64  `json:"duration_ms"`
+	StartedAt  string `json:"started_at"`
+}
+
 // Trigger 定时触发器
 type Trigger struct {
-	ID          int64  `json:"id"`
-	SessionID   int64  `json:"session_id"`
-	Content     string `json:"content"`      // 自然语言指令
-	TriggerTime string `json:"trigger_time"` // "2006-01-02 15:04:05" | "15:04:05" | "1h30m"
-	MaxFires    int    `json:"max_fires"`    // -1=无限
-	Enabled     bool   `json:"enabled"`
-	FiredCount  int    `json:"fired_count"`
-	Status      string `json:"status"`       // active/fired/failed/completed/disabled
-	NextFireAt  string `json:"next_fire_at"` // 下次触发时间
-	LastFiredAt string `json:"last_fired_at"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
+	ID          int64    `json:"id"`
+	SessionID   int64    `json:"session_id"`
+	Content     string   `json:"content"`      // 自然语言指令
+	TriggerTime string   `json:"trigger_time"` // "2006-01-02 15:04:05" | "15:04:05" | "1h30m" | cron "0 9 * * 1-5"
+	Timezone    string   `json:"timezone"`     // IANA 时区，如 "America/New_York"；空 = CST+8
+	Exclusions  []string `json:"exclusions"`   // 不触发的日期："2026-10-01" | "2026-10-01..2026-10-07" | "12-25" | "@节假日表"
+	MaxFires    int      `json:"max_fires"`    // -1=无限
+	Misfire     string   `json:"misfire"`      // 停机期间错过的触发：fire_once（默认，补一次）| fire_all | skip
+	RetryLimit  int      `json:"retry_limit"`  // 会话忙时最多重试次数，0 = 默认 10，-1 = 一直排队
+	RetryDelay  string   `json:"retry_delay"`  // 首次重试间隔，之后每次翻倍（上限 1h），空 = 1m
+	Enabled     bool     `json:"enabled"`
+	FiredCount  int      `json:"fired_count"`
+	Status      string   `json:"status"`       // active/fired/queued/failed/completed/disabled
+	NextFireAt  string   `json:"next_fire_at"` // 下次触发时间
+	LastFiredAt string   `json:"last_fired_at"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+// Trigger misfire policies
+const (
+	MisfireFireOnce = "fire_once"
+	MisfireFireAll  = "fire_all"
+	MisfireSkip     = "skip"
+)
+
+// TriggerRun statuses
+const (
+	TriggerRunPending = "pending"
+	TriggerRunSuccess = "success"
+	TriggerRunFailed  = "failed"
+	TriggerRunSkipped = "skipped"
+)
+
+// TriggerRun 触发器执行记录（每个计划触发时间一条）
+type TriggerRun struct {
+	ID            int64  `json:"id"`
+	TriggerID     int64  `json:"trigger_id"`
+	SessionID     int64  `json:"session_id"`
+	ScheduledAt   string `json:"scheduled_at"`    // 计划触发时间
+	FiredAt       string `json:"fired_at"`        // 实际发送时间
+	Status        string `json:"status"`          // pending | success | failed | skipped
+	Attempts      int    `json:"attempts"`        // 已尝试次数
+	Error         string `json:"error"`           // 最近一次错误
+	Note          string `json:"note"`            // 补触发 / 跳过说明
+	MessageID     int64  `json:"message_id"`      // 发送的用户消息 ID
+	NextAttemptAt string `json:"next_attempt_at"` // pending 时下次尝试时间
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
 }
 
 // TokenUsage Token 用量记录
@@ -124,6 +205,45 @@ type CompressSettings struct {
 	MinTurns    int    `json:"min_turns"`    // 最小对话轮数阈值（user 消息数），默认 10；token 与轮数同时满足才触发压缩
 }
 
+// PoolSettings Claude CLI 进程池设置
+type PoolSettings struct {
+	MaxProcesses int `json:"max_processes"` // 最大存活进程数，0 = 不限制；满时淘汰最久未用的空闲进程，否则排队
+}
+
+// VectorChunkSettings 向量引擎文档分块设置（单位：字符）
+type VectorChunkSettings struct {
+	Size    int `json:"size"`    // 每块最大字符数
+	Overlap int `json:"overlap"` // 同一小节拆分时相邻块重叠的字符数
+}
+
+// Vector embedder types
+const (
+	EmbedderBuiltin     = "builtin"     // 内置 bge-small-zh（可自动下载）
+	EmbedderHuggingFace = "huggingface" // 本地已缓存的其它 HuggingFace BERT 模型
+	EmbedderOpenAI      = "openai"      // 供应商的 OpenAI 兼容 /embeddings 接口
+)
+
+// VectorEmbedderSettings 向量嵌入模型设置；更换后后台重建索引
+type VectorEmbedderSettings struct {
+	Type       string `json:"type"`                  // builtin | huggingface | openai，空 = builtin
+	Model      string `json:"model,omitempty"`       // huggingface: 模型名（如 BAAI/bge-base-zh-v1.5）；openai: 嵌入模型 ID
+	ProviderID string `json:"provider_id,omitempty"` // openai: 供应商 ID
+}
+
+// ToolPolicy 工具权限策略（会话级或团队级），编译为 Claude CLI 的
+// --permission-mode / --allowedTools / --disallowedTools 参数。
+// 未配置策略的会话保持原行为（--dangerously-skip-permissions）。
+type ToolPolicy struct {
+	PermissionMode string   `json:"permission_mode"` // default | acceptEdits | plan | bypassPermissions，空 = default
+	AllowedTools   []string `json:"allowed_tools"`   // 允许的工具，如 Read, Grep, WebFetch, mcp__server__tool
+	DeniedTools    []string `json:"denied_tools"`    // 禁用的工具（优先于允许列表）
+	BashPatterns   []string `json:"bash_patterns"`   // 允许的 Bash 命令模式，如 "git status", "npm run test:*"
+	WritablePaths  []string `json:"writable_paths"`  // 允许 Edit/Write 的路径 glob，如 "docs/**"
+	// 需人工审批的工具（"*" = 所有未放行的工具）；其余未放行的工具直接拒绝
+	ApprovalTools      []string `json:"approval_tools,omitempty"`
+	ApprovalTimeoutSec int      `json:"approval_timeout_sec,omitempty"` // 审批超时（秒），超时自动拒绝，默认 300
+}
+
 // AIError AI 错误追踪记录
 type AIError struct {
 	ID        int64     `json:"id"`
@@ -197,7 +317,7 @@ type Mount struct {
 // Hook 事件 Hook（事件驱动触发）
 type Hook struct {
 	ID            int64  `json:"id"`
-	Event         string `json:"event"`          // session.created | message.received | message.count | session.error
+	Event         string `json:"event"`          // 事件类型，见 core.HookEvents（session.created | stream.completed | service.died ...）
 	Condition     string `json:"condition"`       // 条件表达式，如 content_match:xxx 或 count_gt:100
 	TargetSession int64  `json:"target_session"`  // 触发时发消息到哪个会话
 	Payload       string `json:"payload"`         // 消息模板，支持 {source_session_id} 等占位符
@@ -221,6 +341,64 @@ type MemoryChangelog struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// Memory proposal kinds and statuses
+const (
+	ProposalMerge    = "merge"    // 近似重复的记忆，建议合并为一份
+	ProposalConflict = "conflict" // decision / preference 记录之间可能矛盾
+
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	ProposalRejected = "rejected"
+	ProposalStale    = "stale" // 提案涉及的文件已变更或删除
+)
+
+// MemoryProposal 记忆整理任务产生的提案，进入审核队列，批准后才改动文件
+type MemoryProposal struct {
+	ID            int64    `json:"id"`
+	Scope         string   `json:"scope"`
+	Kind          string   `json:"kind"`           // merge | conflict
+	Files         []string `json:"files"`          // 簇内的记忆文件名
+	Similarity    float64  `json:"similarity"`     // 簇内相似度（最弱一条边）
+	Reason        string   `json:"reason"`         // 提案原因 / 冲突说明
+	Target        string   `json:"target"`         // 合并后保留的文件名
+	MergedContent string   `json:"merged_content"` // 供应商撰写的合并版本，空 = 直接保留 target
+	ProviderID    string   `json:"provider_id"`    // 撰写合并版本的供应商
+	Fingerprint   string   `json:"-"`              // 簇指纹（文件 + 内容哈希），避免重复提案
+	Status        string   `json:"status"`         // pending | approved | rejected | stale
+	ReviewNote    string   `json:"review_note"`
+	CreatedAt     string   `json:"created_at"`
+	ReviewedAt    string   `json:"reviewed_at"`
+}
+
+// MemoryConsolidationSettings 记忆整理后台任务设置
+type MemoryConsolidationSettings struct {
+	Enabled       bool    `json:"enabled"`
+	IntervalHours int     `json:"interval_hours"` // 运行间隔（小时），默认 24
+	Threshold     float64 `json:"threshold"`      // 聚类的余弦相似度阈值，默认 0.92
+	UseProvider   bool    `json:"use_provider"`   // 由会话的供应商撰写合并版本
+	ProviderID    string  `json:"provider_id"`    // 会话无供应商时使用，空 = 默认供应商
+}
+
+// Memory policy actions
+const (
+	PolicyDeprecate = "deprecate" // 设置 mem_status=deprecated
+	PolicyArchive   = "archive"   // 移入作用域目录下的 .archive/ 并移出索引
+)
+
+// MemoryPolicy 记忆生命周期策略（每个作用域一条，"*" 作用于未单独配置的作用域）
+type MemoryPolicy struct {
+	ID                int64           `json:"id"`
+	Scope             string          `json:"scope"`
+	Enabled           bool            `json:"enabled"`
+	Filter            json.RawMessage `json:"filter,omitempty"`     // 只作用于匹配的记忆（元数据过滤表达式）
+	ExpireDays        int             `json:"expire_days"`          // 超过 N 天未使用（命中/读取/更新）即过期，0 = 关闭
+	UnusedDays        int             `json:"unused_days"`          // 创建 N 天后仍从未命中/读取即过期，0 = 关闭
+	Action            string          `json:"action"`               // 过期处理：deprecate（默认）| archive
+	DecayHalfLifeDays float64         `json:"decay_half_life_days"` // 检索分数按最后使用时间衰减的半衰期（天），0 = 不衰减
+	CreatedAt         string          `json:"created_at"`
+	UpdatedAt         string          `json:"updated_at"`
+}
+
 // Schema JSON Schema 定义（用于结构化记忆校验）
 type Schema struct {
 	ID         int64  `json:"id"`
@@ -230,3 +408,23 @@ type Schema struct {
 	CreatedAt  string `json:"created_at"`
 	UpdatedAt  string `json:"updated_at"`
 }
+
+// Token roles
+const (
+	RoleAdmin    = "admin"    // 全部权限（供应商、令牌、关机、导入导出）
+	RoleOperator = "operator" // 日常读写（会话、记忆、服务、触发器）
+	RoleReadOnly = "readonly" // 只读
+)
+
+// APIToken API 访问令牌（仅存储哈希，明文只在创建时返回一次）
+type APIToken struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`       // admin | operator | readonly
+	SessionID  int64  `json:"session_id"` // >0 = 会话级令牌（注入 Claude 子进程），只能修改该会话
+	Prefix     string `json:"prefix"`     // 明文前缀，用于在列表中识别
+	TokenHash  string `json:"-"`
+	ExpiresAt  string `json:"expires_at"` // 空 = 永不过期
+	LastUsedAt string `json:"last_used_at"`
+	CreatedAt  string `json:"created_at"`
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"ai-hub/server/model"
+)
+
+// InitAPITokensTable creates the api_tokens table (called from migrate).
+func InitAPITokensTable() {
+	DB.Exec(`CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT 'readonly',
+		session_id INTEGER NOT NULL DEFAULT 0,
+		prefix TEXT NOT NULL DEFAULT '',
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at TEXT NOT NULL DEFAULT '',
+		last_used_at TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT ''
+	)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_api_tokens_session ON api_tokens(session_id)`)
+}
+
+func CreateAPIToken(t *model.APIToken) error {
+	t.CreatedAt = now()
+	result, err := DB.Exec(
+		`INSERT INTO api_tokens (name, role, session_id, prefix, token_hash, expires_at, last_used_at, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Name, t.Role, t.SessionID, t.Prefix, t.TokenHash, t.ExpiresAt, t.LastUsedAt, t.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	t.ID = id
+	return nil
+}
+
+// ListAPITokens returns user-managed tokens (session-scoped tokens are excluded,
+// they are minted and revoked automatically by the process pool).
+func ListAPITokens() ([]model.APIToken, error) {
+	rows, err := DB.Query(`SELECT id, name, role, session_id, prefix, token_hash, expires_at, last_used_at, created_at FROM api_tokens WHERE session_id = 0 ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []model.APIToken
+	for rows.Next() {
+		var t model.APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Role, &t.SessionID, &t.Prefix, &t.TokenHash, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+func GetAPITokenByHash(hash string) (*model.APIToken, error) {
+	var t model.APIToken
+	err := DB.QueryRow(`SELECT id, name, role, session_id, prefix, token_hash, expires_at, last_used_at, created_at FROM api_tokens WHERE token_hash = ?`, hash).
+		Scan(&t.ID, &t.Name, &t.Role, &t.SessionID, &t.Prefix, &t.TokenHash, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func DeleteAPIToken(id int64) error {
+	_, err := DB.Exec(`DELETE FROM api_tokens WHERE id = ?`, id)
+	return err
+}
+
+// DeleteSessionAPITokens revokes all tokens scoped to the given session.
+func DeleteSessionAPITokens(sessionID int64) error {
+	_, err := DB.Exec(`DELETE FROM api_tokens WHERE session_id = ?`, sessionID)
+	return err
+}
+
+// DeleteAllSessionAPITokens revokes every session-scoped token.
+// Called at startup: no Claude subprocess survives a restart.
+func DeleteAllSessionAPITokens() error {
+	_, err := DB.Exec(`DELETE FROM api_tokens WHERE session_id > 0`)
+	return err
+}
+
+// CountAdminAPITokens returns the number of user-managed admin tokens.
+func CountAdminAPITokens() int {
+	var n int
+	DB.QueryRow(`SELECT COUNT(*) FROM api_tokens WHERE role = ? AND session_id = 0`, model.RoleAdmin).Scan(&n)
+	return n
+}
+
+func TouchAPIToken(id int64) error {
+	_, err := DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now(), id)
+	return err
+}
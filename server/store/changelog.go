@@ -41,9 +41,20 @@ func AddChangelog(cl *model.MemoryChangelog) error {
 	}
 	id, _ := result.LastInsertId()
 	cl.ID = id
+	if changelogHook != nil {
+		changelogHook(cl)
+	}
 	return nil
 }
 
+var changelogHook func(*model.MemoryChangelog)
+
+// SetChangelogHook registers a function called after each changelog entry is
+// added (memory.written hooks). Set by core to break the import cycle.
+func SetChangelogHook(fn func(*model.MemoryChangelog)) {
+	changelogHook = fn
+}
+
 // ListChangelog returns changelog entries for a specific file+scope, ordered by version DESC.
 func ListChangelog(fileName, scope string, limit int) ([]model.MemoryChangelog, error) {
 	if limit <= 0 {
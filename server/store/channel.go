@@ -13,10 +13,14 @@ func CreateChannel(ch *model.Channel) error {
 	if ch.Config == "" {
 		ch.Config = "{}"
 	}
+	encConfig, err := encryptChannelConfig(ch.Config)
+	if err != nil {
+		return err
+	}
 	result, err := DB.Exec(
 		`INSERT INTO channels (name, platform, session_id, config, enabled, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		ch.Name, ch.Platform, ch.SessionID, ch.Config, ch.Enabled, ch.CreatedAt, ch.UpdatedAt,
+		ch.Name, ch.Platform, ch.SessionID, encConfig, ch.Enabled, ch.CreatedAt, ch.UpdatedAt,
 	)
 	if err != nil {
 		return err
@@ -38,6 +42,7 @@ func ListChannels() ([]model.Channel, error) {
 		if err := rows.Scan(&ch.ID, &ch.Name, &ch.Platform, &ch.SessionID, &ch.Config, &ch.Enabled, &ch.CreatedAt, &ch.UpdatedAt); err != nil {
 			return nil, err
 		}
+		ch.Config = decryptChannelConfig(ch.Config)
 		list = append(list, ch)
 	}
 	return list, nil
@@ -50,6 +55,7 @@ func GetChannel(id int64) (*model.Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	ch.Config = decryptChannelConfig(ch.Config)
 	return &ch, nil
 }
 
@@ -66,6 +72,7 @@ func GetChannelByPlatformConfig(platform, key, value string) (*model.Channel, er
 		}
 		needle := `"` + key + `":"` + value + `"`
 		if strings.Contains(ch.Config, needle) {
+			ch.Config = decryptChannelConfig(ch.Config)
 			return &ch, nil
 		}
 	}
@@ -79,14 +86,19 @@ func GetEnabledChannelByPlatform(platform string) (*model.Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	ch.Config = decryptChannelConfig(ch.Config)
 	return &ch, nil
 }
 
 func UpdateChannel(ch *model.Channel) error {
 	ch.UpdatedAt = time.Now()
-	_, err := DB.Exec(
+	encConfig, err := encryptChannelConfig(ch.Config)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(
 		`UPDATE channels SET name=?, platform=?, session_id=?, config=?, enabled=?, updated_at=? WHERE id=?`,
-		ch.Name, ch.Platform, ch.SessionID, ch.Config, ch.Enabled, ch.UpdatedAt, ch.ID,
+		ch.Name, ch.Platform, ch.SessionID, encConfig, ch.Enabled, ch.UpdatedAt, ch.ID,
 	)
 	return err
 }
@@ -20,6 +20,10 @@ func Init(dataDir string) error {
 	if err != nil {
 		return err
 	}
+	toolOutputDir = filepath.Join(dataDir, "tool-outputs")
+	if err := initMasterKey(dataDir); err != nil {
+		return err
+	}
 	return migrate()
 }
 
@@ -69,6 +73,9 @@ func migrate() error {
 
 	// Messages: add attention_context column
 	DB.Exec(`ALTER TABLE messages ADD COLUMN attention_context TEXT NOT NULL DEFAULT ''`)
+	// Messages: provenance of messages not typed by a user (trigger, hook, channel, shadow)
+	DB.Exec(`ALTER TABLE messages ADD COLUMN source TEXT NOT NULL DEFAULT ''`)
+	DB.Exec(`ALTER TABLE messages ADD COLUMN source_id INTEGER NOT NULL DEFAULT 0`)
 
 	// Sessions: add group_name column
 	DB.Exec(`ALTER TABLE sessions ADD COLUMN group_name TEXT NOT NULL DEFAULT ''`)
@@ -90,6 +97,14 @@ func migrate() error {
 		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
 	)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_triggers_session ON triggers(session_id)`)
+	// Triggers: cron support — IANA time zone and exclusion dates (JSON array)
+	DB.Exec(`ALTER TABLE triggers ADD COLUMN timezone TEXT NOT NULL DEFAULT ''`)
+	DB.Exec(`ALTER TABLE triggers ADD COLUMN exclusions TEXT NOT NULL DEFAULT '[]'`)
+	// Triggers: misfire policy and busy-session retry
+	DB.Exec(`ALTER TABLE triggers ADD COLUMN misfire TEXT NOT NULL DEFAULT ''`)
+	DB.Exec(`ALTER TABLE triggers ADD COLUMN retry_limit INTEGER NOT NULL DEFAULT 0`)
+	DB.Exec(`ALTER TABLE triggers ADD COLUMN retry_delay TEXT NOT NULL DEFAULT ''`)
+	InitTriggerRunsTable()
 
 	// Token usage table
 	DB.Exec(`CREATE TABLE IF NOT EXISTS token_usage (
@@ -186,6 +201,8 @@ func migrate() error {
 	// Sessions: add shadow session fields (attention mode v2)
 	DB.Exec(`ALTER TABLE sessions ADD COLUMN is_shadow INTEGER NOT NULL DEFAULT 0`)
 	DB.Exec(`ALTER TABLE sessions ADD COLUMN parent_id INTEGER NOT NULL DEFAULT 0`)
+	// Sessions: fork point (message ID in the parent) for forked sessions
+	DB.Exec(`ALTER TABLE sessions ADD COLUMN fork_point INTEGER NOT NULL DEFAULT 0`)
 
 	// Sessions: add health fields (Issue #213)
 	DB.Exec(`ALTER TABLE sessions ADD COLUMN health_score TEXT NOT NULL DEFAULT ''`)
@@ -223,6 +240,12 @@ func migrate() error {
 	// Memory changelog table (Issue #212: memory change tracking)
 	InitChangelogTable()
 
+	// Memory consolidation review queue (merge / conflict proposals)
+	InitMemoryProposalsTable()
+
+	// Memory lifecycle policies (expiry, decay, archival)
+	InitMemoryPoliciesTable()
+
 	// Sessions: add auto_reset_threshold column (Issue #214: context reset)
 	DB.Exec(`ALTER TABLE sessions ADD COLUMN auto_reset_threshold INTEGER NOT NULL DEFAULT 0`)
 
@@ -238,6 +261,24 @@ func migrate() error {
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_shadow_activities_timestamp ON shadow_activities(timestamp DESC)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_shadow_activities_type ON shadow_activities(type)`)
 
+	// API tokens table (auth)
+	InitAPITokensTable()
+
+	// Provider failover chains (per session / group)
+	InitProviderChainsTable()
+
+	// Tool permission policies (per session / group)
+	InitToolPoliciesTable()
+
+	// Complete tool call records (full input / output) per assistant message
+	InitToolCallsTable()
+
+	// Global message search (FTS5 index + sync triggers, backfilled once)
+	InitMessagesFTS()
+
+	// Encrypt plaintext secrets left by older versions (provider keys, channel credentials)
+	encryptExistingSecrets()
+
 	return nil
 }
 
@@ -56,6 +56,10 @@ func CreateGroup(name, description string) (*model.Group, error) {
 // DeleteGroup deletes a group by name
 func DeleteGroup(name string) error {
 	_, err := DB.Exec(`DELETE FROM groups WHERE name = ?`, name)
+	if err == nil {
+		DB.Exec(`DELETE FROM provider_chains WHERE scope = ? AND scope_key = ?`, ChainScopeGroup, name)
+		DB.Exec(`DELETE FROM tool_policies WHERE scope = ? AND scope_key = ?`, PolicyScopeGroup, name)
+	}
 	return err
 }
 
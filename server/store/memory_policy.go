@@ -0,0 +1,71 @@
+package store
+
+import (
+	"ai-hub/server/model"
+)
+
+// InitMemoryPoliciesTable creates the memory_policies table (called from migrate).
+func InitMemoryPoliciesTable() {
+	DB.Exec(`CREATE TABLE IF NOT EXISTS memory_policies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scope TEXT NOT NULL UNIQUE,
+		enabled INTEGER NOT NULL DEFAULT 0,
+		filter TEXT NOT NULL DEFAULT '',
+		expire_days INTEGER NOT NULL DEFAULT 0,
+		unused_days INTEGER NOT NULL DEFAULT 0,
+		action TEXT NOT NULL DEFAULT 'deprecate',
+		decay_half_life_days REAL NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL DEFAULT '',
+		updated_at TEXT NOT NULL DEFAULT ''
+	)`)
+}
+
+// ListMemoryPolicies returns all memory policies ordered by scope.
+func ListMemoryPolicies() ([]model.MemoryPolicy, error) {
+	rows, err := DB.Query(`SELECT id, scope, enabled, filter, expire_days, unused_days, action, decay_half_life_days, created_at, updated_at
+		FROM memory_policies ORDER BY scope`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []model.MemoryPolicy{}
+	for rows.Next() {
+		var p model.MemoryPolicy
+		var filter string
+		if err := rows.Scan(&p.ID, &p.Scope, &p.Enabled, &filter, &p.ExpireDays, &p.UnusedDays, &p.Action,
+			&p.DecayHalfLifeDays, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if filter != "" {
+			p.Filter = []byte(filter)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// SaveMemoryPolicy creates the policy of p.Scope or replaces the existing
+// one, and fills in p.ID.
+func SaveMemoryPolicy(p *model.MemoryPolicy) error {
+	p.UpdatedAt = now()
+	_, err := DB.Exec(`INSERT INTO memory_policies (scope, enabled, filter, expire_days, unused_days, action, decay_half_life_days, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(scope) DO UPDATE SET enabled = excluded.enabled, filter = excluded.filter, expire_days = excluded.expire_days,
+			unused_days = excluded.unused_days, action = excluded.action, decay_half_life_days = excluded.decay_half_life_days,
+			updated_at = excluded.updated_at`,
+		p.Scope, p.Enabled, string(p.Filter), p.ExpireDays, p.UnusedDays, p.Action, p.DecayHalfLifeDays, p.UpdatedAt, p.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return DB.QueryRow(`SELECT id, created_at FROM memory_policies WHERE scope = ?`, p.Scope).Scan(&p.ID, &p.CreatedAt)
+}
+
+// DeleteMemoryPolicy deletes a policy; it returns false if there was none.
+func DeleteMemoryPolicy(id int64) (bool, error) {
+	result, err := DB.Exec(`DELETE FROM memory_policies WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"ai-hub/server/model"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+)
+
+// InitMemoryProposalsTable creates the memory_proposals table (called from migrate).
+func InitMemoryProposalsTable() {
+	DB.Exec(`CREATE TABLE IF NOT EXISTS memory_proposals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scope TEXT NOT NULL DEFAULT '',
+		kind TEXT NOT NULL DEFAULT '',
+		files TEXT NOT NULL DEFAULT '[]',
+		similarity REAL NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL DEFAULT '',
+		target TEXT NOT NULL DEFAULT '',
+		merged_content TEXT NOT NULL DEFAULT '',
+		provider_id TEXT NOT NULL DEFAULT '',
+		fingerprint TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		review_note TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT '',
+		reviewed_at TEXT NOT NULL DEFAULT ''
+	)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_memory_proposals_status ON memory_proposals(status, scope)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_memory_proposals_fingerprint ON memory_proposals(fingerprint)`)
+}
+
+const memoryProposalColumns = `id, scope, kind, files, similarity, reason, target, merged_content, provider_id, fingerprint, status, review_note, created_at, reviewed_at`
+
+func scanMemoryProposal(row interface{ Scan(...interface{}) error }) (*model.MemoryProposal, error) {
+	var p model.MemoryProposal
+	var files string
+	if err := row.Scan(&p.ID, &p.Scope, &p.Kind, &files, &p.Similarity, &p.Reason, &p.Target, &p.MergedContent,
+		&p.ProviderID, &p.Fingerprint, &p.Status, &p.ReviewNote, &p.CreatedAt, &p.ReviewedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(files), &p.Files)
+	if p.Files == nil {
+		p.Files = []string{}
+	}
+	return &p, nil
+}
+
+// CreateMemoryProposal queues a new proposal as pending.
+func CreateMemoryProposal(p *model.MemoryProposal) error {
+	files, err := json.Marshal(p.Files)
+	if err != nil {
+		return err
+	}
+	p.Status = model.ProposalPending
+	p.CreatedAt = now()
+	result, err := DB.Exec(`INSERT INTO memory_proposals (scope, kind, files, similarity, reason, target, merged_content, provider_id, fingerprint, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Scope, p.Kind, string(files), p.Similarity, p.Reason, p.Target, p.MergedContent, p.ProviderID, p.Fingerprint, p.Status, p.CreatedAt)
+	if err != nil {
+		return err
+	}
+	p.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListMemoryProposals returns proposals newest first, optionally filtered by
+// status and scope.
+func ListMemoryProposals(status, scope string, limit int) ([]model.MemoryProposal, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	query := `SELECT ` + memoryProposalColumns + ` FROM memory_proposals WHERE 1=1`
+	var args []interface{}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	if scope != "" {
+		query += ` AND scope = ?`
+		args = append(args, scope)
+	}
+	query += ` ORDER BY id DESC LIMIT ` + strconv.Itoa(limit)
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []model.MemoryProposal{}
+	for rows.Next() {
+		p, err := scanMemoryProposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
+
+// GetMemoryProposal returns a proposal, or nil if it does not exist.
+func GetMemoryProposal(id int64) (*model.MemoryProposal, error) {
+	p, err := scanMemoryProposal(DB.QueryRow(`SELECT `+memoryProposalColumns+` FROM memory_proposals WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// HasMemoryProposal reports whether a cluster was already proposed and is
+// still pending or was rejected (so it is not proposed again).
+func HasMemoryProposal(fingerprint string) bool {
+	var n int
+	DB.QueryRow(`SELECT COUNT(*) FROM memory_proposals WHERE fingerprint = ? AND status IN (?, ?)`,
+		fingerprint, model.ProposalPending, model.ProposalRejected).Scan(&n)
+	return n > 0
+}
+
+// ReviewMemoryProposal moves a pending proposal to status. It returns false
+// when the proposal was no longer pending (reviewed concurrently).
+func ReviewMemoryProposal(id int64, status, note string) (bool, error) {
+	result, err := DB.Exec(`UPDATE memory_proposals SET status = ?, review_note = ?, reviewed_at = ? WHERE id = ? AND status = ?`,
+		status, note, now(), id, model.ProposalPending)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,311 @@
+package store
+
+import (
+	"ai-hub/server/model"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Global message search backed by an FTS5 external-content table over
+// messages.content. The trigram tokenizer is used because the default
+// unicode61 tokenizer cannot split CJK text into words.
+//
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag (the
+// Makefile sets it). Without it, search falls back to LIKE and the sync
+// triggers are dropped so inserts into messages keep working.
+
+const (
+	ftsSyncedKey = "search.messages_fts_synced"
+
+	searchMarkOpen  = "<mark>"
+	searchMarkClose = "</mark>"
+
+	// trigram indexes substrings of at least 3 characters; shorter terms use LIKE
+	ftsMinTermRunes = 3
+)
+
+var ftsEnabled bool
+
+var messagesFTSTriggers = map[string]string{
+	"messages_fts_ai": `CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+	"messages_fts_ad": `CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END`,
+	"messages_fts_au": `CREATE TRIGGER IF NOT EXISTS messages_fts_au AFTER UPDATE OF content ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		INSERT INTO messages_fts(rowid, content) VALUES (new.id, new.content);
+	END`,
+}
+
+// InitMessagesFTS creates the FTS index and its sync triggers, and backfills
+// existing messages the first time (or after running a build without FTS5).
+func InitMessagesFTS() {
+	if !fts5Available() {
+		log.Printf("[search] FTS5 not compiled in (build with -tags sqlite_fts5); message search uses LIKE")
+		for name := range messagesFTSTriggers {
+			DB.Exec(`DROP TRIGGER IF EXISTS ` + name)
+		}
+		// Index is no longer maintained: rebuild next time FTS5 is available
+		DB.Exec(`DELETE FROM settings WHERE key = ?`, ftsSyncedKey)
+		ftsEnabled = false
+		return
+	}
+	if _, err := DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		content, content='messages', content_rowid='id', tokenize='trigram'
+	)`); err != nil {
+		log.Printf("[search] create messages_fts failed: %v", err)
+		return
+	}
+	for name, ddl := range messagesFTSTriggers {
+		if _, err := DB.Exec(ddl); err != nil {
+			log.Printf("[search] create trigger %s failed: %v", name, err)
+			return
+		}
+	}
+	if v, _ := GetSetting(ftsSyncedKey); v != "1" {
+		start := time.Now()
+		if _, err := DB.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`); err != nil {
+			log.Printf("[search] backfill messages_fts failed: %v", err)
+			return
+		}
+		SetSetting(ftsSyncedKey, "1")
+		log.Printf("[search] messages_fts backfilled in %s", time.Since(start).Round(time.Millisecond))
+	}
+	ftsEnabled = true
+}
+
+// fts5Available probes for the fts5 module inside a rolled-back transaction.
+func fts5Available() bool {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)`)
+	return err == nil
+}
+
+// FTSEnabled reports whether global search is using the FTS5 index.
+func FTSEnabled() bool {
+	return ftsEnabled
+}
+
+// MessageSearchQuery filters a global message search.
+type MessageSearchQuery struct {
+	Query string    // space-separated terms (AND); "quoted phrases" allowed
+	Group string    // session group_name
+	Role  string    // user | assistant
+	Since time.Time // zero = no lower bound
+	Limit int
+}
+
+// SearchAllMessages searches message content across all (non-shadow)
+// sessions. With FTS5, hits are ranked by bm25; otherwise newest first.
+func SearchAllMessages(q MessageSearchQuery) ([]model.MessageSearchHit, error) {
+	terms := splitSearchTerms(q.Query)
+	if len(terms) == 0 {
+		return []model.MessageSearchHit{}, nil
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+
+	var ftsTerms, likeTerms []string
+	for _, t := range terms {
+		if ftsEnabled && utf8.RuneCountInString(t) >= ftsMinTermRunes {
+			ftsTerms = append(ftsTerms, t)
+		} else {
+			likeTerms = append(likeTerms, t)
+		}
+	}
+
+	var (
+		sqlStr string
+		args   []interface{}
+	)
+	if len(ftsTerms) > 0 {
+		sqlStr = `SELECT m.id, m.session_id, s.title, s.group_name, m.role, m.content,
+			snippet(messages_fts, 0, '` + searchMarkOpen + `', '` + searchMarkClose + `', '…', 40),
+			bm25(messages_fts), m.created_at
+			FROM messages_fts
+			JOIN messages m ON m.id = messages_fts.rowid
+			JOIN sessions s ON s.id = m.session_id
+			WHERE messages_fts MATCH ? AND s.is_shadow = 0`
+		args = append(args, ftsMatchExpr(ftsTerms))
+	} else {
+		sqlStr = `SELECT m.id, m.session_id, s.title, s.group_name, m.role, m.content, '', 0, m.created_at
+			FROM messages m
+			JOIN sessions s ON s.id = m.session_id
+			WHERE s.is_shadow = 0`
+	}
+	for _, t := range likeTerms {
+		sqlStr += ` AND m.content LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(t)+"%")
+	}
+	if q.Group != "" {
+		sqlStr += ` AND s.group_name = ?`
+		args = append(args, q.Group)
+	}
+	if q.Role != "" {
+		sqlStr += ` AND m.role = ?`
+		args = append(args, q.Role)
+	}
+	if !q.Since.IsZero() {
+		sqlStr += ` AND julianday(m.created_at) >= julianday(?)`
+		args = append(args, q.Since.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if len(ftsTerms) > 0 {
+		sqlStr += ` ORDER BY bm25(messages_fts), m.id DESC LIMIT ?`
+	} else {
+		sqlStr += ` ORDER BY m.id DESC LIMIT ?`
+	}
+	args = append(args, q.Limit)
+
+	rows, err := DB.Query(sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hits := []model.MessageSearchHit{}
+	for rows.Next() {
+		var h model.MessageSearchHit
+		var content string
+		if err := rows.Scan(&h.MessageID, &h.SessionID, &h.SessionTitle, &h.GroupName, &h.Role,
+			&content, &h.Snippet, &h.Rank, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		// LIKE-only hits (and short terms FTS did not mark) get a snippet built here
+		if h.Snippet == "" || len(likeTerms) > 0 {
+			h.Snippet = buildSnippet(content, terms)
+		}
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
+
+// splitSearchTerms splits on whitespace, keeping "quoted phrases" together.
+func splitSearchTerms(q string) []string {
+	var terms []string
+	var cur strings.Builder
+	inQuote := false
+	flush := func() {
+		if t := strings.TrimSpace(cur.String()); t != "" {
+			terms = append(terms, t)
+		}
+		cur.Reset()
+	}
+	for _, r := range q {
+		switch {
+		case r == '"':
+			flush()
+			inQuote = !inQuote
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n' || r == '　'):
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return terms
+}
+
+// ftsMatchExpr quotes every term as an FTS5 string so user input can never
+// be parsed as query syntax; adjacent strings are ANDed.
+func ftsMatchExpr(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
+// buildSnippet cuts a window around the first matching term and marks every
+// (case-insensitive) occurrence of the terms inside it.
+func buildSnippet(content string, terms []string) string {
+	const radius = 40
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+	if len(lower) != len(runes) {
+		lower = runes // case folding changed the length; match case-sensitively
+	}
+	lowerTerms := make([][]rune, 0, len(terms))
+	for _, t := range terms {
+		lt := []rune(strings.ToLower(t))
+		if len(lt) != len([]rune(t)) {
+			lt = []rune(t)
+		}
+		lowerTerms = append(lowerTerms, lt)
+	}
+
+	first := -1
+	for _, lt := range lowerTerms {
+		if i := indexRunes(lower, lt, 0); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+	start := first - radius
+	if start < 0 {
+		start = 0
+	}
+	end := first + radius*2
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		matched := 0
+		for _, lt := range lowerTerms {
+			if len(lt) > matched && i+len(lt) <= len(runes) && indexRunes(lower[i:i+len(lt)], lt, 0) == 0 {
+				matched = len(lt)
+			}
+		}
+		if matched > 0 {
+			b.WriteString(searchMarkOpen)
+			b.WriteString(string(runes[i : i+matched]))
+			b.WriteString(searchMarkClose)
+			i += matched
+			continue
+		}
+		b.WriteRune(runes[i])
+		i++
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func indexRunes(s, sub []rune, from int) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := from; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -34,10 +34,14 @@ func CreateProvider(p *model.Provider) error {
 		}
 	}
 
+	encKey, err := EncryptSecret(p.APIKey)
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec(
 		`INSERT INTO providers (id, name, type, base_url, api_key, model_id, is_default, auth_mode, usage_mode, proxy_url, created_at, updated_at)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		p.ID, p.Name, p.Mode, p.BaseURL, p.APIKey, p.ModelID, boolToInt(p.IsDefault), p.AuthMode, p.UsageMode, p.ProxyURL, p.CreatedAt, p.UpdatedAt,
+		p.ID, p.Name, p.Mode, p.BaseURL, encKey, p.ModelID, boolToInt(p.IsDefault), p.AuthMode, p.UsageMode, p.ProxyURL, p.CreatedAt, p.UpdatedAt,
 	)
 	if err != nil {
 		return err
@@ -59,6 +63,7 @@ func ListProviders() ([]model.Provider, error) {
 			return nil, err
 		}
 		p.Mode = p.DetectMode()
+		p.APIKey = decryptOrLog("provider "+p.ID, p.APIKey)
 		if p.UsageMode == "" {
 			p.UsageMode = "upstream"
 		}
@@ -78,6 +83,7 @@ func GetProvider(id string) (*model.Provider, error) {
 		return nil, err
 	}
 	p.Mode = p.DetectMode()
+	p.APIKey = decryptOrLog("provider "+p.ID, p.APIKey)
 	if p.UsageMode == "" {
 		p.UsageMode = "upstream"
 	}
@@ -108,9 +114,13 @@ func UpdateProvider(p *model.Provider) error {
 		}
 	}
 
+	encKey, err := EncryptSecret(p.APIKey)
+	if err != nil {
+		return err
+	}
 	_, err = tx.Exec(
 		`UPDATE providers SET name=?, type=?, base_url=?, api_key=?, model_id=?, is_default=?, auth_mode=?, usage_mode=?, proxy_url=?, updated_at=? WHERE id=?`,
-		p.Name, p.Mode, p.BaseURL, p.APIKey, p.ModelID, boolToInt(p.IsDefault), p.AuthMode, p.UsageMode, p.ProxyURL, p.UpdatedAt, p.ID,
+		p.Name, p.Mode, p.BaseURL, encKey, p.ModelID, boolToInt(p.IsDefault), p.AuthMode, p.UsageMode, p.ProxyURL, p.UpdatedAt, p.ID,
 	)
 	if err != nil {
 		return err
@@ -155,6 +165,7 @@ func GetDefaultProvider() (*model.Provider, error) {
 		return nil, err
 	}
 	p.Mode = p.DetectMode()
+	p.APIKey = decryptOrLog("provider "+p.ID, p.APIKey)
 	if p.UsageMode == "" {
 		p.UsageMode = "upstream"
 	}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Provider chain scopes
+const (
+	ChainScopeSession = "session"
+	ChainScopeGroup   = "group"
+)
+
+// InitProviderChainsTable creates the provider_chains table (called from migrate).
+// A chain is the ordered list of fallback provider IDs for a session or a group.
+func InitProviderChainsTable() {
+	DB.Exec(`CREATE TABLE IF NOT EXISTS provider_chains (
+		scope TEXT NOT NULL,
+		scope_key TEXT NOT NULL,
+		provider_ids TEXT NOT NULL DEFAULT '[]',
+		updated_at TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (scope, scope_key)
+	)`)
+}
+
+// GetProviderChain returns the chain for a scope, or nil if none is configured.
+func GetProviderChain(scope, key string) []string {
+	var raw string
+	if err := DB.QueryRow(`SELECT provider_ids FROM provider_chains WHERE scope = ? AND scope_key = ?`, scope, key).Scan(&raw); err != nil {
+		return nil
+	}
+	var ids []string
+	json.Unmarshal([]byte(raw), &ids)
+	return ids
+}
+
+// SetProviderChain replaces the chain for a scope. An empty list removes it.
+func SetProviderChain(scope, key string, providerIDs []string) error {
+	if len(providerIDs) == 0 {
+		_, err := DB.Exec(`DELETE FROM provider_chains WHERE scope = ? AND scope_key = ?`, scope, key)
+		return err
+	}
+	data, _ := json.Marshal(providerIDs)
+	_, err := DB.Exec(`INSERT OR REPLACE INTO provider_chains (scope, scope_key, provider_ids, updated_at) VALUES (?, ?, ?, ?)`,
+		scope, key, string(data), now())
+	return err
+}
+
+// ResolveProviderChain returns the session chain, falling back to the group chain.
+func ResolveProviderChain(sessionID int64, groupName string) []string {
+	if ids := GetProviderChain(ChainScopeSession, strconv.FormatInt(sessionID, 10)); len(ids) > 0 {
+		return ids
+	}
+	if groupName != "" {
+		return GetProviderChain(ChainScopeGroup, groupName)
+	}
+	return nil
+}
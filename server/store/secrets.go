@@ -0,0 +1,486 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Secrets at rest: provider API keys and secret fields inside channel configs
+// are stored as "enc:v1:<base64(nonce|ciphertext)>" (AES-256-GCM).
+// The master key comes from AI_HUB_MASTER_KEY (base64 or hex, 32 bytes) or
+// <data-dir>/master.key, generated on first start.
+const (
+	secretPrefix     = "enc:v1:"
+	masterKeyEnv     = "AI_HUB_MASTER_KEY"
+	masterKeyFile    = "master.key"
+	masterKeyNewFile = "master.key.new" // written during rotation, before the DB commit
+)
+
+// secretConfigKeys are channel config fields treated as secrets.
+var secretConfigKeys = map[string]bool{
+	"app_secret":         true,
+	"encrypt_key":        true,
+	"verification_token": true,
+	"token":              true,
+	"access_token":       true,
+	"secret":             true,
+	"password":           true,
+}
+
+var (
+	masterKey      []byte
+	fallbackKeys   [][]byte // decrypt-only (interrupted rotation)
+	masterKeyDir   string
+	masterKeyMu    sync.RWMutex
+	errNoMasterKey = errors.New("master key not initialized")
+)
+
+// initMasterKey loads or creates the master key (called from Init).
+func initMasterKey(dataDir string) error {
+	masterKeyMu.Lock()
+	defer masterKeyMu.Unlock()
+	masterKeyDir = dataDir
+	fallbackKeys = nil
+
+	if env := strings.TrimSpace(os.Getenv(masterKeyEnv)); env != "" {
+		key, err := parseMasterKey(env)
+		if err != nil {
+			return fmt.Errorf("%s: %w", masterKeyEnv, err)
+		}
+		masterKey = key
+		return nil
+	}
+
+	path := filepath.Join(dataDir, masterKeyFile)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		key, err := parseMasterKey(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		masterKey = key
+	case os.IsNotExist(err):
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		if err := writeKeyFile(path, key); err != nil {
+			return err
+		}
+		log.Printf("[secrets] generated master key at %s", path)
+		masterKey = key
+	default:
+		return err
+	}
+
+	// A leftover master.key.new means a rotation was interrupted: rows may be
+	// encrypted with either key.
+	if data, err := os.ReadFile(filepath.Join(dataDir, masterKeyNewFile)); err == nil {
+		if key, err := parseMasterKey(string(data)); err == nil {
+			fallbackKeys = append(fallbackKeys, key)
+		}
+	}
+	return nil
+}
+
+func parseMasterKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(s); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, errors.New("master key must be 32 bytes, base64 or hex encoded")
+}
+
+func writeKeyFile(path string, key []byte) error {
+	return os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+}
+
+func encryptWith(key []byte, plain string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptWith(key []byte, enc string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(enc, secretPrefix))
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// MasterKeyFromEnv reports whether the master key is supplied by AI_HUB_MASTER_KEY.
+func MasterKeyFromEnv() bool {
+	return strings.TrimSpace(os.Getenv(masterKeyEnv)) != ""
+}
+
+// IsEncryptedSecret reports whether a stored value is already encrypted.
+func IsEncryptedSecret(s string) bool {
+	return strings.HasPrefix(s, secretPrefix)
+}
+
+// EncryptSecret encrypts a value for storage. Empty and already-encrypted
+// values are returned unchanged.
+func EncryptSecret(plain string) (string, error) {
+	if plain == "" || IsEncryptedSecret(plain) {
+		return plain, nil
+	}
+	masterKeyMu.RLock()
+	key := masterKey
+	masterKeyMu.RUnlock()
+	if key == nil {
+		return "", errNoMasterKey
+	}
+	return encryptWith(key, plain)
+}
+
+// DecryptSecret decrypts a stored value. Legacy plaintext is returned as is.
+func DecryptSecret(stored string) (string, error) {
+	if !IsEncryptedSecret(stored) {
+		return stored, nil
+	}
+	masterKeyMu.RLock()
+	defer masterKeyMu.RUnlock()
+	plain, err := decryptWithAny(stored)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return plain, nil
+}
+
+// decryptOrLog is DecryptSecret for read paths: failures are logged and
+// yield an empty value rather than leaking ciphertext to callers.
+func decryptOrLog(what, stored string) string {
+	plain, err := DecryptSecret(stored)
+	if err != nil {
+		log.Printf("[secrets] %s: %v", what, err)
+		return ""
+	}
+	return plain
+}
+
+// MaskSecret renders a secret for API responses: first/last 4 chars only.
+func MaskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= 8 {
+		return "********"
+	}
+	return string(r[:4]) + "****" + string(r[len(r)-4:])
+}
+
+// transformChannelSecrets applies fn to every secret field of a channel
+// config JSON (top level only). Non-JSON configs are returned unchanged.
+func transformChannelSecrets(config string, fn func(key, val string) (string, error)) (string, error) {
+	if strings.TrimSpace(config) == "" {
+		return config, nil
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return config, nil
+	}
+	changed := false
+	for k, v := range cfg {
+		s, ok := v.(string)
+		if !ok || s == "" || !secretConfigKeys[k] {
+			continue
+		}
+		out, err := fn(k, s)
+		if err != nil {
+			return "", err
+		}
+		if out != s {
+			cfg[k] = out
+			changed = true
+		}
+	}
+	if !changed {
+		return config, nil
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encryptChannelConfig encrypts secret fields before a channel config is stored.
+func encryptChannelConfig(config string) (string, error) {
+	return transformChannelSecrets(config, func(_, v string) (string, error) { return EncryptSecret(v) })
+}
+
+// decryptChannelConfig restores plaintext secret fields after a channel config is read.
+func decryptChannelConfig(config string) string {
+	out, err := transformChannelSecrets(config, func(k, v string) (string, error) {
+		return decryptOrLog("channel config "+k, v), nil
+	})
+	if err != nil {
+		return config
+	}
+	return out
+}
+
+// MaskChannelConfig masks secret fields of a (decrypted) channel config for API responses.
+func MaskChannelConfig(config string) string {
+	out, err := transformChannelSecrets(config, func(_, v string) (string, error) { return MaskSecret(v), nil })
+	if err != nil {
+		return config
+	}
+	return out
+}
+
+// UnmaskChannelConfig replaces masked secret values sent back by a client
+// (unchanged edit form) with the current plaintext from existing.
+func UnmaskChannelConfig(incoming, existing string) string {
+	var prev map[string]interface{}
+	json.Unmarshal([]byte(existing), &prev)
+	out, err := transformChannelSecrets(incoming, func(k, v string) (string, error) {
+		if old, ok := prev[k].(string); ok && old != "" && v == MaskSecret(old) {
+			return old, nil
+		}
+		return v, nil
+	})
+	if err != nil {
+		return incoming
+	}
+	return out
+}
+
+// encryptExistingSecrets is the one-time migration that encrypts plaintext
+// secrets left by older versions. Idempotent: encrypted values are skipped.
+func encryptExistingSecrets() {
+	rows, err := DB.Query(`SELECT id, api_key FROM providers WHERE api_key != '' AND api_key NOT LIKE 'enc:v1:%'`)
+	if err == nil {
+		type kv struct{ id, val string }
+		var pending []kv
+		for rows.Next() {
+			var r kv
+			if rows.Scan(&r.id, &r.val) == nil {
+				pending = append(pending, r)
+			}
+		}
+		rows.Close()
+		for _, r := range pending {
+			if enc, err := EncryptSecret(r.val); err == nil {
+				DB.Exec(`UPDATE providers SET api_key = ? WHERE id = ?`, enc, r.id)
+			}
+		}
+		if len(pending) > 0 {
+			log.Printf("[secrets] encrypted %d provider API key(s)", len(pending))
+		}
+	}
+
+	rows, err = DB.Query(`SELECT id, config FROM channels`)
+	if err == nil {
+		type kv struct {
+			id  int64
+			val string
+		}
+		var pending []kv
+		for rows.Next() {
+			var r kv
+			if rows.Scan(&r.id, &r.val) == nil {
+				pending = append(pending, r)
+			}
+		}
+		rows.Close()
+		n := 0
+		for _, r := range pending {
+			enc, err := encryptChannelConfig(r.val)
+			if err == nil && enc != r.val {
+				DB.Exec(`UPDATE channels SET config = ? WHERE id = ?`, enc, r.id)
+				n++
+			}
+		}
+		if n > 0 {
+			log.Printf("[secrets] encrypted secrets in %d channel config(s)", n)
+		}
+	}
+}
+
+// RotateMasterKey re-encrypts every stored secret with a new master key.
+// newKeyText (base64 or hex) may be empty to generate one. When the key comes
+// from the environment the caller must supply it and update AI_HUB_MASTER_KEY
+// afterwards; otherwise the new key replaces <data-dir>/master.key.
+// Returns the number of re-encrypted rows.
+func RotateMasterKey(newKeyText string) (int, error) {
+	fromEnv := MasterKeyFromEnv()
+	if fromEnv && strings.TrimSpace(newKeyText) == "" {
+		return 0, fmt.Errorf("master key is provided by %s: pass the new key explicitly", masterKeyEnv)
+	}
+	var newKey []byte
+	if strings.TrimSpace(newKeyText) != "" {
+		key, err := parseMasterKey(newKeyText)
+		if err != nil {
+			return 0, err
+		}
+		newKey = key
+	} else {
+		newKey = make([]byte, 32)
+		if _, err := rand.Read(newKey); err != nil {
+			return 0, err
+		}
+	}
+
+	masterKeyMu.Lock()
+	defer masterKeyMu.Unlock()
+
+	newPath := filepath.Join(masterKeyDir, masterKeyNewFile)
+	if !fromEnv {
+		// Persist the new key before committing, so a crash leaves it usable as fallback
+		if err := writeKeyFile(newPath, newKey); err != nil {
+			return 0, err
+		}
+	}
+
+	reencrypt := func(v string) (string, error) {
+		plain := v
+		if IsEncryptedSecret(v) {
+			var err error
+			plain, err = decryptWithAny(v)
+			if err != nil {
+				return "", err
+			}
+		}
+		return encryptWith(newKey, plain)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	count := 0
+
+	type provRow struct{ id, key string }
+	var provs []provRow
+	rows, err := tx.Query(`SELECT id, api_key FROM providers WHERE api_key != ''`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var r provRow
+		if err := rows.Scan(&r.id, &r.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		provs = append(provs, r)
+	}
+	rows.Close()
+	for _, r := range provs {
+		enc, err := reencrypt(r.key)
+		if err != nil {
+			return 0, fmt.Errorf("provider %s: %w", r.id, err)
+		}
+		if _, err := tx.Exec(`UPDATE providers SET api_key = ? WHERE id = ?`, enc, r.id); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	type chRow struct {
+		id     int64
+		config string
+	}
+	var chans []chRow
+	rows, err = tx.Query(`SELECT id, config FROM channels`)
+	if err != nil {
+		return 0, err
+	}
+	for rows.Next() {
+		var r chRow
+		if err := rows.Scan(&r.id, &r.config); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		chans = append(chans, r)
+	}
+	rows.Close()
+	for _, r := range chans {
+		enc, err := transformChannelSecrets(r.config, func(_, v string) (string, error) { return reencrypt(v) })
+		if err != nil {
+			return 0, fmt.Errorf("channel %d: %w", r.id, err)
+		}
+		if enc == r.config {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE channels SET config = ? WHERE id = ?`, enc, r.id); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if !fromEnv {
+		if err := os.Rename(newPath, filepath.Join(masterKeyDir, masterKeyFile)); err != nil {
+			// DB already uses the new key; keep it as fallback so reads still work
+			fallbackKeys = append(fallbackKeys, newKey)
+			return count, fmt.Errorf("re-encrypted %d secrets but failed to replace %s: %w", count, masterKeyFile, err)
+		}
+	}
+	masterKey = newKey
+	fallbackKeys = nil
+	return count, nil
+}
+
+// decryptWithAny decrypts with the current or fallback keys (caller holds masterKeyMu).
+func decryptWithAny(enc string) (string, error) {
+	var lastErr error = errNoMasterKey
+	for _, key := range append([][]byte{masterKey}, fallbackKeys...) {
+		if key == nil {
+			continue
+		}
+		plain, err := decryptWith(key, enc)
+		if err == nil {
+			return plain, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
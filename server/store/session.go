@@ -3,6 +3,7 @@ package store
 import (
 	"ai-hub/server/model"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,8 +18,8 @@ func CreateSession(s *model.Session) error {
 		s.Title = "New Chat"
 	}
 	result, err := DB.Exec(
-		`INSERT INTO sessions (title, provider_id, claude_session_id, work_dir, group_name, is_shadow, parent_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		s.Title, s.ProviderID, s.ClaudeSessionID, s.WorkDir, s.GroupName, s.IsShadow, s.ParentID, s.CreatedAt, s.UpdatedAt,
+		`INSERT INTO sessions (title, provider_id, claude_session_id, work_dir, group_name, is_shadow, parent_id, fork_point, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.Title, s.ProviderID, s.ClaudeSessionID, s.WorkDir, s.GroupName, s.IsShadow, s.ParentID, s.ForkPoint, s.CreatedAt, s.UpdatedAt,
 	)
 	if err != nil {
 		return err
@@ -33,7 +34,7 @@ func CreateSession(s *model.Session) error {
 
 func ListSessions() ([]model.Session, error) {
 	// Exclude shadow sessions from normal listing
-	rows, err := DB.Query(`SELECT id, title, icon, provider_id, claude_session_id, work_dir, group_name, last_compress_msg_id, attention_enabled, attention_rules, is_shadow, parent_id, health_score, health_updated_at, correction_count, drift_count, auto_reset_threshold, created_at, updated_at FROM sessions WHERE is_shadow = 0 ORDER BY updated_at DESC`)
+	rows, err := DB.Query(`SELECT id, title, icon, provider_id, claude_session_id, work_dir, group_name, last_compress_msg_id, attention_enabled, attention_rules, is_shadow, parent_id, fork_point, health_score, health_updated_at, correction_count, drift_count, auto_reset_threshold, created_at, updated_at FROM sessions WHERE is_shadow = 0 ORDER BY updated_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -41,7 +42,7 @@ func ListSessions() ([]model.Session, error) {
 	var list []model.Session
 	for rows.Next() {
 		var s model.Session
-		if err := rows.Scan(&s.ID, &s.Title, &s.Icon, &s.ProviderID, &s.ClaudeSessionID, &s.WorkDir, &s.GroupName, &s.LastCompressMsgID, &s.AttentionEnabled, &s.AttentionRules, &s.IsShadow, &s.ParentID, &s.HealthScore, &s.HealthUpdatedAt, &s.CorrectionCount, &s.DriftCount, &s.AutoResetThreshold, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		if err := rows.Scan(&s.ID, &s.Title, &s.Icon, &s.ProviderID, &s.ClaudeSessionID, &s.WorkDir, &s.GroupName, &s.LastCompressMsgID, &s.AttentionEnabled, &s.AttentionRules, &s.IsShadow, &s.ParentID, &s.ForkPoint, &s.HealthScore, &s.HealthUpdatedAt, &s.CorrectionCount, &s.DriftCount, &s.AutoResetThreshold, &s.CreatedAt, &s.UpdatedAt); err != nil {
 			return nil, err
 		}
 		list = append(list, s)
@@ -52,8 +53,8 @@ func ListSessions() ([]model.Session, error) {
 func GetSession(id int64) (*model.Session, error) {
 	var s model.Session
 	err := DB.QueryRow(
-		`SELECT id, title, icon, provider_id, claude_session_id, work_dir, group_name, last_compress_msg_id, attention_enabled, attention_rules, is_shadow, parent_id, health_score, health_updated_at, correction_count, drift_count, auto_reset_threshold, created_at, updated_at FROM sessions WHERE id = ?`, id,
-	).Scan(&s.ID, &s.Title, &s.Icon, &s.ProviderID, &s.ClaudeSessionID, &s.WorkDir, &s.GroupName, &s.LastCompressMsgID, &s.AttentionEnabled, &s.AttentionRules, &s.IsShadow, &s.ParentID, &s.HealthScore, &s.HealthUpdatedAt, &s.CorrectionCount, &s.DriftCount, &s.AutoResetThreshold, &s.CreatedAt, &s.UpdatedAt)
+		`SELECT id, title, icon, provider_id, claude_session_id, work_dir, group_name, last_compress_msg_id, attention_enabled, attention_rules, is_shadow, parent_id, fork_point, health_score, health_updated_at, correction_count, drift_count, auto_reset_threshold, created_at, updated_at FROM sessions WHERE id = ?`, id,
+	).Scan(&s.ID, &s.Title, &s.Icon, &s.ProviderID, &s.ClaudeSessionID, &s.WorkDir, &s.GroupName, &s.LastCompressMsgID, &s.AttentionEnabled, &s.AttentionRules, &s.IsShadow, &s.ParentID, &s.ForkPoint, &s.HealthScore, &s.HealthUpdatedAt, &s.CorrectionCount, &s.DriftCount, &s.AutoResetThreshold, &s.CreatedAt, &s.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +76,10 @@ func DeleteSession(id int64) error {
 		return err
 	}
 	DB.Exec(`DELETE FROM token_usage WHERE session_id = ?`, id)
+	DB.Exec(`DELETE FROM api_tokens WHERE session_id = ?`, id)
+	DB.Exec(`DELETE FROM provider_chains WHERE scope = ? AND scope_key = ?`, ChainScopeSession, strconv.FormatInt(id, 10))
+	DB.Exec(`DELETE FROM tool_policies WHERE scope = ? AND scope_key = ?`, PolicyScopeSession, strconv.FormatInt(id, 10))
+	deleteToolCalls("session_id", id)
 	_, err = DB.Exec(`DELETE FROM sessions WHERE id = ?`, id)
 	return err
 }
@@ -82,8 +87,8 @@ func DeleteSession(id int64) error {
 func AddMessage(m *model.Message) error {
 	m.CreatedAt = time.Now()
 	result, err := DB.Exec(
-		`INSERT INTO messages (session_id, role, content, metadata, attention_context, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
-		m.SessionID, m.Role, m.Content, m.Metadata, m.AttentionContext, m.CreatedAt,
+		`INSERT INTO messages (session_id, role, content, metadata, attention_context, source, source_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.SessionID, m.Role, m.Content, m.Metadata, m.AttentionContext, m.Source, m.SourceID, m.CreatedAt,
 	)
 	if err != nil {
 		return err
@@ -110,13 +115,14 @@ func UpdateMessageContent(id int64, content string, metadata string) error {
 // DeleteMessage removes a single message by ID.
 // Used to clean up empty pre-inserted messages when streaming produces no content.
 func DeleteMessage(id int64) error {
+	deleteToolCalls("message_id", id)
 	_, err := DB.Exec(`DELETE FROM messages WHERE id = ?`, id)
 	return err
 }
 
 func GetMessages(sessionID int64) ([]model.Message, error) {
 	rows, err := DB.Query(
-		`SELECT id, session_id, role, content, metadata, attention_context, created_at FROM messages WHERE session_id = ? ORDER BY created_at`,
+		`SELECT id, session_id, role, content, metadata, attention_context, source, source_id, created_at FROM messages WHERE session_id = ? ORDER BY created_at`,
 		sessionID,
 	)
 	if err != nil {
@@ -126,7 +132,7 @@ func GetMessages(sessionID int64) ([]model.Message, error) {
 	var list []model.Message
 	for rows.Next() {
 		var m model.Message
-		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.Metadata, &m.AttentionContext, &m.CreatedAt); err != nil {
+		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.Metadata, &m.AttentionContext, &m.Source, &m.SourceID, &m.CreatedAt); err != nil {
 			return nil, err
 		}
 		list = append(list, m)
@@ -147,8 +153,8 @@ func GetMessagesPaginated(sessionID int64, beforeID int64, limit int) ([]model.M
 	if beforeID > 0 {
 		// Subquery: get the last `limit` rows before beforeID, then re-order ASC
 		rows2, err2 := DB.Query(
-			`SELECT id, session_id, role, content, metadata, attention_context, created_at FROM (
-				SELECT id, session_id, role, content, metadata, attention_context, created_at FROM messages
+			`SELECT id, session_id, role, content, metadata, attention_context, source, source_id, created_at FROM (
+				SELECT id, session_id, role, content, metadata, attention_context, source, source_id, created_at FROM messages
 				WHERE session_id = ? AND id < ? ORDER BY id DESC LIMIT ?
 			) sub ORDER BY id ASC`,
 			sessionID, beforeID, limit,
@@ -158,8 +164,8 @@ func GetMessagesPaginated(sessionID int64, beforeID int64, limit int) ([]model.M
 	} else {
 		// No cursor: get the latest `limit` messages
 		rows2, err2 := DB.Query(
-			`SELECT id, session_id, role, content, metadata, attention_context, created_at FROM (
-				SELECT id, session_id, role, content, metadata, attention_context, created_at FROM messages
+			`SELECT id, session_id, role, content, metadata, attention_context, source, source_id, created_at FROM (
+				SELECT id, session_id, role, content, metadata, attention_context, source, source_id, created_at FROM messages
 				WHERE session_id = ? ORDER BY id DESC LIMIT ?
 			) sub ORDER BY id ASC`,
 			sessionID, limit,
@@ -174,7 +180,7 @@ func GetMessagesPaginated(sessionID int64, beforeID int64, limit int) ([]model.M
 	var list []model.Message
 	for rows.Next() {
 		var m model.Message
-		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.Metadata, &m.AttentionContext, &m.CreatedAt); err != nil {
+		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.Metadata, &m.AttentionContext, &m.Source, &m.SourceID, &m.CreatedAt); err != nil {
 			return nil, err
 		}
 		list = append(list, m)
@@ -323,7 +329,7 @@ func CreateSessionWithMessage(providerID string, content string, workDir string,
 // triggerMsgID is the user message that started the current streaming round.
 func GetPendingUserMessages(sessionID int64, triggerMsgID int64) ([]model.Message, error) {
 	rows, err := DB.Query(`
-		SELECT id, session_id, role, content, metadata, created_at FROM messages
+		SELECT id, session_id, role, content, metadata, source, created_at FROM messages
 		WHERE session_id = ? AND role = 'user' AND id > ?
 		ORDER BY created_at`,
 		sessionID, triggerMsgID,
@@ -335,7 +341,7 @@ func GetPendingUserMessages(sessionID int64, triggerMsgID int64) ([]model.Messag
 	var list []model.Message
 	for rows.Next() {
 		var m model.Message
-		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.Metadata, &m.CreatedAt); err != nil {
+		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.Content, &m.Metadata, &m.Source, &m.CreatedAt); err != nil {
 			return nil, err
 		}
 		list = append(list, m)
@@ -350,11 +356,19 @@ func GetLastUserMessageID(sessionID int64) int64 {
 	return id
 }
 
+// GetMessageSource returns a message's source ("" = typed by a user).
+func GetMessageSource(id int64) string {
+	var source string
+	DB.QueryRow(`SELECT source FROM messages WHERE id = ?`, id).Scan(&source)
+	return source
+}
+
 // DeleteMessagesFrom removes the message with the given id AND all messages after it
 // for the given session (id >= fromMsgID). Used by the retry-message feature so the
 // original user message + any subsequent AI reply are both cleared before re-sending.
 func DeleteMessagesFrom(sessionID int64, fromMsgID int64) error {
 	_, err := DB.Exec(`DELETE FROM messages WHERE session_id = ? AND id >= ?`, sessionID, fromMsgID)
+	pruneToolCalls(sessionID)
 	return err
 }
 
@@ -630,6 +644,7 @@ func ResetSessionMessages(sessionID int64, keepLast int) (int64, error) {
 		if err != nil {
 			return 0, err
 		}
+		pruneToolCalls(sessionID)
 		return result.RowsAffected()
 	}
 
@@ -641,6 +656,7 @@ func ResetSessionMessages(sessionID int64, keepLast int) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	pruneToolCalls(sessionID)
 	return result.RowsAffected()
 }
 
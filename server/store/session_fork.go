@@ -0,0 +1,156 @@
+package store
+
+import (
+	"ai-hub/server/model"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ForkSession creates a session branched from parent at message fromMsgID:
+// messages up to and including fromMsgID are copied with their tool calls
+// (and overflow output files), and provider, work dir, group, attention
+// settings, session tool policy and failover chain are inherited. The fork gets a fresh Claude session ID.
+// Returns the new session and the number of copied messages.
+func ForkSession(parent *model.Session, fromMsgID int64, title string) (*model.Session, int64, error) {
+	var owner int64
+	if err := DB.QueryRow(`SELECT session_id FROM messages WHERE id = ?`, fromMsgID).Scan(&owner); err != nil || owner != parent.ID {
+		return nil, 0, fmt.Errorf("message %d not found in session %d", fromMsgID, parent.ID)
+	}
+	if title == "" {
+		title = parent.Title + " (分叉)"
+	}
+	fork := &model.Session{
+		Title:      title,
+		ProviderID: parent.ProviderID,
+		WorkDir:    parent.WorkDir,
+		GroupName:  parent.GroupName,
+		ParentID:   parent.ID,
+		ForkPoint:  fromMsgID,
+	}
+	if err := CreateSession(fork); err != nil {
+		return nil, 0, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		DeleteSession(fork.ID)
+		return nil, 0, err
+	}
+	var files []string // overflow files copied for the fork, removed on failure
+	fail := func(err error) (*model.Session, int64, error) {
+		tx.Rollback()
+		for _, f := range files {
+			os.Remove(f)
+		}
+		DeleteSession(fork.ID)
+		return nil, 0, err
+	}
+
+	// Copy messages one by one to map old IDs to new ones for their tool calls
+	var msgs []model.Message
+	rows, err := tx.Query(`SELECT id, role, content, metadata, attention_context, source, source_id, created_at FROM messages
+		WHERE session_id = ? AND id <= ? ORDER BY id`, parent.ID, fromMsgID)
+	if err != nil {
+		return fail(err)
+	}
+	for rows.Next() {
+		var m model.Message
+		if err := rows.Scan(&m.ID, &m.Role, &m.Content, &m.Metadata, &m.AttentionContext, &m.Source, &m.SourceID, &m.CreatedAt); err != nil {
+			rows.Close()
+			return fail(err)
+		}
+		msgs = append(msgs, m)
+	}
+	rows.Close()
+	msgIDs := make(map[int64]int64, len(msgs))
+	for _, m := range msgs {
+		result, err := tx.Exec(`INSERT INTO messages (session_id, role, content, metadata, attention_context, source, source_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, fork.ID, m.Role, m.Content, m.Metadata, m.AttentionContext, m.Source, m.SourceID, m.CreatedAt)
+		if err != nil {
+			return fail(err)
+		}
+		msgIDs[m.ID], _ = result.LastInsertId()
+	}
+
+	var calls []model.ToolCall
+	rows, err = tx.Query(`SELECT message_id, tool_use_id, name, input, output, output_size, output_file, truncated, is_error, duration_ms, started_at
+		FROM tool_calls WHERE session_id = ? AND message_id <= ? ORDER BY id`, parent.ID, fromMsgID)
+	if err != nil {
+		return fail(err)
+	}
+	for rows.Next() {
+		var tc model.ToolCall
+		var truncated, isError int
+		if err := rows.Scan(&tc.MessageID, &tc.ToolUseID, &tc.Name, &tc.Input, &tc.Output, &tc.OutputSize, &tc.OutputFile,
+			&truncated, &isError, &tc.DurationMs, &tc.StartedAt); err != nil {
+			rows.Close()
+			return fail(err)
+		}
+		tc.Truncated, tc.IsError = truncated == 1, isError == 1
+		calls = append(calls, tc)
+	}
+	rows.Close()
+	for _, tc := range calls {
+		newMsgID, ok := msgIDs[tc.MessageID]
+		if !ok {
+			continue
+		}
+		// The fork owns its overflow files: deleting either session must not break the other
+		if tc.OutputFile != "" {
+			data, err := ReadToolOutputFile(&tc)
+			tc.OutputFile = ""
+			if err == nil {
+				if path, err := writeToolOutputFile(fork.ID, tc.ToolUseID, data); err == nil {
+					tc.OutputFile = path
+					files = append(files, path)
+				}
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO tool_calls (session_id, message_id, tool_use_id, name, input, output, output_size, output_file, truncated, is_error, duration_ms, started_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			fork.ID, newMsgID, tc.ToolUseID, tc.Name, tc.Input, tc.Output, tc.OutputSize, tc.OutputFile,
+			boolToInt(tc.Truncated), boolToInt(tc.IsError), tc.DurationMs, tc.StartedAt); err != nil {
+			return fail(err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE sessions SET icon = ?, attention_enabled = ?, attention_rules = ? WHERE id = ?`,
+		parent.Icon, parent.AttentionEnabled, parent.AttentionRules, fork.ID); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	copied := int64(len(msgs))
+	fork.Icon, fork.AttentionEnabled, fork.AttentionRules = parent.Icon, parent.AttentionEnabled, parent.AttentionRules
+
+	// A fork must not escape the parent's restrictions
+	parentKey, forkKey := strconv.FormatInt(parent.ID, 10), strconv.FormatInt(fork.ID, 10)
+	if p := GetToolPolicy(PolicyScopeSession, parentKey); p != nil {
+		SetToolPolicy(PolicyScopeSession, forkKey, p)
+	}
+	if chain := GetProviderChain(ChainScopeSession, parentKey); len(chain) > 0 {
+		SetProviderChain(ChainScopeSession, forkKey, chain)
+	}
+	return fork, copied, nil
+}
+
+// ListForks returns the sessions forked from parentID (shadow sessions excluded).
+func ListForks(parentID int64) ([]model.Session, error) {
+	rows, err := DB.Query(`SELECT id, title, group_name, parent_id, fork_point, created_at, updated_at
+		FROM sessions WHERE parent_id = ? AND is_shadow = 0 ORDER BY id`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []model.Session
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.Title, &s.GroupName, &s.ParentID, &s.ForkPoint, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"ai-hub/server/model"
 	"database/sql"
+	"encoding/json"
 	"strconv"
 )
 
@@ -75,6 +76,128 @@ func SaveCompressSettings(s *model.CompressSettings) error {
 	return SetSetting("compress.min_turns", strconv.Itoa(s.MinTurns))
 }
 
+// GetPoolSettings reads pool.* keys. defaultMax applies when unset.
+func GetPoolSettings(defaultMax int) *model.PoolSettings {
+	s := &model.PoolSettings{MaxProcesses: defaultMax}
+	if v, _ := GetSetting("pool.max_processes"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			s.MaxProcesses = n
+		}
+	}
+	return s
+}
+
+// SavePoolSettings writes pool settings.
+func SavePoolSettings(s *model.PoolSettings) error {
+	return SetSetting("pool.max_processes", strconv.Itoa(s.MaxProcesses))
+}
+
+// GetVectorChunkSettings reads vector.chunk_* keys; unset keys keep the given defaults.
+func GetVectorChunkSettings(defaultSize, defaultOverlap int) *model.VectorChunkSettings {
+	s := &model.VectorChunkSettings{Size: defaultSize, Overlap: defaultOverlap}
+	if v, _ := GetSetting("vector.chunk_size"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			s.Size = n
+		}
+	}
+	if v, _ := GetSetting("vector.chunk_overlap"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			s.Overlap = n
+		}
+	}
+	return s
+}
+
+// SaveVectorChunkSettings writes vector chunk settings.
+func SaveVectorChunkSettings(s *model.VectorChunkSettings) error {
+	if err := SetSetting("vector.chunk_size", strconv.Itoa(s.Size)); err != nil {
+		return err
+	}
+	return SetSetting("vector.chunk_overlap", strconv.Itoa(s.Overlap))
+}
+
+// GetVectorEmbedderSettings reads vector.embedder_* keys; unset means the builtin model.
+func GetVectorEmbedderSettings() *model.VectorEmbedderSettings {
+	s := &model.VectorEmbedderSettings{Type: model.EmbedderBuiltin}
+	if v, _ := GetSetting("vector.embedder_type"); v != "" {
+		s.Type = v
+	}
+	s.Model, _ = GetSetting("vector.embedder_model")
+	s.ProviderID, _ = GetSetting("vector.embedder_provider")
+	return s
+}
+
+// SaveVectorEmbedderSettings writes vector embedder settings.
+func SaveVectorEmbedderSettings(s *model.VectorEmbedderSettings) error {
+	if err := SetSetting("vector.embedder_type", s.Type); err != nil {
+		return err
+	}
+	if err := SetSetting("vector.embedder_model", s.Model); err != nil {
+		return err
+	}
+	return SetSetting("vector.embedder_provider", s.ProviderID)
+}
+
+// GetMemoryConsolidationSettings reads memory.consolidate_* keys; unset keys
+// keep the defaults (disabled, every 24h, threshold 0.92).
+func GetMemoryConsolidationSettings() *model.MemoryConsolidationSettings {
+	s := &model.MemoryConsolidationSettings{IntervalHours: 24, Threshold: 0.92}
+	if v, _ := GetSetting("memory.consolidate_enabled"); v != "" {
+		s.Enabled = v == "true"
+	}
+	if v, _ := GetSetting("memory.consolidate_interval_hours"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			s.IntervalHours = n
+		}
+	}
+	if v, _ := GetSetting("memory.consolidate_threshold"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f > 0 && f <= 1 {
+			s.Threshold = f
+		}
+	}
+	if v, _ := GetSetting("memory.consolidate_use_provider"); v != "" {
+		s.UseProvider = v == "true"
+	}
+	s.ProviderID, _ = GetSetting("memory.consolidate_provider")
+	return s
+}
+
+// SaveMemoryConsolidationSettings writes memory consolidation settings.
+func SaveMemoryConsolidationSettings(s *model.MemoryConsolidationSettings) error {
+	pairs := [][2]string{
+		{"memory.consolidate_enabled", strconv.FormatBool(s.Enabled)},
+		{"memory.consolidate_interval_hours", strconv.Itoa(s.IntervalHours)},
+		{"memory.consolidate_threshold", strconv.FormatFloat(s.Threshold, 'f', -1, 64)},
+		{"memory.consolidate_use_provider", strconv.FormatBool(s.UseProvider)},
+		{"memory.consolidate_provider", s.ProviderID},
+	}
+	for _, kv := range pairs {
+		if err := SetSetting(kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTriggerCalendars returns the named holiday lists triggers can exclude
+// with "@name" (setting trigger.calendars, a JSON object of date lists).
+func GetTriggerCalendars() map[string][]string {
+	calendars := make(map[string][]string)
+	if v, _ := GetSetting("trigger.calendars"); v != "" {
+		json.Unmarshal([]byte(v), &calendars)
+	}
+	return calendars
+}
+
+// SaveTriggerCalendars replaces all named holiday lists.
+func SaveTriggerCalendars(calendars map[string][]string) error {
+	data, err := json.Marshal(calendars)
+	if err != nil {
+		return err
+	}
+	return SetSetting("trigger.calendars", string(data))
+}
+
 // CountUserMessages returns the number of user messages in a session (each = 1 turn).
 // When afterMsgID > 0, only messages with id > afterMsgID are counted (incremental since last compress).
 func CountUserMessages(sessionID int64, afterMsgID int64) int {
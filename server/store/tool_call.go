@@ -0,0 +1,170 @@
+package store
+
+import (
+	"ai-hub/server/model"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ToolOutputInlineLimit is the largest tool output kept in the database;
+// anything longer is truncated there and written whole to an overflow file.
+const ToolOutputInlineLimit = 32 * 1024
+
+// toolOutputDir holds overflow files: <data>/tool-outputs/<session>/<tool_use_id>.txt
+var toolOutputDir string
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// InitToolCallsTable creates the tool_calls table (called from migrate).
+func InitToolCallsTable() {
+	DB.Exec(`CREATE TABLE IF NOT EXISTS tool_calls (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		tool_use_id TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		input TEXT NOT NULL DEFAULT '',
+		output TEXT NOT NULL DEFAULT '',
+		output_size INTEGER NOT NULL DEFAULT 0,
+		output_file TEXT NOT NULL DEFAULT '',
+		truncated INTEGER NOT NULL DEFAULT 0,
+		is_error INTEGER NOT NULL DEFAULT 0,
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		started_at TEXT NOT NULL DEFAULT ''
+	)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_tool_calls_message ON tool_calls(message_id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_tool_calls_session ON tool_calls(session_id)`)
+}
+
+// AddToolCall stores a tool call. Output over ToolOutputInlineLimit is
+// written to an overflow file and only its prefix is kept in the row.
+func AddToolCall(tc *model.ToolCall) error {
+	tc.OutputSize = len(tc.Output)
+	if tc.OutputSize > ToolOutputInlineLimit {
+		if path, err := writeToolOutputFile(tc.SessionID, tc.ToolUseID, tc.Output); err == nil {
+			tc.OutputFile = path
+		}
+		tc.Output = truncateUTF8(tc.Output, ToolOutputInlineLimit)
+		tc.Truncated = true
+	}
+	if tc.StartedAt == "" {
+		tc.StartedAt = now()
+	}
+	result, err := DB.Exec(`INSERT INTO tool_calls (session_id, message_id, tool_use_id, name, input, output, output_size, output_file, truncated, is_error, duration_ms, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		tc.SessionID, tc.MessageID, tc.ToolUseID, tc.Name, tc.Input, tc.Output, tc.OutputSize, tc.OutputFile,
+		boolToInt(tc.Truncated), boolToInt(tc.IsError), tc.DurationMs, tc.StartedAt)
+	if err != nil {
+		return err
+	}
+	tc.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListToolCalls returns the tool calls of one message in execution order.
+func ListToolCalls(messageID int64) ([]model.ToolCall, error) {
+	rows, err := DB.Query(`SELECT id, session_id, message_id, tool_use_id, name, input, output, output_size, output_file, truncated, is_error, duration_ms, started_at
+		FROM tool_calls WHERE message_id = ? ORDER BY id`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []model.ToolCall{}
+	for rows.Next() {
+		var tc model.ToolCall
+		var truncated, isError int
+		if err := rows.Scan(&tc.ID, &tc.SessionID, &tc.MessageID, &tc.ToolUseID, &tc.Name, &tc.Input, &tc.Output,
+			&tc.OutputSize, &tc.OutputFile, &truncated, &isError, &tc.DurationMs, &tc.StartedAt); err != nil {
+			return nil, err
+		}
+		tc.Truncated, tc.IsError = truncated == 1, isError == 1
+		list = append(list, tc)
+	}
+	return list, rows.Err()
+}
+
+// ReadToolOutputFile returns the full output of a truncated tool call.
+func ReadToolOutputFile(tc *model.ToolCall) (string, error) {
+	if tc.OutputFile == "" {
+		return tc.Output, nil
+	}
+	data, err := os.ReadFile(tc.OutputFile)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// deleteToolCalls removes tool call rows (and overflow files) matching a column.
+func deleteToolCalls(column string, id int64) {
+	rows, err := DB.Query(`SELECT output_file FROM tool_calls WHERE `+column+` = ? AND output_file != ''`, id)
+	if err == nil {
+		var files []string
+		for rows.Next() {
+			var f string
+			if rows.Scan(&f) == nil {
+				files = append(files, f)
+			}
+		}
+		rows.Close()
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+	DB.Exec(`DELETE FROM tool_calls WHERE `+column+` = ?`, id)
+}
+
+// pruneToolCalls drops the tool calls of a session whose message was deleted
+// (truncate / context reset).
+func pruneToolCalls(sessionID int64) {
+	rows, err := DB.Query(`SELECT DISTINCT message_id FROM tool_calls WHERE session_id = ?
+		AND message_id NOT IN (SELECT id FROM messages WHERE session_id = ?)`, sessionID, sessionID)
+	if err != nil {
+		return
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		deleteToolCalls("message_id", id)
+	}
+}
+
+func writeToolOutputFile(sessionID int64, toolUseID, output string) (string, error) {
+	if toolOutputDir == "" {
+		return "", fmt.Errorf("tool output dir not initialized")
+	}
+	dir := filepath.Join(toolOutputDir, strconv.FormatInt(sessionID, 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := unsafeFileChars.ReplaceAllString(toolUseID, "_")
+	if name == "" {
+		name = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	path := filepath.Join(dir, name+".txt")
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && n < len(s) && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"ai-hub/server/model"
+	"encoding/json"
+	"strconv"
+)
+
+// Tool policy scopes
+const (
+	PolicyScopeSession = "session"
+	PolicyScopeGroup   = "group"
+)
+
+// InitToolPoliciesTable creates the tool_policies table (called from migrate).
+// One row per session or group; the policy itself is stored as JSON.
+func InitToolPoliciesTable() {
+	DB.Exec(`CREATE TABLE IF NOT EXISTS tool_policies (
+		scope TEXT NOT NULL,
+		scope_key TEXT NOT NULL,
+		policy TEXT NOT NULL DEFAULT '{}',
+		updated_at TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (scope, scope_key)
+	)`)
+}
+
+// GetToolPolicy returns the policy for a scope, or nil if none is configured.
+func GetToolPolicy(scope, key string) *model.ToolPolicy {
+	var raw string
+	if err := DB.QueryRow(`SELECT policy FROM tool_policies WHERE scope = ? AND scope_key = ?`, scope, key).Scan(&raw); err != nil {
+		return nil
+	}
+	var p model.ToolPolicy
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return nil
+	}
+	return &p
+}
+
+// SetToolPolicy replaces the policy for a scope. A nil policy removes it.
+func SetToolPolicy(scope, key string, p *model.ToolPolicy) error {
+	if p == nil {
+		_, err := DB.Exec(`DELETE FROM tool_policies WHERE scope = ? AND scope_key = ?`, scope, key)
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(`INSERT OR REPLACE INTO tool_policies (scope, scope_key, policy, updated_at) VALUES (?, ?, ?, ?)`,
+		scope, key, string(data), now())
+	return err
+}
+
+// ResolveToolPolicy returns the session policy, falling back to the group policy.
+// nil means unrestricted.
+func ResolveToolPolicy(sessionID int64, groupName string) *model.ToolPolicy {
+	if p := GetToolPolicy(PolicyScopeSession, strconv.FormatInt(sessionID, 10)); p != nil {
+		return p
+	}
+	if groupName != "" {
+		return GetToolPolicy(PolicyScopeGroup, groupName)
+	}
+	return nil
+}
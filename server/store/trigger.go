@@ -2,6 +2,7 @@ package store
 
 import (
 	"ai-hub/server/model"
+	"encoding/json"
 	"time"
 )
 
@@ -11,6 +12,30 @@ func now() string {
 	return time.Now().In(time.FixedZone("CST", 8*3600)).Format(triggerTimeLayout)
 }
 
+const triggerColumns = `id, session_id, content, trigger_time, timezone, exclusions, max_fires, misfire, retry_limit, retry_delay, enabled, fired_count, status, next_fire_at, last_fired_at, created_at, updated_at`
+
+func scanTrigger(row interface{ Scan(...interface{}) error }) (*model.Trigger, error) {
+	var t model.Trigger
+	var exclusions string
+	if err := row.Scan(&t.ID, &t.SessionID, &t.Content, &t.TriggerTime, &t.Timezone, &exclusions, &t.MaxFires, &t.Misfire, &t.RetryLimit, &t.RetryDelay, &t.Enabled,
+		&t.FiredCount, &t.Status, &t.NextFireAt, &t.LastFiredAt, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(exclusions), &t.Exclusions)
+	if t.Exclusions == nil {
+		t.Exclusions = []string{}
+	}
+	return &t, nil
+}
+
+func exclusionsJSON(list []string) string {
+	if len(list) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
 func CreateTrigger(t *model.Trigger) error {
 	t.CreatedAt = now()
 	t.UpdatedAt = t.CreatedAt
@@ -18,9 +43,9 @@ func CreateTrigger(t *model.Trigger) error {
 		t.Status = "active"
 	}
 	result, err := DB.Exec(
-		`INSERT INTO triggers (session_id, content, trigger_time, max_fires, enabled, fired_count, status, next_fire_at, last_fired_at, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		t.SessionID, t.Content, t.TriggerTime, t.MaxFires, t.Enabled, t.FiredCount, t.Status, t.NextFireAt, t.LastFiredAt, t.CreatedAt, t.UpdatedAt,
+		`INSERT INTO triggers (session_id, content, trigger_time, timezone, exclusions, max_fires, misfire, retry_limit, retry_delay, enabled, fired_count, status, next_fire_at, last_fired_at, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.SessionID, t.Content, t.TriggerTime, t.Timezone, exclusionsJSON(t.Exclusions), t.MaxFires, t.Misfire, t.RetryLimit, t.RetryDelay, t.Enabled, t.FiredCount, t.Status, t.NextFireAt, t.LastFiredAt, t.CreatedAt, t.UpdatedAt,
 	)
 	if err != nil {
 		return err
@@ -31,59 +56,56 @@ func CreateTrigger(t *model.Trigger) error {
 }
 
 func ListTriggers() ([]model.Trigger, error) {
-	rows, err := DB.Query(`SELECT id, session_id, content, trigger_time, max_fires, enabled, fired_count, status, next_fire_at, last_fired_at, created_at, updated_at FROM triggers ORDER BY session_id, id`)
+	rows, err := DB.Query(`SELECT ` + triggerColumns + ` FROM triggers ORDER BY session_id, id`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var list []model.Trigger
 	for rows.Next() {
-		var t model.Trigger
-		if err := rows.Scan(&t.ID, &t.SessionID, &t.Content, &t.TriggerTime, &t.MaxFires, &t.Enabled, &t.FiredCount, &t.Status, &t.NextFireAt, &t.LastFiredAt, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		t, err := scanTrigger(rows)
+		if err != nil {
 			return nil, err
 		}
-		list = append(list, t)
+		list = append(list, *t)
 	}
 	return list, nil
 }
 
 func ListTriggersBySession(sessionID int64) ([]model.Trigger, error) {
-	rows, err := DB.Query(`SELECT id, session_id, content, trigger_time, max_fires, enabled, fired_count, status, next_fire_at, last_fired_at, created_at, updated_at FROM triggers WHERE session_id = ? ORDER BY id`, sessionID)
+	rows, err := DB.Query(`SELECT `+triggerColumns+` FROM triggers WHERE session_id = ? ORDER BY id`, sessionID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var list []model.Trigger
 	for rows.Next() {
-		var t model.Trigger
-		if err := rows.Scan(&t.ID, &t.SessionID, &t.Content, &t.TriggerTime, &t.MaxFires, &t.Enabled, &t.FiredCount, &t.Status, &t.NextFireAt, &t.LastFiredAt, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		t, err := scanTrigger(rows)
+		if err != nil {
 			return nil, err
 		}
-		list = append(list, t)
+		list = append(list, *t)
 	}
 	return list, nil
 }
 
 func GetTrigger(id int64) (*model.Trigger, error) {
-	var t model.Trigger
-	err := DB.QueryRow(`SELECT id, session_id, content, trigger_time, max_fires, enabled, fired_count, status, next_fire_at, last_fired_at, created_at, updated_at FROM triggers WHERE id = ?`, id).
-		Scan(&t.ID, &t.SessionID, &t.Content, &t.TriggerTime, &t.MaxFires, &t.Enabled, &t.FiredCount, &t.Status, &t.NextFireAt, &t.LastFiredAt, &t.CreatedAt, &t.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return &t, nil
+	return scanTrigger(DB.QueryRow(`SELECT `+triggerColumns+` FROM triggers WHERE id = ?`, id))
 }
 
 func UpdateTrigger(t *model.Trigger) error {
 	t.UpdatedAt = now()
 	_, err := DB.Exec(
-		`UPDATE triggers SET session_id=?, content=?, trigger_time=?, max_fires=?, enabled=?, fired_count=?, status=?, next_fire_at=?, last_fired_at=?, updated_at=? WHERE id=?`,
-		t.SessionID, t.Content, t.TriggerTime, t.MaxFires, t.Enabled, t.FiredCount, t.Status, t.NextFireAt, t.LastFiredAt, t.UpdatedAt, t.ID,
+		`UPDATE triggers SET session_id=?, content=?, trigger_time=?, timezone=?, exclusions=?, max_fires=?, misfire=?, retry_limit=?, retry_delay=?, enabled=?, fired_count=?, status=?, next_fire_at=?, last_fired_at=?, updated_at=? WHERE id=?`,
+		t.SessionID, t.Content, t.TriggerTime, t.Timezone, exclusionsJSON(t.Exclusions), t.MaxFires, t.Misfire, t.RetryLimit, t.RetryDelay, t.Enabled, t.FiredCount, t.Status, t.NextFireAt, t.LastFiredAt, t.UpdatedAt, t.ID,
 	)
 	return err
 }
 
 func DeleteTrigger(id int64) error {
+	if _, err := DB.Exec(`DELETE FROM trigger_runs WHERE trigger_id = ?`, id); err != nil {
+		return err
+	}
 	_, err := DB.Exec(`DELETE FROM triggers WHERE id = ?`, id)
 	return err
 }
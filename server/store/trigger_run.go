@@ -0,0 +1,115 @@
+package store
+
+import (
+	"ai-hub/server/model"
+	"strconv"
+)
+
+// triggerRunsKept is the number of runs kept per trigger; older ones are pruned.
+const triggerRunsKept = 500
+
+// InitTriggerRunsTable creates the trigger_runs table (called from migrate).
+func InitTriggerRunsTable() {
+	DB.Exec(`CREATE TABLE IF NOT EXISTS trigger_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trigger_id INTEGER NOT NULL,
+		session_id INTEGER NOT NULL DEFAULT 0,
+		scheduled_at TEXT NOT NULL DEFAULT '',
+		fired_at TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		note TEXT NOT NULL DEFAULT '',
+		message_id INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL DEFAULT '',
+		updated_at TEXT NOT NULL DEFAULT ''
+	)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_trigger_runs_trigger ON trigger_runs(trigger_id, id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_trigger_runs_pending ON trigger_runs(status, next_attempt_at)`)
+}
+
+const triggerRunColumns = `id, trigger_id, session_id, scheduled_at, fired_at, status, attempts, error, note, message_id, next_attempt_at, created_at, updated_at`
+
+func scanTriggerRun(row interface{ Scan(...interface{}) error }) (*model.TriggerRun, error) {
+	var r model.TriggerRun
+	if err := row.Scan(&r.ID, &r.TriggerID, &r.SessionID, &r.ScheduledAt, &r.FiredAt, &r.Status, &r.Attempts,
+		&r.Error, &r.Note, &r.MessageID, &r.NextAttemptAt, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func queryTriggerRuns(query string, args ...interface{}) ([]model.TriggerRun, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []model.TriggerRun{}
+	for rows.Next() {
+		r, err := scanTriggerRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *r)
+	}
+	return list, rows.Err()
+}
+
+// CreateTriggerRun records a run and prunes the trigger's oldest runs.
+func CreateTriggerRun(r *model.TriggerRun) error {
+	r.CreatedAt = now()
+	r.UpdatedAt = r.CreatedAt
+	result, err := DB.Exec(`INSERT INTO trigger_runs (trigger_id, session_id, scheduled_at, fired_at, status, attempts, error, note, message_id, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.TriggerID, r.SessionID, r.ScheduledAt, r.FiredAt, r.Status, r.Attempts, r.Error, r.Note, r.MessageID, r.NextAttemptAt, r.CreatedAt, r.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	r.ID, _ = result.LastInsertId()
+	DB.Exec(`DELETE FROM trigger_runs WHERE trigger_id = ? AND status != ? AND id NOT IN
+		(SELECT id FROM trigger_runs WHERE trigger_id = ? ORDER BY id DESC LIMIT ?)`,
+		r.TriggerID, model.TriggerRunPending, r.TriggerID, triggerRunsKept)
+	return nil
+}
+
+func UpdateTriggerRun(r *model.TriggerRun) error {
+	r.UpdatedAt = now()
+	_, err := DB.Exec(`UPDATE trigger_runs SET status=?, fired_at=?, attempts=?, error=?, note=?, message_id=?, next_attempt_at=?, updated_at=? WHERE id=?`,
+		r.Status, r.FiredAt, r.Attempts, r.Error, r.Note, r.MessageID, r.NextAttemptAt, r.UpdatedAt, r.ID)
+	return err
+}
+
+// ListTriggerRuns returns a trigger's runs, newest first.
+func ListTriggerRuns(triggerID int64, limit int) ([]model.TriggerRun, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return queryTriggerRuns(`SELECT `+triggerRunColumns+` FROM trigger_runs WHERE trigger_id = ? ORDER BY id DESC LIMIT `+strconv.Itoa(limit), triggerID)
+}
+
+// DueTriggerRuns returns the pending runs whose next attempt is at or before
+// at, oldest first.
+func DueTriggerRuns(at string) ([]model.TriggerRun, error) {
+	return queryTriggerRuns(`SELECT `+triggerRunColumns+` FROM trigger_runs WHERE status = ? AND next_attempt_at <= ? ORDER BY id`,
+		model.TriggerRunPending, at)
+}
+
+// TriggersWithPendingRuns returns the IDs of triggers that have a pending run.
+func TriggersWithPendingRuns() (map[int64]bool, error) {
+	rows, err := DB.Query(`SELECT DISTINCT trigger_id FROM trigger_runs WHERE status = ?`, model.TriggerRunPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	m := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		m[id] = true
+	}
+	return m, nil
+}
@@ -1,4 +1,4 @@
-import type { Provider, Session, Message, Trigger, Channel, TokenUsage, TokenUsageStats, CompressSettings } from '../types'
+import type { Provider, Session, Message, Trigger, TriggerRun, Channel, TokenUsage, TokenUsageStats, CompressSettings, PoolSettings, PoolStatus, ToolApproval, ToolCallRecord, SessionTreeNode } from '../types'
 
 const BASE = '/api/v1'
 
@@ -42,6 +42,15 @@ export const deleteSession = (id: number) =>
   request<{ ok: boolean }>(`/sessions/${id}`, { method: 'DELETE' })
 export const getMessages = (sessionId: number) =>
   request<Message[]>(`/sessions/${sessionId}/messages`)
+export const forkSession = (sessionId: number, fromMsgId?: number, title = '') =>
+  request<{ session: Session; copied_messages: number }>(
+    `/sessions/${sessionId}/fork${fromMsgId ? `?from_msg_id=${fromMsgId}` : ''}`,
+    { method: 'POST', body: JSON.stringify({ title }) },
+  )
+export const getSessionTree = (sessionId: number) =>
+  request<{ session_id: number; root: SessionTreeNode }>(`/sessions/${sessionId}/tree`)
+export const getMessageToolCalls = (sessionId: number, msgId: number, full = false) =>
+  request<ToolCallRecord[]>(`/sessions/${sessionId}/messages/${msgId}/tools${full ? '?full=true' : ''}`)
 
 // Paginated messages: returns { messages, has_more }
 export const getMessagesPaginated = (sessionId: number, limit = 50, beforeId?: number) => {
@@ -229,6 +238,10 @@ export const createTrigger = (t: Partial<Trigger>) =>
   request<Trigger>('/triggers', { method: 'POST', body: JSON.stringify(t) })
 export const updateTrigger = (id: number, t: Partial<Trigger>) =>
   request<Trigger>(`/triggers/${id}`, { method: 'PUT', body: JSON.stringify(t) })
+export const previewTrigger = (t: Partial<Trigger> & { count?: number }) =>
+  request<{ next: string[] }>('/triggers/preview', { method: 'POST', body: JSON.stringify(t) })
+export const listTriggerRuns = (id: number, limit = 50) =>
+  request<TriggerRun[]>(`/triggers/${id}/runs?limit=${limit}`)
 export const deleteTrigger = (id: number) =>
   request<{ ok: boolean }>(`/triggers/${id}`, { method: 'DELETE' })
 
@@ -259,6 +272,8 @@ export interface MemorySearchResult {
   created_at: string  // RFC3339
   updated_at: string  // RFC3339
   metadata: Record<string, any>
+  heading?: string         // heading path of the best-matching chunk
+  matched_chunks?: number  // chunks of this file among the hits
 }
 export const searchMemory = (query: string, topK: number = 10, sessionId?: number) =>
   request<{ results: MemorySearchResult[] }>('/vector/search_memory', {
@@ -274,7 +289,7 @@ export const readMemoryFile = (scope: string, fileName: string) =>
   })
 
 export const vectorHealth = () =>
-  request<{ ready: boolean; disabled: boolean; error?: string; fix_hint?: string }>('/vector/health')
+  request<{ ready: boolean; disabled: boolean; degraded?: boolean; error?: string; fix_hint?: string; pending_embeddings?: number }>('/vector/health')
 
 // List .md files in a vector scope dir (knowledge / memory / rules)
 export const listVectorFiles = (scope: string) =>
@@ -452,6 +467,17 @@ export const getCompressSettings = () => request<CompressSettings>('/settings/co
 export const updateCompressSettings = (s: CompressSettings) =>
   request<{ ok: boolean }>('/settings/compress', { method: 'PUT', body: JSON.stringify(s) })
 
+// Process pool settings
+export const getPoolSettings = () => request<PoolStatus>('/settings/pool')
+export const updatePoolSettings = (s: PoolSettings) =>
+  request<{ ok: boolean }>('/settings/pool', { method: 'PUT', body: JSON.stringify(s) })
+
+// Tool approvals
+export const listApprovals = (sessionId?: number) =>
+  request<ToolApproval[]>(sessionId ? `/approvals?session_id=${sessionId}` : '/approvals')
+export const decideApproval = (id: string, decision: 'approve' | 'deny', reason = '') =>
+  request<{ ok: boolean }>(`/approvals/${id}`, { method: 'POST', body: JSON.stringify({ decision, reason }) })
+
 // Schemas
 export interface SchemaItem {
   id: number
@@ -574,6 +600,22 @@ export const enableHook = (id: number) =>
   request<{ ok: boolean }>(`/hooks/${id}/enable`, { method: 'POST' })
 export const disableHook = (id: number) =>
   request<{ ok: boolean }>(`/hooks/${id}/disable`, { method: 'POST' })
+export interface HookTestEvent {
+  event?: string
+  source_session_id?: number
+  content?: string
+  message_count?: number
+  source?: string
+  vars?: Record<string, string>
+  condition?: string
+}
+export interface HookTestResult {
+  matched: boolean
+  reason?: string
+  payload?: string
+}
+export const testHook = (id: number, ev: HookTestEvent) =>
+  request<HookTestResult>(`/hooks/${id}/test`, { method: 'POST', body: JSON.stringify(ev) })
 
 // Injection Router
 export interface InjectionRoute {
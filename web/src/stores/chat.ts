@@ -1,6 +1,6 @@
 import { defineStore } from 'pinia'
 import { ref, computed, nextTick } from 'vue'
-import type { Session, Message, Provider, WSMessage, ToolCall, StepsMetadata, TokenUsage } from '../types'
+import type { Session, Message, Provider, WSMessage, ToolCall, StepsMetadata, TokenUsage, QueueInfo, ToolApproval } from '../types'
 import * as api from '../composables/api'
 import router from '../router'
 
@@ -30,6 +30,11 @@ export const useChatStore = defineStore('chat', () => {
   const attentionStatus = ref('')  // Current status message
   const attentionActive = ref(false)  // Whether attention mode is currently running
 
+  // Process pool queue: waiting for a free Claude process slot (session id → status text)
+  const queueStatus = ref<Record<number, string>>({})
+  // Tool calls paused for human approval (approval id → request)
+  const pendingApprovals = ref<Record<string, ToolApproval>>({})
+
   const workDir = ref('')
   const pendingProviderId = ref('')  // provider selected in new-chat dialog
   const pendingGroupName = ref('')   // group_name selected in new-chat dialog
@@ -115,6 +120,10 @@ export const useChatStore = defineStore('chat', () => {
       }
       // Refresh sessions and version after reconnect
       loadSessions()
+      // Approvals requested while disconnected
+      api.listApprovals().then(list => {
+        pendingApprovals.value = Object.fromEntries(list.map(a => [a.id, a]))
+      }).catch(() => {})
     }
 
     ws.value.onmessage = (event) => {
@@ -208,6 +217,35 @@ export const useChatStore = defineStore('chat', () => {
         return
       }
 
+      // queue: session is waiting for a process pool slot
+      if (msg.type === 'queue') {
+        try {
+          const info: QueueInfo = JSON.parse(msg.content)
+          if (info.position > 0) {
+            const wait = info.estimated_wait_sec >= 60
+              ? `约 ${Math.round(info.estimated_wait_sec / 60)} 分钟`
+              : `约 ${info.estimated_wait_sec} 秒`
+            queueStatus.value[msg.session_id] = `排队等待进程：第 ${info.position}/${info.queue_length} 位，预计 ${wait}`
+          } else {
+            delete queueStatus.value[msg.session_id]
+          }
+        } catch { /* ignore parse errors */ }
+        return
+      }
+
+      // tool_approval: a tool call waits for approve/deny (or was just decided)
+      if (msg.type === 'tool_approval') {
+        try {
+          const a: ToolApproval = JSON.parse(msg.content)
+          if (a.status === 'pending') {
+            pendingApprovals.value[a.id] = a
+          } else {
+            delete pendingApprovals.value[a.id]
+          }
+        } catch { /* ignore parse errors */ }
+        return
+      }
+
       // message_queued: a message was saved while session was streaming
       if (msg.type === 'message_queued') {
         // If viewing this session, add the queued message to the list
@@ -298,6 +336,14 @@ export const useChatStore = defineStore('chat', () => {
           const tc = toolCalls.value.find((t) => t.id === msg.tool_id)
           if (tc) {
             tc.status = 'done'
+            tc.output = msg.content
+            if (msg.detail) {
+              try {
+                const d = JSON.parse(msg.detail)
+                tc.is_error = d.is_error
+                tc.duration_ms = d.duration_ms
+              } catch { /* ignore parse errors */ }
+            }
           }
           break
         }
@@ -665,6 +711,11 @@ export const useChatStore = defineStore('chat', () => {
     }
   }
 
+  async function decideApproval(id: string, decision: 'approve' | 'deny', reason = '') {
+    await api.decideApproval(id, decision, reason)
+    delete pendingApprovals.value[id]
+  }
+
   return {
     sessions,
     currentSessionId,
@@ -708,5 +759,10 @@ export const useChatStore = defineStore('chat', () => {
     // Attention mode v2
     attentionActive,
     attentionStatus,
+    // Process pool queue
+    queueStatus,
+    // Tool approvals
+    pendingApprovals,
+    decideApproval,
   }
 })
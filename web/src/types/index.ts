@@ -33,10 +33,23 @@ export interface Session {
   correction_count: number
   drift_count: number
   auto_reset_threshold: number
+  parent_id?: number
+  fork_point?: number   // message id in the parent this session was forked at (0 = not a fork)
   created_at: string
   updated_at: string
 }
 
+// Fork tree node (GET /sessions/:id/tree)
+export interface SessionTreeNode {
+  id: number
+  title: string
+  group_name: string
+  parent_id: number
+  fork_point: number
+  created_at: string
+  children: SessionTreeNode[]
+}
+
 export interface Message {
   id: number
   session_id: number
@@ -44,6 +57,8 @@ export interface Message {
   content: string
   metadata?: string
   attention_context?: string
+  source?: 'trigger' | 'hook' | 'channel' | 'shadow'
+  source_id?: number
   created_at: string
 }
 
@@ -52,17 +67,45 @@ export interface StepInfo {
   name?: string
   input?: string
   status?: string
+  tool_id?: string
 }
 
 export interface StepsMetadata {
   steps: StepInfo[]
   thinking?: string
+  approvals?: ToolApprovalRecord[]
+}
+
+// Tool call waiting for a human decision (WS "tool_approval", GET /approvals)
+export interface ToolApproval {
+  id: string
+  session_id: number
+  tool_name: string
+  tool_use_id?: string
+  input: unknown
+  status: 'pending' | 'approved' | 'denied' | 'timeout' | 'cancelled'
+  reason?: string
+  decided_by?: string
+  requested_at: string
+  expires_at: string
+}
+
+export interface ToolApprovalRecord {
+  id: string
+  tool_name: string
+  tool_use_id?: string
+  decision: 'approved' | 'denied' | 'timeout' | 'cancelled'
+  reason?: string
+  decided_by?: string
+  requested_at: string
+  decided_at: string
 }
 
 export interface WSMessage {
-  type: 'chat' | 'stop' | 'subscribe' | 'error' | 'chunk' | 'thinking' | 'tool_start' | 'tool_input' | 'tool_result' | 'done' | 'session_created' | 'streaming_status' | 'session_update' | 'session_title_update' | 'process_update' | 'message_queued' | 'token_usage' | 'attention_update' | 'attention_status' | 'attention_clear' | 'context_reset'
+  type: 'chat' | 'stop' | 'subscribe' | 'error' | 'chunk' | 'thinking' | 'tool_start' | 'tool_input' | 'tool_result' | 'done' | 'session_created' | 'streaming_status' | 'session_update' | 'session_title_update' | 'process_update' | 'message_queued' | 'token_usage' | 'attention_update' | 'attention_status' | 'attention_clear' | 'context_reset' | 'queue' | 'tool_approval'
   session_id: number
   content: string
+  detail?: string
   tool_id?: string
   tool_name?: string
 }
@@ -72,6 +115,26 @@ export interface ToolCall {
   name: string
   input: string
   status: 'running' | 'done'
+  output?: string
+  is_error?: boolean
+  duration_ms?: number
+}
+
+// Persisted tool call (GET /sessions/:id/messages/:msg_id/tools)
+export interface ToolCallRecord {
+  id: number
+  session_id: number
+  message_id: number
+  tool_use_id: string
+  name: string
+  input: string
+  output: string
+  output_size: number
+  output_file?: string
+  truncated: boolean
+  is_error: boolean
+  duration_ms: number
+  started_at: string
 }
 
 export interface Trigger {
@@ -79,7 +142,12 @@ export interface Trigger {
   session_id: number
   content: string
   trigger_time: string
+  timezone: string
+  exclusions: string[]
   max_fires: number
+  misfire: string
+  retry_limit: number
+  retry_delay: string
   enabled: boolean
   fired_count: number
   status: string
@@ -89,6 +157,22 @@ export interface Trigger {
   updated_at: string
 }
 
+export interface TriggerRun {
+  id: number
+  trigger_id: number
+  session_id: number
+  scheduled_at: string
+  fired_at: string
+  status: string
+  attempts: number
+  error: string
+  note: string
+  message_id: number
+  next_attempt_at: string
+  created_at: string
+  updated_at: string
+}
+
 export interface Channel {
   id: number
   name: string
@@ -119,6 +203,24 @@ export interface TokenUsageStats {
   count: number
 }
 
+export interface PoolSettings {
+  max_processes: number   // 最大存活 Claude 进程数，0 = 不限制
+}
+
+// Process pool queue state pushed via WS "queue" (position 0 = no longer queued)
+export interface QueueInfo {
+  position: number
+  queue_length: number
+  priority: number
+  estimated_wait_sec: number
+}
+
+export interface PoolStatus extends PoolSettings {
+  running: number
+  queued: number
+  queue: QueueInfo[]
+}
+
 export interface CompressSettings {
   auto_enabled: boolean
   threshold: number   // input token 绝对值阈值，如 80000